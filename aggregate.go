@@ -0,0 +1,132 @@
+package qdb
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Bucket 按时间间隔聚合的一个分组
+type Bucket struct {
+	Time  qtime.DateTime // 分组开始时间
+	Value float64        // 聚合值，NULL为0
+}
+
+// AggregateByInterval 按时间间隔分组聚合，用于按小时、按天统计等图表数据，结果按时间升序排列，没有数据的分组不返回
+//
+//	qtime.DateTime 字段按数值截断，不依赖数据库函数；time.Time 字段使用各数据库的日期函数截断
+//	UTC存储时按UTC时间分组，分组开始时间转换为本地时间
+//
+//	@param column 时间列，如 LastTime
+//	@param interval 间隔，支持能整除1小时的分钟数（如5、15分钟）、能整除1天的小时数（如1、6小时）及1天
+//	@param aggExpr 聚合表达式，如 COUNT(*)、AVG(Temp)、SUM(Amount)
+//	@param query 条件，如 DeviceId = ?，为空不限制
+//	@param args 条件参数
+//	@return []Bucket, error
+func (dao *Dao[T]) AggregateByInterval(column string, interval time.Duration, aggExpr string, query interface{}, args ...interface{}) ([]Bucket, error) {
+	buckets := make([]Bucket, 0)
+	err := dao.exec("AggregateByInterval", OpRead, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		f := stmt.Schema.LookUpField(column)
+		if f == nil {
+			return fmt.Errorf("%s has no field %s", stmt.Schema.Name, column)
+		}
+		var expr string
+		var err error
+		if f.FieldType == dateTimeType {
+			expr, err = dateTimeBucket(op.DB.Dialector.Name(), stmt.Quote(f.DBName), interval)
+		} else {
+			expr, err = timeBucket(op.DB.Dialector.Name(), stmt.Quote(f.DBName), interval)
+		}
+		if err != nil {
+			return err
+		}
+
+		db := dao.query(op.DB).Model(new(T))
+		if query != nil && query != "" {
+			db = db.Where(query, args...)
+		}
+		rows, err := db.Select(expr + " AS qdb_bucket, " + aggExpr + " AS qdb_value").Group(expr).Order(expr).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		_, utc := op.DB.Config.Plugins[utcPlugin{}.Name()]
+		for rows.Next() {
+			var key any
+			var value sql.NullFloat64
+			if err = rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			t, err := ToDateTime(key)
+			if err != nil {
+				return err
+			}
+			if utc && f.FieldType == dateTimeType {
+				t = LocalDateTime(t)
+			}
+			buckets = append(buckets, Bucket{Time: t, Value: value.Float64})
+			op.RowsAffected++
+		}
+		return rows.Err()
+	})
+	return buckets, err
+}
+
+// dateTimeBucket qtime.DateTime 列（yyyyMMddHHmmss数值）的截断表达式
+func dateTimeBucket(dialect string, col string, interval time.Duration) (string, error) {
+	// mysql 的 / 为小数除法，整除使用 DIV
+	div := "/"
+	if dialect == "mysql" {
+		div = "DIV"
+	}
+	switch {
+	case interval == 24*time.Hour:
+		return fmt.Sprintf("(%s %s 1000000 * 1000000)", col, div), nil
+	case interval >= time.Hour && interval < 24*time.Hour && interval%time.Hour == 0 && 24%int(interval/time.Hour) == 0:
+		n := int(interval / time.Hour)
+		return fmt.Sprintf("(%s %s 1000000 * 1000000 + %s %s 10000 %% 100 %s %d * %d * 10000)", col, div, col, div, div, n, n), nil
+	case interval >= time.Minute && interval < time.Hour && interval%time.Minute == 0 && 60%int(interval/time.Minute) == 0:
+		n := int(interval / time.Minute)
+		return fmt.Sprintf("(%s %s 10000 * 10000 + %s %s 100 %% 100 %s %d * %d * 100)", col, div, col, div, div, n, n), nil
+	}
+	return "", fmt.Errorf("qdb: unsupported aggregate interval %s", interval)
+}
+
+// timeBucket 时间列的截断表达式，按各数据库的日期函数生成
+func timeBucket(dialect string, col string, interval time.Duration) (string, error) {
+	if _, err := dateTimeBucket(dialect, col, interval); err != nil {
+		return "", err
+	}
+	secs := int64(interval / time.Second)
+	minutes := int64(interval / time.Minute)
+	day := interval == 24*time.Hour
+	switch dialect {
+	case "mysql":
+		if day {
+			return fmt.Sprintf("DATE(%s)", col), nil
+		}
+		return fmt.Sprintf("FROM_UNIXTIME(FLOOR(UNIX_TIMESTAMP(%s) / %d) * %d)", col, secs, secs), nil
+	case "postgres":
+		if day {
+			return fmt.Sprintf("date_trunc('day', %s)", col), nil
+		}
+		return fmt.Sprintf("to_timestamp(floor(extract(epoch from %s) / %d) * %d)", col, secs, secs), nil
+	case "sqlserver":
+		if day {
+			return fmt.Sprintf("CAST(%s AS date)", col), nil
+		}
+		return fmt.Sprintf("DATEADD(minute, DATEDIFF(minute, 0, %s) / %d * %d, 0)", col, minutes, minutes), nil
+	case "sqlite":
+		if day {
+			return fmt.Sprintf("date(%s, 'localtime')", col), nil
+		}
+		return fmt.Sprintf("datetime(CAST(strftime('%%s', %s) AS integer) / %d * %d, 'unixepoch', 'localtime')", col, secs, secs), nil
+	}
+	return "", fmt.Errorf("%w: aggregate interval on %s", ErrUnsupported, dialect)
+}
@@ -0,0 +1,43 @@
+package qdb
+
+import (
+	"context"
+)
+
+// DbAudit 记录创建人和最后修改人，与 DbSimple、DbTracked 等一同嵌入模型
+//
+//	操作人通过 WithActor 放入上下文，并使用 Dao.WithContext 传入
+type DbAudit struct {
+	CreatedBy string `gorm:"size:64;<-:create"` // 创建人
+	UpdatedBy string `gorm:"size:64"`           // 最后修改人
+}
+
+// Auditable 可选的操作人接口，嵌入 DbAudit 的模型已自动实现
+type Auditable interface {
+	SetActor(actor string)
+}
+
+// SetActor 创建人为空时写入，最后修改人每次写入
+func (m *DbAudit) SetActor(actor string) {
+	if m.CreatedBy == "" {
+		m.CreatedBy = actor
+	}
+	m.UpdatedBy = actor
+}
+
+// WithActor 返回带操作人的上下文，Dao写入时填充到 DbAudit
+//
+//	@param ctx 上下文
+//	@param actor 操作人，如用户ID
+//	@return context.Context
+func WithActor(ctx context.Context, actor string) context.Context {
+	return WithValues(ctx, KeyActor, actor)
+}
+
+// ActorFrom 读取上下文中的操作人
+//
+//	@param ctx 上下文
+//	@return string, bool
+func ActorFrom(ctx context.Context) (string, bool) {
+	return ValueFrom[string](ctx, KeyActor)
+}
@@ -0,0 +1,256 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sync"
+	"time"
+)
+
+// DataMigration 数据迁移步骤，按主键分批执行，每批与进度在同一事务中提交，中断后从上次位置继续
+//
+//	如为新增列回填数据：
+//	Batch: func(tx *gorm.DB, from, to uint64) (int64, error) {
+//		r := tx.Model(&User{}).Where("Id > ? AND Id <= ?", from, to).Update("NickName", gorm.Expr("UserName"))
+//		return r.RowsAffected, r.Error
+//	}
+type DataMigration struct {
+	Name       string                                            // 名称，唯一，作为进度记录的键
+	Model      any                                               // 遍历的模型，主键需为整数，如 &User{}
+	BatchSize  int                                               // 每批的行数，为0使用1000
+	Pause      time.Duration                                     // 每批之间的暂停，降低对线上业务的影响
+	Batch      func(tx *gorm.DB, from, to uint64) (int64, error) // 处理主键在 (from, to] 之间的一批，返回影响的行数
+	OnProgress func(p MigrationProgress)                         // 每批完成后回调，为空不处理
+}
+
+// MigrationProgress 数据迁移进度
+type MigrationProgress struct {
+	Name   string // 名称
+	LastId uint64 // 已处理到的主键
+	Rows   int64  // 累计影响的行数
+	Done   bool   // 是否已完成
+}
+
+// dataMigration 数据迁移进度记录
+type dataMigration struct {
+	Name        string         `gorm:"primaryKey;size:128"` // 名称
+	LastId      uint64         // 已处理到的主键
+	Rows        int64          // 累计影响的行数
+	Done        bool           // 是否已完成
+	UpdatedTime qtime.DateTime // 最后更新时间
+}
+
+// TableName 表名
+func (dataMigration) TableName() string {
+	return "qdb_data_migration"
+}
+
+var (
+	dataMigrations     []DataMigration
+	dataMigrationNames = map[string]bool{}
+	dataMigrationLock  sync.Mutex
+)
+
+// RegisterDataMigration 注册数据迁移步骤，通过 RunDataMigrations 按注册顺序执行，名称重复时panic
+//
+//	@param steps 迁移步骤
+func RegisterDataMigration(steps ...DataMigration) {
+	dataMigrationLock.Lock()
+	defer dataMigrationLock.Unlock()
+	for _, step := range steps {
+		if dataMigrationNames[step.Name] {
+			panic(fmt.Sprintf("qdb: data migration %s already registered", step.Name))
+		}
+		dataMigrationNames[step.Name] = true
+		dataMigrations = append(dataMigrations, step)
+	}
+}
+
+// RunDataMigrations 按注册顺序执行全部未完成的数据迁移，通常在 AutoMigrateAll 之后调用
+//
+//	@param ctx 上下文，取消时在当前批次完成后停止，下次从中断位置继续
+//	@param db 数据库连接
+//	@return error
+func RunDataMigrations(ctx context.Context, db *gorm.DB) error {
+	dataMigrationLock.Lock()
+	steps := append([]DataMigration(nil), dataMigrations...)
+	dataMigrationLock.Unlock()
+	for _, step := range steps {
+		if err := RunDataMigration(ctx, db, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunDataMigration 执行一个数据迁移步骤，已完成的直接返回
+//
+//	多实例同时执行时通过数据库锁保证只有一个实例在处理
+//
+//	@param ctx 上下文，取消时在当前批次完成后停止，下次从中断位置继续
+//	@param db 数据库连接
+//	@param step 迁移步骤
+//	@return error
+func RunDataMigration(ctx context.Context, db *gorm.DB, step DataMigration) error {
+	if step.Name == "" || step.Model == nil || step.Batch == nil {
+		return fmt.Errorf("qdb: data migration requires Name, Model and Batch")
+	}
+	if step.BatchSize <= 0 {
+		step.BatchSize = 1000
+	}
+	if err := ensureTable(db, &dataMigration{}); err != nil {
+		return err
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(step.Model); err != nil {
+		return err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("qdb: data migration %s: model has no primary key", step.Name)
+	}
+	pkColumn := clause.Column{Name: pk.DBName}
+
+	// 同一时间只有一个实例执行，锁在每批完成后续期
+	lockName := "data_migration:" + step.Name
+	owner := lockOwner()
+	ttl := 5 * time.Minute
+	ok, err := tryLock(db, lockName, owner, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("qdb: data migration %s is running on another instance", step.Name)
+	}
+	defer func() { _ = unlock(db, lockName, owner) }()
+
+	progress, err := loadMigrationProgress(db, step.Name)
+	if err != nil || progress.Done {
+		return err
+	}
+	db = db.WithContext(ctx)
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		to, found, err := batchEnd(db, step.Model, pkColumn, progress.LastId, step.BatchSize)
+		if err != nil {
+			return fmt.Errorf("qdb: data migration %s: %w", step.Name, err)
+		}
+		if !found {
+			progress.Done = true
+			if err = saveMigrationProgress(db, progress); err != nil {
+				return err
+			}
+			if step.OnProgress != nil {
+				step.OnProgress(progress)
+			}
+			return nil
+		}
+		// 批次和进度在同一事务中提交，中断后不会重复处理
+		next := progress
+		err = trackedTx(db, func(tx *gorm.DB) error {
+			rows, err := step.Batch(tx, progress.LastId, to)
+			if err != nil {
+				return err
+			}
+			next.LastId = to
+			next.Rows += rows
+			return saveMigrationProgress(tx, next)
+		}, 1)
+		if err != nil {
+			return fmt.Errorf("qdb: data migration %s at %d: %w", step.Name, progress.LastId, err)
+		}
+		progress = next
+		if step.OnProgress != nil {
+			step.OnProgress(progress)
+		}
+		// 续期失败说明租约已过期并被其他实例取得，停止执行避免两个实例同时迁移
+		if ok, err = tryLock(db, lockName, owner, ttl); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("qdb: data migration %s lost its lock to another instance", step.Name)
+		}
+		if step.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.Pause):
+			}
+		}
+	}
+}
+
+// DataMigrationStatus 返回数据迁移的进度，未执行过时返回零值进度
+//
+//	@param db 数据库连接
+//	@param name 名称
+//	@return MigrationProgress, error
+func DataMigrationStatus(db *gorm.DB, name string) (MigrationProgress, error) {
+	if err := ensureTable(db, &dataMigration{}); err != nil {
+		return MigrationProgress{}, err
+	}
+	return loadMigrationProgress(db, name)
+}
+
+// ResetDataMigration 清除数据迁移的进度，下次从头执行
+//
+//	@param db 数据库连接
+//	@param name 名称
+//	@return error
+func ResetDataMigration(db *gorm.DB, name string) error {
+	if err := ensureTable(db, &dataMigration{}); err != nil {
+		return err
+	}
+	model := &dataMigration{}
+	return db.Where(clause.Eq{Column: fieldColumn(db, model, "Name"), Value: name}).Delete(model).Error
+}
+
+// batchEnd 返回从 last 之后第 size 行的主键，不足一批时返回最大主键，没有剩余行时 found 为false
+func batchEnd(db *gorm.DB, model any, pk clause.Column, last uint64, size int) (uint64, bool, error) {
+	var ids []uint64
+	err := db.Session(&gorm.Session{NewDB: true}).Model(model).Unscoped().
+		Where(clause.Gt{Column: pk, Value: last}).
+		Order(clause.OrderByColumn{Column: pk}).
+		Offset(size-1).Limit(1).
+		Pluck(pk.Name, &ids).Error
+	if err != nil {
+		return 0, false, err
+	}
+	if len(ids) > 0 {
+		return ids[0], true, nil
+	}
+	var high sql.NullInt64
+	err = db.Session(&gorm.Session{NewDB: true}).Model(model).Unscoped().
+		Select("MAX(?)", pk).
+		Where(clause.Gt{Column: pk, Value: last}).
+		Row().Scan(&high)
+	if err != nil || !high.Valid {
+		return 0, false, err
+	}
+	return uint64(high.Int64), true, nil
+}
+
+// loadMigrationProgress 读取进度记录
+func loadMigrationProgress(db *gorm.DB, name string) (MigrationProgress, error) {
+	model := &dataMigration{}
+	result := db.Where(clause.Eq{Column: fieldColumn(db, model, "Name"), Value: name}).Limit(1).Find(model)
+	if result.Error != nil {
+		return MigrationProgress{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return MigrationProgress{Name: name}, nil
+	}
+	return MigrationProgress{Name: name, LastId: model.LastId, Rows: model.Rows, Done: model.Done}, nil
+}
+
+// saveMigrationProgress 写入进度记录
+func saveMigrationProgress(db *gorm.DB, p MigrationProgress) error {
+	return db.Save(&dataMigration{Name: p.Name, LastId: p.LastId, Rows: p.Rows, Done: p.Done,
+		UpdatedTime: qtime.NewDateTime(now())}).Error
+}
@@ -0,0 +1,67 @@
+package qdb
+
+import (
+	"context"
+)
+
+// 常用的上下文键
+const (
+	KeyTraceID = "qdb.traceId" // 链路ID
+	KeyTenant  = "qdb.tenant"  // 租户
+	KeyActor   = "qdb.actor"   // 操作人，见 WithActor
+	KeyOwner   = "qdb.owner"   // 所属对象，见 WithOwner
+
+	KeyUnscoped       = "qdb.unscoped"       // 查询不应用默认查询范围，见 WithUnscoped
+	KeyIncludeDeleted = "qdb.includeDeleted" // 查询包含软删除的记录，见 WithIncludeDeleted
+)
+
+type bagKey struct{}
+
+// WithValues 返回附加键值的上下文，供中间件、审计、查询标记等读取，同名键覆盖
+//
+//	@param ctx 上下文
+//	@param kv 键值对，如 KeyTraceID, "abc", KeyTenant, "t1"
+//	@return context.Context
+func WithValues(ctx context.Context, kv ...any) context.Context {
+	old := Values(ctx)
+	bag := make(map[string]any, len(old)+len(kv)/2)
+	for k, v := range old {
+		bag[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if key, ok := kv[i].(string); ok {
+			bag[key] = kv[i+1]
+		}
+	}
+	return context.WithValue(ctx, bagKey{}, bag)
+}
+
+// Values 返回上下文中的全部键值，不可修改
+//
+//	@param ctx 上下文
+//	@return map[string]any
+func Values(ctx context.Context) map[string]any {
+	if ctx == nil {
+		return nil
+	}
+	bag, _ := ctx.Value(bagKey{}).(map[string]any)
+	return bag
+}
+
+// ValueFrom 读取上下文中的值
+//
+//	@param ctx 上下文
+//	@param key 键
+//	@return V, bool 值类型不符时返回false
+func ValueFrom[V any](ctx context.Context, key string) (V, bool) {
+	v, ok := Values(ctx)[key].(V)
+	return v, ok
+}
+
+// Value 读取本次操作上下文中的值
+//
+//	@param key 键
+//	@return any
+func (op *Operation) Value(key string) any {
+	return Values(op.Context())[key]
+}
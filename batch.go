@@ -0,0 +1,67 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sync"
+)
+
+// 各连接池的 auto_increment_increment，仅mysql使用
+var autoIncrements sync.Map
+
+// autoIncrementKey 步长的缓存键，事务中解析到所属的 *sql.DB，避免每个事务各缓存一份
+func autoIncrementKey(db *gorm.DB) any {
+	if sqlDB, err := db.DB(); err == nil {
+		return sqlDB
+	}
+	return db.Dialector
+}
+
+// batchSize 单条语句的参数数量受限（sqlserver为2100），按字段数计算每批数量
+func batchSize(sch *schema.Schema) int {
+	size := 2000 / (len(sch.DBNames) + 1)
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// splitByPk 按主键是否为空拆分，避免同一批中混用自增与显式主键
+func splitByPk[T any](ctx context.Context, pk *schema.Field, list []*T) (zero []*T, set []*T) {
+	for _, model := range list {
+		if _, ok := pk.ValueOf(ctx, reflect.ValueOf(model).Elem()); ok {
+			zero = append(zero, model)
+		} else {
+			set = append(set, model)
+		}
+	}
+	return zero, set
+}
+
+// batchIds 批量新增后能否取得全部生成的唯一号
+//
+//	sqlite、postgres 使用 RETURNING，sqlserver 使用 OUTPUT，均可直接取得；
+//	mysql 仅返回首个唯一号，其余按 auto_increment_increment 推算，
+//	要求同一语句生成的唯一号连续（innodb_autoinc_lock_mode 各模式下单条多行 INSERT 均满足），
+//	服务端步长与模型定义（autoIncrementIncrement 标签，默认1）不一致时返回false，改为逐条新增
+func batchIds(db *gorm.DB, pk *schema.Field) bool {
+	if db.Dialector.Name() != "mysql" {
+		return true
+	}
+	key := autoIncrementKey(db)
+	v, ok := autoIncrements.Load(key)
+	if !ok {
+		var inc int64
+		if err := db.Session(&gorm.Session{NewDB: true}).Raw("SELECT @@auto_increment_increment").Scan(&inc).Error; err != nil {
+			return false
+		}
+		v, _ = autoIncrements.LoadOrStore(key, inc)
+	}
+	step := pk.AutoIncrementIncrement
+	if step <= 0 {
+		step = 1
+	}
+	return v.(int64) == step
+}
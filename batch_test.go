@@ -0,0 +1,53 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"testing"
+)
+
+type batchItem struct {
+	DbSimple
+	Name string
+}
+
+func TestCreateListIds(t *testing.T) {
+	db := newTestDB(t)
+	dao, err := TryNewDao[batchItem](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := []*batchItem{{Name: "a"}, {Name: "b"}, {DbSimple: DbSimple{Id: 100}, Name: "c"}, {Name: "d"}}
+	if err = dao.CreateListP(list); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[uint64]bool{}
+	for _, item := range list {
+		if item.Id == 0 || seen[item.Id] {
+			t.Fatalf("invalid id after CreateList: %+v", list)
+		}
+		seen[item.Id] = true
+		got, err := dao.GetModel(item.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got == nil || got.Name != item.Name {
+			t.Fatalf("id %d: got %+v, want name %s", item.Id, got, item.Name)
+		}
+	}
+}
+
+func TestAutoIncrementKeyInTransaction(t *testing.T) {
+	db := newTestDB(t)
+	key := autoIncrementKey(db)
+	for i := 0; i < 2; i++ {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if k := autoIncrementKey(tx); k != key {
+				t.Errorf("transaction key %v differs from connection key %v", k, key)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
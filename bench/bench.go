@@ -0,0 +1,188 @@
+// Package bench Dao性能基准，用于评估内部实现的改动，也可用于测试自定义模型
+package bench
+
+import (
+	"fmt"
+	"github.com/kamioair/qdb"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// Row 默认的基准测试模型
+type Row struct {
+	qdb.DbSimple
+	Name  string `gorm:"size:64;index"`
+	Value int64
+	Note  string `gorm:"size:255"`
+}
+
+// Result 基准测试结果
+type Result struct {
+	Name string // 名称，如 Create、CreateList/100
+	testing.BenchmarkResult
+}
+
+// 内存数据库序号，每次打开独立的数据库
+var memorySeq int64
+
+// OpenMemory 打开独立的sqlite内存数据库，命名规则与 qdb 默认配置一致
+//
+//	@return *gorm.DB, error
+func OpenMemory() (*gorm.DB, error) {
+	name := fmt.Sprintf("file:qdb_bench_%d?mode=memory&cache=shared", atomic.AddInt64(&memorySeq, 1))
+	return gorm.Open(sqlite.Open(name), &gorm.Config{
+		NamingStrategy:         schema.NamingStrategy{SingularTable: true, NoLowerCase: true},
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+}
+
+// Open 按 qdb 连接串打开数据库，用于对真实服务测试
+//
+//	注意：会替换全局配置来源
+//
+//	@param connect 连接串，格式同配置文件，如 mysql|用户名:密码@tcp(127.0.0.1:3306)/bench?charset=utf8mb4&parseTime=True&loc=Local
+//	@return *gorm.DB, error
+func Open(connect string) (db *gorm.DB, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	qdb.SetConfigSource(qdb.LiteralSource(map[string]any{
+		"Bench": map[string]any{
+			"Connect": connect,
+			"Config":  map[string]any{"SkipDefaultTransaction": true, "NoLowerCase": true, "SingularTable": true},
+		},
+	}))
+	return qdb.NewDb("Bench", ""), nil
+}
+
+// Run 使用默认模型执行全部基准测试
+//
+//	@param db 数据库连接
+//	@return []Result, error
+func Run(db *gorm.DB) ([]Result, error) {
+	return Model(db, func(i int) Row {
+		return Row{Name: fmt.Sprintf("row-%d", i), Value: int64(i), Note: strings.Repeat("x", 32)}
+	})
+}
+
+// Model 使用自定义模型执行基准测试：Create、CreateList、GetModel、GetList、Save、SaveList
+//
+//	测试前清空模型对应的表
+//
+//	@param db 数据库连接
+//	@param newModel 按序号生成模型，主键须为空
+//	@return []Result, error
+func Model[T any](db *gorm.DB, newModel func(i int) T) ([]Result, error) {
+	dao, err := qdb.TryNewDao[T](db)
+	if err != nil {
+		return nil, err
+	}
+	if err = dao.Truncate(); err != nil {
+		return nil, err
+	}
+	// 预置数据供查询和保存使用
+	seed := make([]T, 1000)
+	for i := range seed {
+		seed[i] = newModel(i)
+	}
+	if err = dao.CreateList(seed); err != nil {
+		return nil, err
+	}
+	ids := make([]uint64, 0, len(seed))
+	list, err := dao.GetList(0, len(seed))
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range list {
+		if model, ok := any(m).(qdb.Model); ok {
+			ids = append(ids, model.GetID())
+		}
+	}
+
+	var failed error
+	fail := func(b *testing.B, err error) {
+		if err != nil && failed == nil {
+			failed = err
+			b.FailNow()
+		}
+	}
+	cases := []struct {
+		name string
+		fn   func(b *testing.B)
+	}{
+		{"Create", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m := newModel(i)
+				fail(b, dao.Create(&m))
+			}
+		}},
+		{"CreateList/100", func(b *testing.B) {
+			batch := make([]T, 100)
+			for i := 0; i < b.N; i++ {
+				for j := range batch {
+					batch[j] = newModel(i*100 + j)
+				}
+				fail(b, dao.CreateList(batch))
+			}
+		}},
+		{"GetModel", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := dao.GetModel(ids[i%len(ids)])
+				fail(b, err)
+			}
+		}},
+		{"GetList/100", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := dao.GetList(uint64(i%900), 100)
+				fail(b, err)
+			}
+		}},
+		{"Save", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				fail(b, dao.Save(list[i%len(list)]))
+			}
+		}},
+		{"SaveList/100", func(b *testing.B) {
+			batch := make([]*T, 100)
+			for i := 0; i < b.N; i++ {
+				for j := range batch {
+					batch[j] = list[(i*100+j)%len(list)]
+				}
+				fail(b, dao.SaveListP(batch))
+			}
+		}},
+	}
+
+	results := make([]Result, 0, len(cases))
+	for _, c := range cases {
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			c.fn(b)
+		})
+		if failed != nil {
+			return results, fmt.Errorf("%s: %w", c.name, failed)
+		}
+		results = append(results, Result{Name: c.name, BenchmarkResult: r})
+	}
+	return results, nil
+}
+
+// Print 以 go test -bench 的格式输出结果
+//
+//	@param w 输出
+//	@param prefix 名称前缀，如 sqlite
+//	@param results 结果
+func Print(w io.Writer, prefix string, results []Result) {
+	for _, r := range results {
+		_, _ = fmt.Fprintf(w, "Benchmark%s/%s\t%s\t%s\n", prefix, r.Name, r.BenchmarkResult.String(), r.MemString())
+	}
+}
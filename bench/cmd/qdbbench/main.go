@@ -0,0 +1,48 @@
+// qdbbench 执行Dao基准测试
+//
+//	默认使用sqlite内存数据库，通过 -connect 或环境变量 QDB_BENCH_CONNECT 指定真实服务，多个以分号分隔
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/kamioair/qdb/bench"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+)
+
+func main() {
+	connect := flag.String("connect", os.Getenv("QDB_BENCH_CONNECT"), "qdb连接串，多个以分号分隔，为空使用sqlite内存数据库")
+	flag.Parse()
+
+	targets := []string{""}
+	if *connect != "" {
+		targets = strings.Split(*connect, ";")
+	}
+	failed := false
+	for _, target := range targets {
+		var db *gorm.DB
+		var err error
+		name := "Memory"
+		if target == "" {
+			db, err = bench.OpenMemory()
+		} else {
+			name = strings.SplitN(target, "|", 2)[0]
+			name = strings.ToUpper(name[:1]) + name[1:]
+			db, err = bench.Open(target)
+		}
+		if err == nil {
+			var results []bench.Result
+			results, err = bench.Run(db)
+			bench.Print(os.Stdout, name, results)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,223 @@
+package qdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BlobStore 外部存储，如文件系统、S3，键由内容哈希生成，相同内容只保存一份
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// FileBlobStore 保存到本地目录的外部存储，按键的前两位分目录
+type FileBlobStore struct {
+	Dir string // 根目录
+}
+
+// Put 写入内容，已存在时跳过
+func (s FileBlobStore) Put(_ context.Context, key string, data []byte) error {
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免读到写了一半的内容
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Get 读取内容
+func (s FileBlobStore) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(s.path(key))
+}
+
+// path 键对应的文件路径
+func (s FileBlobStore) path(key string) string {
+	if len(key) > 2 {
+		return filepath.Join(s.Dir, key[:2], key)
+	}
+	return filepath.Join(s.Dir, key)
+}
+
+// 列内容的首字节
+const (
+	blobInline byte = 0 // 其后为内容
+	blobRef    byte = 1 // 其后为外部存储的键
+)
+
+var (
+	blobStore       BlobStore
+	blobInlineLimit = 64 * 1024
+	blobLock        sync.RWMutex
+)
+
+// SetBlobStore 设置 Blob 字段的外部存储，未设置时内容全部保存在行内
+//
+//	@param store 外部存储，如 FileBlobStore{Dir: "./blobs"}
+//	@param inlineLimit 行内保存的最大字节数，超过时写入外部存储，为0使用64KB
+func SetBlobStore(store BlobStore, inlineLimit int) {
+	blobLock.Lock()
+	defer blobLock.Unlock()
+	if inlineLimit <= 0 {
+		inlineLimit = 64 * 1024
+	}
+	blobStore, blobInlineLimit = store, inlineLimit
+}
+
+// currentBlobStore 返回外部存储和行内上限
+func currentBlobStore() (BlobStore, int) {
+	blobLock.RLock()
+	defer blobLock.RUnlock()
+	return blobStore, blobInlineLimit
+}
+
+// Blob 文件等二进制内容字段，小内容保存在行内，大内容写入 SetBlobStore 设置的外部存储，行内只保存引用
+//
+// 建表时 mysql 为 longblob、postgres 为 bytea、sqlserver 为 varbinary(max)、sqlite 为 blob；
+// 读取时只加载引用，调用 Bytes 时再从外部存储读取；外部存储的内容不随记录删除
+type Blob struct {
+	data   []byte
+	ref    string
+	loaded bool
+	lock   sync.Mutex
+}
+
+// NewBlob 创建内容字段
+//
+//	@param data 内容
+//	@return *Blob
+func NewBlob(data []byte) *Blob {
+	return &Blob{data: data, loaded: true}
+}
+
+// Bytes 返回内容，保存在外部存储时首次调用读取
+//
+//	@return []byte, error
+func (b *Blob) Bytes() ([]byte, error) {
+	return b.BytesContext(context.Background())
+}
+
+// BytesContext 返回内容，保存在外部存储时首次调用读取
+//
+//	@param ctx 上下文
+//	@return []byte, error
+func (b *Blob) BytesContext(ctx context.Context) ([]byte, error) {
+	if b == nil {
+		return nil, nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.loaded || b.ref == "" {
+		return b.data, nil
+	}
+	store, _ := currentBlobStore()
+	if store == nil {
+		return nil, errors.New("qdb: blob store is not set")
+	}
+	data, err := store.Get(ctx, b.ref)
+	if err != nil {
+		return nil, fmt.Errorf("qdb: read blob %s: %w", b.ref, err)
+	}
+	b.data, b.loaded = data, true
+	return data, nil
+}
+
+// Ref 返回外部存储的键，保存在行内时为空
+//
+//	@return string
+func (b *Blob) Ref() string {
+	if b == nil {
+		return ""
+	}
+	return b.ref
+}
+
+// GormDataType 通用数据类型
+func (*Blob) GormDataType() string {
+	return string(schema.Bytes)
+}
+
+// GormDBDataType 各数据库的建表类型
+func (*Blob) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "longblob"
+	case "postgres":
+		return "bytea"
+	case "sqlserver":
+		return "varbinary(max)"
+	default:
+		return "blob"
+	}
+}
+
+// GormValue 写入值，超过行内上限时先写入外部存储
+func (b *Blob) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	if b == nil {
+		return clause.Expr{SQL: "NULL"}
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.loaded {
+		// 读取后未修改，引用不变
+		return clause.Expr{SQL: "?", Vars: []any{append([]byte{blobRef}, b.ref...)}}
+	}
+	store, limit := currentBlobStore()
+	if store == nil || len(b.data) <= limit {
+		b.ref = ""
+		return clause.Expr{SQL: "?", Vars: []any{append([]byte{blobInline}, b.data...)}}
+	}
+	sum := sha256.Sum256(b.data)
+	key := hex.EncodeToString(sum[:])
+	if err := store.Put(ctx, key, b.data); err != nil {
+		_ = db.AddError(fmt.Errorf("qdb: write blob %s: %w", key, err))
+		return clause.Expr{SQL: "NULL"}
+	}
+	b.ref = key
+	return clause.Expr{SQL: "?", Vars: []any{append([]byte{blobRef}, key...)}}
+}
+
+// Scan 读取值
+func (b *Blob) Scan(src any) error {
+	var raw []byte
+	switch x := src.(type) {
+	case nil:
+	case []byte:
+		raw = x
+	case string:
+		raw = []byte(x)
+	default:
+		return fmt.Errorf("qdb: cannot convert %T to blob", src)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.data, b.ref, b.loaded = nil, "", true
+	if len(raw) == 0 {
+		return nil
+	}
+	switch raw[0] {
+	case blobInline:
+		b.data = append([]byte(nil), raw[1:]...)
+	case blobRef:
+		b.ref, b.loaded = string(raw[1:]), false
+	default:
+		return fmt.Errorf("qdb: unknown blob format %d", raw[0])
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// BreakerOptions 熔断选项
+type BreakerOptions struct {
+	Failures  int                  // 连续失败多少次后熔断，为0使用5
+	CoolDown  time.Duration        // 熔断时长，之后允许一次试探，为0使用10秒
+	IsFailure func(err error) bool // 判断是否计为失败，为空使用 IsConnError
+}
+
+// breakerState 单个数据库的熔断状态
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// CircuitBreaker 熔断中间件，按数据库连接分别计算，连续连接失败后在熔断期内直接返回 ErrCircuitOpen，避免每次请求都等待连接超时
+//
+//	@param opts 熔断选项
+//	@return Middleware
+func CircuitBreaker(opts BreakerOptions) Middleware {
+	if opts.Failures <= 0 {
+		opts.Failures = 5
+	}
+	if opts.CoolDown <= 0 {
+		opts.CoolDown = 10 * time.Second
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsConnError
+	}
+	states := map[gorm.Dialector]*breakerState{}
+	var lock sync.Mutex
+
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			lock.Lock()
+			st, ok := states[op.DB.Dialector]
+			if !ok {
+				st = &breakerState{}
+				states[op.DB.Dialector] = st
+			}
+			probe := false
+			if st.failures >= opts.Failures {
+				// 熔断期内或已有试探请求时直接失败
+				if time.Now().Before(st.openUntil) || st.probing {
+					lock.Unlock()
+					return fmt.Errorf("%w: %s on %s", ErrCircuitOpen, op.Name, op.Table)
+				}
+				st.probing, probe = true, true
+			}
+			lock.Unlock()
+
+			err := next(op)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if probe {
+				st.probing = false
+			}
+			if err != nil && opts.IsFailure(err) {
+				st.failures++
+				if st.failures >= opts.Failures {
+					st.openUntil = time.Now().Add(opts.CoolDown)
+				}
+			} else {
+				st.failures = 0
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+)
+
+// Cancelable 可取消的Dao，用于管理界面中止耗时的报表查询等
+type Cancelable[T any] struct {
+	Dao    *Dao[T] // 通过该Dao执行的操作可被取消
+	db     *gorm.DB
+	conn   *sql.Conn // mysql使用的专用连接
+	connID int64
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+// Cancelable 返回可取消的Dao，使用完毕后需调用 Close 或 Cancel
+//
+//	mysql使用专用连接，取消时执行 KILL QUERY 中止服务端语句，其他数据库由驱动随上下文取消
+//
+//	@return *Cancelable[T], error
+func (dao *Dao[T]) Cancelable() (*Cancelable[T], error) {
+	parent := dao.db.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	c := &Cancelable[T]{db: dao.db, cancel: cancel}
+	db := dao.db.WithContext(ctx)
+
+	if dao.db.Dialector.Name() == "mysql" {
+		sqlDB, err := dao.db.DB()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		if c.conn, err = sqlDB.Conn(context.Background()); err != nil {
+			cancel()
+			return nil, err
+		}
+		if err = c.conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&c.connID); err != nil {
+			_ = c.conn.Close()
+			cancel()
+			return nil, err
+		}
+		db = dao.db.Session(&gorm.Session{Context: ctx})
+		db.Statement.ConnPool = c.conn
+	}
+
+	clone := *dao
+	clone.db = db
+	c.Dao = &clone
+	return c, nil
+}
+
+// Cancel 取消执行中的操作并释放连接，之后该Dao不可再使用
+//
+//	@return error
+func (c *Cancelable[T]) Cancel() error {
+	var err error
+	c.once.Do(func() {
+		if c.conn != nil {
+			err = c.db.Exec(fmt.Sprintf("KILL QUERY %d", c.connID)).Error
+		}
+		c.cancel()
+		if c.conn != nil {
+			_ = c.conn.Close()
+		}
+	})
+	return err
+}
+
+// Close 释放连接，不中止执行中的操作
+//
+//	@return error
+func (c *Cancelable[T]) Close() error {
+	var err error
+	c.once.Do(func() {
+		if c.conn != nil {
+			err = c.conn.Close()
+		}
+		c.cancel()
+	})
+	return err
+}
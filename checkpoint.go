@@ -0,0 +1,104 @@
+package qdb
+
+import (
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// dbCheckpoint 检查点记录
+type dbCheckpoint struct {
+	Name        string         `gorm:"primaryKey;size:128"` // 名称
+	Cursor      string         `gorm:"size:1000"`           // 进度
+	UpdatedTime qtime.DateTime // 最后更新时间
+}
+
+// TableName 表名
+func (dbCheckpoint) TableName() string {
+	return "qdb_checkpoint"
+}
+
+// Checkpoint 批处理检查点，用于增量同步、ETL等循环任务保存处理进度，重启后从上次位置继续，记录在 qdb_checkpoint 表
+//
+//	进度需与数据一同提交时使用 SaveTx 在同一事务中保存
+type Checkpoint struct {
+	db *gorm.DB
+}
+
+// NewCheckpoint 创建检查点，表不存在时自动创建
+//
+//	@param db 数据库连接
+//	@return *Checkpoint, error
+func NewCheckpoint(db *gorm.DB) (*Checkpoint, error) {
+	if err := ensureTable(db, &dbCheckpoint{}); err != nil {
+		return nil, err
+	}
+	return &Checkpoint{db: db}, nil
+}
+
+// Load 读取进度
+//
+//	@param name 名称，如 sync:orders
+//	@return string 进度, bool 是否存在, error
+func (c *Checkpoint) Load(name string) (string, bool, error) {
+	var rows []dbCheckpoint
+	err := c.db.Where(clause.Eq{Column: fieldColumn(c.db, &dbCheckpoint{}, "Name"), Value: name}).Limit(1).Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return "", false, err
+	}
+	return rows[0].Cursor, true, nil
+}
+
+// Save 保存进度，已存在时覆盖
+//
+//	@param name 名称
+//	@param cursor 进度，如最后处理的唯一号、时间或上游返回的游标
+//	@return error
+func (c *Checkpoint) Save(name string, cursor string) error {
+	return c.SaveTx(c.db, name, cursor)
+}
+
+// SaveTx 在指定事务中保存进度，与本批数据一同提交或回滚
+//
+//	@param tx 事务
+//	@param name 名称
+//	@param cursor 进度
+//	@return error
+func (c *Checkpoint) SaveTx(tx *gorm.DB, name string, cursor string) error {
+	row := &dbCheckpoint{Name: name, Cursor: cursor, UpdatedTime: qtime.NewDateTime(now())}
+	return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error
+}
+
+// CompareAndSave 仅当当前进度为 expected 时保存新进度，用于多个实例推进同一进度时避免覆盖
+//
+//	@param name 名称
+//	@param expected 预期的当前进度，记录不存在时视为空
+//	@param cursor 新进度
+//	@return bool 是否保存, error
+func (c *Checkpoint) CompareAndSave(name string, expected string, cursor string) (bool, error) {
+	row := &dbCheckpoint{}
+	result := c.db.Model(row).
+		Where(clause.Eq{Column: fieldColumn(c.db, row, "Name"), Value: name}).
+		Where(clause.Eq{Column: fieldColumn(c.db, row, "Cursor"), Value: expected}).
+		Updates(map[string]any{
+			fieldColumn(c.db, row, "Cursor").Name:      cursor,
+			fieldColumn(c.db, row, "UpdatedTime").Name: qtime.NewDateTime(now()),
+		})
+	if result.Error != nil || result.RowsAffected > 0 || expected != "" {
+		return result.RowsAffected > 0, result.Error
+	}
+	// 记录不存在时新增，并发新增只有一个成功
+	err := c.db.Create(&dbCheckpoint{Name: name, Cursor: cursor, UpdatedTime: qtime.NewDateTime(now())}).Error
+	if IsDuplicateKey(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete 删除进度，下次从头开始
+//
+//	@param name 名称
+//	@return error
+func (c *Checkpoint) Delete(name string) error {
+	return c.db.Where(clause.Eq{Column: fieldColumn(c.db, &dbCheckpoint{}, "Name"), Value: name}).Delete(&dbCheckpoint{}).Error
+}
@@ -0,0 +1,187 @@
+package qdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TableChecksum 表校验结果
+type TableChecksum struct {
+	Table string            // 表名
+	Count int               // 行数
+	Rows  map[uint64]string // 唯一号及行哈希
+	Sum   string            // 全表哈希，按唯一号顺序由行哈希计算
+}
+
+// ChecksumDiff 校验差异
+type ChecksumDiff struct {
+	Missing []uint64 // 源中存在、目标中不存在
+	Extra   []uint64 // 目标中存在、源中不存在
+	Changed []uint64 // 两边都存在但内容不同
+}
+
+// Equal 是否无差异
+func (d *ChecksumDiff) Equal() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+var (
+	checksumColumns = map[reflect.Type][]string{}
+	checksumLock    sync.RWMutex
+)
+
+// SetChecksumColumns 设置模型参与校验的列，未设置时使用除 LastTime 外的全部列
+//
+//	@param columns 列名
+func SetChecksumColumns[T any](columns ...string) {
+	checksumLock.Lock()
+	defer checksumLock.Unlock()
+	checksumColumns[reflect.TypeOf((*T)(nil)).Elem()] = columns
+}
+
+// Checksum 计算表中每行及全表的哈希，值按类型统一格式化，不同数据库之间结果一致
+//
+//	@param dao 数据访问对象
+//	@param query 可选条件及参数，如 "Id > ?", 100
+//	@return *TableChecksum, error
+func Checksum[T any](dao *Dao[T], query ...any) (*TableChecksum, error) {
+	var sum *TableChecksum
+	err := dao.exec("Checksum", OpRead, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		pk := stmt.Schema.PrioritizedPrimaryField
+		if pk == nil {
+			return fmt.Errorf("%s has no primary key", stmt.Schema.Name)
+		}
+		checksumLock.RLock()
+		columns := checksumColumns[reflect.TypeOf((*T)(nil)).Elem()]
+		checksumLock.RUnlock()
+		if len(columns) == 0 {
+			for _, f := range stmt.Schema.Fields {
+				if f.DBName != "" && f.Name != "LastTime" {
+					columns = append(columns, f.DBName)
+				}
+			}
+		}
+		columns = append([]string{}, columns...)
+		sort.Strings(columns)
+
+		db := dao.query(op.DB).Model(new(T)).Select(append([]string{pk.DBName}, columns...)).Order(pk.DBName)
+		if len(query) > 0 {
+			db = db.Where(query[0], query[1:]...)
+		}
+		rows, err := db.Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		sum = &TableChecksum{Table: stmt.Schema.Table, Rows: map[uint64]string{}}
+		total := sha256.New()
+		for rows.Next() {
+			row := map[string]any{}
+			if err = op.DB.ScanRows(rows, &row); err != nil {
+				return err
+			}
+			id, _ := strconv.ParseUint(checksumValue(row[pk.DBName]), 10, 64)
+			h := sha256.New()
+			for _, col := range columns {
+				h.Write([]byte(col + "=" + checksumValue(row[col]) + "\x1f"))
+			}
+			rowSum := hex.EncodeToString(h.Sum(nil))
+			sum.Rows[id] = rowSum
+			total.Write([]byte(strconv.FormatUint(id, 10) + ":" + rowSum + "\n"))
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		sum.Count = len(sum.Rows)
+		sum.Sum = hex.EncodeToString(total.Sum(nil))
+		op.RowsAffected = int64(sum.Count)
+		return nil
+	})
+	return sum, err
+}
+
+// CompareChecksums 比较两个校验结果
+//
+//	@param src 源
+//	@param dst 目标
+//	@return *ChecksumDiff
+func CompareChecksums(src, dst *TableChecksum) *ChecksumDiff {
+	diff := &ChecksumDiff{}
+	for id, h := range src.Rows {
+		if d, ok := dst.Rows[id]; !ok {
+			diff.Missing = append(diff.Missing, id)
+		} else if d != h {
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range dst.Rows {
+		if _, ok := src.Rows[id]; !ok {
+			diff.Extra = append(diff.Extra, id)
+		}
+	}
+	for _, ids := range [][]uint64{diff.Missing, diff.Extra, diff.Changed} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return diff
+}
+
+// DiffTables 比较两个连接中同一模型的表数据
+//
+//	@param src 源
+//	@param dst 目标
+//	@param query 可选条件及参数
+//	@return *ChecksumDiff, error
+func DiffTables[T any](src, dst *Dao[T], query ...any) (*ChecksumDiff, error) {
+	a, err := Checksum(src, query...)
+	if err != nil {
+		return nil, err
+	}
+	b, err := Checksum(dst, query...)
+	if err != nil {
+		return nil, err
+	}
+	return CompareChecksums(a, b), nil
+}
+
+// checksumValue 统一格式化列值，消除不同驱动返回类型的差异
+func checksumValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "\x00"
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10)
+	}
+	return fmt.Sprint(v)
+}
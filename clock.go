@@ -0,0 +1,44 @@
+package qdb
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时钟，用于LastTime等时间戳和gorm的NowFunc
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc 方法形式的时钟
+type ClockFunc func() time.Time
+
+// Now 返回当前时间
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+var (
+	clock     Clock = ClockFunc(time.Now)
+	clockLock sync.RWMutex
+)
+
+// SetClock 设置全局时钟，为空时恢复本机时间，如测试中冻结时间、分布式系统使用同步后的UTC时间
+//
+//	@param c 时钟
+func SetClock(c Clock) {
+	clockLock.Lock()
+	defer clockLock.Unlock()
+	if c == nil {
+		c = ClockFunc(time.Now)
+	}
+	clock = c
+}
+
+// now 返回全局时钟的当前时间
+func now() time.Time {
+	clockLock.RLock()
+	c := clock
+	clockLock.RUnlock()
+	return c.Now()
+}
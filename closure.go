@@ -0,0 +1,362 @@
+package qdb
+
+import (
+	"database/sql"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+// Tree 基于闭包表的层级结构，适用于不支持递归查询的数据库或版本
+//
+// 每个节点与其所有祖先（含自身）各保存一行路径，记录在 qdb_closure 表，
+// 新增、移动、删除节点须通过 Tree 执行以维护路径，已有数据可通过 Rebuild 生成
+type Tree[T any] struct {
+	dao    *Dao[T]
+	parent string // 上级字段，如 ParentId，0表示根节点
+}
+
+// treePath 闭包表中的一条路径
+type treePath struct {
+	Tree       string `gorm:"primaryKey;size:128"`                // 表名
+	Ancestor   uint64 `gorm:"primaryKey"`                         // 祖先唯一号
+	Descendant uint64 `gorm:"primaryKey;index:idx_qdb_closure_d"` // 后代唯一号
+	Depth      int    // 层级差，自身为0
+}
+
+// TableName 表名
+func (treePath) TableName() string {
+	return "qdb_closure"
+}
+
+// 单条语句中 IN 列表的最大数量
+const treeChunk = 1000
+
+// Tree 返回按上级字段组织的层级结构，闭包表不存在时自动创建
+//
+//	@param parentField 上级字段，类型为 uint64，如 ParentId
+//	@return *Tree[T], error
+func (dao *Dao[T]) Tree(parentField string) (*Tree[T], error) {
+	if f, ok := reflect.TypeOf(new(T)).Elem().FieldByName(parentField); !ok || f.Type.Kind() != reflect.Uint64 {
+		return nil, fmt.Errorf("qdb: %s has no uint64 field %s", dao.table, parentField)
+	}
+	if err := ensureTable(dao.db, &treePath{}); err != nil {
+		return nil, err
+	}
+	return &Tree[T]{dao: dao, parent: parentField}, nil
+}
+
+// Create 新增节点并写入路径
+//
+//	@param model 待新增实体，上级不存在时返回 ErrNotFound
+//	@return error
+func (t *Tree[T]) Create(model *T) error {
+	return t.dao.exec("TreeCreate", OpCreate, func(op *Operation) error {
+		touch(op.Context(), model, now())
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			if _, parent := t.ids(model); parent > 0 {
+				if err := t.checkPolicy(tx, []uint64{parent}); err != nil {
+					return err
+				}
+			}
+			result := tx.Create(model)
+			if result.Error != nil {
+				return result.Error
+			}
+			op.RowsAffected = result.RowsAffected
+			id, parent := t.ids(model)
+			if err := tx.Create(&treePath{Tree: t.dao.table, Ancestor: id, Descendant: id}).Error; err != nil {
+				return err
+			}
+			if parent == 0 {
+				return nil
+			}
+			result = tx.Exec(t.sql("INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s) SELECT %[2]s, %[3]s, ?, %[5]s + 1 FROM %[1]s WHERE %[2]s = ? AND %[4]s = ?"),
+				id, t.dao.table, parent)
+			if result.Error == nil && result.RowsAffected == 0 {
+				return fmt.Errorf("%w: parent %d", ErrNotFound, parent)
+			}
+			return result.Error
+		}, 1)
+	})
+}
+
+// Move 将节点及其子树移动到新的上级下
+//
+//	@param id 节点唯一号
+//	@param parentId 新的上级唯一号，0表示移为根节点，不能是节点自身或其后代
+//	@return error
+func (t *Tree[T]) Move(id uint64, parentId uint64) error {
+	return t.dao.exec("TreeMove", OpUpdate, func(op *Operation) error {
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			subtree, err := t.subtreeIds(tx, id)
+			if err != nil {
+				return err
+			}
+			if len(subtree) == 0 {
+				return ErrNotFound
+			}
+			for _, d := range subtree {
+				if d == parentId {
+					return fmt.Errorf("qdb: cannot move node %d under its own subtree", id)
+				}
+			}
+			if err = t.checkPolicy(tx, append([]uint64{parentId}, subtree...)); err != nil {
+				return err
+			}
+			// 删除子树与原祖先之间的路径
+			var ancestors []uint64
+			err = tx.Model(&treePath{}).Where(t.sql("%[2]s = ? AND %[4]s = ? AND %[5]s > 0"), t.dao.table, id).
+				Pluck(fieldColumn(tx, &treePath{}, "Ancestor").Name, &ancestors).Error
+			if err != nil {
+				return err
+			}
+			for _, part := range chunkIds(subtree) {
+				if len(ancestors) == 0 {
+					break
+				}
+				err = tx.Where(t.sql("%[2]s = ? AND %[4]s IN ? AND %[3]s IN ?"), t.dao.table, part, ancestors).
+					Delete(&treePath{}).Error
+				if err != nil {
+					return err
+				}
+			}
+			if parentId > 0 {
+				result := tx.Exec(t.sql("INSERT INTO %[1]s (%[2]s, %[3]s, %[4]s, %[5]s) "+
+					"SELECT p.%[2]s, p.%[3]s, s.%[4]s, p.%[5]s + s.%[5]s + 1 FROM %[1]s p JOIN %[1]s s ON s.%[2]s = p.%[2]s "+
+					"WHERE p.%[2]s = ? AND p.%[4]s = ? AND s.%[3]s = ?"), t.dao.table, parentId, id)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					return fmt.Errorf("%w: parent %d", ErrNotFound, parentId)
+				}
+			}
+			result := rowPolicy[T](tx).Model(new(T)).Where(clause.Eq{Column: fieldColumn(tx, new(T), "Id"), Value: id}).
+				Update(fieldColumn(tx, new(T), t.parent).Name, parentId)
+			op.RowsAffected = result.RowsAffected
+			return result.Error
+		}, 1)
+	})
+}
+
+// Delete 删除节点及其全部后代
+//
+//	@param id 节点唯一号
+//	@return error
+func (t *Tree[T]) Delete(id uint64) error {
+	return t.dao.exec("TreeDelete", OpDelete, func(op *Operation) error {
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			subtree, err := t.subtreeIds(tx, id)
+			if err != nil {
+				return err
+			}
+			if err = t.checkPolicy(tx, subtree); err != nil {
+				return err
+			}
+			for _, part := range chunkIds(subtree) {
+				result := rowPolicy[T](tx).Where(clause.IN{Column: fieldColumn(tx, new(T), "Id"), Values: toAny(part)}).Delete(new(T))
+				if result.Error != nil {
+					return result.Error
+				}
+				op.RowsAffected += result.RowsAffected
+				err = tx.Where(t.sql("%[2]s = ? AND %[4]s IN ?"), t.dao.table, part).Delete(&treePath{}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, 1)
+	})
+}
+
+// GetSubtree 查询节点及其后代，按层级、唯一号排序
+//
+//	@param id 节点唯一号
+//	@param maxDepth 最大层级差，1为只查询直接下级，0不限制
+//	@return []*T, error
+func (t *Tree[T]) GetSubtree(id uint64, maxDepth int) ([]*T, error) {
+	return t.find("TreeSubtree", func(db *gorm.DB) *gorm.DB {
+		db = db.Where(t.sql("c.%[3]s = ?"), id)
+		if maxDepth > 0 {
+			db = db.Where(t.sql("c.%[5]s <= ?"), maxDepth)
+		}
+		return db.Order(t.sql("c.%[5]s"))
+	}, t.sql("c.%[4]s"))
+}
+
+// GetChildren 查询直接下级
+//
+//	@param id 节点唯一号，0表示查询根节点
+//	@return []*T, error
+func (t *Tree[T]) GetChildren(id uint64) ([]*T, error) {
+	list := make([]*T, 0)
+	err := t.dao.exec("TreeChildren", OpRead, func(op *Operation) error {
+		result := t.dao.list(op.DB).Where(clause.Eq{Column: fieldColumn(op.DB, new(T), t.parent), Value: id}).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// GetAncestors 查询节点的全部祖先，从根节点到直接上级排序，不含自身
+//
+//	@param id 节点唯一号
+//	@return []*T, error
+func (t *Tree[T]) GetAncestors(id uint64) ([]*T, error) {
+	return t.find("TreeAncestors", func(db *gorm.DB) *gorm.DB {
+		return db.Where(t.sql("c.%[4]s = ? AND c.%[5]s > 0"), id).Order(t.sql("c.%[5]s DESC"))
+	}, t.sql("c.%[3]s"))
+}
+
+// GetDepth 查询节点的层级，根节点为0
+//
+//	@param id 节点唯一号
+//	@return int, error
+func (t *Tree[T]) GetDepth(id uint64) (int, error) {
+	var depth sql.NullInt64
+	err := t.dao.exec("TreeDepth", OpRead, func(op *Operation) error {
+		return op.DB.Model(&treePath{}).Select(t.sql("MAX(%[5]s)")).
+			Where(t.sql("%[2]s = ? AND %[4]s = ?"), t.dao.table, id).Row().Scan(&depth)
+	})
+	if err == nil && !depth.Valid {
+		err = ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(depth.Int64), nil
+}
+
+// Rebuild 按上级字段重新生成全部路径，用于为已有数据启用闭包表或修复路径
+//
+//	模型注册了行过滤策略时返回 ErrOpNotAllowed，重新生成会涉及策略外的节点
+//
+//	@return error
+func (t *Tree[T]) Rebuild() error {
+	return t.dao.exec("TreeRebuild", OpUpdate, func(op *Operation) error {
+		if hasRowPolicy[T]() {
+			return fmt.Errorf("%w: rebuild with row policy on %s", ErrOpNotAllowed, t.dao.table)
+		}
+		type node struct {
+			Id     uint64
+			Parent uint64
+		}
+		var nodes []node
+		err := op.DB.Model(new(T)).Select("? AS Id, ? AS Parent", fieldColumn(op.DB, new(T), "Id"), fieldColumn(op.DB, new(T), t.parent)).
+			Scan(&nodes).Error
+		if err != nil {
+			return err
+		}
+		parents := make(map[uint64]uint64, len(nodes))
+		for _, n := range nodes {
+			parents[n.Id] = n.Parent
+		}
+		paths := make([]treePath, 0, len(nodes))
+		for _, n := range nodes {
+			// 沿上级向上，上级缺失或数据成环时停止
+			ancestor := n.Id
+			for depth := 0; ; depth++ {
+				paths = append(paths, treePath{Tree: t.dao.table, Ancestor: ancestor, Descendant: n.Id, Depth: depth})
+				next := parents[ancestor]
+				if _, ok := parents[next]; next == 0 || !ok || depth >= len(nodes) {
+					break
+				}
+				ancestor = next
+			}
+		}
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			if err := tx.Where(t.sql("%[2]s = ?"), t.dao.table).Delete(&treePath{}).Error; err != nil {
+				return err
+			}
+			if len(paths) == 0 {
+				return nil
+			}
+			result := tx.CreateInBatches(paths, treeChunk/2)
+			op.RowsAffected = result.RowsAffected
+			return result.Error
+		}, 1)
+	})
+}
+
+// find 关联闭包表查询节点
+func (t *Tree[T]) find(name string, where func(db *gorm.DB) *gorm.DB, joinColumn string) ([]*T, error) {
+	list := make([]*T, 0)
+	err := t.dao.exec(name, OpRead, func(op *Operation) error {
+		db := t.dao.query(op.DB).Model(new(T))
+		db = db.Joins(fmt.Sprintf("JOIN %s c ON %s = %s.%s", op.DB.Statement.Quote("qdb_closure"), joinColumn,
+			op.DB.Statement.Quote(t.dao.table), op.DB.Statement.Quote(fieldColumn(op.DB, new(T), "Id").Name))).
+			Where(t.sql("c.%[2]s = ?"), t.dao.table)
+		result := where(db).Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: clause.PrimaryKey}}).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// subtreeIds 查询节点及其后代的唯一号
+func (t *Tree[T]) subtreeIds(db *gorm.DB, id uint64) ([]uint64, error) {
+	var ids []uint64
+	err := db.Model(&treePath{}).Where(t.sql("%[2]s = ? AND %[3]s = ?"), t.dao.table, id).
+		Pluck(fieldColumn(db, &treePath{}, "Descendant").Name, &ids).Error
+	return ids, err
+}
+
+// checkPolicy 有行过滤策略时确认节点均在策略范围内，否则返回 ErrNotFound，避免修改其他租户的节点及其路径
+func (t *Tree[T]) checkPolicy(tx *gorm.DB, ids []uint64) error {
+	if !hasRowPolicy[T]() {
+		return nil
+	}
+	for _, part := range chunkIds(ids) {
+		var all, visible int64
+		in := clause.IN{Column: fieldColumn(tx, new(T), "Id"), Values: toAny(part)}
+		if err := tx.Model(new(T)).Where(in).Count(&all).Error; err != nil {
+			return err
+		}
+		if err := rowPolicy[T](tx).Model(new(T)).Where(in).Count(&visible).Error; err != nil {
+			return err
+		}
+		if visible < all {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// ids 读取模型的唯一号和上级
+func (t *Tree[T]) ids(model *T) (uint64, uint64) {
+	value := reflect.ValueOf(model).Elem()
+	return value.FieldByName("Id").Uint(), value.FieldByName(t.parent).Uint()
+}
+
+// sql 替换语句中的闭包表表名和列名：%[1]s 表名，%[2]s Tree，%[3]s Ancestor，%[4]s Descendant，%[5]s Depth
+func (t *Tree[T]) sql(format string) string {
+	db := t.dao.db
+	quote := func(field string) string {
+		return db.Statement.Quote(fieldColumn(db, &treePath{}, field).Name)
+	}
+	return fmt.Sprintf(format, db.Statement.Quote(treePath{}.TableName()), quote("Tree"), quote("Ancestor"), quote("Descendant"), quote("Depth"))
+}
+
+// chunkIds 按 IN 列表的最大数量拆分
+func chunkIds(ids []uint64) [][]uint64 {
+	var parts [][]uint64
+	for len(ids) > treeChunk {
+		parts = append(parts, ids[:treeChunk])
+		ids = ids[treeChunk:]
+	}
+	if len(ids) > 0 {
+		parts = append(parts, ids)
+	}
+	return parts
+}
+
+// toAny 转换为 clause.IN 的参数
+func toAny(ids []uint64) []any {
+	values := make([]any, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return values
+}
@@ -0,0 +1,179 @@
+package qdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type treeNode struct {
+	DbSimple
+	ParentId uint64
+	Name     string
+}
+
+type policyNode struct {
+	DbSimple
+	ParentId uint64
+	Tenant   string
+	Name     string
+}
+
+func init() {
+	RegisterRowPolicy[policyNode](func(ctx context.Context) Condition {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return Condition{Query: "tenant = ?", Args: []any{tenant}}
+	})
+}
+
+// treeNames 返回节点名称
+func treeNames[T any](list []*T, name func(*T) string) []string {
+	names := make([]string, len(list))
+	for i, v := range list {
+		names[i] = name(v)
+	}
+	return names
+}
+
+// equalNames 名称列表是否相同
+func equalNames(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTree(t *testing.T) {
+	dao, err := TryNewDao[treeNode](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := dao.Tree("ParentId")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := func(n *treeNode) string { return n.Name }
+	root := &treeNode{Name: "root"}
+	if err = tree.Create(root); err != nil {
+		t.Fatal(err)
+	}
+	a := &treeNode{ParentId: root.Id, Name: "a"}
+	if err = tree.Create(a); err != nil {
+		t.Fatal(err)
+	}
+	b := &treeNode{ParentId: a.Id, Name: "b"}
+	if err = tree.Create(b); err != nil {
+		t.Fatal(err)
+	}
+	c := &treeNode{ParentId: root.Id, Name: "c"}
+	if err = tree.Create(c); err != nil {
+		t.Fatal(err)
+	}
+	if err = tree.Create(&treeNode{ParentId: 999, Name: "orphan"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Create under missing parent: got %v, want ErrNotFound", err)
+	}
+
+	list, err := tree.GetSubtree(root.Id, 0)
+	if got := treeNames(list, name); err != nil || !equalNames(got, "root", "a", "c", "b") {
+		t.Errorf("GetSubtree: %v %v", got, err)
+	}
+	list, err = tree.GetSubtree(root.Id, 1)
+	if got := treeNames(list, name); err != nil || !equalNames(got, "root", "a", "c") {
+		t.Errorf("GetSubtree depth 1: %v %v", got, err)
+	}
+	list, err = tree.GetAncestors(b.Id)
+	if got := treeNames(list, name); err != nil || !equalNames(got, "root", "a") {
+		t.Errorf("GetAncestors: %v %v", got, err)
+	}
+	list, err = tree.GetChildren(root.Id)
+	if got := treeNames(list, name); err != nil || !equalNames(got, "a", "c") {
+		t.Errorf("GetChildren: %v %v", got, err)
+	}
+	if depth, err := tree.GetDepth(b.Id); err != nil || depth != 2 {
+		t.Errorf("GetDepth: %d %v", depth, err)
+	}
+
+	// 移动子树
+	if err = tree.Move(a.Id, c.Id); err != nil {
+		t.Fatal(err)
+	}
+	list, err = tree.GetAncestors(b.Id)
+	if got := treeNames(list, name); err != nil || !equalNames(got, "root", "c", "a") {
+		t.Errorf("GetAncestors after Move: %v %v", got, err)
+	}
+	if moved, _ := dao.GetModel(a.Id); moved == nil || moved.ParentId != c.Id {
+		t.Errorf("Move did not update parent: %+v", moved)
+	}
+	if err = tree.Move(c.Id, b.Id); err == nil {
+		t.Error("Move under own subtree succeeded")
+	}
+
+	// 重建后路径不变
+	if err = tree.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	if depth, err := tree.GetDepth(b.Id); err != nil || depth != 3 {
+		t.Errorf("GetDepth after Rebuild: %d %v", depth, err)
+	}
+
+	// 删除子树
+	if err = tree.Delete(c.Id); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := dao.GetAll()
+	if got := treeNames(all, name); !equalNames(got, "root") {
+		t.Errorf("after Delete: %v", got)
+	}
+	if _, err = tree.GetDepth(b.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetDepth of deleted node: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestTreeRowPolicy(t *testing.T) {
+	dao, err := TryNewDao[policyNode](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := dao.WithContext(context.WithValue(context.Background(), tenantKey{}, "a")).Tree("ParentId")
+	b, _ := dao.WithContext(context.WithValue(context.Background(), tenantKey{}, "b")).Tree("ParentId")
+	root := &policyNode{Tenant: "a", Name: "root"}
+	if err = a.Create(root); err != nil {
+		t.Fatal(err)
+	}
+	child := &policyNode{ParentId: root.Id, Tenant: "a", Name: "child"}
+	if err = a.Create(child); err != nil {
+		t.Fatal(err)
+	}
+	other := &policyNode{Tenant: "b", Name: "other"}
+	if err = b.Create(other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = b.Create(&policyNode{ParentId: root.Id, Tenant: "b", Name: "intruder"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Create under other tenant's node: got %v, want ErrNotFound", err)
+	}
+	if err = b.Move(child.Id, other.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Move of other tenant's node: got %v, want ErrNotFound", err)
+	}
+	if err = a.Move(child.Id, other.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Move under other tenant's node: got %v, want ErrNotFound", err)
+	}
+	if err = b.Delete(root.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of other tenant's node: got %v, want ErrNotFound", err)
+	}
+	if err = b.Rebuild(); !errors.Is(err, ErrOpNotAllowed) {
+		t.Errorf("Rebuild with row policy: got %v, want ErrOpNotAllowed", err)
+	}
+	list, err := a.GetSubtree(root.Id, 0)
+	if err != nil || len(list) != 2 {
+		t.Errorf("tenant a subtree changed: %d %v", len(list), err)
+	}
+	if got, _ := a.dao.GetModel(child.Id); got == nil || got.ParentId != root.Id {
+		t.Errorf("child moved: %+v", got)
+	}
+}
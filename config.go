@@ -0,0 +1,258 @@
+package qdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/kamioair/utils/qconfig"
+	"github.com/kamioair/utils/qio"
+	"github.com/spf13/viper"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ConfigSource 配置来源
+type ConfigSource interface {
+	// Load 读取配置节到对象，返回配置节的原始内容，配置节不存在时返回空
+	Load(sectionName string, cfg any) (map[string]any, error)
+}
+
+var (
+	configSource ConfigSource
+	argsConfig   bool
+	configLock   sync.RWMutex
+)
+
+// SetConfigSource 设置全局配置来源，为空时恢复默认的配置文件
+//
+//	@param src 配置来源，如 FileSource、EnvSource、LiteralSource
+func SetConfigSource(src ConfigSource) {
+	configLock.Lock()
+	defer configLock.Unlock()
+	configSource = src
+}
+
+// EnableArgsConfig 启用从启动参数 os.Args[1] 的JSON中读取 ConfigPath，仅在未设置配置来源时生效
+func EnableArgsConfig() {
+	configLock.Lock()
+	defer configLock.Unlock()
+	argsConfig = true
+}
+
+// currentConfigSource 返回当前配置来源
+//
+//	未设置时使用配置文件，路径优先级：启动参数（需启用）> 环境变量 QDB_CONFIG > ./config.yaml
+func currentConfigSource() (ConfigSource, error) {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	if configSource != nil {
+		return configSource, nil
+	}
+
+	path := "./config.yaml"
+	if val := os.Getenv("QDB_CONFIG"); val != "" {
+		path = val
+	}
+	if argsConfig && len(os.Args) > 1 {
+		args := map[string]string{}
+		if err := json.Unmarshal([]byte(os.Args[1]), &args); err != nil {
+			return nil, err
+		}
+		// 自定义配置文件路径
+		if val, ok := args["ConfigPath"]; ok {
+			path = val
+		}
+	}
+	return FileSource(path), nil
+}
+
+// FileSource 配置文件来源，按扩展名支持 yaml、json、toml，yaml文件不存在时生成带注释的默认配置
+//
+//	@param path 配置文件路径
+//	@return ConfigSource
+func FileSource(path string) ConfigSource {
+	return fileSource(path)
+}
+
+type fileSource string
+
+// Load 读取配置节
+func (f fileSource) Load(sectionName string, cfg any) (map[string]any, error) {
+	path := string(f)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+	if ext == "json" || ext == "toml" {
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType(ext)
+		if qio.PathExists(path) {
+			if err := v.ReadInConfig(); err != nil {
+				return nil, fmt.Errorf("无法读取配置文件: %v", err)
+			}
+		}
+		raw := v.GetStringMap(sectionName)
+		return raw, decodeSection(raw, cfg)
+	}
+
+	// 首次运行时生成带注释的默认配置
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if !qio.PathExists(path) {
+		if err := writeDefaultYAML(path, map[string]any{sectionName: cfg}, []string{sectionName}); err != nil {
+			return nil, err
+		}
+	}
+
+	// yaml 使用统一的配置加载，支持保存
+	if err := qconfig.LoadConfig(path, sectionName, cfg); err != nil {
+		return nil, err
+	}
+	return viper.GetStringMap(sectionName), nil
+}
+
+// WriteDefaultConfig 生成带注释的默认yaml配置文件，文件已存在时返回错误
+//
+//	@param path 配置文件路径
+//	@param sectionNames 配置节名称，为空使用 Db
+//	@return error
+func WriteDefaultConfig(path string, sectionNames ...string) error {
+	if qio.PathExists(path) {
+		return fmt.Errorf("config file %s: %w", path, os.ErrExist)
+	}
+	if len(sectionNames) == 0 {
+		sectionNames = []string{"Db"}
+	}
+	sections := map[string]any{}
+	for _, name := range sectionNames {
+		sections[name] = initBaseConfig("")
+	}
+	return writeDefaultYAML(path, sections, sectionNames)
+}
+
+// writeDefaultYAML 按顺序写入配置节，字段的 comment 标签作为注释
+func writeDefaultYAML(path string, sections map[string]any, order []string) error {
+	var builder strings.Builder
+	for i, name := range order {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(fmt.Sprintf("############################### %s Config ###############################\n", name))
+		builder.WriteString(name + ":\n")
+		writeYAMLValue(&builder, reflect.ValueOf(sections[name]), 1)
+	}
+	return qio.WriteString(path, builder.String(), false)
+}
+
+// writeYAMLValue 写入结构体字段，嵌套结构体缩进输出，其他类型以JSON形式输出
+func writeYAMLValue(builder *strings.Builder, value reflect.Value, indent int) {
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	prefix := strings.Repeat("  ", indent)
+	typ := value.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if comment := field.Tag.Get("comment"); comment != "" {
+			for _, line := range strings.Split(comment, "\n") {
+				builder.WriteString(prefix + "# " + line + "\n")
+			}
+		}
+		fv := value.Field(i)
+		if fv.Kind() == reflect.Struct {
+			builder.WriteString(prefix + field.Name + ":\n")
+			writeYAMLValue(builder, fv, indent+1)
+			continue
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(fv.Interface())
+		builder.WriteString(prefix + field.Name + ": " + buf.String())
+	}
+}
+
+// EnvSource 环境变量来源，变量名为 前缀+配置节+字段路径，以下划线分隔，不区分大小写
+//
+//	如 QDB_Db_Connect=sqlite|./db/data.db&OFF、QDB_Db_Config_OpenLog=true
+//
+//	@param prefix 前缀，如 QDB_
+//	@return ConfigSource
+func EnvSource(prefix string) ConfigSource {
+	return envSource(prefix)
+}
+
+type envSource string
+
+// Load 读取配置节
+func (e envSource) Load(sectionName string, cfg any) (map[string]any, error) {
+	head := strings.ToLower(string(e) + sectionName + "_")
+	raw := map[string]any{}
+	for _, kv := range os.Environ() {
+		sp := strings.SplitN(kv, "=", 2)
+		if len(sp) != 2 || !strings.HasPrefix(strings.ToLower(sp[0]), head) {
+			continue
+		}
+		keys := strings.Split(sp[0][len(head):], "_")
+		node := raw
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := node[key].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[key] = child
+			}
+			node = child
+		}
+		// 布尔、数字按JSON解析，其余作为字符串
+		var value any = sp[1]
+		if err := json.Unmarshal([]byte(sp[1]), &value); err != nil {
+			value = sp[1]
+		}
+		node[keys[len(keys)-1]] = value
+	}
+	return raw, decodeSection(raw, cfg)
+}
+
+// LiteralSource 固定内容来源，用于测试或由程序自行组装配置
+//
+//	@param sections 配置节名称与内容，内容为map或结构体，如 {"Db": {"Connect": "sqlite|./db/data.db&OFF"}}
+//	@return ConfigSource
+func LiteralSource(sections map[string]any) ConfigSource {
+	return literalSource(sections)
+}
+
+type literalSource map[string]any
+
+// Load 读取配置节
+func (l literalSource) Load(sectionName string, cfg any) (map[string]any, error) {
+	section, ok := l[sectionName]
+	if !ok {
+		return map[string]any{}, nil
+	}
+	js, err := json.Marshal(section)
+	if err != nil {
+		return nil, err
+	}
+	raw := map[string]any{}
+	if err = json.Unmarshal(js, &raw); err != nil {
+		return nil, err
+	}
+	return raw, decodeSection(raw, cfg)
+}
+
+// decodeSection 将配置节原始内容转换到对象
+func decodeSection(raw map[string]any, cfg any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	js, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(js, cfg)
+}
@@ -0,0 +1,353 @@
+package qdb
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/viper"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteOptions 远程配置参数
+type RemoteOptions struct {
+	Address   string        // 服务地址，如 http://127.0.0.1:8500
+	Key       string        // 配置键，nacos为dataId
+	Group     string        // nacos分组，为空使用 DEFAULT_GROUP
+	Namespace string        // nacos命名空间
+	Username  string        // 用户名，etcd、nacos认证使用
+	Password  string        // 密码
+	Token     string        // consul ACL Token
+	Format    string        // 配置内容格式，yaml、json、toml，为空使用yaml
+	Interval  time.Duration // etcd轮询间隔，为空使用10秒
+}
+
+// remoteBackend 远程配置服务
+type remoteBackend interface {
+	// fetch 读取配置内容，wait为true时阻塞直到版本与last不同或超时
+	fetch(ctx context.Context, last string, wait bool) (content []byte, version string, err error)
+}
+
+// RemoteSource 远程配置来源，内容为包含多个配置节的完整配置文档
+type RemoteSource struct {
+	backend remoteBackend
+	format  string
+	version string
+	doc     *viper.Viper
+	lock    sync.RWMutex
+}
+
+// ConsulSource 从Consul KV读取配置，变更通过阻塞查询通知
+//
+//	@param opts 远程配置参数
+//	@return *RemoteSource, error
+func ConsulSource(opts RemoteOptions) (*RemoteSource, error) {
+	return newRemoteSource(&consulBackend{opts: opts}, opts)
+}
+
+// EtcdSource 从etcd v3读取配置，通过HTTP网关访问，变更通过轮询通知
+//
+//	@param opts 远程配置参数
+//	@return *RemoteSource, error
+func EtcdSource(opts RemoteOptions) (*RemoteSource, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	return newRemoteSource(&etcdBackend{opts: opts}, opts)
+}
+
+// NacosSource 从Nacos配置中心读取配置，变更通过长轮询监听通知
+//
+//	@param opts 远程配置参数
+//	@return *RemoteSource, error
+func NacosSource(opts RemoteOptions) (*RemoteSource, error) {
+	if opts.Group == "" {
+		opts.Group = "DEFAULT_GROUP"
+	}
+	return newRemoteSource(&nacosBackend{opts: opts}, opts)
+}
+
+// newRemoteSource 创建远程配置来源并读取首个版本
+func newRemoteSource(backend remoteBackend, opts RemoteOptions) (*RemoteSource, error) {
+	r := &RemoteSource{backend: backend, format: opts.Format}
+	if r.format == "" {
+		r.format = "yaml"
+	}
+	content, version, err := backend.fetch(context.Background(), "", false)
+	if err != nil {
+		return nil, err
+	}
+	if err = r.update(content, version); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Load 读取配置节
+func (r *RemoteSource) Load(sectionName string, cfg any) (map[string]any, error) {
+	r.lock.RLock()
+	raw := r.doc.GetStringMap(sectionName)
+	r.lock.RUnlock()
+	return raw, decodeSection(raw, cfg)
+}
+
+// Watch 在后台监听配置变更，变更后回调，ctx结束时停止
+//
+//	回调中可重新调用 NewDb 创建连接并替换旧连接
+//
+//	@param ctx 上下文
+//	@param onChange 变更回调
+func (r *RemoteSource) Watch(ctx context.Context, onChange func()) {
+	go func() {
+		for ctx.Err() == nil {
+			r.lock.RLock()
+			last := r.version
+			r.lock.RUnlock()
+
+			content, version, err := r.backend.fetch(ctx, last, true)
+			if err != nil {
+				// 服务不可用时稍后重试
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+				}
+				continue
+			}
+			if version == last {
+				continue
+			}
+			if err = r.update(content, version); err == nil {
+				onChange()
+			}
+		}
+	}()
+}
+
+// update 解析并替换配置文档
+func (r *RemoteSource) update(content []byte, version string) error {
+	doc := viper.New()
+	doc.SetConfigType(r.format)
+	if err := doc.ReadConfig(bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("无法解析远程配置: %v", err)
+	}
+	r.lock.Lock()
+	r.doc = doc
+	r.version = version
+	r.lock.Unlock()
+	return nil
+}
+
+// remoteRequest 发送HTTP请求并返回响应
+func remoteRequest(ctx context.Context, method string, uri string, body io.Reader, header map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, data, nil
+}
+
+// consulBackend Consul KV
+type consulBackend struct {
+	opts RemoteOptions
+}
+
+// fetch 读取配置，使用 X-Consul-Index 阻塞查询
+func (c *consulBackend) fetch(ctx context.Context, last string, wait bool) ([]byte, string, error) {
+	uri := fmt.Sprintf("%s/v1/kv/%s?raw", strings.TrimRight(c.opts.Address, "/"), strings.TrimLeft(c.opts.Key, "/"))
+	if wait && last != "" {
+		uri += "&index=" + url.QueryEscape(last) + "&wait=5m"
+	}
+	header := map[string]string{}
+	if c.opts.Token != "" {
+		header["X-Consul-Token"] = c.opts.Token
+	}
+	resp, data, err := remoteRequest(ctx, http.MethodGet, uri, nil, header)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("consul kv %s: %s", c.opts.Key, resp.Status)
+	}
+	return data, resp.Header.Get("X-Consul-Index"), nil
+}
+
+// etcdBackend etcd v3 HTTP网关
+type etcdBackend struct {
+	opts  RemoteOptions
+	token string
+}
+
+// fetch 读取配置，使用 mod_revision 作为版本
+func (e *etcdBackend) fetch(ctx context.Context, last string, wait bool) ([]byte, string, error) {
+	if wait {
+		select {
+		case <-ctx.Done():
+			return nil, last, ctx.Err()
+		case <-time.After(e.opts.Interval):
+		}
+	}
+	addr := strings.TrimRight(e.opts.Address, "/")
+	if e.opts.Username != "" && e.token == "" {
+		if err := e.login(ctx, addr); err != nil {
+			return nil, "", err
+		}
+	}
+	body, _ := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(e.opts.Key))})
+	header := map[string]string{"Content-Type": "application/json"}
+	if e.token != "" {
+		header["Authorization"] = e.token
+	}
+	resp, data, err := remoteRequest(ctx, http.MethodPost, addr+"/v3/kv/range", bytes.NewReader(body), header)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		e.token = ""
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("etcd range %s: %s", e.opts.Key, resp.Status)
+	}
+	result := struct {
+		Kvs []struct {
+			Value       string `json:"value"`
+			ModRevision string `json:"mod_revision"`
+		} `json:"kvs"`
+	}{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, "", err
+	}
+	if len(result.Kvs) == 0 {
+		return nil, "", fmt.Errorf("etcd key %s not found", e.opts.Key)
+	}
+	content, err := base64.StdEncoding.DecodeString(result.Kvs[0].Value)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, result.Kvs[0].ModRevision, nil
+}
+
+// login 获取etcd认证令牌
+func (e *etcdBackend) login(ctx context.Context, addr string) error {
+	body, _ := json.Marshal(map[string]string{"name": e.opts.Username, "password": e.opts.Password})
+	resp, data, err := remoteRequest(ctx, http.MethodPost, addr+"/v3/auth/authenticate", bytes.NewReader(body),
+		map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("etcd authenticate: %s", resp.Status)
+	}
+	result := struct {
+		Token string `json:"token"`
+	}{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	e.token = result.Token
+	return nil
+}
+
+// nacosBackend Nacos配置中心
+type nacosBackend struct {
+	opts  RemoteOptions
+	token string
+}
+
+// fetch 读取配置，使用内容MD5作为版本，等待时通过监听接口长轮询
+func (n *nacosBackend) fetch(ctx context.Context, last string, wait bool) ([]byte, string, error) {
+	addr := strings.TrimRight(n.opts.Address, "/")
+	if n.opts.Username != "" && n.token == "" {
+		if err := n.login(ctx, addr); err != nil {
+			return nil, "", err
+		}
+	}
+	query := url.Values{}
+	if n.token != "" {
+		query.Set("accessToken", n.token)
+	}
+
+	if wait && last != "" {
+		listening := n.opts.Key + "\x02" + n.opts.Group + "\x02" + last
+		if n.opts.Namespace != "" {
+			listening += "\x02" + n.opts.Namespace
+		}
+		form := url.Values{"Listening-Configs": {listening + "\x01"}}
+		resp, data, err := remoteRequest(ctx, http.MethodPost, addr+"/nacos/v1/cs/configs/listener?"+query.Encode(),
+			strings.NewReader(form.Encode()), map[string]string{
+				"Content-Type":         "application/x-www-form-urlencoded",
+				"Long-Pulling-Timeout": "30000",
+			})
+		if err != nil {
+			return nil, "", err
+		}
+		if resp.StatusCode == http.StatusForbidden {
+			n.token = ""
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, "", fmt.Errorf("nacos listener %s: %s", n.opts.Key, resp.Status)
+		}
+		// 无变化时返回空
+		if len(strings.TrimSpace(string(data))) == 0 {
+			return nil, last, nil
+		}
+	}
+
+	query.Set("dataId", n.opts.Key)
+	query.Set("group", n.opts.Group)
+	if n.opts.Namespace != "" {
+		query.Set("tenant", n.opts.Namespace)
+	}
+	resp, data, err := remoteRequest(ctx, http.MethodGet, addr+"/nacos/v1/cs/configs?"+query.Encode(), nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		n.token = ""
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("nacos config %s: %s", n.opts.Key, resp.Status)
+	}
+	sum := md5.Sum(data)
+	return data, hex.EncodeToString(sum[:]), nil
+}
+
+// login 获取nacos访问令牌
+func (n *nacosBackend) login(ctx context.Context, addr string) error {
+	form := url.Values{"username": {n.opts.Username}, "password": {n.opts.Password}}
+	resp, data, err := remoteRequest(ctx, http.MethodPost, addr+"/nacos/v1/auth/login", strings.NewReader(form.Encode()),
+		map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("nacos login: %s", resp.Status)
+	}
+	result := struct {
+		AccessToken string `json:"accessToken"`
+	}{}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	n.token = result.AccessToken
+	return nil
+}
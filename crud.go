@@ -0,0 +1,434 @@
+package qdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// CrudAction 接口操作
+type CrudAction string
+
+const (
+	CrudList   CrudAction = "list"   // 分页查询
+	CrudGet    CrudAction = "get"    // 按唯一号查询
+	CrudCreate CrudAction = "create" // 新建
+	CrudUpdate CrudAction = "update" // 修改
+	CrudDelete CrudAction = "delete" // 删除
+)
+
+// CrudOptions 通用增删改查接口的选项
+type CrudOptions[T any] struct {
+	ReadOnly    bool                   // 只读，仅开放查询接口
+	Filters     map[string]FilterField // 允许过滤的字段，为空时允许JSON输出的全部列（不含 json:"-"），按字段名或列名引用
+	PageSize    int                    // 默认每页数量，为0使用20
+	MaxPageSize int                    // 最大每页数量，为0使用500
+	MaxBody     int64                  // 请求体最大字节数，为0使用1MB
+	// Authorize 请求级鉴权，在查询数据库之前调用，返回错误时拒绝并返回403，为空不鉴权
+	Authorize func(r *http.Request, action CrudAction) error
+	// Guard 记录级鉴权，查询、修改、删除时传入已存在的记录，新建时传入待新建的记录，返回错误时拒绝并返回403，为空不检查
+	Guard func(r *http.Request, action CrudAction, model *T) error
+	// Logf 日志方法，记录返回500的内部错误，响应中不包含错误详情，为空使用 log.Printf
+	Logf func(format string, args ...any)
+}
+
+// crudHandler 通用增删改查接口
+type crudHandler[T any] struct {
+	dao     *Dao[T]
+	opts    CrudOptions[T]
+	pk      *schema.Field
+	columns map[string]string
+	server  []*schema.Field // 由服务端维护的字段，忽略请求中的值
+	updates []string        // PUT 修改的列
+}
+
+// crudServerFields 由服务端维护的字段，包括主键之外的时间、操作人和所属对象
+var crudServerFields = map[string]bool{
+	"CreatedTime": true,
+	"LastTime":    true,
+	"CreatedBy":   true,
+	"UpdatedBy":   true,
+	"OwnerType":   true,
+	"OwnerId":     true,
+}
+
+// crudPage 分页查询的结果
+type crudPage[T any] struct {
+	List  []*T  `json:"list"`
+	Total int64 `json:"total"`
+}
+
+// NewCrudHandler 为Dao生成标准的 REST 增删改查接口，用于内部管理工具，不必为每个实体手写相同的处理函数
+//
+//	路由相对挂载位置，如 mux.Handle("/api/orders/", http.StripPrefix("/api/orders", h))：
+//	GET / 分页查询，参数 filter 为过滤表达式（参见 ParseFilter）、page 从1开始、pageSize、sort 如 Name asc,Id desc，返回 {"list":[],"total":0}；
+//	GET /{id} 查询；POST / 新建；PUT /{id} 将请求体覆盖到已有记录后修改全部可写字段，未提供的字段保持原值、提供的零值照常写入；
+//	PATCH /{id} 仅修改非零值字段；DELETE /{id} 删除。
+//	主键、CreatedTime、LastTime、CreatedBy、UpdatedBy、OwnerType、OwnerId 由服务端维护，请求中的值被忽略；json:"-" 的字段不会被修改。
+//	请求和响应均为JSON，错误返回 {"error":"..."}，数据库等内部错误为500且仅记录到日志，记录不存在为404，唯一键冲突为409，不允许的操作为405
+//
+//	@param dao 数据访问对象，操作经过其中间件和允许的操作类型检查
+//	@param opts 选项
+//	@return http.Handler
+func NewCrudHandler[T any](dao *Dao[T], opts CrudOptions[T]) http.Handler {
+	if opts.PageSize <= 0 {
+		opts.PageSize = 20
+	}
+	if opts.MaxPageSize <= 0 {
+		opts.MaxPageSize = 500
+	}
+	if opts.MaxBody <= 0 {
+		opts.MaxBody = 1 << 20
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	stmt := &gorm.Statement{DB: dao.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		panic(fmt.Sprintf("qdb: crud handler: %v", err))
+	}
+	h := &crudHandler[T]{dao: dao, opts: opts, pk: stmt.Schema.PrioritizedPrimaryField, columns: map[string]string{}}
+	if h.pk == nil {
+		panic(fmt.Sprintf("qdb: crud handler: %s has no primary key", stmt.Schema.Name))
+	}
+	// 不输出到JSON的列不允许排序，避免通过排序结果推断其内容
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName != "" && !crudHidden(f) {
+			h.columns[strings.ToLower(f.Name)] = f.DBName
+			h.columns[strings.ToLower(f.DBName)] = f.DBName
+		}
+	}
+	// PUT 只修改JSON可见的非服务端字段，最后操作时间和修改人由Dao写入
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		switch {
+		case f.PrimaryKey || crudServerFields[f.Name]:
+			h.server = append(h.server, f)
+			if f.Name == "LastTime" || f.Name == "UpdatedBy" {
+				h.updates = append(h.updates, f.DBName)
+			}
+		case f.Updatable && !crudHidden(f):
+			h.updates = append(h.updates, f.DBName)
+		}
+	}
+	if h.opts.Filters == nil {
+		h.opts.Filters = map[string]FilterField{}
+		for _, f := range stmt.Schema.Fields {
+			if f.DBName == "" || crudHidden(f) {
+				continue
+			}
+			field := FilterField{Column: f.DBName}
+			if f.FieldType == dateTimeType {
+				field.Convert = DateTimeValue
+			}
+			h.opts.Filters[f.Name] = field
+			h.opts.Filters[f.DBName] = field
+		}
+	}
+	return h
+}
+
+// ServeHTTP 按方法和路径分发请求
+func (h *crudHandler[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	var id uint64
+	if path != "" {
+		var err error
+		if id, err = strconv.ParseUint(path, 10, 64); err != nil || id == 0 {
+			crudError(w, http.StatusNotFound, "not found")
+			return
+		}
+	}
+	var action CrudAction
+	switch {
+	case r.Method == http.MethodGet && id == 0:
+		action = CrudList
+	case r.Method == http.MethodGet:
+		action = CrudGet
+	case r.Method == http.MethodPost && id == 0:
+		action = CrudCreate
+	case (r.Method == http.MethodPut || r.Method == http.MethodPatch) && id > 0:
+		action = CrudUpdate
+	case r.Method == http.MethodDelete && id > 0:
+		action = CrudDelete
+	default:
+		crudError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if h.opts.ReadOnly && action != CrudList && action != CrudGet {
+		crudError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if h.opts.Authorize != nil {
+		if err := h.opts.Authorize(r, action); err != nil {
+			crudError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	dao := h.dao.WithContext(r.Context())
+	var (
+		result any
+		err    error
+		status = http.StatusOK
+	)
+	switch action {
+	case CrudList:
+		result, err = h.list(dao, r)
+	case CrudGet:
+		result, err = h.get(dao, r, action, id)
+	case CrudCreate:
+		model := new(T)
+		if err = h.decode(r, model); err == nil {
+			h.reset(r.Context(), model, nil)
+			if err = h.guard(r, action, model); err == nil {
+				err = dao.Create(model)
+				result, status = model, http.StatusCreated
+			}
+		}
+	case CrudUpdate:
+		result, err = h.update(dao, r, id)
+	case CrudDelete:
+		if _, err = h.get(dao, r, action, id); err == nil {
+			err = dao.Delete(id)
+			status = http.StatusNoContent
+		}
+	}
+	if err != nil {
+		status = crudStatus(err)
+		msg := err.Error()
+		if status == http.StatusInternalServerError {
+			h.opts.Logf("qdb: crud %s %s %s: %v", h.dao.table, r.Method, r.URL.Path, err)
+			msg = http.StatusText(status)
+		}
+		crudError(w, status, msg)
+		return
+	}
+	crudWrite(w, status, result)
+}
+
+// list 分页查询
+func (h *crudHandler[T]) list(dao *Dao[T], r *http.Request) (any, error) {
+	q := r.URL.Query()
+	opts := FindOptions{Limit: h.opts.PageSize}
+	if s := q.Get("pageSize"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, crudBadRequest{fmt.Errorf("invalid pageSize %q", s)}
+		}
+		opts.Limit = n
+		if n > h.opts.MaxPageSize {
+			opts.Limit = h.opts.MaxPageSize
+		}
+	}
+	if s := q.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, crudBadRequest{fmt.Errorf("invalid page %q", s)}
+		}
+		opts.Offset = (n - 1) * opts.Limit
+	}
+	if expr := q.Get("filter"); expr != "" {
+		f, err := ParseFilter(expr, h.opts.Filters)
+		if err != nil {
+			return nil, crudBadRequest{err}
+		}
+		opts.Where, opts.Args = f.Query, f.Args
+	}
+	// 排序只允许模型的列
+	if s := q.Get("sort"); s != "" {
+		orders := make([]string, 0)
+		for _, part := range strings.Split(s, ",") {
+			words := strings.Fields(part)
+			if len(words) == 0 || len(words) > 2 {
+				return nil, crudBadRequest{fmt.Errorf("invalid sort %q", s)}
+			}
+			column, ok := h.columns[strings.ToLower(words[0])]
+			if !ok {
+				return nil, crudBadRequest{fmt.Errorf("unknown sort field %q", words[0])}
+			}
+			order := dao.db.Statement.Quote(column)
+			if len(words) == 2 {
+				switch strings.ToLower(words[1]) {
+				case "asc":
+				case "desc":
+					order += " DESC"
+				default:
+					return nil, crudBadRequest{fmt.Errorf("invalid sort %q", s)}
+				}
+			}
+			orders = append(orders, order)
+		}
+		opts.Order = strings.Join(orders, ", ")
+	}
+	list, total, err := dao.FindAndCount(opts)
+	if err != nil {
+		return nil, err
+	}
+	return crudPage[T]{List: list, Total: total}, nil
+}
+
+// get 查询已存在的记录并进行记录级鉴权
+func (h *crudHandler[T]) get(dao *Dao[T], r *http.Request, action CrudAction, id uint64) (*T, error) {
+	model, err := dao.GetModel(id)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, ErrNotFound
+	}
+	return model, h.guard(r, action, model)
+}
+
+// update 修改记录，PUT 在已有记录上覆盖请求中的字段后修改全部可写字段，PATCH 仅修改非零值字段
+func (h *crudHandler[T]) update(dao *Dao[T], r *http.Request, id uint64) (*T, error) {
+	existing, err := h.get(dao, r, CrudUpdate, id)
+	if err != nil {
+		return nil, err
+	}
+	put := r.Method == http.MethodPut
+	model := new(T)
+	if put {
+		*model = *existing
+	}
+	if err = h.decode(r, model); err != nil {
+		return nil, err
+	}
+	if put {
+		h.reset(r.Context(), model, existing)
+	} else {
+		h.reset(r.Context(), model, nil)
+	}
+	// 唯一号以路径为准
+	if err = h.pk.Set(r.Context(), reflect.ValueOf(model).Elem(), id); err != nil {
+		return nil, err
+	}
+	if err = h.guard(r, CrudUpdate, model); err != nil {
+		return nil, err
+	}
+	if put {
+		err = h.updateColumns(dao, model)
+	} else {
+		err = dao.Update(model)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dao.GetModel(id)
+}
+
+// updateColumns 按 PUT 可修改的列更新记录，包括零值
+func (h *crudHandler[T]) updateColumns(dao *Dao[T], model *T) error {
+	return dao.exec("UpdateAll", OpUpdate, func(op *Operation) error {
+		touch(op.Context(), model, now())
+		if len(h.updates) == 0 {
+			return nil
+		}
+		// 提交
+		result := rowPolicy[T](op.DB).Model(model).Select(h.updates).Updates(model)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUpdateNotExist
+		}
+		return nil
+	})
+}
+
+// decode 解析请求体到模型，未提供的字段保持原值
+func (h *crudHandler[T]) decode(r *http.Request, model *T) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, h.opts.MaxBody))
+	if err := dec.Decode(model); err != nil {
+		return crudBadRequest{fmt.Errorf("invalid body: %w", err)}
+	}
+	return nil
+}
+
+// reset 将服务端维护的字段恢复为已有记录的值，from 为空时清零，避免客户端写入主键、创建时间、所属对象等
+//
+//	最后操作时间总是清零，由Dao写入时重新填充
+func (h *crudHandler[T]) reset(ctx context.Context, model, from *T) {
+	rv := reflect.ValueOf(model).Elem()
+	for _, f := range h.server {
+		field := f.ReflectValueOf(ctx, rv)
+		if from == nil || f.Name == "LastTime" {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+		field.Set(f.ReflectValueOf(ctx, reflect.ValueOf(from).Elem()))
+	}
+}
+
+// guard 记录级鉴权
+func (h *crudHandler[T]) guard(r *http.Request, action CrudAction, model *T) error {
+	if h.opts.Guard == nil {
+		return nil
+	}
+	if err := h.opts.Guard(r, action, model); err != nil {
+		return crudForbidden{err}
+	}
+	return nil
+}
+
+// crudHidden 字段是否不输出到JSON
+func crudHidden(f *schema.Field) bool {
+	return f.Tag.Get("json") == "-"
+}
+
+// crudBadRequest 请求参数错误
+type crudBadRequest struct{ error }
+
+// crudForbidden 记录级鉴权失败
+type crudForbidden struct{ error }
+
+// crudStatus 错误对应的HTTP状态码
+func crudStatus(err error) int {
+	var bad crudBadRequest
+	var forbidden crudForbidden
+	switch {
+	case errors.As(err, &bad):
+		return http.StatusBadRequest
+	case errors.As(err, &forbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrUpdateNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOpNotAllowed):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrCircuitOpen):
+		return http.StatusServiceUnavailable
+	case IsDuplicateKey(err), errors.Is(err, ErrUniqueConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// crudWrite 写入JSON响应
+func crudWrite(w http.ResponseWriter, status int, v any) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// crudError 写入错误响应
+func crudError(w http.ResponseWriter, status int, msg string) {
+	crudWrite(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,136 @@
+package qdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type crudItem struct {
+	DbTracked
+	DbAudit
+	DbOwned
+	Name   string
+	Note   string
+	Count  int
+	Secret string `json:"-"`
+}
+
+// crudDo 发送请求并解析响应
+func crudDo(t *testing.T, h http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: %v: %s", method, path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func newCrudItem(t *testing.T) (*Dao[crudItem], http.Handler, *crudItem) {
+	t.Helper()
+	dao, err := TryNewDao[crudItem](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &crudItem{Name: "a", Note: "keep", Count: 5, Secret: "s"}
+	item.CreatedBy = "alice"
+	item.OwnerType, item.OwnerId = "order", 7
+	if err = dao.Create(item); err != nil {
+		t.Fatal(err)
+	}
+	return dao, NewCrudHandler(dao, CrudOptions[crudItem]{}), item
+}
+
+func TestCrudPut(t *testing.T) {
+	dao, h, item := newCrudItem(t)
+	path := "/" + strconv.FormatUint(item.Id, 10)
+	body := `{"Id":999,"Name":"b","Count":0,"CreatedBy":"mallory","UpdatedBy":"mallory","OwnerType":"user","OwnerId":99}`
+	var got crudItem
+	if code := crudDo(t, h, http.MethodPut, path, body, &got); code != http.StatusOK {
+		t.Fatalf("PUT: status %d", code)
+	}
+	stored, err := dao.GetModel(item.Id)
+	if err != nil || stored == nil {
+		t.Fatal(stored, err)
+	}
+	if stored.Name != "b" || stored.Count != 0 {
+		t.Errorf("sent fields not updated: %+v", stored)
+	}
+	if stored.Note != "keep" || stored.Secret != "s" {
+		t.Errorf("unsent or hidden fields zeroed: %+v", stored)
+	}
+	if stored.CreatedBy != "alice" || stored.UpdatedBy != "" || stored.OwnerType != "order" || stored.OwnerId != 7 {
+		t.Errorf("server fields taken from body: %+v", stored)
+	}
+	if stored.CreatedTime != item.CreatedTime || stored.LastTime == 0 {
+		t.Errorf("times: got %v/%v, created %v", stored.CreatedTime, stored.LastTime, item.CreatedTime)
+	}
+	if count, _ := dao.GetCount("id = ?", 999); count != 0 {
+		t.Error("PUT wrote body id")
+	}
+}
+
+func TestCrudPatch(t *testing.T) {
+	dao, h, item := newCrudItem(t)
+	path := "/" + strconv.FormatUint(item.Id, 10)
+	if code := crudDo(t, h, http.MethodPatch, path, `{"Name":"c","OwnerId":99}`, nil); code != http.StatusOK {
+		t.Fatalf("PATCH: status %d", code)
+	}
+	stored, err := dao.GetModel(item.Id)
+	if err != nil || stored == nil {
+		t.Fatal(stored, err)
+	}
+	if stored.Name != "c" || stored.Count != 5 || stored.Note != "keep" || stored.Secret != "s" || stored.OwnerId != 7 {
+		t.Errorf("PATCH: %+v", stored)
+	}
+}
+
+func TestCrudCreate(t *testing.T) {
+	_, h, item := newCrudItem(t)
+	body := `{"Id":` + strconv.FormatUint(item.Id, 10) + `,"Name":"new","CreatedBy":"mallory","OwnerType":"user","OwnerId":99}`
+	var got crudItem
+	if code := crudDo(t, h, http.MethodPost, "/", body, &got); code != http.StatusCreated {
+		t.Fatalf("POST: status %d", code)
+	}
+	if got.Id == 0 || got.Id == item.Id {
+		t.Errorf("POST used body id: %d", got.Id)
+	}
+	if got.Name != "new" || got.CreatedBy != "" || got.OwnerType != "" || got.OwnerId != 0 {
+		t.Errorf("POST: %+v", got)
+	}
+}
+
+func TestCrudListGetDelete(t *testing.T) {
+	_, h, item := newCrudItem(t)
+	path := "/" + strconv.FormatUint(item.Id, 10)
+	var page crudPage[crudItem]
+	if code := crudDo(t, h, http.MethodGet, "/?filter=Name%20eq%20'a'&sort=Id%20desc", "", &page); code != http.StatusOK {
+		t.Fatalf("list: status %d", code)
+	}
+	if page.Total != 1 || len(page.List) != 1 || page.List[0].Id != item.Id {
+		t.Errorf("list: %+v", page)
+	}
+	if code := crudDo(t, h, http.MethodGet, "/?sort=Secret", "", nil); code != http.StatusBadRequest {
+		t.Errorf("sort by hidden field: status %d", code)
+	}
+	var got crudItem
+	if code := crudDo(t, h, http.MethodGet, path, "", &got); code != http.StatusOK || got.Name != "a" || got.Secret != "" {
+		t.Errorf("get: status %d %+v", code, got)
+	}
+	if code := crudDo(t, h, http.MethodDelete, path, "", nil); code != http.StatusNoContent {
+		t.Errorf("delete: status %d", code)
+	}
+	if code := crudDo(t, h, http.MethodGet, path, "", nil); code != http.StatusNotFound {
+		t.Errorf("get deleted: status %d", code)
+	}
+	if code := crudDo(t, h, http.MethodPut, path, `{"Name":"x"}`, nil); code != http.StatusNotFound {
+		t.Errorf("put deleted: status %d", code)
+	}
+}
@@ -0,0 +1,86 @@
+package qdb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/kamioair/utils/qtime"
+)
+
+// 游标数据长度：id(8) + 时间(8) + 过滤条件摘要(8)
+const cursorDataLen = 24
+
+// 游标签名长度
+const cursorSignLen = 16
+
+// Cursor 分页游标
+type Cursor struct {
+	LastId   uint64         // 上一页最后一条记录的唯一号
+	LastTime qtime.DateTime // 上一页最后一条记录的时间
+}
+
+// EncodeCursor 将分页位置和过滤条件摘要打包为签名的不透明字符串
+//
+//	@param secret 签名密钥
+//	@param cursor 分页位置
+//	@param filters 本次查询的过滤条件，解码时须一致
+//	@return string, error
+func EncodeCursor(secret []byte, cursor Cursor, filters ...any) (string, error) {
+	hash, err := filterHash(filters)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, cursorDataLen, cursorDataLen+cursorSignLen)
+	binary.BigEndian.PutUint64(buf[0:8], cursor.LastId)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(cursor.LastTime))
+	copy(buf[16:24], hash)
+	buf = append(buf, cursorSign(secret, buf)...)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// DecodeCursor 校验签名和过滤条件并解出分页位置
+//
+//	@param secret 签名密钥
+//	@param token 游标字符串
+//	@param filters 本次查询的过滤条件，须与编码时一致
+//	@return Cursor, error 被篡改或条件不一致时返回 ErrInvalidCursor
+func DecodeCursor(secret []byte, token string, filters ...any) (Cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(buf) != cursorDataLen+cursorSignLen {
+		return Cursor{}, ErrInvalidCursor
+	}
+	data, sign := buf[:cursorDataLen], buf[cursorDataLen:]
+	if !hmac.Equal(sign, cursorSign(secret, data)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	hash, err := filterHash(filters)
+	if err != nil {
+		return Cursor{}, err
+	}
+	if !hmac.Equal(data[16:24], hash) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return Cursor{
+		LastId:   binary.BigEndian.Uint64(data[0:8]),
+		LastTime: qtime.DateTime(binary.BigEndian.Uint64(data[8:16])),
+	}, nil
+}
+
+// cursorSign 计算签名
+func cursorSign(secret []byte, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil)[:cursorSignLen]
+}
+
+// filterHash 计算过滤条件摘要
+func filterHash(filters []any) ([]byte, error) {
+	js, err := json.Marshal(filters)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(js)
+	return sum[:8], nil
+}
@@ -1,19 +1,20 @@
 package qdb
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/kamioair/utils/qconfig"
 	"github.com/kamioair/utils/qio"
-	"github.com/kamioair/utils/qreflect"
 	"github.com/kamioair/utils/qtime"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
+	"log"
 	"reflect"
 	"strings"
 	"time"
@@ -26,22 +27,54 @@ import (
 //	         sqlite|./db/data.db&OFF
 //	         sqlserver|用户名:密码@地址?database=数据库&encrypt=disable
 //	         mysql|用户名:密码@tcp(127.0.0.1:3306)/数据库?charset=utf8mb4&parseTime=True&loc=Local
+//	         mysql|用户名:密码@unix(/var/run/mysqld/mysqld.sock)/数据库
+//	         postgres|host=/var/run/postgresql user=用户名 password=密码 dbname=数据库
 func NewDb(sectionName string, defaultConn string) *gorm.DB {
-	cfg := initBaseConfig(defaultConn)
-	err := qconfig.LoadConfig(cfg.filePath, sectionName, cfg)
+	return NewDbWith(sectionName, defaultConn, nil)
+}
+
+// NewDbWith 创建DB，打开连接前可修改gorm配置
+//
+//	@param sectionName 配置节点名称
+//	@param defaultConn 数据库连接串，为空使用默认值，格式同 NewDb
+//	@param mutate 修改gorm配置的方法，如设置 DisableForeignKeyConstraintWhenMigrating、NowFunc、Plugins，为空不修改
+//	@return *gorm.DB
+func NewDbWith(sectionName string, defaultConn string, mutate func(gc *gorm.Config)) *gorm.DB {
+	cfg, err := loadSetting(sectionName, defaultConn, map[string]bool{})
 	if err != nil {
 		panic(err)
 	}
 
+	namer, err := newNamer(cfg.Config)
+	if err != nil {
+		panic(err)
+	}
 	gc := gorm.Config{
-		NamingStrategy: schema.NamingStrategy{
-			SingularTable: true,
-			NoLowerCase:   cfg.Config.NoLowerCase,
-		},
+		NamingStrategy:         namer,
 		SkipDefaultTransaction: cfg.Config.SkipDefaultTransaction,
+		NowFunc: func() time.Time {
+			if cfg.Config.UTC {
+				return now().UTC()
+			}
+			return now().Local()
+		},
 	}
 	if cfg.Config.OpenLog {
 		gc.Logger = logger.Default.LogMode(logger.Info)
+		// 输出到独立的日志文件
+		if cfg.Config.LogFile != "" {
+			w, err := openRotateWriter(cfg.Config.LogFile, cfg.Config.LogMaxSizeMB, cfg.Config.LogMaxAgeDays)
+			if err != nil {
+				panic(err)
+			}
+			gc.Logger = logger.New(log.New(w, "\r\n", log.LstdFlags), logger.Config{
+				SlowThreshold: 200 * time.Millisecond,
+				LogLevel:      logger.Info,
+			})
+		}
+	}
+	if mutate != nil {
+		mutate(&gc)
 	}
 	sp := strings.Split(cfg.Connect, "|")
 
@@ -75,13 +108,35 @@ func NewDb(sectionName string, defaultConn string) *gorm.DB {
 		}
 	case "mysql":
 		dsn := sp[1]
-		db, err = gorm.Open(mysql.Open(dsn), &gc)
+		if cfg.Config.UTC {
+			dsn = utcDSN(sp[0], dsn)
+		}
+		dialector := mysql.Open(dsn)
+		// SSH隧道
+		if cfg.SSH.Host != "" {
+			dialector, err = openTunnelDialector(sp[0], dsn, cfg.SSH)
+			if err != nil {
+				panic(err)
+			}
+		}
+		db, err = gorm.Open(dialector, &gc)
 		if err != nil {
 			panic(err)
 		}
 	case "postgres":
 		dsn := sp[1]
-		db, err = gorm.Open(postgres.Open(dsn), &gc)
+		if cfg.Config.UTC {
+			dsn = utcDSN(sp[0], dsn)
+		}
+		dialector := postgres.Open(dsn)
+		// SSH隧道
+		if cfg.SSH.Host != "" {
+			dialector, err = openTunnelDialector(sp[0], dsn, cfg.SSH)
+			if err != nil {
+				panic(err)
+			}
+		}
+		db, err = gorm.Open(dialector, &gc)
 		if err != nil {
 			panic(err)
 		}
@@ -89,6 +144,34 @@ func NewDb(sectionName string, defaultConn string) *gorm.DB {
 	if db == nil {
 		panic(errors.New("unknown db type"))
 	}
+	// mysql建表选项
+	if cfg.Config.TableCharset != "" || cfg.Config.TableCollation != "" || cfg.Config.TableEngine != "" {
+		plugin := tableOptionsPlugin{charset: cfg.Config.TableCharset, collation: cfg.Config.TableCollation, engine: cfg.Config.TableEngine}
+		if err = db.Use(plugin); err != nil {
+			panic(err)
+		}
+	}
+	// 查询行数检查及 Watch 通知钩子
+	if err = useMaxRows(db); err != nil {
+		panic(err)
+	}
+	if err = registerWatch(db); err != nil {
+		panic(err)
+	}
+	// UTC存储时间
+	if cfg.Config.UTC {
+		if err = db.Use(utcPlugin{}); err != nil {
+			panic(err)
+		}
+	}
+	// 慢查询记录
+	if cfg.Config.SlowThreshold > 0 {
+		threshold := time.Duration(cfg.Config.SlowThreshold) * time.Millisecond
+		retention := time.Duration(cfg.Config.SlowRetentionDays) * 24 * time.Hour
+		if err = EnableSlowLog(db, threshold, retention); err != nil {
+			panic(err)
+		}
+	}
 	return db
 }
 
@@ -104,23 +187,65 @@ type DbFull struct {
 	FullInfo string         // 其他扩展内容
 }
 
+// DbTracked 同时记录创建时间和最后操作时间的数据模型，创建时间仅在新增时写入
+type DbTracked struct {
+	Id          uint64         `gorm:"primaryKey"`      // 唯一号
+	CreatedTime qtime.DateTime `gorm:"index;<-:create"` // 创建时间
+	LastTime    qtime.DateTime `gorm:"index"`           // 最后操作时间时间
+}
+
 // DAO 通用数据访问对象
 type Dao[T any] struct {
-	db *gorm.DB
+	db    *gorm.DB
+	opts  daoOptions
+	table string       // 表名
+	mws   []Middleware // 中间件
+	stat  *resultStat  // 执行结果记录，仅 XxxResult 方法使用
 }
 
-// NewDao 创建Dao
-func NewDao[T any](db *gorm.DB) *Dao[T] {
+// NewDao 创建Dao，建表失败时返回nil，需要错误信息时使用 TryNewDao
+//
+//	@param db 数据库连接
+//	@param opts 可选项，如 WithDefaultOrder、WithDefaultScope
+//	@return *Dao[T]
+func NewDao[T any](db *gorm.DB, opts ...DaoOption) *Dao[T] {
+	dao, err := TryNewDao[T](db, opts...)
+	if err != nil {
+		return nil
+	}
+	return dao
+}
+
+// TryNewDao 创建Dao，建表失败时返回错误
+//
+//	@param db 数据库连接
+//	@param opts 可选项，如 WithDefaultOrder、WithDefaultScope
+//	@return *Dao[T], error
+func TryNewDao[T any](db *gorm.DB, opts ...DaoOption) (*Dao[T], error) {
 	// 主动创建数据库
 	m := new(T)
-	name := reflect.TypeOf(*m).Name()
-	if db.Migrator().HasTable(name) == false {
-		err := db.AutoMigrate(m)
+	dao := &Dao[T]{db: db, table: reflect.TypeOf(*m).Name()}
+	// 表名由命名策略生成，包含前缀等设置
+	if stmt := (&gorm.Statement{DB: db}); stmt.Parse(m) == nil {
+		dao.table = stmt.Schema.Table
+	}
+	if db.Migrator().HasTable(dao.table) == false {
+		err := migrateDB(db, m).AutoMigrate(m)
 		if err != nil {
-			return nil
+			return nil, err
 		}
 	}
-	return &Dao[T]{db: db}
+	for _, opt := range opts {
+		opt(&dao.opts)
+	}
+	// 回调在创建时注册，之后 MaxRows、Watch 等无需再修改连接
+	if err := useMaxRows(db); err != nil {
+		return nil, err
+	}
+	if err := registerWatch(db); err != nil {
+		return nil, err
+	}
+	return dao, nil
 }
 
 // DB 返回数据库连接
@@ -133,54 +258,241 @@ func (dao *Dao[T]) DB() *gorm.DB {
 //	@param model 待新增实体
 //	@return *T, error
 func (dao *Dao[T]) Create(model *T) error {
-	ref := qreflect.New(model)
-	if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-		_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
+	return dao.exec("Create", OpCreate, func(op *Operation) error {
+		touch(op.Context(), model, now())
+		// 提交
+		result := op.DB.Create(model)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+}
+
+// CreateOrGet 新建一条记录，唯一键冲突时返回已存在的记录，适用于并发注册等场景
+//
+//	@param model 待新增实体
+//	@param uniqueQuery 查询已存在记录的条件，如 code = ?
+//	@param args 条件参数
+//	@return *T 新建或已存在的记录, bool 是否新建, error
+func (dao *Dao[T]) CreateOrGet(model *T, uniqueQuery any, args ...any) (*T, bool, error) {
+	var exist *T
+	created := false
+	err := dao.exec("CreateOrGet", OpCreate, func(op *Operation) error {
+		touch(op.Context(), model, now())
+		result := op.DB.Create(model)
+		if result.Error == nil {
+			op.RowsAffected = result.RowsAffected
+			created = true
+			return nil
+		}
+		if !IsDuplicateKey(result.Error) {
+			return result.Error
+		}
+		// 冲突后查询已存在记录
+		m := new(T)
+		result = op.DB.Where(uniqueQuery, args...).Limit(1).Find(m)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		exist = m
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
 	}
-	// 提交
-	result := dao.DB().Create(model)
-	return result.Error
+	if created {
+		return model, true, nil
+	}
+	return exist, false, nil
 }
 
-// CreateList 创建一组列表
+// CreateList 创建一组列表，分批写入，生成的唯一号写回列表，失败时列表恢复为调用前的内容
 //
 //	@param list 待新增列表
 //	@return *T, error
 func (dao *Dao[T]) CreateList(list []T) error {
-	// 启动事务创建
-	err := dao.DB().Transaction(func(tx *gorm.DB) error {
+	return dao.createList("CreateList", pointers(list))
+}
+
+// CreateListP 创建一组列表，生成的唯一号写回各实体，失败时各实体恢复为调用前的内容
+//
+//	@param list 待新增列表
+//	@return error
+func (dao *Dao[T]) CreateListP(list []*T) error {
+	return dao.createList("CreateListP", list)
+}
+
+// createList 在事务中分批创建，生成的唯一号写回各实体
+func (dao *Dao[T]) createList(name string, list []*T) error {
+	return dao.exec(name, OpCreate, func(op *Operation) error {
+		if len(list) == 0 {
+			return nil
+		}
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		// 事务回滚后恢复各实体，不保留生成的唯一号和写入的时间，以便逐条重试
+		origin := make([]T, len(list))
+		for i, model := range list {
+			origin[i] = *model
+		}
+		ts := now()
 		for _, model := range list {
-			ref := qreflect.New(model)
-			if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-				_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
+			touch(op.Context(), model, ts)
+		}
+		// 启动事务创建
+		err := trackedTx(op.DB, func(tx *gorm.DB) error {
+			pk := stmt.Schema.PrioritizedPrimaryField
+			if pk == nil {
+				result := tx.CreateInBatches(list, batchSize(stmt.Schema))
+				op.RowsAffected += result.RowsAffected
+				return result.Error
 			}
-			if err := tx.Create(&model).Error; err != nil {
+			inserts, explicit := splitByPk(op.Context(), pk, list)
+			if err := createBatches(tx, op, stmt.Schema, inserts); err != nil {
 				return err
 			}
+			if len(explicit) > 0 {
+				result := tx.CreateInBatches(explicit, batchSize(stmt.Schema))
+				op.RowsAffected += result.RowsAffected
+				return result.Error
+			}
+			return nil
+		}, 1)
+		if err != nil {
+			for i, model := range list {
+				*model = origin[i]
+			}
+			op.RowsAffected = 0
 		}
-		return nil
+		return err
 	})
-	return err
 }
 
-// Update 修改一条记录
+// createBatches 分批新增主键为空的记录，无法取得全部生成的唯一号时逐条新增
+func createBatches[T any](tx *gorm.DB, op *Operation, sch *schema.Schema, list []*T) error {
+	if len(list) == 0 {
+		return nil
+	}
+	if !batchIds(tx, sch.PrioritizedPrimaryField) {
+		for _, model := range list {
+			if err := tx.Create(model).Error; err != nil {
+				return err
+			}
+			op.RowsAffected++
+		}
+		return nil
+	}
+	result := tx.CreateInBatches(list, batchSize(sch))
+	op.RowsAffected += result.RowsAffected
+	return result.Error
+}
+
+// Update 修改一条记录，仅更新非零值字段，需要清空字段时使用 UpdateAll
 //
 //	@param model 待更新实体
 //	@return *T, error
 func (dao *Dao[T]) Update(model *T) error {
-	ref := qreflect.New(model)
-	if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-		_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
-	}
-	// 提交
-	result := dao.DB().Model(model).Updates(model)
-	if result.RowsAffected > 0 {
+	return dao.exec("Update", OpUpdate, func(op *Operation) error {
+		dao.touchUpdate(op.Context(), model, now())
+		// 提交
+		result := rowPolicy[T](op.DB).Model(model).Updates(model)
+		op.RowsAffected = result.RowsAffected
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return ErrUpdateNotExist
+	})
+}
+
+// UpdateAll 修改一条记录的所有字段，包括空字符串、0、false等零值
+//
+//	@param model 待更新实体
+//	@return error 记录不存在返回 ErrUpdateNotExist
+func (dao *Dao[T]) UpdateAll(model *T) error {
+	return dao.exec("UpdateAll", OpUpdate, func(op *Operation) error {
+		dao.touchUpdate(op.Context(), model, now())
+		// 提交
+		result := rowPolicy[T](op.DB).Model(model).Select("*").Updates(model)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUpdateNotExist
+		}
 		return nil
-	}
-	if result.Error != nil {
+	})
+}
+
+// UpdateStrict 修改一条记录，未修改任何行时区分记录不存在和内容无变化
+//
+//	注意：仅mysql等按实际变更行数返回的驱动会出现无变化的情况，sqlite、postgres按匹配行数返回
+//
+//	@param model 待更新实体
+//	@return error 记录不存在返回 ErrUpdateNotExist，内容无变化返回 ErrNoChanges
+func (dao *Dao[T]) UpdateStrict(model *T) error {
+	return dao.exec("UpdateStrict", OpUpdate, func(op *Operation) error {
+		return dao.updateChecked(op, model, ErrNoChanges)
+	})
+}
+
+// UpdateLoose 修改一条记录，记录存在但内容无变化时视为成功
+//
+//	@param model 待更新实体
+//	@return error 记录不存在返回 ErrUpdateNotExist
+func (dao *Dao[T]) UpdateLoose(model *T) error {
+	return dao.exec("UpdateLoose", OpUpdate, func(op *Operation) error {
+		return dao.updateChecked(op, model, nil)
+	})
+}
+
+// updateChecked 修改记录，未修改任何行时检查记录是否存在
+func (dao *Dao[T]) updateChecked(op *Operation, model *T, unchanged error) error {
+	dao.touchUpdate(op.Context(), model, now())
+	result := rowPolicy[T](op.DB).Model(model).Updates(model)
+	op.RowsAffected = result.RowsAffected
+	if result.Error != nil || result.RowsAffected > 0 {
 		return result.Error
 	}
-	return errors.New("update record does not exist")
+	exist, err := dao.exists(rowPolicy[T](op.DB), model)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return ErrUpdateNotExist
+	}
+	return unchanged
+}
+
+// exists 按主键判断记录是否存在
+func (dao *Dao[T]) exists(db *gorm.DB, model *T) (bool, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return false, err
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rv := reflect.ValueOf(model).Elem()
+	query := db.Model(new(T))
+	for _, field := range stmt.Schema.PrimaryFields {
+		value, zero := field.ValueOf(ctx, rv)
+		if zero {
+			return false, nil
+		}
+		query = query.Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: value})
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
 }
 
 // UpdateList 修改一组记录
@@ -188,19 +500,33 @@ func (dao *Dao[T]) Update(model *T) error {
 //	@param list 待更新列表
 //	@return *T, error
 func (dao *Dao[T]) UpdateList(list []T) error {
-	err := dao.DB().Transaction(func(tx *gorm.DB) error {
-		for _, model := range list {
-			ref := qreflect.New(model)
-			if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-				_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
-			}
-			if err := tx.Updates(&model).Error; err != nil {
-				return err
+	return dao.updateList("UpdateList", pointers(list))
+}
+
+// UpdateListP 修改一组记录，更新后的时间写回各实体
+//
+//	@param list 待更新列表
+//	@return error
+func (dao *Dao[T]) UpdateListP(list []*T) error {
+	return dao.updateList("UpdateListP", list)
+}
+
+// updateList 在事务中逐条修改
+func (dao *Dao[T]) updateList(name string, list []*T) error {
+	return dao.exec(name, OpUpdate, func(op *Operation) error {
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			ts := now()
+			for _, model := range list {
+				dao.touchUpdate(op.Context(), model, ts)
+				result := rowPolicy[T](tx).Updates(model)
+				if result.Error != nil {
+					return result.Error
+				}
+				op.RowsAffected += result.RowsAffected
 			}
-		}
-		return nil
+			return nil
+		}, 1)
 	})
-	return err
 }
 
 // Save 修改一条记录（不存在则新增）
@@ -208,33 +534,96 @@ func (dao *Dao[T]) UpdateList(list []T) error {
 //	@param model 待保存实体
 //	@return *T, error
 func (dao *Dao[T]) Save(model *T) error {
-	ref := qreflect.New(model)
-	if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-		_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
-	}
-	// 提交
-	result := dao.DB().Save(model)
-	return result.Error
+	return dao.exec("Save", OpCreate|OpUpdate, func(op *Operation) error {
+		dao.touchUpdate(op.Context(), model, now())
+		// 提交
+		result := dao.save(op.DB, model)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
 }
 
 // SaveList 修改一组记录（不存在则新增）
 //
+//	支持冲突时更新的数据库按批使用单条语句写入，主键为空的记录直接新增
+//
 //	@param list 待保存列表
 //	@return *T, error
 func (dao *Dao[T]) SaveList(list []T) error {
-	err := dao.DB().Transaction(func(tx *gorm.DB) error {
+	return dao.saveList("SaveList", pointers(list))
+}
+
+// SaveListP 修改一组记录（不存在则新增），生成的唯一号写回各实体
+//
+//	@param list 待保存列表
+//	@return error
+func (dao *Dao[T]) SaveListP(list []*T) error {
+	return dao.saveList("SaveListP", list)
+}
+
+// saveList 保存一组记录
+func (dao *Dao[T]) saveList(name string, list []*T) error {
+	return dao.exec(name, OpCreate|OpUpdate, func(op *Operation) error {
+		if len(list) == 0 {
+			return nil
+		}
+		// 冲突时更新无法附加行过滤条件，有策略时逐条保存
+		if info, err := ServerInfo(op.DB); err != nil || !info.Supports(FeatureUpsert) || hasRowPolicy[T]() {
+			return dao.saveEach(op, list)
+		}
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		pk := stmt.Schema.PrioritizedPrimaryField
+		if pk == nil {
+			return dao.saveEach(op, list)
+		}
+
+		ts := now()
 		for _, model := range list {
-			ref := qreflect.New(model)
-			if ref.Get("LastTime") == "0001-01-01 00:00:00" {
-				_ = ref.Set("LastTime", qtime.NewDateTime(time.Now()))
-			}
-			if err := tx.Save(&model).Error; err != nil {
+			dao.touchUpdate(op.Context(), model, ts)
+		}
+		inserts, upserts := splitByPk(op.Context(), pk, list)
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			if err := createBatches(tx, op, stmt.Schema, inserts); err != nil {
 				return err
 			}
+			if len(upserts) > 0 {
+				result := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(upserts, batchSize(stmt.Schema))
+				if result.Error != nil {
+					return result.Error
+				}
+				op.RowsAffected += result.RowsAffected
+			}
+			return nil
+		}, 1)
+	})
+}
+
+// saveEach 逐条保存，用于不支持冲突时更新的数据库
+func (dao *Dao[T]) saveEach(op *Operation, list []*T) error {
+	return trackedTx(op.DB, func(tx *gorm.DB) error {
+		ts := now()
+		for _, model := range list {
+			dao.touchUpdate(op.Context(), model, ts)
+			result := dao.save(tx, model)
+			if result.Error != nil {
+				return result.Error
+			}
+			op.RowsAffected += result.RowsAffected
 		}
 		return nil
-	})
-	return err
+	}, 1)
+}
+
+// pointers 返回指向列表各元素的指针，用于写回生成的数据
+func pointers[T any](list []T) []*T {
+	ptrs := make([]*T, len(list))
+	for i := range list {
+		ptrs[i] = &list[i]
+	}
+	return ptrs
 }
 
 // Delete 删除一条记录
@@ -242,18 +631,123 @@ func (dao *Dao[T]) SaveList(list []T) error {
 //	@param id 唯一号
 //	@return *T, error
 func (dao *Dao[T]) Delete(id uint64) error {
-	result := dao.DB().Where("id = ?", id).Delete(new(T))
-	return result.Error
+	return dao.exec("Delete", OpDelete, func(op *Operation) error {
+		var result *gorm.DB
+		if sql := dao.cachedSQL(op.DB, "Delete"); sql != "" {
+			result = op.DB.Exec(sql, id)
+		} else {
+			result = rowPolicy[T](op.DB).Where("id = ?", id).Delete(new(T))
+		}
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
 }
 
 // DeleteCondition 自定义条件删除数据
 //
-//	@param condition 条件，如 id = ? 或 id IN (?) 等
+//	@param condition 条件，如 id = ? 或 id IN (?) 等，为空时须使用 AllowFullTableDelete 选项
 //	@param args 条件参数，如 id, ids 等
 //	@return error
 func (dao *Dao[T]) DeleteCondition(condition string, args ...any) error {
-	result := dao.DB().Where(condition, args...).Delete(new(T))
-	return result.Error
+	return dao.exec("DeleteCondition", OpDelete, func(op *Operation) error {
+		db := op.DB
+		if isFullCondition(condition) {
+			if !dao.opts.allowDelete {
+				return ErrFullTableDelete
+			}
+			db = db.Session(&gorm.Session{AllowGlobalUpdate: true})
+			if strings.TrimSpace(condition) == "" {
+				condition = "1 = 1"
+			}
+		}
+		result := rowPolicy[T](db).Where(condition, args...).Delete(new(T))
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+}
+
+// 批量删除每批之间的停顿时间
+var batchPause = 20 * time.Millisecond
+
+// DeleteConditionBatched 按批次删除数据，每批之间短暂停顿，避免长时间锁表和大事务
+//
+//	@param batchSize 每批删除数量
+//	@param condition 条件，如 id = ? 或 id IN (?) 等，为空时须使用 AllowFullTableDelete 选项
+//	@param args 条件参数，如 id, ids 等
+//	@return int64 删除总数, error
+func (dao *Dao[T]) DeleteConditionBatched(batchSize int, condition string, args ...any) (int64, error) {
+	if batchSize <= 0 {
+		return 0, errors.New("batch size must be greater than 0")
+	}
+	var stat resultStat
+	err := dao.track(&stat).exec("DeleteConditionBatched", OpDelete, func(op *Operation) error {
+		if isFullCondition(condition) {
+			if !dao.opts.allowDelete {
+				return ErrFullTableDelete
+			}
+			condition = "1 = 1"
+		}
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		if stmt.Schema.PrioritizedPrimaryField == nil {
+			return fmt.Errorf("%s has no primary key", dao.table)
+		}
+		pk := clause.Column{Name: stmt.Schema.PrioritizedPrimaryField.DBName}
+
+		for {
+			// 先查出一批主键再删除，兼容不支持 DELETE ... LIMIT 的数据库
+			ids := make([]any, 0, batchSize)
+			if err := rowPolicy[T](op.DB).Model(new(T)).Where(condition, args...).Limit(batchSize).Pluck(pk.Name, &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				return nil
+			}
+			result := rowPolicy[T](op.DB).Where(clause.IN{Column: pk, Values: ids}).Delete(new(T))
+			if result.Error != nil {
+				return result.Error
+			}
+			op.RowsAffected += result.RowsAffected
+			if len(ids) < batchSize {
+				return nil
+			}
+			select {
+			case <-op.Context().Done():
+				return op.Context().Err()
+			case <-time.After(batchPause):
+			}
+		}
+	})
+	return stat.RowsAffected, err
+}
+
+// Truncate 清空表中所有数据，sqlite使用DELETE实现
+//
+//	@return error 模型注册了行过滤策略时返回 ErrOpNotAllowed，使用 DeleteCondition 删除可见的行
+func (dao *Dao[T]) Truncate() error {
+	return dao.exec("Truncate", OpDelete, func(op *Operation) error {
+		if hasRowPolicy[T]() {
+			return fmt.Errorf("%w: truncate on %s with row policy", ErrOpNotAllowed, dao.table)
+		}
+		sql := "TRUNCATE TABLE ?"
+		if op.DB.Dialector.Name() == "sqlite" {
+			sql = "DELETE FROM ?"
+		}
+		result := op.DB.Exec(sql, clause.Table{Name: dao.table})
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+}
+
+// isFullCondition 判断是否为匹配全表的条件
+func isFullCondition(condition string) bool {
+	switch strings.ToLower(strings.ReplaceAll(condition, " ", "")) {
+	case "", "1=1", "true", "1":
+		return true
+	}
+	return false
 }
 
 // GetModel 获取一条记录
@@ -261,30 +755,89 @@ func (dao *Dao[T]) DeleteCondition(condition string, args ...any) error {
 //	@param id 唯一号
 //	@return *T, error
 func (dao *Dao[T]) GetModel(id uint64) (*T, error) {
-	// 创建空对象
-	model := new(T)
-	// 查询
-	result := dao.DB().Where("id = ?", id).Find(model)
-	// 如果异常或者未查询到任何数据
-	if result.Error != nil || result.RowsAffected == 0 {
-		return nil, result.Error
+	if dao.opts.singleFlight {
+		return getShared(dao, fmt.Sprintf("GetModel:%d", id), func() (*T, error) {
+			return dao.getModel(id)
+		})
+	}
+	return dao.getModel(id)
+}
+
+// getModel 获取一条记录
+func (dao *Dao[T]) getModel(id uint64) (*T, error) {
+	var model *T
+	err := dao.exec("GetModel", OpRead, func(op *Operation) error {
+		// 创建空对象
+		m := new(T)
+		// 查询
+		result := dao.findById(op.DB, id, m)
+		op.RowsAffected = result.RowsAffected
+		// 如果异常或者未查询到任何数据
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		model = m
+		return nil
+	})
+	return model, err
+}
+
+// findById 按唯一号查询，可缓存时使用缓存的语句，仍经过查询回调链，AfterFind 等钩子和插件照常执行
+func (dao *Dao[T]) findById(db *gorm.DB, id uint64, model *T) *gorm.DB {
+	if sql := dao.cachedSQL(db, "GetModel"); sql != "" {
+		return db.Raw(sql, id).Find(model)
 	}
-	return model, nil
+	return dao.query(db).Where("id = ?", id).Find(model)
 }
 
-// CheckExist 验证数据是否存在
+// CheckExist 验证数据是否存在，查询失败时返回false，需要区分时使用 Exists
 //
 //	@return []*T, error
 func (dao *Dao[T]) CheckExist(id uint64) bool {
-	// 创建空对象
-	model := new(T)
-	// 查询
-	result := dao.DB().Where("id = ?", id).Find(model)
-	// 如果异常或者未查询到任何数据
-	if result.Error != nil || result.RowsAffected == 0 {
-		return false
+	exist := false
+	_ = dao.exec("CheckExist", OpRead, func(op *Operation) error {
+		// 创建空对象
+		model := new(T)
+		// 查询
+		result := dao.findById(op.DB, id, model)
+		op.RowsAffected = result.RowsAffected
+		// 如果异常或者未查询到任何数据
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		exist = true
+		return nil
+	})
+	return exist
+}
+
+// ExistIds 批量验证数据是否存在，每1000个唯一号查询一次
+//
+//	@param ids 唯一号列表
+//	@return map[uint64]bool 每个唯一号是否存在, error
+func (dao *Dao[T]) ExistIds(ids []uint64) (map[uint64]bool, error) {
+	exist := make(map[uint64]bool, len(ids))
+	for _, id := range ids {
+		exist[id] = false
 	}
-	return true
+	err := dao.exec("ExistIds", OpRead, func(op *Operation) error {
+		for i := 0; i < len(ids); i += 1000 {
+			end := i + 1000
+			if end > len(ids) {
+				end = len(ids)
+			}
+			found := make([]uint64, 0, end-i)
+			if err := dao.query(op.DB).Model(new(T)).Where("id IN ?", ids[i:end]).Pluck("id", &found).Error; err != nil {
+				return err
+			}
+			for _, id := range found {
+				exist[id] = true
+			}
+			op.RowsAffected += int64(len(found))
+		}
+		return nil
+	})
+	return exist, err
 }
 
 // GetList 查询一组列表
@@ -294,12 +847,13 @@ func (dao *Dao[T]) CheckExist(id uint64) bool {
 //	@return []*T, error
 func (dao *Dao[T]) GetList(startId uint64, maxCount int) ([]*T, error) {
 	list := make([]*T, 0)
-	// 查询
-	result := dao.DB().Limit(maxCount).Offset(int(startId)).Find(&list)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return list, result.Error
-	}
-	return list, nil
+	err := dao.exec("GetList", OpRead, func(op *Operation) error {
+		// 查询
+		result := dao.list(op.DB).Limit(maxCount).Offset(int(startId)).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
 }
 
 // GetAll 返回所有列表
@@ -307,12 +861,13 @@ func (dao *Dao[T]) GetList(startId uint64, maxCount int) ([]*T, error) {
 //	@return []*T, error
 func (dao *Dao[T]) GetAll() ([]*T, error) {
 	list := make([]*T, 0)
-	// 查询
-	result := dao.DB().Find(&list)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return list, result.Error
-	}
-	return list, nil
+	err := dao.exec("GetAll", OpRead, func(op *Operation) error {
+		// 查询
+		result := dao.list(op.DB).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
 }
 
 // GetCondition 条件查询一条记录
@@ -321,13 +876,19 @@ func (dao *Dao[T]) GetAll() ([]*T, error) {
 //	@param args 条件参数，如 id, ids 等
 //	@return *T, error
 func (dao *Dao[T]) GetCondition(query interface{}, args ...interface{}) (*T, error) {
-	model := new(T)
-	// 查询
-	result := dao.DB().Where(query, args...).Find(model)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return nil, result.Error
-	}
-	return model, nil
+	var model *T
+	err := dao.exec("GetCondition", OpRead, func(op *Operation) error {
+		m := new(T)
+		// 查询
+		result := dao.query(op.DB).Where(query, args...).Find(m)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		model = m
+		return nil
+	})
+	return model, err
 }
 
 // GetConditionOrder 条件查询一条记录
@@ -337,13 +898,19 @@ func (dao *Dao[T]) GetCondition(query interface{}, args ...interface{}) (*T, err
 //	@param args 条件参数，如 id, ids 等
 //	@return *T, error
 func (dao *Dao[T]) GetConditionOrder(order string, query interface{}, args ...interface{}) (*T, error) {
-	model := new(T)
-	// 查询
-	result := dao.DB().Order(order).Where(query, args...).Find(model)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return nil, result.Error
-	}
-	return model, nil
+	var model *T
+	err := dao.exec("GetConditionOrder", OpRead, func(op *Operation) error {
+		m := new(T)
+		// 查询
+		result := dao.query(op.DB).Order(order).Where(query, args...).Find(m)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		model = m
+		return nil
+	})
+	return model, err
 }
 
 // GetConditions 条件查询一组列表
@@ -353,12 +920,13 @@ func (dao *Dao[T]) GetConditionOrder(order string, query interface{}, args ...in
 //	@return []*T, error
 func (dao *Dao[T]) GetConditions(query interface{}, args ...interface{}) ([]*T, error) {
 	list := make([]*T, 0)
-	// 查询
-	result := dao.DB().Where(query, args...).Find(&list)
-	if result.Error != nil || result.RowsAffected == 0 {
-		return list, result.Error
-	}
-	return list, nil
+	err := dao.exec("GetConditions", OpRead, func(op *Operation) error {
+		// 查询
+		result := dao.list(op.DB).Where(query, args...).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
 }
 
 // GetConditionsOrder 条件查询一组列表（自定义排序）
@@ -369,19 +937,13 @@ func (dao *Dao[T]) GetConditions(query interface{}, args ...interface{}) ([]*T,
 //	@return []*T, error
 func (dao *Dao[T]) GetConditionsOrder(order string, query interface{}, args ...interface{}) ([]*T, error) {
 	list := make([]*T, 0)
-	// 查询
-	if order == "" {
-		result := dao.DB().Where(query, args...).Find(&list)
-		if result.Error != nil || result.RowsAffected == 0 {
-			return list, result.Error
-		}
-	} else {
-		result := dao.DB().Order(order).Where(query, args...).Find(&list)
-		if result.Error != nil || result.RowsAffected == 0 {
-			return list, result.Error
-		}
-	}
-	return list, nil
+	err := dao.exec("GetConditionsOrder", OpRead, func(op *Operation) error {
+		// 查询
+		result := dao.listOrder(op.DB, order).Where(query, args...).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
 }
 
 // GetConditionsLimit 条件查询一组列表（限制数量）
@@ -392,31 +954,113 @@ func (dao *Dao[T]) GetConditionsOrder(order string, query interface{}, args ...i
 //	@return []*T, error
 func (dao *Dao[T]) GetConditionsLimit(maxCount int, query interface{}, args ...interface{}) ([]*T, error) {
 	list := make([]*T, 0)
-	// 查询
-	if maxCount > 0 {
-		result := dao.DB().Where(query, args...).Limit(maxCount).Find(&list)
-		if result.Error != nil || result.RowsAffected == 0 {
-			return list, result.Error
+	err := dao.exec("GetConditionsLimit", OpRead, func(op *Operation) error {
+		// 查询
+		db := dao.list(op.DB).Where(query, args...)
+		if maxCount > 0 {
+			db = db.Limit(maxCount)
 		}
-	} else {
-		result := dao.DB().Where(query, args...).Find(&list)
-		if result.Error != nil || result.RowsAffected == 0 {
-			return list, result.Error
+		result := db.Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// GetConditionsLimitSkipLocked 条件查询一组列表并加行锁，跳过已被其他事务锁定的行，需在事务中使用
+//
+//	用于多个工作者从任务表中领取互不重叠的记录，sqlserver 使用 UPDLOCK, READPAST 实现，不支持的数据库返回 ErrUnsupported
+//
+//	@param maxCount 最大数量
+//	@param query 条件，如 status = ?
+//	@param args 条件参数
+//	@return []*T, error
+func (dao *Dao[T]) GetConditionsLimitSkipLocked(maxCount int, query interface{}, args ...interface{}) ([]*T, error) {
+	list := make([]*T, 0)
+	err := dao.exec("GetConditionsLimitSkipLocked", OpRead, func(op *Operation) error {
+		if err := RequireFeature(op.DB, FeatureSkipLocked); err != nil {
+			return err
 		}
-	}
-	return list, nil
+		db := skipLocked(dao.list(op.DB).Where(query, args...))
+		if maxCount > 0 {
+			db = db.Limit(maxCount)
+		}
+		result := db.Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
 }
 
 // GetCount 获取总记录数
 //
 //	@param query 条件，如 id = ? 或 id IN (?) 等
 //	@param args 条件参数，如 id, ids 等
-//	@return int64
-func (dao *Dao[T]) GetCount(query interface{}, args ...interface{}) int64 {
-	// 创建空对象
-	model := new(T)
-	// 查询
+//	@return int64, error
+func (dao *Dao[T]) GetCount(query interface{}, args ...interface{}) (int64, error) {
+	var count int64
+	err := dao.exec("GetCount", OpRead, func(op *Operation) error {
+		// 创建空对象
+		model := new(T)
+		// 查询
+		return dao.query(op.DB).Model(model).Where(query, args...).Count(&count).Error
+	})
+	return count, err
+}
+
+// CountDistinct 获取指定列不重复值的数量
+//
+//	@param column 列名
+//	@param query 条件，如 status = ?，为空不限制
+//	@param args 条件参数
+//	@return int64, error
+func (dao *Dao[T]) CountDistinct(column string, query interface{}, args ...interface{}) (int64, error) {
 	var count int64
-	dao.DB().Model(model).Where(query, args...).Count(&count)
-	return count
+	err := dao.exec("CountDistinct", OpRead, func(op *Operation) error {
+		db := dao.query(op.DB).Model(new(T))
+		if query != nil && query != "" {
+			db = db.Where(query, args...)
+		}
+		return db.Distinct(column).Count(&count).Error
+	})
+	return count, err
+}
+
+// CountGroupBy 按指定列分组获取各值的数量，值转换为字符串作为键，NULL的键为空字符串
+//
+//	@param column 列名
+//	@param query 条件，如 status = ?，为空不限制
+//	@param args 条件参数
+//	@return map[string]int64, error
+func (dao *Dao[T]) CountGroupBy(column string, query interface{}, args ...interface{}) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := dao.exec("CountGroupBy", OpRead, func(op *Operation) error {
+		db := dao.query(op.DB).Model(new(T))
+		if query != nil && query != "" {
+			db = db.Where(query, args...)
+		}
+		col := clause.Column{Name: column}
+		rows, err := db.Select("?, COUNT(*)", col).Group(op.DB.Statement.Quote(col)).Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var key any
+			var count int64
+			if err = rows.Scan(&key, &count); err != nil {
+				return err
+			}
+			if b, ok := key.([]byte); ok {
+				key = string(b)
+			}
+			if key == nil {
+				key = ""
+			}
+			counts[fmt.Sprint(key)] += count
+			op.RowsAffected++
+		}
+		return rows.Err()
+	})
+	return counts, err
 }
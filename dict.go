@@ -0,0 +1,228 @@
+package qdb
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DbDict 字典项，用于下拉框、状态码等参考数据，同一类型下编码唯一
+type DbDict struct {
+	DbSimple
+	Type     string `gorm:"size:64;uniqueIndex:,composite:code"` // 字典类型，如 OrderStatus
+	Code     string `gorm:"size:64;uniqueIndex:,composite:code"` // 编码
+	Value    string `gorm:"size:255"`                            // 值
+	Display  string `gorm:"size:255"`                            // 默认显示名称
+	Displays string `gorm:"size:2000"`                           // 多语言显示名称，JSON，如 {"en":"Paid"}
+	Sort     int    // 排序，升序
+	Enabled  Bool   // 是否启用，查询只返回启用的项
+}
+
+// TableName 表名
+func (DbDict) TableName() string {
+	return "qdb_dict"
+}
+
+// DisplayIn 返回指定语言的显示名称，未配置时返回默认显示名称
+//
+//	@param lang 语言，如 en、zh-CN，为空返回默认显示名称
+//	@return string
+func (d *DbDict) DisplayIn(lang string) string {
+	if lang == "" || d.Displays == "" {
+		return d.Display
+	}
+	displays := map[string]string{}
+	if json.Unmarshal([]byte(d.Displays), &displays) == nil {
+		if v, ok := displays[lang]; ok && v != "" {
+			return v
+		}
+	}
+	return d.Display
+}
+
+// SetDisplayIn 设置指定语言的显示名称
+//
+//	@param lang 语言，如 en
+//	@param display 显示名称
+func (d *DbDict) SetDisplayIn(lang string, display string) {
+	displays := map[string]string{}
+	_ = json.Unmarshal([]byte(d.Displays), &displays)
+	displays[lang] = display
+	js, _ := json.Marshal(displays)
+	d.Displays = string(js)
+}
+
+// DictOption 下拉框选项
+type DictOption struct {
+	Code    string `json:"code"`
+	Value   string `json:"value"`
+	Display string `json:"display"`
+}
+
+// Dict 字典，启用的项全部缓存在内存中，通过 Dao 修改后自动刷新
+type Dict struct {
+	dao    *Dao[DbDict]
+	ttl    time.Duration
+	lock   sync.RWMutex
+	items  map[string][]*DbDict
+	loaded time.Time
+	gen    uint64 // 每次 Refresh 加1，开始加载后被刷新的结果不写入缓存
+	bus    *InvalidationBus
+}
+
+// NewDict 创建字典，表不存在时自动创建
+//
+//	其他实例的修改在缓存过期后可见，使用 UseBus 时立即失效
+//
+//	@param db 数据库连接
+//	@param cacheTTL 缓存时长，为0使用5分钟
+//	@return *Dict, error
+func NewDict(db *gorm.DB, cacheTTL time.Duration) (*Dict, error) {
+	if cacheTTL <= 0 {
+		cacheTTL = 5 * time.Minute
+	}
+	dao, err := TryNewDao[DbDict](db)
+	if err != nil {
+		return nil, err
+	}
+	d := &Dict{dao: dao, ttl: cacheTTL}
+	// 写入后清空缓存
+	dao.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			err := next(op)
+			if op.Kind != OpRead {
+				d.Refresh()
+				d.lock.RLock()
+				bus := d.bus
+				d.lock.RUnlock()
+				if bus != nil {
+					bus.Invalidate("dict:"+dao.table, "")
+				}
+			}
+			return err
+		}
+	})
+	return d, nil
+}
+
+// Dao 返回字典表的Dao，用于后台维护，修改后缓存自动刷新
+//
+//	@return *Dao[DbDict]
+func (d *Dict) Dao() *Dao[DbDict] {
+	return d.dao
+}
+
+// UseBus 接入缓存失效总线，本实例修改后通知其他实例刷新缓存，须在修改前调用
+//
+//	@param bus 缓存失效总线
+func (d *Dict) UseBus(bus *InvalidationBus) {
+	d.lock.Lock()
+	d.bus = bus
+	d.lock.Unlock()
+	bus.Register("dict:"+d.dao.table, func(string) {
+		d.Refresh()
+	})
+}
+
+// Refresh 清空缓存，下次查询时重新加载
+func (d *Dict) Refresh() {
+	d.lock.Lock()
+	d.items = nil
+	d.gen++
+	d.lock.Unlock()
+}
+
+// Items 返回类型下启用的全部项，按排序、编码排列
+//
+//	@param typ 字典类型
+//	@return []*DbDict, error
+func (d *Dict) Items(typ string) ([]*DbDict, error) {
+	items, err := d.load()
+	if err != nil {
+		return nil, err
+	}
+	return items[typ], nil
+}
+
+// Get 按编码查询启用的项
+//
+//	@param typ 字典类型
+//	@param code 编码
+//	@return *DbDict, bool, error
+func (d *Dict) Get(typ string, code string) (*DbDict, bool, error) {
+	items, err := d.Items(typ)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, item := range items {
+		if item.Code == code {
+			return item, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// Display 返回编码的显示名称，不存在时返回编码本身
+//
+//	@param typ 字典类型
+//	@param code 编码
+//	@param lang 语言，为空使用默认显示名称
+//	@return string
+func (d *Dict) Display(typ string, code string, lang string) string {
+	item, ok, err := d.Get(typ, code)
+	if err != nil || !ok {
+		return code
+	}
+	return item.DisplayIn(lang)
+}
+
+// Options 返回类型下的下拉框选项
+//
+//	@param typ 字典类型
+//	@param lang 语言，为空使用默认显示名称
+//	@return []DictOption, error
+func (d *Dict) Options(typ string, lang string) ([]DictOption, error) {
+	items, err := d.Items(typ)
+	if err != nil {
+		return nil, err
+	}
+	options := make([]DictOption, 0, len(items))
+	for _, item := range items {
+		options = append(options, DictOption{Code: item.Code, Value: item.Value, Display: item.DisplayIn(lang)})
+	}
+	return options, nil
+}
+
+// load 返回缓存，过期或被清空时重新加载
+func (d *Dict) load() (map[string][]*DbDict, error) {
+	d.lock.RLock()
+	items, loaded, gen := d.items, d.loaded, d.gen
+	d.lock.RUnlock()
+	if items != nil && time.Since(loaded) < d.ttl {
+		return items, nil
+	}
+	list, err := d.dao.GetConditions(clause.Eq{Column: fieldColumn(d.dao.db, &DbDict{}, "Enabled"), Value: Bool(true)})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Sort != list[j].Sort {
+			return list[i].Sort < list[j].Sort
+		}
+		return list[i].Code < list[j].Code
+	})
+	items = make(map[string][]*DbDict)
+	for _, item := range list {
+		items[item.Type] = append(items[item.Type], item)
+	}
+	// 加载期间有修改时不缓存，避免旧数据覆盖刷新
+	d.lock.Lock()
+	if d.gen == gen {
+		d.items, d.loaded = items, time.Now()
+	}
+	d.lock.Unlock()
+	return items, nil
+}
@@ -0,0 +1,203 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sync/atomic"
+	"time"
+)
+
+// DualStep 协调写入的一端
+type DualStep struct {
+	DB         *gorm.DB                // 数据库连接
+	Write      func(tx *gorm.DB) error // 写入方法，在事务中执行
+	Compensate func(db *gorm.DB) error // 补偿方法，本端已提交而另一端提交失败时执行，为空则不补偿
+}
+
+// ErrDualWrite 协调写入失败，已提交的一端补偿失败或无法补偿
+var ErrDualWrite = errors.New("dual write partially committed")
+
+var xidSeq uint64
+
+// DualWrite 在两个连接上协调写入，尽量保证同时成功或同时失败
+//
+//	mysql使用XA事务、postgres使用预备事务（需开启 max_prepared_transactions），先预备两端再提交；
+//	其他数据库使用普通事务，先提交可预备的一端和first，second提交失败时执行first的补偿方法
+//
+//	@param ctx 上下文
+//	@param first 第一端，如本地sqlite
+//	@param second 第二端，如中心mysql
+//	@return error 部分提交且无法补偿时返回 ErrDualWrite
+func DualWrite(ctx context.Context, first, second DualStep) error {
+	xid := fmt.Sprintf("qdb-%d-%d", time.Now().UnixNano(), atomic.AddUint64(&xidSeq, 1))
+	steps := []DualStep{first, second}
+	parts := make([]*dualPart, 0, 2)
+	rollback := func() {
+		for _, p := range parts {
+			_ = p.rollback()
+		}
+	}
+
+	// 写入并预备
+	for i, step := range steps {
+		p, err := beginDualPart(ctx, step.DB, fmt.Sprintf("%s-%d", xid, i))
+		if err != nil {
+			rollback()
+			return err
+		}
+		parts = append(parts, p)
+		if err = step.Write(p.tx); err != nil {
+			rollback()
+			return err
+		}
+	}
+	for _, p := range parts {
+		if err := p.prepare(); err != nil {
+			rollback()
+			return err
+		}
+	}
+
+	// 先提交未预备的一端，失败时另一端仍可回滚
+	order := []int{0, 1}
+	if parts[0].xa && !parts[1].xa {
+		order = []int{1, 0}
+	}
+	if err := parts[order[0]].commit(); err != nil {
+		_ = parts[order[1]].rollback()
+		return err
+	}
+	err := parts[order[1]].commit()
+	if err == nil {
+		return nil
+	}
+	if parts[order[1]].xa {
+		return fmt.Errorf("%w: commit prepared %s: %v", ErrDualWrite, parts[order[1]].xid, err)
+	}
+	// 已提交一端的补偿
+	done := steps[order[0]]
+	if done.Compensate == nil {
+		return fmt.Errorf("%w: %v", ErrDualWrite, err)
+	}
+	if cerr := done.Compensate(done.DB.WithContext(ctx)); cerr != nil {
+		return fmt.Errorf("%w: %v, compensate: %v", ErrDualWrite, err, cerr)
+	}
+	return err
+}
+
+// dualPart 协调写入的参与者
+type dualPart struct {
+	db   *gorm.DB
+	tx   *gorm.DB
+	conn *sql.Conn // 预备事务使用的专用连接
+	xid  string
+	xa   bool   // 是否支持预备
+	step string // 当前阶段：started、prepared、done
+	end  func() // 结束事务监控
+}
+
+// beginDualPart 开始事务，mysql、postgres使用专用连接执行预备事务语句
+func beginDualPart(ctx context.Context, db *gorm.DB, xid string) (*dualPart, error) {
+	p := &dualPart{db: db, xid: xid}
+	dialect := db.Dialector.Name()
+	if dialect != "mysql" && dialect != "postgres" {
+		p.tx = db.WithContext(ctx).Begin()
+		if p.tx.Error != nil {
+			return p, p.tx.Error
+		}
+		p.step, p.end = "started", trackTx(1)
+		return p, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	p.conn, err = sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.xa = true
+	start := "BEGIN"
+	if dialect == "mysql" {
+		start = fmt.Sprintf("XA START '%s'", xid)
+	}
+	if _, err = p.conn.ExecContext(ctx, start); err != nil {
+		_ = p.conn.Close()
+		return nil, err
+	}
+	p.tx = db.Session(&gorm.Session{Context: ctx, SkipDefaultTransaction: true})
+	p.tx.Statement.ConnPool = p.conn
+	p.step, p.end = "started", trackTx(1)
+	return p, nil
+}
+
+// prepare 预备事务
+func (p *dualPart) prepare() error {
+	if !p.xa {
+		return nil
+	}
+	ctx := context.Background()
+	if p.db.Dialector.Name() == "mysql" {
+		if _, err := p.conn.ExecContext(ctx, fmt.Sprintf("XA END '%s'", p.xid)); err != nil {
+			return err
+		}
+		if _, err := p.conn.ExecContext(ctx, fmt.Sprintf("XA PREPARE '%s'", p.xid)); err != nil {
+			return err
+		}
+	} else if _, err := p.conn.ExecContext(ctx, fmt.Sprintf("PREPARE TRANSACTION '%s'", p.xid)); err != nil {
+		return err
+	}
+	p.step = "prepared"
+	return nil
+}
+
+// commit 提交事务
+func (p *dualPart) commit() error {
+	if p.step == "done" {
+		return nil
+	}
+	p.step = "done"
+	defer p.end()
+	if !p.xa {
+		return p.tx.Commit().Error
+	}
+	defer p.conn.Close()
+	stmt := fmt.Sprintf("COMMIT PREPARED '%s'", p.xid)
+	if p.db.Dialector.Name() == "mysql" {
+		stmt = fmt.Sprintf("XA COMMIT '%s'", p.xid)
+	}
+	_, err := p.conn.ExecContext(context.Background(), stmt)
+	return err
+}
+
+// rollback 回滚事务
+func (p *dualPart) rollback() error {
+	if p.step == "done" {
+		return nil
+	}
+	step := p.step
+	p.step = "done"
+	defer p.end()
+	if !p.xa {
+		return p.tx.Rollback().Error
+	}
+	defer p.conn.Close()
+	ctx := context.Background()
+	if p.db.Dialector.Name() == "mysql" {
+		if step == "started" {
+			_, _ = p.conn.ExecContext(ctx, fmt.Sprintf("XA END '%s'", p.xid))
+		}
+		_, err := p.conn.ExecContext(ctx, fmt.Sprintf("XA ROLLBACK '%s'", p.xid))
+		return err
+	}
+	if step == "started" {
+		_, err := p.conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	_, err := p.conn.ExecContext(ctx, fmt.Sprintf("ROLLBACK PREPARED '%s'", p.xid))
+	return err
+}
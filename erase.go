@@ -0,0 +1,85 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// ErasureRule 数据主体的擦除规则
+type ErasureRule struct {
+	Column    string         // 标识数据主体的列，如 UserId
+	Anonymize map[string]any // 需匿名化的列及替换值，为空则删除整行
+}
+
+// ErasureItem 单表擦除结果
+type ErasureItem struct {
+	Table      string // 表名
+	Deleted    int64  // 删除行数
+	Anonymized int64  // 匿名化行数
+}
+
+// ErasureReport 擦除报告
+type ErasureReport struct {
+	SubjectKey any           // 数据主体标识
+	Time       time.Time     // 执行时间
+	Items      []ErasureItem // 各表结果，按注册顺序
+}
+
+var (
+	erasures    []func(tx *gorm.DB, key any) (ErasureItem, error)
+	erasureLock sync.RWMutex
+)
+
+// RegisterErasure 注册模型的擦除规则，按注册顺序执行，存在外键时应先注册子表
+//
+//	@param rule 擦除规则
+func RegisterErasure[T any](rule ErasureRule) {
+	erasureLock.Lock()
+	defer erasureLock.Unlock()
+	erasures = append(erasures, func(tx *gorm.DB, key any) (ErasureItem, error) {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(new(T)); err != nil {
+			return ErasureItem{}, err
+		}
+		item := ErasureItem{Table: stmt.Schema.Table}
+		where := fmt.Sprintf("%s = ?", stmt.Quote(rule.Column))
+		// 删除整行，包括软删除的数据
+		if len(rule.Anonymize) == 0 {
+			result := tx.Unscoped().Where(where, key).Delete(new(T))
+			item.Deleted = result.RowsAffected
+			return item, result.Error
+		}
+		result := tx.Unscoped().Model(new(T)).Where(where, key).Updates(rule.Anonymize)
+		item.Anonymized = result.RowsAffected
+		return item, result.Error
+	})
+}
+
+// Erase 在一个事务中删除或匿名化数据主体在所有已注册表中的数据，用于GDPR等数据擦除请求
+//
+//	@param db 数据库连接
+//	@param subjectKey 数据主体标识，如用户ID
+//	@return *ErasureReport, error 失败时整体回滚
+func Erase(db *gorm.DB, subjectKey any) (*ErasureReport, error) {
+	erasureLock.RLock()
+	fns := append([]func(tx *gorm.DB, key any) (ErasureItem, error){}, erasures...)
+	erasureLock.RUnlock()
+
+	report := &ErasureReport{SubjectKey: subjectKey, Time: now()}
+	err := trackedTx(db, func(tx *gorm.DB) error {
+		for _, fn := range fns {
+			item, err := fn(tx, subjectKey)
+			if err != nil {
+				return fmt.Errorf("erase %s: %w", item.Table, err)
+			}
+			report.Items = append(report.Items, item)
+		}
+		return nil
+	}, 1)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,95 @@
+package qdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"net"
+	"strings"
+)
+
+var (
+	// ErrUnsupported 当前数据库不支持该功能
+	ErrUnsupported = errors.New("qdb: feature not supported by server")
+	// ErrInvalidCursor 分页游标无效或已被篡改
+	ErrInvalidCursor = errors.New("qdb: invalid cursor")
+	// ErrUpdateNotExist 待修改的记录不存在
+	ErrUpdateNotExist = errors.New("update record does not exist")
+	// ErrNoChanges 记录存在但内容无变化
+	ErrNoChanges = errors.New("qdb: no changes")
+	// ErrNotFound 记录不存在
+	ErrNotFound = errors.New("qdb: record not found")
+	// ErrFullTableDelete 删除条件为空，未允许删除全表
+	ErrFullTableDelete = errors.New("qdb: delete without condition is not allowed, use AllowFullTableDelete or Truncate")
+	// ErrOpNotAllowed Dao不允许执行该类型的操作
+	ErrOpNotAllowed = errors.New("qdb: operation not allowed")
+	// ErrRateLimited 操作超出限流
+	ErrRateLimited = errors.New("qdb: rate limited")
+	// ErrCircuitOpen 数据库连接连续失败，熔断期内不再执行
+	ErrCircuitOpen = errors.New("qdb: circuit open")
+	// ErrTooManyRows 查询返回的行数超过上限
+	ErrTooManyRows = errors.New("qdb: too many rows")
+	// ErrSchemaDrift 已注册的语句与实际表结构不一致
+	ErrSchemaDrift = errors.New("qdb: schema drift")
+	// ErrUniqueConflict 唯一性校验失败，详细信息见 ConflictError
+	ErrUniqueConflict = errors.New("qdb: unique conflict")
+	// ErrLedgerBroken 账本序号不连续或哈希链不一致
+	ErrLedgerBroken = errors.New("qdb: ledger broken")
+	// ErrInvalidTransition 状态转换未声明或当前状态与预期不符
+	ErrInvalidTransition = errors.New("qdb: invalid state transition")
+	// ErrEventsDropped 变化事件积压被丢弃，订阅方需重新加载
+	ErrEventsDropped = errors.New("qdb: change events dropped")
+)
+
+// IsDuplicateKey 判断是否为唯一键冲突错误
+//
+//	@param err 错误
+//	@return bool
+func IsDuplicateKey(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	var me *mysqlDriver.MySQLError
+	if errors.As(err, &me) {
+		return me.Number == 1062
+	}
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) {
+		return pe.Code == "23505"
+	}
+	// sqlite、sqlserver按错误信息判断
+	msg := err.Error()
+	return strings.Contains(msg, "UNIQUE constraint failed") ||
+		strings.Contains(msg, "Cannot insert duplicate key")
+}
+
+// IsConnError 判断是否为连接类错误，如连接被拒绝、断开、超时
+//
+//	@param err 错误
+//	@return bool
+func IsConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqlDriver.ErrInvalidConn) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, key := range []string{"connection refused", "connection reset", "broken pipe", "no such host", "i/o timeout",
+		"bad connection", "unable to open database", "failed to connect"} {
+		if strings.Contains(msg, key) {
+			return true
+		}
+	}
+	return false
+}
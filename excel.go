@@ -0,0 +1,783 @@
+package qdb
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsx 单个工作表的最大行数
+const xlsxMaxRows = 1048576
+
+// XlsxWriter 流式写入只有一个工作表的 .xlsx 文件，逐行写入压缩包，不在内存中保存全部数据
+type XlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+	err   error
+}
+
+// NewXlsxWriter 创建 .xlsx 写入器，写入完成后须调用 Close
+//
+//	@param w 输出，如文件、http.ResponseWriter
+//	@param sheet 工作表名称，为空使用 Sheet1
+//	@return *XlsxWriter, error
+func NewXlsxWriter(w io.Writer, sheet string) (*XlsxWriter, error) {
+	if sheet == "" {
+		sheet = "Sheet1"
+	}
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+			`<sheet name="` + xmlEscape(sheet) + `" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`},
+		// 样式1为表头粗体
+		{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(f, xml.Header+part.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &XlsxWriter{zw: zw, sheet: bufio.NewWriterSize(f, 64*1024)}
+	_, x.err = x.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x, x.err
+}
+
+// WriteHeader 写入粗体的表头行
+//
+//	@param titles 列标题
+//	@return error
+func (x *XlsxWriter) WriteHeader(titles ...string) error {
+	values := make([]any, len(titles))
+	for i, t := range titles {
+		values[i] = t
+	}
+	return x.writeRow(values, 1)
+}
+
+// WriteRow 写入一行，数值、布尔写为对应类型的单元格，时间按 2006-01-02 15:04:05 格式写为文本，nil 为空单元格
+//
+//	@param values 各列的值
+//	@return error
+func (x *XlsxWriter) WriteRow(values ...any) error {
+	return x.writeRow(values, 0)
+}
+
+// writeRow 按样式写入一行
+func (x *XlsxWriter) writeRow(values []any, style int) error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.rows >= xlsxMaxRows {
+		return fmt.Errorf("qdb: xlsx sheet exceeds %d rows", xlsxMaxRows)
+	}
+	x.rows++
+	b := x.sheet
+	b.WriteString(`<row r="`)
+	b.WriteString(strconv.Itoa(x.rows))
+	b.WriteString(`">`)
+	for i, v := range values {
+		kind, text := xlsxCell(v)
+		if kind == "" {
+			continue
+		}
+		b.WriteString(`<c r="`)
+		b.WriteString(xlsxColumn(i))
+		b.WriteString(strconv.Itoa(x.rows))
+		b.WriteByte('"')
+		if style > 0 {
+			b.WriteString(` s="`)
+			b.WriteString(strconv.Itoa(style))
+			b.WriteByte('"')
+		}
+		switch kind {
+		case "n":
+			b.WriteString(`><v>`)
+			b.WriteString(text)
+			b.WriteString(`</v></c>`)
+		case "b":
+			b.WriteString(` t="b"><v>`)
+			b.WriteString(text)
+			b.WriteString(`</v></c>`)
+		default:
+			b.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+			b.WriteString(xmlEscape(text))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	_, x.err = b.WriteString(`</row>`)
+	return x.err
+}
+
+// Close 结束工作表并完成压缩包，不关闭底层输出
+//
+//	@return error
+func (x *XlsxWriter) Close() error {
+	if x.err == nil {
+		_, x.err = x.sheet.WriteString(`</sheetData></worksheet>`)
+	}
+	if x.err == nil {
+		x.err = x.sheet.Flush()
+	}
+	if err := x.zw.Close(); x.err == nil {
+		x.err = err
+	}
+	return x.err
+}
+
+// xlsxCell 返回单元格类型（n 数值、b 布尔、s 文本，空表示空单元格）及内容
+func xlsxCell(v any) (string, string) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", ""
+		}
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+	switch x := v.(type) {
+	case nil:
+		return "", ""
+	case qtime.DateTime:
+		if x == 0 {
+			return "", ""
+		}
+		return "s", x.ToTime().Format("2006-01-02 15:04:05")
+	case time.Time:
+		if x.IsZero() {
+			return "", ""
+		}
+		return "s", x.Format("2006-01-02 15:04:05")
+	case Time:
+		if x.IsZero() {
+			return "", ""
+		}
+		return "s", x.Format("2006-01-02 15:04:05")
+	case []byte:
+		return "s", string(x)
+	case fmt.Stringer:
+		return "s", x.String()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "n", strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// 超过15位有效数字时 Excel 会丢失精度，按文本写入
+		if rv.Uint() >= 1e15 {
+			return "s", strconv.FormatUint(rv.Uint(), 10)
+		}
+		return "n", strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return "n", strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+	case reflect.Bool:
+		if rv.Bool() {
+			return "b", "1"
+		}
+		return "b", "0"
+	}
+	return "s", fmt.Sprint(v)
+}
+
+// xlsxColumn 列序号（从0开始）对应的列名，如 A、Z、AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xmlEscape 转义XML文本，无效字符替换为 U+FFFD
+func xmlEscape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// excelField 导出或导入的字段
+type excelField struct {
+	field    *schema.Field
+	title    string
+	required bool
+}
+
+// excelFields 返回模型中参与导出、导入的字段，标题取自 xlsx 标签，为 - 时忽略，未设置时使用字段名，
+// 标签中的 required 表示导入时必填，如 `xlsx:"订单号,required"`
+func excelFields(db *gorm.DB, model any) ([]excelField, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	fields := make([]excelField, 0, len(stmt.Schema.Fields))
+	for _, f := range stmt.Schema.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		opts := strings.Split(f.Tag.Get("xlsx"), ",")
+		title := strings.TrimSpace(opts[0])
+		if title == "-" {
+			continue
+		}
+		if title == "" {
+			title = f.Name
+		}
+		ef := excelField{field: f, title: title}
+		for _, opt := range opts[1:] {
+			ef.required = ef.required || strings.TrimSpace(opt) == "required"
+		}
+		fields = append(fields, ef)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("qdb: model has no exportable fields")
+	}
+	return fields, nil
+}
+
+// ExportExcel 将条件查询结果导出为 .xlsx，逐行读取并写入，不在内存中保存全部结果
+//
+//	表头取自字段的 xlsx 标签，如 `xlsx:"订单号"`，为 - 时不导出，未设置时使用字段名
+//
+//	@param w 输出
+//	@param query 条件，如 Status = ?，为nil导出全部
+//	@param args 条件参数
+//	@return int64 导出行数, error
+func (dao *Dao[T]) ExportExcel(w io.Writer, query any, args ...any) (int64, error) {
+	var count int64
+	err := dao.exec("ExportExcel", OpRead, func(op *Operation) error {
+		fields, err := excelFields(op.DB, new(T))
+		if err != nil {
+			return err
+		}
+		db := dao.list(op.DB).Model(new(T))
+		if query != nil {
+			db = db.Where(query, args...)
+		}
+		rows, err := db.Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		x, err := NewXlsxWriter(w, dao.table)
+		if err != nil {
+			return err
+		}
+		titles := make([]string, len(fields))
+		for i, f := range fields {
+			titles[i] = f.title
+		}
+		if err = x.WriteHeader(titles...); err != nil {
+			return err
+		}
+		ctx := op.Context()
+		values := make([]any, len(fields))
+		for rows.Next() {
+			model := new(T)
+			if err = op.DB.ScanRows(rows, model); err != nil {
+				return err
+			}
+			rv := reflect.ValueOf(model).Elem()
+			for i, f := range fields {
+				values[i], _ = f.field.ValueOf(ctx, rv)
+			}
+			if err = x.WriteRow(values...); err != nil {
+				return err
+			}
+			count++
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		op.RowsAffected = count
+		return x.Close()
+	})
+	return count, err
+}
+
+// ReadXlsx 流式读取 .xlsx 的第一个工作表，逐行回调，单元格按列位置对齐，空行跳过
+//
+//	数值按文本原样返回，日期格式的单元格为 Excel 序列值，布尔为 TRUE、FALSE
+//
+//	@param r 输入，如 *os.File、bytes.Reader
+//	@param size 输入长度
+//	@param fn 行回调，row 为行号（从1开始），cells 在回调返回后复用，返回错误时停止读取
+//	@return error
+func ReadXlsx(r io.ReaderAt, size int64, fn func(row int, cells []string) error) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("qdb: invalid xlsx: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	sheet := files[xlsxFirstSheet(files)]
+	if sheet == nil {
+		return errors.New("qdb: invalid xlsx: worksheet not found")
+	}
+	var shared []string
+	if f := files["xl/sharedStrings.xml"]; f != nil {
+		if shared, err = xlsxSharedStrings(f); err != nil {
+			return err
+		}
+	}
+
+	rc, err := sheet.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(bufio.NewReader(rc))
+	var (
+		cells             []string
+		text              strings.Builder
+		row, col          int
+		kind              string
+		inValue, phonetic bool
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("qdb: invalid xlsx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row++
+				if ref := xlsxAttr(t, "r"); ref != "" {
+					row, _ = strconv.Atoi(ref)
+				}
+				cells = cells[:0]
+			case "c":
+				col = len(cells)
+				if ref := xlsxAttr(t, "r"); ref != "" {
+					col = xlsxColumnIndex(ref)
+				}
+				kind = xlsxAttr(t, "t")
+				text.Reset()
+			case "v", "t":
+				inValue = !phonetic
+			case "rPh":
+				phonetic = true
+			}
+		case xml.CharData:
+			if inValue {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "rPh":
+				phonetic = false
+			case "c":
+				value := text.String()
+				switch kind {
+				case "s":
+					i, err := strconv.Atoi(strings.TrimSpace(value))
+					if err != nil || i < 0 || i >= len(shared) {
+						return fmt.Errorf("qdb: invalid xlsx: shared string %q", value)
+					}
+					value = shared[i]
+				case "b":
+					value = strings.ToUpper(strconv.FormatBool(strings.TrimSpace(value) == "1"))
+				}
+				for len(cells) <= col {
+					cells = append(cells, "")
+				}
+				cells[col] = value
+			case "row":
+				for len(cells) > 0 && strings.TrimSpace(cells[len(cells)-1]) == "" {
+					cells = cells[:len(cells)-1]
+				}
+				if len(cells) == 0 {
+					continue
+				}
+				if err = fn(row, cells); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// xlsxFirstSheet 从工作簿及其关系中查找第一个工作表的路径
+func xlsxFirstSheet(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+	var book struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Items []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if xlsxUnmarshal(files["xl/workbook.xml"], &book) != nil || len(book.Sheets) == 0 ||
+		xlsxUnmarshal(files["xl/_rels/workbook.xml.rels"], &rels) != nil {
+		return fallback
+	}
+	for _, rel := range rels.Items {
+		if rel.Id != book.Sheets[0].Id {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return "xl/" + rel.Target
+	}
+	return fallback
+}
+
+// xlsxUnmarshal 解析压缩包中的XML文件
+func xlsxUnmarshal(f *zip.File, v any) error {
+	if f == nil {
+		return io.ErrUnexpectedEOF
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxSharedStrings 读取共享字符串表，富文本的各段合并，忽略注音
+func xlsxSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	dec := xml.NewDecoder(bufio.NewReader(rc))
+	list := make([]string, 0)
+	var text strings.Builder
+	inText, phonetic := false, false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return list, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("qdb: invalid xlsx: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				text.Reset()
+			case "t":
+				inText = !phonetic
+			case "rPh":
+				phonetic = true
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "si":
+				list = append(list, text.String())
+			case "t":
+				inText = false
+			case "rPh":
+				phonetic = false
+			}
+		}
+	}
+}
+
+// xlsxAttr 返回元素的属性值
+func xlsxAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// xlsxColumnIndex 单元格引用对应的列序号（从0开始），如 A1 为0、AA3 为26
+func xlsxColumnIndex(ref string) int {
+	i := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		i = i*26 + int(ch-'A'+1)
+	}
+	return i - 1
+}
+
+// ImportError 导入失败的行
+type ImportError struct {
+	Row     int    // 行号，与 Excel 中一致
+	Column  string // 列标题，整行的错误为空
+	Message string // 错误信息
+}
+
+// ImportReport 导入结果
+type ImportReport struct {
+	Total    int           // 数据行数
+	Imported int           // 成功导入的行数
+	Errors   []ImportError // 失败的行，按行号排序
+}
+
+// 导入时每批写入的行数
+const importBatchSize = 500
+
+// ImportExcel 从 .xlsx 的第一个工作表导入，首个非空行为表头，按列标题对应字段，逐行转换、校验，通过的行分批写入
+//
+//	列标题与字段的 xlsx 标签、字段名或列名匹配，无法匹配的列忽略；标签含 required 的字段，表头缺少该列时返回错误，
+//	单元格为空时记为该行的错误。日期列兼容文本和 Excel 序列值。某批写入失败时逐行重试，以定位失败的行
+//
+//	@param r 输入
+//	@param size 输入长度
+//	@param validate 行校验，返回错误时该行不导入，为nil不校验
+//	@return *ImportReport 导入结果, error 文件无效或表头缺少必填列时返回
+func (dao *Dao[T]) ImportExcel(r io.ReaderAt, size int64, validate func(row int, model *T) error) (*ImportReport, error) {
+	fields, err := excelFields(dao.db, new(T))
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{Errors: make([]ImportError, 0)}
+	ctx := dao.db.Statement.Context
+	var (
+		columns []*excelField
+		batch   []*T
+		rows    []int
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if dao.CreateListP(batch) == nil {
+			report.Imported += len(batch)
+		} else {
+			// 失败时 CreateListP 已恢复各实体，逐条重试不带回滚的唯一号和时间
+			for i, model := range batch {
+				if err := dao.Create(model); err != nil {
+					report.Errors = append(report.Errors, ImportError{Row: rows[i], Message: err.Error()})
+					continue
+				}
+				report.Imported++
+			}
+		}
+		batch, rows = batch[:0], rows[:0]
+	}
+	err = ReadXlsx(r, size, func(row int, cells []string) error {
+		// 表头
+		if columns == nil {
+			columns = make([]*excelField, len(cells))
+			found := make(map[*schema.Field]bool, len(fields))
+			for i, title := range cells {
+				title = strings.TrimSpace(title)
+				for j := range fields {
+					f := &fields[j]
+					if !found[f.field] && (title == f.title || strings.EqualFold(title, f.field.Name) || strings.EqualFold(title, f.field.DBName)) {
+						columns[i] = f
+						found[f.field] = true
+						break
+					}
+				}
+			}
+			for _, f := range fields {
+				if f.required && !found[f.field] {
+					return fmt.Errorf("qdb: xlsx missing required column %s", f.title)
+				}
+			}
+			return nil
+		}
+
+		report.Total++
+		model := new(T)
+		rv := reflect.ValueOf(model).Elem()
+		failed := false
+		filled := make(map[*schema.Field]bool, len(columns))
+		for i, f := range columns {
+			if f == nil || i >= len(cells) || strings.TrimSpace(cells[i]) == "" {
+				continue
+			}
+			v, err := excelValue(f.field.FieldType, cells[i])
+			if err != nil {
+				report.Errors = append(report.Errors, ImportError{Row: row, Column: f.title, Message: err.Error()})
+				failed = true
+				continue
+			}
+			f.field.ReflectValueOf(ctx, rv).Set(v)
+			filled[f.field] = true
+		}
+		for _, f := range fields {
+			if f.required && !filled[f.field] && !failed {
+				report.Errors = append(report.Errors, ImportError{Row: row, Column: f.title, Message: "value is required"})
+				failed = true
+			}
+		}
+		if !failed && validate != nil {
+			if err := validate(row, model); err != nil {
+				report.Errors = append(report.Errors, ImportError{Row: row, Message: err.Error()})
+				failed = true
+			}
+		}
+		if failed {
+			return nil
+		}
+		batch = append(batch, model)
+		rows = append(rows, row)
+		if len(batch) >= importBatchSize {
+			flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	flush()
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	return report, nil
+}
+
+// excelValue 将单元格文本转换为字段类型的值
+func excelValue(t reflect.Type, text string) (reflect.Value, error) {
+	text = strings.TrimSpace(text)
+	if t.Kind() == reflect.Ptr {
+		v, err := excelValue(t.Elem(), text)
+		if err != nil {
+			return v, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	}
+	v := reflect.New(t).Elem()
+	switch t {
+	case dateTimeType:
+		if tm, ok := excelSerial(text); ok {
+			v.Set(reflect.ValueOf(dateTimeOf(tm)))
+			return v, nil
+		}
+		dt, err := parseDateTime(text)
+		v.Set(reflect.ValueOf(dt))
+		return v, err
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(Time{}):
+		tm, ok := excelSerial(text)
+		if !ok {
+			var err error
+			if tm, err = parseTime(text); err != nil {
+				return v, err
+			}
+		}
+		if t == reflect.TypeOf(Time{}) {
+			v.Set(reflect.ValueOf(Time{Time: tm}))
+		} else {
+			v.Set(reflect.ValueOf(tm))
+		}
+		return v, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			// Excel 中的整数可能以 3.0 形式保存
+			f, ferr := strconv.ParseFloat(text, 64)
+			if ferr != nil || f != float64(int64(f)) {
+				return v, fmt.Errorf("invalid integer %q", text)
+			}
+			n = int64(f)
+		}
+		if v.OverflowInt(n) {
+			return v, fmt.Errorf("integer %q out of range", text)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			f, ferr := strconv.ParseFloat(text, 64)
+			if ferr != nil || f < 0 || f != float64(uint64(f)) {
+				return v, fmt.Errorf("invalid unsigned integer %q", text)
+			}
+			n = uint64(f)
+		}
+		if v.OverflowUint(n) {
+			return v, fmt.Errorf("integer %q out of range", text)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return v, fmt.Errorf("invalid number %q", text)
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := parseBool(text)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	default:
+		// 自定义类型，如 Bool、JSON，按文本扫描
+		if s, ok := v.Addr().Interface().(sql.Scanner); ok {
+			return v, s.Scan(text)
+		}
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// excelSerial 解析 Excel 日期序列值，如 45413.5 为 2024-05-01 12:00:00
+func excelSerial(text string) (time.Time, bool) {
+	f, err := strconv.ParseFloat(text, 64)
+	// 序列值最大为 9999-12-31，更大的数字按 yyyymmddhhmmss 处理
+	if err != nil || f <= 0 || f >= 2958466 {
+		return time.Time{}, false
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.Local)
+	return base.Add(time.Duration(f*86400+0.5) * time.Second), true
+}
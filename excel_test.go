@@ -0,0 +1,124 @@
+package qdb
+
+import (
+	"bytes"
+	"github.com/kamioair/utils/qtime"
+	"testing"
+)
+
+type excelItem struct {
+	Id       uint64         `gorm:"primaryKey" xlsx:"-"`
+	LastTime qtime.DateTime `xlsx:"-"`
+	Code     string         `gorm:"size:32;uniqueIndex" xlsx:"编号,required"`
+	Name     string         `xlsx:"名称"`
+	Amount   int
+	Enabled  bool
+}
+
+// excelFile 生成测试用的 .xlsx
+func excelFile(t *testing.T, header []string, rows ...[]any) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	x, err := NewXlsxWriter(&buf, "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = x.WriteHeader(header...); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err = x.WriteRow(row...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExcelExportImport(t *testing.T) {
+	src, err := TryNewDao[excelItem](newTestDB(t), WithDefaultOrder("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = src.CreateList([]excelItem{{Code: "a1", Name: "甲", Amount: 3, Enabled: true}, {Code: "b2", Name: "<乙&>", Amount: -1}}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	count, err := src.ExportExcel(&buf, nil)
+	if err != nil || count != 2 {
+		t.Fatal(count, err)
+	}
+	var rows [][]string
+	err = ReadXlsx(bytes.NewReader(buf.Bytes()), int64(buf.Len()), func(row int, cells []string) error {
+		rows = append(rows, append([]string(nil), cells...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][0] != "编号" || rows[0][1] != "名称" || rows[2][1] != "<乙&>" {
+		t.Fatalf("exported rows: %q", rows)
+	}
+
+	dst, err := TryNewDao[excelItem](newTestDB(t), WithDefaultOrder("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := dst.ImportExcel(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 || report.Imported != 2 || len(report.Errors) != 0 {
+		t.Fatalf("import report: %+v", report)
+	}
+	list, _ := dst.GetAll()
+	if len(list) != 2 || list[0].Name != "甲" || list[0].Amount != 3 || !list[0].Enabled || list[1].Amount != -1 || list[1].Enabled {
+		t.Fatalf("imported: %+v", list)
+	}
+}
+
+func TestExcelImportErrors(t *testing.T) {
+	dao, err := TryNewDao[excelItem](newTestDB(t), WithDefaultOrder("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dao.Create(&excelItem{Code: "dup"}); err != nil {
+		t.Fatal(err)
+	}
+	f := excelFile(t, []string{"编号", "名称", "Amount"},
+		[]any{"a", "ok", 1},
+		[]any{"dup", "conflict", 2},
+		[]any{"", "missing code", 3},
+		[]any{"c", "bad amount", "x"},
+		[]any{"b", "ok", 4},
+	)
+	report, err := dao.ImportExcel(f, f.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 5 || report.Imported != 2 || len(report.Errors) != 3 {
+		t.Fatalf("import report: %+v", report)
+	}
+	for i, row := range []int{3, 4, 5} {
+		if report.Errors[i].Row != row {
+			t.Errorf("error %d: got row %d, want %d", i, report.Errors[i].Row, row)
+		}
+	}
+	list, _ := dao.GetAll()
+	if len(list) != 3 || list[0].Code != "a" || list[1].Code != "b" || list[2].Code != "dup" {
+		t.Fatalf("stored: %+v", list)
+	}
+
+	// 写入失败时恢复实体，逐条重试不使用回滚的唯一号
+	batch := []*excelItem{{Code: "x"}, {Code: "dup"}}
+	if err = dao.CreateListP(batch); err == nil {
+		t.Fatal("CreateListP with duplicate succeeded")
+	}
+	for _, model := range batch {
+		if model.Id != 0 || model.LastTime != 0 {
+			t.Errorf("model not reset after rollback: %+v", model)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package qdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+)
+
+// Anonymizer 列值匿名化方法，参数为原值，返回导出值
+type Anonymizer func(value any) any
+
+// HashAnonymizer 使用加盐SHA256替换原值，相同原值得到相同结果，便于保留关联关系
+//
+//	@param salt 盐
+//	@return Anonymizer
+func HashAnonymizer(salt string) Anonymizer {
+	return func(value any) any {
+		if value == nil {
+			return nil
+		}
+		sum := sha256.Sum256([]byte(salt + fmt.Sprint(value)))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// FakeAnonymizer 按格式生成伪造值，格式中的 %s 替换为原值的短哈希
+//
+//	@param format 格式，如 user_%s、%s@example.com、138%s
+//	@return Anonymizer
+func FakeAnonymizer(format string) Anonymizer {
+	return func(value any) any {
+		if value == nil {
+			return nil
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+		return fmt.Sprintf(format, hex.EncodeToString(sum[:4]))
+	}
+}
+
+// NullAnonymizer 将原值置空
+//
+//	@return Anonymizer
+func NullAnonymizer() Anonymizer {
+	return func(value any) any {
+		return nil
+	}
+}
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	Where       string                // 条件，为空导出全表
+	Args        []any                 // 条件参数
+	Anonymizers map[string]Anonymizer // 列名及匿名化方法，如 {"Phone": HashAnonymizer("s")}
+}
+
+// ExportTable 将表数据按每行一个JSON对象导出，导出时对指定列匿名化
+//
+//	@param db 数据库连接
+//	@param table 表名
+//	@param w 输出
+//	@param opts 导出选项
+//	@return int64 导出行数, error
+func ExportTable(db *gorm.DB, table string, w io.Writer, opts ExportOptions) (int64, error) {
+	query := db.Table(table)
+	if opts.Where != "" {
+		query = query.Where(opts.Where, opts.Args...)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	enc := json.NewEncoder(w)
+	count := int64(0)
+	for rows.Next() {
+		row := map[string]any{}
+		if err = db.ScanRows(rows, &row); err != nil {
+			return count, err
+		}
+		for col, fn := range opts.Anonymizers {
+			if v, ok := row[col]; ok {
+				row[col] = fn(v)
+			}
+		}
+		if err = enc.Encode(row); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
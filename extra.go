@@ -0,0 +1,147 @@
+package qdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+)
+
+// 扩展字段路径，如 device.name
+var extraPathRegex = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// extraHolder 拥有FullInfo扩展内容的模型，嵌入DbFull即可
+type extraHolder interface {
+	fullInfo() *string
+}
+
+// fullInfo 返回扩展内容字段
+func (m *DbFull) fullInfo() *string {
+	return &m.FullInfo
+}
+
+// GetExtra 将FullInfo作为JSON文档读取指定路径的值
+//
+//	@param model 嵌入DbFull的模型
+//	@param path 路径，多级使用.分隔，如 device.name
+//	@return V, bool 是否存在, error
+func GetExtra[V any](model extraHolder, path string) (V, bool, error) {
+	var value V
+	doc, err := loadExtra(model, path)
+	if err != nil {
+		return value, false, err
+	}
+	// 逐级查找
+	var node any = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return value, false, nil
+		}
+		if node, ok = m[key]; !ok {
+			return value, false, nil
+		}
+	}
+	// 通过json转换为目标类型
+	js, err := json.Marshal(node)
+	if err != nil {
+		return value, false, err
+	}
+	if err = json.Unmarshal(js, &value); err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+// SetExtra 将FullInfo作为JSON文档写入指定路径的值，中间节点不存在时自动创建
+//
+//	@param model 嵌入DbFull的模型
+//	@param path 路径，多级使用.分隔，如 device.name
+//	@param value 值，为nil时删除该路径
+//	@return error
+func SetExtra(model extraHolder, path string, value any) error {
+	doc, err := loadExtra(model, path)
+	if err != nil {
+		return err
+	}
+	keys := strings.Split(path, ".")
+	node := doc
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := node[key].(map[string]any)
+		if !ok {
+			if value == nil {
+				return nil
+			}
+			child = map[string]any{}
+			node[key] = child
+		}
+		node = child
+	}
+	if value == nil {
+		delete(node, keys[len(keys)-1])
+	} else {
+		node[keys[len(keys)-1]] = value
+	}
+	js, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	*model.fullInfo() = string(js)
+	return nil
+}
+
+// ExtraExpr 返回查询FullInfo中指定路径值的SQL表达式，用于条件查询
+//
+//	@param db 数据库连接
+//	@param path 路径，多级使用.分隔，如 device.name
+//	@return string 如 json_extract(FullInfo, '$.device.name'), error
+func ExtraExpr(db *gorm.DB, path string) (string, error) {
+	if !extraPathRegex.MatchString(path) {
+		return "", fmt.Errorf("invalid extra path %q", path)
+	}
+	if err := RequireFeature(db, FeatureJSON); err != nil {
+		return "", err
+	}
+	column := db.Statement.Quote(db.NamingStrategy.ColumnName("", "FullInfo"))
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return fmt.Sprintf("json_extract(%s, '$.%s')", column, path), nil
+	case "mysql":
+		return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '$.%s'))", column, path), nil
+	case "postgres":
+		return fmt.Sprintf("(%s::jsonb #>> '{%s}')", column, strings.ReplaceAll(path, ".", ",")), nil
+	case "sqlserver":
+		return fmt.Sprintf("JSON_VALUE(%s, '$.%s')", column, path), nil
+	}
+	return "", fmt.Errorf("%w: extra query on %s", ErrUnsupported, db.Dialector.Name())
+}
+
+// GetConditionsExtra 按FullInfo中指定路径的值查询一组列表
+//
+//	@param path 路径，多级使用.分隔，如 device.name
+//	@param value 值
+//	@return []*T, error
+func (dao *Dao[T]) GetConditionsExtra(path string, value any) ([]*T, error) {
+	expr, err := ExtraExpr(dao.DB(), path)
+	if err != nil {
+		return make([]*T, 0), err
+	}
+	return dao.GetConditions(expr+" = ?", value)
+}
+
+// loadExtra 校验路径并解析FullInfo内容
+func loadExtra(model extraHolder, path string) (map[string]any, error) {
+	if !extraPathRegex.MatchString(path) {
+		return nil, fmt.Errorf("invalid extra path %q", path)
+	}
+	doc := map[string]any{}
+	info := *model.fullInfo()
+	if info == "" {
+		return doc, nil
+	}
+	if err := json.Unmarshal([]byte(info), &doc); err != nil {
+		return nil, fmt.Errorf("FullInfo is not a json object: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,276 @@
+package qdb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/kamioair/utils/qcache"
+	"gorm.io/gorm"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// FallbackOptions 降级选项
+type FallbackOptions struct {
+	CacheTTL  time.Duration        // 查询结果缓存时长，主库不可用时使用，为0使用1小时
+	QueueFile string               // 离线写入队列文件，为空时写入失败直接返回错误
+	IsOutage  func(err error) bool // 判断是否为主库不可用，为空使用 IsConnError 及 ErrCircuitOpen
+}
+
+// Fallback 可降级的Dao，主库不可用时查询返回缓存数据，写入进入离线队列，恢复后通过 Flush 重放
+type Fallback[T any] struct {
+	dao   *Dao[T]
+	opts  FallbackOptions
+	cache *qcache.Caches[any]
+	lock  sync.Mutex
+}
+
+// queuedWrite 离线队列中的一次写入
+type queuedWrite struct {
+	Op     string                     `json:"op"` // Create、Update、Save、Delete
+	Id     uint64                     `json:"id,omitempty"`
+	Fields map[string]json.RawMessage `json:"fields,omitempty"` // 按 gorm 结构保存的列值，键为字段名
+}
+
+// WithFallback 返回可降级的Dao，用于网络中断时保持边缘端界面可用
+//
+//	@param opts 降级选项
+//	@return *Fallback[T]
+func (dao *Dao[T]) WithFallback(opts FallbackOptions) *Fallback[T] {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = time.Hour
+	}
+	if opts.IsOutage == nil {
+		opts.IsOutage = func(err error) bool {
+			return errors.Is(err, ErrCircuitOpen) || IsConnError(err)
+		}
+	}
+	return &Fallback[T]{dao: dao, opts: opts, cache: qcache.NewCaches[any](opts.CacheTTL, opts.CacheTTL, nil)}
+}
+
+// GetModel 查询一条记录，主库不可用时返回缓存
+//
+//	@param id 唯一号
+//	@return *T, bool 是否为可能过期的缓存数据, error
+func (f *Fallback[T]) GetModel(id uint64) (*T, bool, error) {
+	key := fmt.Sprintf("model:%d", id)
+	model, err := f.dao.GetModel(id)
+	if err == nil {
+		f.cache.Set(key, model)
+		return model, false, nil
+	}
+	if v, ok := f.cache.Get(key); ok && f.opts.IsOutage(err) {
+		return v.(*T), true, nil
+	}
+	return nil, false, err
+}
+
+// GetConditions 条件查询一组列表，主库不可用时返回缓存
+//
+//	@param query 条件
+//	@param args 条件参数
+//	@return []*T, bool 是否为可能过期的缓存数据, error
+func (f *Fallback[T]) GetConditions(query any, args ...any) ([]*T, bool, error) {
+	key := fmt.Sprintf("conditions:%v:%v", query, args)
+	list, err := f.dao.GetConditions(query, args...)
+	if err == nil {
+		f.cache.Set(key, list)
+		return list, false, nil
+	}
+	if v, ok := f.cache.Get(key); ok && f.opts.IsOutage(err) {
+		return v.([]*T), true, nil
+	}
+	return nil, false, err
+}
+
+// Create 新建一条记录，主库不可用时进入离线队列
+//
+//	@param model 待新增实体
+//	@return bool 是否进入离线队列, error
+func (f *Fallback[T]) Create(model *T) (bool, error) {
+	return f.write("Create", 0, model, f.dao.Create(model))
+}
+
+// Update 修改一条记录，主库不可用时进入离线队列
+//
+//	@param model 待更新实体
+//	@return bool 是否进入离线队列, error
+func (f *Fallback[T]) Update(model *T) (bool, error) {
+	return f.write("Update", 0, model, f.dao.Update(model))
+}
+
+// Save 保存一条记录，主库不可用时进入离线队列
+//
+//	@param model 待保存实体
+//	@return bool 是否进入离线队列, error
+func (f *Fallback[T]) Save(model *T) (bool, error) {
+	return f.write("Save", 0, model, f.dao.Save(model))
+}
+
+// Delete 删除一条记录，主库不可用时进入离线队列
+//
+//	@param id 唯一号
+//	@return bool 是否进入离线队列, error
+func (f *Fallback[T]) Delete(id uint64) (bool, error) {
+	return f.write("Delete", id, nil, f.dao.Delete(id))
+}
+
+// write 写入失败且为主库不可用时进入离线队列
+func (f *Fallback[T]) write(op string, id uint64, model *T, err error) (bool, error) {
+	if err == nil || f.opts.QueueFile == "" || !f.opts.IsOutage(err) {
+		return false, err
+	}
+	item := queuedWrite{Op: op, Id: id}
+	if model != nil {
+		fields, err := f.encode(model)
+		if err != nil {
+			return false, err
+		}
+		item.Fields = fields
+	}
+	line, _ := json.Marshal(item)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if err = os.MkdirAll(filepath.Dir(f.opts.QueueFile), 0777); err != nil {
+		return false, err
+	}
+	file, err := os.OpenFile(f.opts.QueueFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Flush 按顺序重放离线队列中的写入，遇到失败或无法解析的行时停止并保留未完成的部分
+//
+//	无法解析的行原样保留，需人工修正或删除后才能继续重放
+//
+//	@return int 已重放的数量, error
+func (f *Fallback[T]) Flush() (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.opts.QueueFile == "" {
+		return 0, nil
+	}
+	file, err := os.Open(f.opts.QueueFile)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	var lines [][]byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	_ = file.Close()
+	if err = scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	for _, line := range lines {
+		var item queuedWrite
+		if err = json.Unmarshal(line, &item); err != nil {
+			err = fmt.Errorf("qdb: fallback queue %s: unparseable line %d: %w", f.opts.QueueFile, done+1, err)
+			break
+		}
+		if err = f.replay(item); err != nil {
+			break
+		}
+		done++
+	}
+	// 原样保留未完成的部分
+	rest := make([]byte, 0)
+	for _, line := range lines[done:] {
+		rest = append(append(rest, line...), '\n')
+	}
+	if werr := os.WriteFile(f.opts.QueueFile, rest, 0666); werr != nil && err == nil {
+		err = werr
+	}
+	return done, err
+}
+
+// replay 重放一次写入
+func (f *Fallback[T]) replay(item queuedWrite) error {
+	if item.Op == "Delete" {
+		return f.dao.Delete(item.Id)
+	}
+	if item.Fields == nil {
+		return fmt.Errorf("queued %s has no fields", item.Op)
+	}
+	model := new(T)
+	if err := f.decode(item.Fields, model); err != nil {
+		return err
+	}
+	switch item.Op {
+	case "Create":
+		return f.dao.Create(model)
+	case "Update":
+		return f.dao.Update(model)
+	case "Save":
+		return f.dao.Save(model)
+	}
+	return fmt.Errorf("unknown queued op %s", item.Op)
+}
+
+// encode 按 gorm 结构逐列序列化，不受 json 标签影响
+func (f *Fallback[T]) encode(model *T) (map[string]json.RawMessage, error) {
+	stmt := &gorm.Statement{DB: f.dao.db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	rv := reflect.ValueOf(model).Elem()
+	fields := make(map[string]json.RawMessage, len(stmt.Schema.Fields))
+	for _, field := range stmt.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		v, zero := field.ValueOf(ctx, rv)
+		if zero {
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", stmt.Schema.Name, field.Name, err)
+		}
+		fields[field.Name] = data
+	}
+	return fields, nil
+}
+
+// decode 按 gorm 结构逐列还原 encode 的结果
+func (f *Fallback[T]) decode(fields map[string]json.RawMessage, model *T) error {
+	stmt := &gorm.Statement{DB: f.dao.db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	rv := reflect.ValueOf(model).Elem()
+	for name, data := range fields {
+		field := stmt.Schema.LookUpField(name)
+		if field == nil {
+			return fmt.Errorf("%s has no field %s", stmt.Schema.Name, name)
+		}
+		v := reflect.New(field.FieldType)
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return fmt.Errorf("%s.%s: %w", stmt.Schema.Name, name, err)
+		}
+		field.ReflectValueOf(ctx, rv).Set(v.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,512 @@
+package qdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 表达式最大嵌套层数
+const filterMaxDepth = 32
+
+// FilterField 允许过滤的字段
+type FilterField struct {
+	Column  string                   // 数据库列名
+	Convert func(v any) (any, error) // 值转换方法，可为空
+}
+
+// Filter 解析后的查询条件，可直接用于 GetConditions(f.Query, f.Args...)
+type Filter struct {
+	Query string
+	Args  []any
+}
+
+// FilterFields 按同名列生成允许过滤的字段白名单
+//
+//	@param names 字段名
+//	@return map[string]FilterField
+func FilterFields(names ...string) map[string]FilterField {
+	fields := make(map[string]FilterField, len(names))
+	for _, name := range names {
+		fields[name] = FilterField{Column: name}
+	}
+	return fields
+}
+
+// DateTimeValue 将日期字符串转换为 qtime.DateTime，用于 FilterField.Convert
+func DateTimeValue(v any) (any, error) {
+	str, ok := v.(string)
+	if !ok {
+		return v, nil
+	}
+	var dt qtime.DateTime
+	if err := dt.UnmarshalJSON([]byte(str)); err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// ParseFilter 解析过滤表达式
+//
+//	支持 eq ne gt ge lt le in、and or not、括号，以及 contains/startswith/endswith 函数
+//	如 status eq 1 and (lastTime gt '2024-01-01' or contains(name,'abc'))
+//
+//	@param expr 过滤表达式，为空时返回全部
+//	@param fields 允许过滤的字段白名单
+//	@return *Filter, error
+func ParseFilter(expr string, fields map[string]FilterField) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return &Filter{Query: "1 = 1"}, nil
+	}
+	p := &filterParser{tokens: tokens, fields: fields, filter: &Filter{}}
+	query, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("filter: unexpected %q", p.tokens[p.pos].text)
+	}
+	p.filter.Query = query
+	return p.filter, nil
+}
+
+// ParseFilterJSON 解析JSON格式的过滤条件，多个字段之间为and关系
+//
+//	如 {"status":1,"lastTime":{"gt":"2024-01-01"},"$or":[{"name":{"contains":"a"}},{"code":"b"}]}
+//
+//	@param data JSON内容，为空时返回全部
+//	@param fields 允许过滤的字段白名单
+//	@return *Filter, error
+func ParseFilterJSON(data []byte, fields map[string]FilterField) (*Filter, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return &Filter{Query: "1 = 1"}, nil
+	}
+	doc := map[string]any{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	f := &Filter{}
+	query, err := jsonFilter(doc, fields, f, 0)
+	if err != nil {
+		return nil, err
+	}
+	if query == "" {
+		query = "1 = 1"
+	}
+	f.Query = query
+	return f, nil
+}
+
+// jsonFilter 递归解析JSON过滤对象
+func jsonFilter(doc map[string]any, fields map[string]FilterField, f *Filter, depth int) (string, error) {
+	if depth > filterMaxDepth {
+		return "", fmt.Errorf("filter: too deep")
+	}
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := doc[key]
+		if key == "$or" || key == "$and" {
+			items, ok := value.([]any)
+			if !ok {
+				return "", fmt.Errorf("filter: %s requires an array", key)
+			}
+			subs := make([]string, 0, len(items))
+			for _, item := range items {
+				sub, ok := item.(map[string]any)
+				if !ok {
+					return "", fmt.Errorf("filter: %s requires objects", key)
+				}
+				q, err := jsonFilter(sub, fields, f, depth+1)
+				if err != nil {
+					return "", err
+				}
+				if q != "" {
+					subs = append(subs, "("+q+")")
+				}
+			}
+			if len(subs) > 0 {
+				parts = append(parts, "("+strings.Join(subs, " "+strings.ToUpper(key[1:])+" ")+")")
+			}
+			continue
+		}
+
+		ops, ok := value.(map[string]any)
+		if !ok {
+			ops = map[string]any{"eq": value}
+		}
+		opKeys := make([]string, 0, len(ops))
+		for k := range ops {
+			opKeys = append(opKeys, k)
+		}
+		sort.Strings(opKeys)
+		for _, op := range opKeys {
+			q, err := filterCompare(f, fields, key, op, ops[op])
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, q)
+		}
+	}
+	return strings.Join(parts, " AND "), nil
+}
+
+// filterCompare 生成单个比较条件
+func filterCompare(f *Filter, fields map[string]FilterField, name string, op string, value any) (string, error) {
+	field, ok := fields[name]
+	if !ok {
+		return "", fmt.Errorf("filter: field %q is not allowed", name)
+	}
+	return compareExpr(f, clause.Column{Name: field.Column}, name, op, value, field.Convert)
+}
+
+// compareExpr 生成单个比较条件，column 为 clause.Column 或 clause.Expr
+func compareExpr(f *Filter, column any, name string, op string, value any, conv func(v any) (any, error)) (string, error) {
+	convert := func(v any) (any, error) {
+		if conv == nil || v == nil {
+			return v, nil
+		}
+		return conv(v)
+	}
+
+	switch op {
+	case "eq", "ne":
+		if value == nil {
+			if op == "eq" {
+				f.Args = append(f.Args, column)
+				return "? IS NULL", nil
+			}
+			f.Args = append(f.Args, column)
+			return "? IS NOT NULL", nil
+		}
+		fallthrough
+	case "gt", "ge", "lt", "le":
+		v, err := convert(value)
+		if err != nil {
+			return "", fmt.Errorf("filter: field %q: %w", name, err)
+		}
+		f.Args = append(f.Args, column, v)
+		return "? " + filterOps[op] + " ?", nil
+	case "in":
+		items, ok := value.([]any)
+		if !ok || len(items) == 0 {
+			return "", fmt.Errorf("filter: in requires a non-empty list")
+		}
+		values := make([]any, 0, len(items))
+		for _, item := range items {
+			v, err := convert(item)
+			if err != nil {
+				return "", fmt.Errorf("filter: field %q: %w", name, err)
+			}
+			values = append(values, v)
+		}
+		f.Args = append(f.Args, column, values)
+		return "? IN ?", nil
+	case "contains", "startswith", "endswith":
+		str, ok := value.(string)
+		if !ok {
+			return "", fmt.Errorf("filter: %s requires a string", op)
+		}
+		str = likeEscape(str)
+		switch op {
+		case "contains":
+			str = "%" + str + "%"
+		case "startswith":
+			str = str + "%"
+		case "endswith":
+			str = "%" + str
+		}
+		f.Args = append(f.Args, column, str)
+		return "? LIKE ? ESCAPE '!'", nil
+	}
+	return "", fmt.Errorf("filter: unknown operator %q", op)
+}
+
+// 比较运算符
+var filterOps = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"gt": ">",
+	"ge": ">=",
+	"lt": "<",
+	"le": "<=",
+}
+
+// likeEscape 转义LIKE通配符，转义字符为!
+func likeEscape(str string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_", "[", "![").Replace(str)
+}
+
+// filterToken 词法单元
+type filterToken struct {
+	kind  byte // i 标识符，s 字符串，n 数字，p 符号
+	text  string
+	value any
+}
+
+// tokenizeFilter 词法分析
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	tokens := make([]filterToken, 0)
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, filterToken{kind: 'p', text: string(c)})
+			i++
+		case c == '\'':
+			// 字符串，两个单引号表示一个单引号
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(expr); j++ {
+				if expr[j] == '\'' {
+					if j+1 < len(expr) && expr[j+1] == '\'' {
+						sb.WriteByte('\'')
+						j++
+						continue
+					}
+					break
+				}
+				sb.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("filter: unterminated string")
+			}
+			tokens = append(tokens, filterToken{kind: 's', text: expr[i : j+1], value: sb.String()})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '.' || (expr[j] >= '0' && expr[j] <= '9')) {
+				j++
+			}
+			text := expr[i:j]
+			var value any
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				value = n
+			} else if fv, err := strconv.ParseFloat(text, 64); err == nil {
+				value = fv
+			} else {
+				return nil, fmt.Errorf("filter: invalid number %q", text)
+			}
+			tokens = append(tokens, filterToken{kind: 'n', text: text, value: value})
+			i = j
+		case c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z'):
+			j := i + 1
+			for j < len(expr) && (expr[j] == '_' || expr[j] == '.' || (expr[j] >= 'A' && expr[j] <= 'Z') ||
+				(expr[j] >= 'a' && expr[j] <= 'z') || (expr[j] >= '0' && expr[j] <= '9')) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: 'i', text: expr[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("filter: unexpected character %q", c)
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser 语法分析
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+	fields map[string]FilterField
+	filter *Filter
+}
+
+// peek 查看当前词法单元
+func (p *filterParser) peek() *filterToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// keyword 当前词法单元是否为指定关键字，是则前进
+func (p *filterParser) keyword(word string) bool {
+	t := p.peek()
+	if t != nil && t.kind == 'i' && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// symbol 当前词法单元是否为指定符号，是则前进
+func (p *filterParser) symbol(s string) bool {
+	t := p.peek()
+	if t != nil && t.kind == 'p' && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// expect 要求当前词法单元为指定符号
+func (p *filterParser) expect(s string) error {
+	if !p.symbol(s) {
+		if t := p.peek(); t != nil {
+			return fmt.Errorf("filter: expected %q but got %q", s, t.text)
+		}
+		return fmt.Errorf("filter: expected %q", s)
+	}
+	return nil
+}
+
+// parseOr or表达式
+func (p *filterParser) parseOr(depth int) (string, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return "", err
+		}
+		left = left + " OR " + right
+	}
+	return left, nil
+}
+
+// parseAnd and表达式
+func (p *filterParser) parseAnd(depth int) (string, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+	return left, nil
+}
+
+// parseUnary not、括号、函数或比较
+func (p *filterParser) parseUnary(depth int) (string, error) {
+	if depth > filterMaxDepth {
+		return "", fmt.Errorf("filter: too deep")
+	}
+	if p.keyword("not") {
+		q, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + q, nil
+	}
+	if p.symbol("(") {
+		q, err := p.parseOr(depth + 1)
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect(")"); err != nil {
+			return "", err
+		}
+		return "(" + q + ")", nil
+	}
+
+	t := p.peek()
+	if t == nil || t.kind != 'i' {
+		return "", fmt.Errorf("filter: expected field")
+	}
+	p.pos++
+	name := strings.ToLower(t.text)
+
+	// 函数
+	if name == "contains" || name == "startswith" || name == "endswith" {
+		if err := p.expect("("); err != nil {
+			return "", err
+		}
+		field := p.peek()
+		if field == nil || field.kind != 'i' {
+			return "", fmt.Errorf("filter: %s requires a field", name)
+		}
+		p.pos++
+		if err := p.expect(","); err != nil {
+			return "", err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect(")"); err != nil {
+			return "", err
+		}
+		return filterCompare(p.filter, p.fields, field.text, name, value)
+	}
+
+	// 比较
+	op := p.peek()
+	if op == nil || op.kind != 'i' {
+		return "", fmt.Errorf("filter: expected operator after %q", t.text)
+	}
+	p.pos++
+	opName := strings.ToLower(op.text)
+	if opName == "in" {
+		if err := p.expect("("); err != nil {
+			return "", err
+		}
+		values := make([]any, 0)
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return "", err
+			}
+			values = append(values, v)
+			if !p.symbol(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return "", err
+		}
+		return filterCompare(p.filter, p.fields, t.text, opName, values)
+	}
+	if _, ok := filterOps[opName]; !ok {
+		return "", fmt.Errorf("filter: unknown operator %q", op.text)
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return "", err
+	}
+	return filterCompare(p.filter, p.fields, t.text, opName, value)
+}
+
+// parseValue 字符串、数字、true、false、null
+func (p *filterParser) parseValue() (any, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("filter: expected value")
+	}
+	p.pos++
+	switch t.kind {
+	case 's', 'n':
+		return t.value, nil
+	case 'i':
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("filter: invalid value %q", t.text)
+}
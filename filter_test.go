@@ -0,0 +1,182 @@
+package qdb
+
+import (
+	"gorm.io/gorm/clause"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type filterItem struct {
+	DbSimple
+	Name  string
+	Count int
+}
+
+func filterCol(name string) clause.Column {
+	return clause.Column{Name: name}
+}
+
+func TestParseFilter(t *testing.T) {
+	fields := FilterFields("Name", "Count")
+	cases := []struct {
+		expr  string
+		query string
+		args  []any
+	}{
+		{"", "1 = 1", nil},
+		{"Name eq 'a'", "? = ?", []any{filterCol("Name"), "a"}},
+		{"Count ne 1", "? <> ?", []any{filterCol("Count"), int64(1)}},
+		{"Count gt -1.5", "? > ?", []any{filterCol("Count"), -1.5}},
+		{"Count GE 2", "? >= ?", []any{filterCol("Count"), int64(2)}},
+		{"Count lt 3", "? < ?", []any{filterCol("Count"), int64(3)}},
+		{"Count le 4", "? <= ?", []any{filterCol("Count"), int64(4)}},
+		{"Name eq null", "? IS NULL", []any{filterCol("Name")}},
+		{"Name ne null", "? IS NOT NULL", []any{filterCol("Name")}},
+		{"Count in (1, 2)", "? IN ?", []any{filterCol("Count"), []any{int64(1), int64(2)}}},
+		{"Name eq 'a' and Count eq 1 or not Count eq 2", "? = ? AND ? = ? OR NOT ? = ?",
+			[]any{filterCol("Name"), "a", filterCol("Count"), int64(1), filterCol("Count"), int64(2)}},
+		{"Name eq 'a' and (Count eq 1 or Count eq 2)", "? = ? AND (? = ? OR ? = ?)",
+			[]any{filterCol("Name"), "a", filterCol("Count"), int64(1), filterCol("Count"), int64(2)}},
+		{"contains(Name,'5%_!')", "? LIKE ? ESCAPE '!'", []any{filterCol("Name"), "%5!%!_!!%"}},
+		{"startswith(Name,'a')", "? LIKE ? ESCAPE '!'", []any{filterCol("Name"), "a%"}},
+		{"endswith(Name,'[a')", "? LIKE ? ESCAPE '!'", []any{filterCol("Name"), "%![a"}},
+		// 注入内容只会作为参数
+		{"Name eq 'x'' OR 1=1; DROP TABLE filter_items; --'", "? = ?",
+			[]any{filterCol("Name"), "x' OR 1=1; DROP TABLE filter_items; --"}},
+	}
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			f, err := ParseFilter(c.expr, fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Query != c.query {
+				t.Fatalf("query %q, want %q", f.Query, c.query)
+			}
+			if !reflect.DeepEqual(f.Args, c.args) {
+				t.Fatalf("args %#v, want %#v", f.Args, c.args)
+			}
+		})
+	}
+}
+
+func TestParseFilterInvalid(t *testing.T) {
+	fields := FilterFields("Name", "Count")
+	cases := []struct {
+		name string
+		expr string
+		err  string
+	}{
+		{"unknown field", "Secret eq 'a'", "not allowed"},
+		{"raw column", "1 eq 1", "expected field"},
+		{"function field", "contains(Secret,'a')", "not allowed"},
+		{"semicolon", "Name eq 'a'; DROP TABLE filter_items", "unexpected character"},
+		{"comment", "Name eq 'a' -- x", "invalid number"},
+		{"sql operator", "Name = 'a'", "unexpected character"},
+		{"unknown operator", "Name like 'a'", "unknown operator"},
+		{"trailing", "Name eq 'a' Count", "unexpected"},
+		{"unterminated string", "Name eq 'a", "unterminated string"},
+		{"missing value", "Name eq", "expected value"},
+		{"invalid value", "Name eq Count", "invalid value"},
+		{"missing operator", "Name", "expected operator"},
+		{"unbalanced open", "(Name eq 'a'", `expected ")"`},
+		{"unbalanced close", "Name eq 'a')", "unexpected"},
+		{"empty in", "Count in ()", "invalid value"},
+		{"contains number", "contains(Name,1)", "requires a string"},
+		{"invalid number", "Count eq 1.2.3", "invalid number"},
+		{"too deep", strings.Repeat("(", filterMaxDepth+2) + "Count eq 1" + strings.Repeat(")", filterMaxDepth+2), "too deep"},
+		{"not too deep", strings.Repeat("not ", filterMaxDepth+2) + "Count eq 1", "too deep"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseFilter(c.expr, fields)
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("error %v, want %q", err, c.err)
+			}
+		})
+	}
+}
+
+func TestParseFilterJSON(t *testing.T) {
+	fields := FilterFields("Name", "Count")
+	cases := []struct {
+		json  string
+		query string
+		args  []any
+		err   string
+	}{
+		{"", "1 = 1", nil, ""},
+		{`{}`, "1 = 1", nil, ""},
+		{`{"Name":"a"}`, "? = ?", []any{filterCol("Name"), "a"}, ""},
+		{`{"Name":null}`, "? IS NULL", []any{filterCol("Name")}, ""},
+		{`{"Count":{"ge":1,"lt":3}}`, "? >= ? AND ? < ?", []any{filterCol("Count"), float64(1), filterCol("Count"), float64(3)}, ""},
+		{`{"Count":{"in":[1,2]}}`, "? IN ?", []any{filterCol("Count"), []any{float64(1), float64(2)}}, ""},
+		{`{"$or":[{"Name":{"contains":"%"}},{"Count":1}]}`, "((? LIKE ? ESCAPE '!') OR (? = ?))",
+			[]any{filterCol("Name"), "%!%%", filterCol("Count"), float64(1)}, ""},
+		{`{"Secret":"a"}`, "", nil, "not allowed"},
+		{`{"Name":{"like":"a"}}`, "", nil, "unknown operator"},
+		{`{"Count":{"in":[]}}`, "", nil, "non-empty list"},
+		{`{"$or":{"Name":"a"}}`, "", nil, "requires an array"},
+		{`{"$and":["a"]}`, "", nil, "requires objects"},
+		{`{"Name":`, "", nil, "filter:"},
+		{strings.Repeat(`{"$or":[`, filterMaxDepth+2) + `{}` + strings.Repeat(`]}`, filterMaxDepth+2), "", nil, "too deep"},
+	}
+	for _, c := range cases {
+		t.Run(c.json, func(t *testing.T) {
+			f, err := ParseFilterJSON([]byte(c.json), fields)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("error %v, want %q", err, c.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Query != c.query {
+				t.Fatalf("query %q, want %q", f.Query, c.query)
+			}
+			if !reflect.DeepEqual(f.Args, c.args) {
+				t.Fatalf("args %#v, want %#v", f.Args, c.args)
+			}
+		})
+	}
+}
+
+func TestFilterQuery(t *testing.T) {
+	dao, err := TryNewDao[filterItem](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range []*filterItem{{Name: "a%b", Count: 1}, {Name: "ab", Count: 2}, {Name: "x'y", Count: 3}} {
+		if err = dao.Create(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		expr string
+		want int
+	}{
+		{"", 3},
+		{"contains(Name,'%')", 1},
+		{"startswith(Name,'a')", 2},
+		{"Name eq 'x''y'", 1},
+		{"Name eq 'x'' OR ''1''=''1'", 0},
+		{"Count in (1, 3) and not Name eq 'ab'", 2},
+		{"Count gt 1 and (Name eq 'ab' or Name eq 'a%b')", 1},
+	}
+	for _, c := range cases {
+		f, err := ParseFilter(c.expr, FilterFields("Name", "Count"))
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		list, err := dao.GetConditions(f.Query, f.Args...)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expr, err)
+		}
+		if len(list) != c.want {
+			t.Fatalf("%s: got %d rows, want %d", c.expr, len(list), c.want)
+		}
+	}
+}
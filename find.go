@@ -0,0 +1,119 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+// FindOptions 组合查询参数
+type FindOptions struct {
+	Where   any      // 条件，如 id = ? 或 id IN (?)，也可以是map或结构体，为空查询全部
+	Args    []any    // 条件参数
+	Order   string   // 排序，如 id asc, time desc，为空使用默认排序
+	Limit   int      // 最大数量，0不限制
+	Offset  int      // 跳过数量
+	Select  []string // 查询的列，为空查询全部
+	Preload []string // 预加载的关联
+}
+
+// Find 按组合参数查询一组列表，条件、排序、分页、列和预加载可同时使用
+//
+//	@param opts 查询参数
+//	@return []*T, error
+func (dao *Dao[T]) Find(opts FindOptions) ([]*T, error) {
+	list := make([]*T, 0)
+	err := dao.exec("Find", OpRead, func(op *Operation) error {
+		result := dao.find(op.DB, opts, true).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// FindAndCount 按组合参数查询一组列表，同时返回不分页时的总数
+//
+//	支持窗口函数的数据库使用 COUNT(*) OVER() 单次查询，其他数据库或有预加载时分两次查询
+//
+//	@param opts 查询参数
+//	@return []*T, int64 总数, error
+func (dao *Dao[T]) FindAndCount(opts FindOptions) ([]*T, int64, error) {
+	list := make([]*T, 0)
+	var total int64
+	err := dao.exec("FindAndCount", OpRead, func(op *Operation) error {
+		info, err := ServerInfo(op.DB)
+		if err != nil || !info.Supports(FeatureWindow) || len(opts.Preload) > 0 {
+			result := dao.find(op.DB, opts, true).Find(&list)
+			if result.Error != nil {
+				return result.Error
+			}
+			op.RowsAffected = result.RowsAffected
+			return dao.find(op.DB, opts, false).Model(new(T)).Count(&total).Error
+		}
+
+		// 结果行附加总数列，扫描到包含T和总数的临时结构
+		rowType := reflect.StructOf([]reflect.StructField{
+			{Name: "Model", Type: reflect.TypeOf(new(T)).Elem(), Tag: `gorm:"embedded"`},
+			{Name: "QdbTotal", Type: reflect.TypeOf(int64(0)), Tag: `gorm:"column:qdb_total"`},
+		})
+		rows := reflect.New(reflect.SliceOf(rowType))
+		db := dao.find(op.DB, opts, true).Model(new(T))
+		if len(opts.Select) > 0 {
+			db = db.Select(append(append([]string{}, opts.Select...), "COUNT(*) OVER() AS qdb_total"))
+		} else {
+			db = db.Select("?.*, COUNT(*) OVER() AS qdb_total", clause.Table{Name: clause.CurrentTable})
+		}
+		result := db.Find(rows.Interface())
+		if result.Error != nil {
+			return result.Error
+		}
+		op.RowsAffected = result.RowsAffected
+		for i := 0; i < rows.Elem().Len(); i++ {
+			row := rows.Elem().Index(i)
+			list = append(list, row.Field(0).Addr().Interface().(*T))
+			total = row.Field(1).Int()
+		}
+		// 临时结构不是模型类型，查询回调未转换UTC时间
+		if _, ok := op.DB.Config.Plugins[utcPlugin{}.Name()]; ok {
+			stmt := &gorm.Statement{DB: op.DB}
+			if err = stmt.Parse(new(T)); err != nil {
+				return err
+			}
+			convertSchemaDateTimes(op.Context(), stmt.Schema, reflect.ValueOf(list), LocalDateTime)
+		}
+		// 超出最后一页时没有结果行，单独查询总数
+		if len(list) == 0 && opts.Offset > 0 {
+			return dao.find(op.DB, opts, false).Model(new(T)).Count(&total).Error
+		}
+		return nil
+	})
+	return list, total, err
+}
+
+// find 应用组合查询参数，page 为false时不应用排序和分页
+func (dao *Dao[T]) find(db *gorm.DB, opts FindOptions, page bool) *gorm.DB {
+	// 总数与列表使用相同的分区时间窗口
+	if page {
+		db = dao.listOrder(db, opts.Order)
+	} else {
+		db = dao.partitionRange(dao.query(db), true)
+	}
+	if opts.Where != nil {
+		db = db.Where(opts.Where, opts.Args...)
+	}
+	if len(opts.Select) > 0 {
+		db = db.Select(opts.Select)
+	}
+	for _, p := range opts.Preload {
+		db = db.Preload(p)
+	}
+	if page {
+		if opts.Limit > 0 {
+			db = db.Limit(opts.Limit)
+		}
+		if opts.Offset > 0 {
+			db = db.Offset(opts.Offset)
+		}
+	}
+	return db
+}
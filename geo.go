@@ -0,0 +1,306 @@
+package qdb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"math"
+)
+
+// SRIDWGS84 WGS84经纬度坐标系
+const SRIDWGS84 = 4326
+
+// WKB 几何类型
+const (
+	wkbPoint    = 1
+	ewkbSRIDBit = 0x20000000
+)
+
+// Point 经纬度坐标点，WGS84坐标系
+//
+// 建表时 mysql 为 point SRID 4326、postgres 为 geometry(Point,4326)（需安装PostGIS）、sqlserver 为 geography，
+// sqlite 以十六进制 EWKB 文本存储，不支持空间查询
+type Point struct {
+	Lng float64 // 经度
+	Lat float64 // 纬度
+}
+
+// GormDataType 通用数据类型
+func (Point) GormDataType() string {
+	return "geometry"
+}
+
+// GormDBDataType 各数据库的建表类型
+func (Point) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "point SRID 4326"
+	case "postgres":
+		return "geometry(Point,4326)"
+	case "sqlserver":
+		return "geography"
+	default:
+		return "text"
+	}
+}
+
+// GormValue 写入值
+func (p Point) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	return Geometry{SRID: SRIDWGS84, WKB: p.wkb()}.GormValue(ctx, db)
+}
+
+// Scan 读取值
+func (p *Point) Scan(src any) error {
+	// sqlserver geography 单点格式：SRID(4) 版本(1) 标记(1) 纬度(8) 经度(8)
+	if b, ok := src.([]byte); ok && len(b) == 22 && b[5] == 0x0C {
+		p.Lat = math.Float64frombits(binary.LittleEndian.Uint64(b[6:]))
+		p.Lng = math.Float64frombits(binary.LittleEndian.Uint64(b[14:]))
+		return nil
+	}
+	var g Geometry
+	if err := g.Scan(src); err != nil {
+		return err
+	}
+	if g.WKB == nil {
+		*p = Point{}
+		return nil
+	}
+	point, err := g.Point()
+	if err != nil {
+		return err
+	}
+	*p = point
+	return nil
+}
+
+// wkb 小端序WKB
+func (p Point) wkb() []byte {
+	b := make([]byte, 21)
+	b[0] = 1
+	binary.LittleEndian.PutUint32(b[1:], wkbPoint)
+	binary.LittleEndian.PutUint64(b[5:], math.Float64bits(p.Lng))
+	binary.LittleEndian.PutUint64(b[13:], math.Float64bits(p.Lat))
+	return b
+}
+
+// Geometry 任意几何对象，以WKB保存，可通过 go-geom、orb 等库解析
+//
+// 建表时 mysql、postgres 为 geometry、sqlserver 为 geography，sqlite 以十六进制 EWKB 文本存储；
+// sqlserver 读取时需查询 列.STAsBinary() 并以 SRID 为0的WKB扫描
+type Geometry struct {
+	SRID int    // 坐标系，如 4326
+	WKB  []byte // WKB内容，为nil表示NULL
+}
+
+// GormDataType 通用数据类型
+func (Geometry) GormDataType() string {
+	return "geometry"
+}
+
+// GormDBDataType 各数据库的建表类型
+func (Geometry) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql", "postgres":
+		return "geometry"
+	case "sqlserver":
+		return "geography"
+	default:
+		return "text"
+	}
+}
+
+// GormValue 写入值
+func (g Geometry) GormValue(_ context.Context, db *gorm.DB) clause.Expr {
+	if g.WKB == nil {
+		return clause.Expr{SQL: "NULL"}
+	}
+	switch db.Dialector.Name() {
+	case "mysql":
+		return clause.Expr{SQL: "ST_GeomFromWKB(?, ?, 'axis-order=long-lat')", Vars: []any{g.WKB, g.SRID}}
+	case "postgres":
+		return clause.Expr{SQL: "ST_SetSRID(ST_GeomFromWKB(?), ?)", Vars: []any{g.WKB, g.SRID}}
+	case "sqlserver":
+		return clause.Expr{SQL: "geography::STGeomFromWKB(?, ?)", Vars: []any{g.WKB, g.SRID}}
+	default:
+		return clause.Expr{SQL: "?", Vars: []any{hex.EncodeToString(toEWKB(g.SRID, g.WKB))}}
+	}
+}
+
+// Scan 读取值，兼容 mysql 内部格式、postgres 和 sqlite 的十六进制 EWKB 及普通WKB
+func (g *Geometry) Scan(src any) error {
+	var b []byte
+	switch x := src.(type) {
+	case nil:
+		*g = Geometry{}
+		return nil
+	case []byte:
+		b = x
+	case string:
+		b = []byte(x)
+	default:
+		return fmt.Errorf("qdb: cannot convert %T to geometry", src)
+	}
+	if len(b) == 0 {
+		*g = Geometry{}
+		return nil
+	}
+	// 十六进制文本
+	if decoded, err := hex.DecodeString(string(b)); err == nil && len(decoded) >= 5 {
+		g.SRID, g.WKB = fromEWKB(decoded)
+		return nil
+	}
+	// mysql 内部格式：小端序SRID(4) + WKB
+	if len(b) >= 9 && b[4] <= 1 {
+		g.SRID = int(binary.LittleEndian.Uint32(b))
+		g.WKB = append([]byte(nil), b[4:]...)
+		return nil
+	}
+	if b[0] <= 1 {
+		g.SRID, g.WKB = fromEWKB(append([]byte(nil), b...))
+		return nil
+	}
+	return fmt.Errorf("qdb: unknown geometry format")
+}
+
+// Point 将点类型的几何对象转换为 Point
+//
+//	@return Point, error
+func (g Geometry) Point() (Point, error) {
+	if len(g.WKB) < 21 {
+		return Point{}, fmt.Errorf("qdb: invalid point wkb")
+	}
+	order := byteOrder(g.WKB[0])
+	if typ := order.Uint32(g.WKB[1:]); typ%1000 != wkbPoint {
+		return Point{}, fmt.Errorf("qdb: geometry type %d is not a point", typ)
+	}
+	return Point{
+		Lng: math.Float64frombits(order.Uint64(g.WKB[5:])),
+		Lat: math.Float64frombits(order.Uint64(g.WKB[13:])),
+	}, nil
+}
+
+// byteOrder WKB字节序
+func byteOrder(flag byte) binary.ByteOrder {
+	if flag == 0 {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// toEWKB 在WKB中写入SRID
+func toEWKB(srid int, wkb []byte) []byte {
+	if len(wkb) < 5 {
+		return wkb
+	}
+	order := byteOrder(wkb[0])
+	out := make([]byte, 9, len(wkb)+4)
+	out[0] = wkb[0]
+	order.PutUint32(out[1:], order.Uint32(wkb[1:])|ewkbSRIDBit)
+	order.PutUint32(out[5:], uint32(srid))
+	return append(out, wkb[5:]...)
+}
+
+// fromEWKB 读取EWKB中的SRID并返回普通WKB，不含SRID时SRID为0
+func fromEWKB(b []byte) (int, []byte) {
+	if len(b) < 5 {
+		return 0, b
+	}
+	order := byteOrder(b[0])
+	typ := order.Uint32(b[1:])
+	if typ&ewkbSRIDBit == 0 || len(b) < 9 {
+		return 0, b
+	}
+	srid := int(order.Uint32(b[5:]))
+	out := make([]byte, 5, len(b)-4)
+	out[0] = b[0]
+	order.PutUint32(out[1:], typ&^ewkbSRIDBit)
+	return srid, append(out, b[9:]...)
+}
+
+// WithinRadius 查询距中心点指定距离（米）内的记录，按球面距离计算
+//
+//	sqlite 不支持，查询返回 ErrUnsupported
+//
+//	@param column 点类型列名，如 Location
+//	@param center 中心点
+//	@param meters 距离，单位米
+//	@return QueryOpt
+func WithinRadius(column string, center Point, meters float64) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		col := clause.Column{Name: column}
+		switch db.Dialector.Name() {
+		case "mysql":
+			return db.Where("ST_Distance_Sphere(?, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) <= ?", col, pointWKT(center), meters)
+		case "postgres":
+			return db.Where("ST_DWithin(?::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)", col, center.Lng, center.Lat, meters)
+		case "sqlserver":
+			return db.Where("?.STDistance(geography::Point(?, ?, 4326)) <= ?", col, center.Lat, center.Lng, meters)
+		}
+		_ = db.AddError(fmt.Errorf("%w: spatial query on %s", ErrUnsupported, db.Dialector.Name()))
+		return db
+	}
+}
+
+// InBBox 查询位于矩形范围内的记录，mysql、postgres 可使用空间索引
+//
+//	sqlite 不支持，查询返回 ErrUnsupported
+//
+//	@param column 点类型列名，如 Location
+//	@param sw 西南角，经纬度最小值
+//	@param ne 东北角，经纬度最大值
+//	@return QueryOpt
+func InBBox(column string, sw, ne Point) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		col := clause.Column{Name: column}
+		switch db.Dialector.Name() {
+		case "mysql":
+			polygon := fmt.Sprintf("POLYGON((%s, %s, %s, %s, %s))", coord(sw.Lng, sw.Lat), coord(ne.Lng, sw.Lat),
+				coord(ne.Lng, ne.Lat), coord(sw.Lng, ne.Lat), coord(sw.Lng, sw.Lat))
+			return db.Where("MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), ?)", polygon, col)
+		case "postgres":
+			return db.Where("? && ST_MakeEnvelope(?, ?, ?, ?, 4326)", col, sw.Lng, sw.Lat, ne.Lng, ne.Lat)
+		case "sqlserver":
+			return db.Where("?.Long BETWEEN ? AND ? AND ?.Lat BETWEEN ? AND ?", col, sw.Lng, ne.Lng, col, sw.Lat, ne.Lat)
+		}
+		_ = db.AddError(fmt.Errorf("%w: spatial query on %s", ErrUnsupported, db.Dialector.Name()))
+		return db
+	}
+}
+
+// OrderByDistance 按距中心点的距离由近到远排序
+//
+//	@param column 点类型列名，如 Location
+//	@param center 中心点
+//	@return QueryOpt
+func OrderByDistance(column string, center Point) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		col := clause.Column{Name: column}
+		var expr clause.Expr
+		switch db.Dialector.Name() {
+		case "mysql":
+			expr = gorm.Expr("ST_Distance_Sphere(?, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))", col, pointWKT(center))
+		case "postgres":
+			expr = gorm.Expr("? <-> ST_SetSRID(ST_MakePoint(?, ?), 4326)", col, center.Lng, center.Lat)
+		case "sqlserver":
+			expr = gorm.Expr("?.STDistance(geography::Point(?, ?, 4326))", col, center.Lat, center.Lng)
+		default:
+			_ = db.AddError(fmt.Errorf("%w: spatial query on %s", ErrUnsupported, db.Dialector.Name()))
+			return db
+		}
+		return db.Clauses(clause.OrderBy{Expression: expr})
+	}
+}
+
+// pointWKT 点的WKT文本，经度在前
+func pointWKT(p Point) string {
+	return "POINT(" + coord(p.Lng, p.Lat) + ")"
+}
+
+// coord WKT坐标
+func coord(x, y float64) string {
+	return fmt.Sprintf("%v %v", x, y)
+}
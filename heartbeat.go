@@ -0,0 +1,115 @@
+package qdb
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/rand"
+	"time"
+)
+
+// DbHeartbeat 节点心跳记录
+type DbHeartbeat struct {
+	Node      string         `gorm:"primaryKey;size:128"` // 节点标识，如设备号
+	Info      string         `gorm:"size:2000"`           // 节点状态，JSON
+	StartTime qtime.DateTime // 节点本次启动时间
+	LastTime  qtime.DateTime `gorm:"index"` // 最后心跳时间
+}
+
+// TableName 表名
+func (DbHeartbeat) TableName() string {
+	return "qdb_heartbeat"
+}
+
+// Heartbeat 节点心跳，按间隔写入 qdb_heartbeat 表，每次只执行一条 upsert，用于设备、服务实例的在线监控
+type Heartbeat struct {
+	db       *gorm.DB
+	node     string
+	interval time.Duration
+	start    qtime.DateTime
+	Info     func() any // 每次心跳附带的状态，如版本、负载，为空不附带
+}
+
+// NewHeartbeat 创建节点心跳，表不存在时自动创建
+//
+//	@param db 数据库连接
+//	@param node 节点标识
+//	@param interval 心跳间隔，实际间隔在其上下10%内随机，避免大量节点同时写入
+//	@return *Heartbeat, error
+func NewHeartbeat(db *gorm.DB, node string, interval time.Duration) (*Heartbeat, error) {
+	if err := ensureTable(db, &DbHeartbeat{}); err != nil {
+		return nil, err
+	}
+	return &Heartbeat{db: db, node: node, interval: interval, start: qtime.NewDateTime(now())}, nil
+}
+
+// Beat 写入一次心跳
+//
+//	@param ctx 上下文
+//	@return error
+func (h *Heartbeat) Beat(ctx context.Context) error {
+	row := &DbHeartbeat{Node: h.node, StartTime: h.start, LastTime: qtime.NewDateTime(now())}
+	if h.Info != nil {
+		if info := h.Info(); info != nil {
+			js, err := json.Marshal(info)
+			if err != nil {
+				return err
+			}
+			row.Info = string(js)
+		}
+	}
+	return h.db.WithContext(ctx).Set("qdb:skip_stats", true).Set("qdb:skip_slow_log", true).
+		Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error
+}
+
+// Run 立即写入一次心跳，之后按间隔循环写入，直到上下文结束
+//
+//	@param ctx 上下文
+//	@param onError 写入失败回调，为空忽略
+func (h *Heartbeat) Run(ctx context.Context, onError func(err error)) {
+	for {
+		if err := h.Beat(ctx); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		wait := h.interval
+		if jitter := int64(h.interval / 5); jitter > 0 {
+			wait += time.Duration(rand.Int63n(jitter)) - h.interval/10
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// StaleNodes 查询超过指定时长没有心跳的节点，按最后心跳时间排序
+//
+//	@param db 数据库连接
+//	@param maxAge 最长无心跳时长，通常为心跳间隔的2到3倍
+//	@return []*DbHeartbeat, error
+func StaleNodes(db *gorm.DB, maxAge time.Duration) ([]*DbHeartbeat, error) {
+	if err := ensureTable(db, &DbHeartbeat{}); err != nil {
+		return nil, err
+	}
+	list := make([]*DbHeartbeat, 0)
+	column := fieldColumn(db, &DbHeartbeat{}, "LastTime")
+	err := db.Where(clause.Lt{Column: column, Value: qtime.NewDateTime(now().Add(-maxAge))}).
+		Order(clause.OrderByColumn{Column: column}).Find(&list).Error
+	return list, err
+}
+
+// Nodes 查询全部节点的心跳记录
+//
+//	@param db 数据库连接
+//	@return []*DbHeartbeat, error
+func Nodes(db *gorm.DB) ([]*DbHeartbeat, error) {
+	if err := ensureTable(db, &DbHeartbeat{}); err != nil {
+		return nil, err
+	}
+	list := make([]*DbHeartbeat, 0)
+	err := db.Order(clause.OrderByColumn{Column: fieldColumn(db, &DbHeartbeat{}, "Node")}).Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,174 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UseIndex 建议使用的索引，用于查询
+//
+//	mysql 生成 USE INDEX，sqlserver 生成 WITH (INDEX(...))，其他数据库忽略
+//
+//	@param names 索引名称，如 idx_last_time
+//	@return QueryOpt
+func UseIndex(names ...string) QueryOpt {
+	return indexHintOpt(false, names)
+}
+
+// ForceIndex 强制使用的索引，用于查询
+//
+//	mysql 生成 FORCE INDEX，sqlserver 生成 WITH (INDEX(...))，sqlite 生成 INDEXED BY（仅使用第一个），postgres忽略
+//
+//	@param names 索引名称，如 idx_last_time
+//	@return QueryOpt
+func ForceIndex(names ...string) QueryOpt {
+	return indexHintOpt(true, names)
+}
+
+// indexHintOpt 按数据库类型生成索引提示
+func indexHintOpt(force bool, names []string) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(names) == 0 {
+			return db
+		}
+		hint := indexHint{dialect: db.Dialector.Name(), force: force, names: names}
+		switch hint.dialect {
+		case "mysql", "sqlserver":
+		case "sqlite":
+			if !force {
+				return db
+			}
+		default:
+			return db
+		}
+		return db.Clauses(hint)
+	}
+}
+
+// indexHint 索引提示，写在 FROM 表名之后
+type indexHint struct {
+	dialect string
+	force   bool
+	names   []string
+}
+
+// Name 子句名称
+func (h indexHint) Name() string {
+	return "qdb:index_hint"
+}
+
+// Build 生成提示
+func (h indexHint) Build(builder clause.Builder) {
+	switch h.dialect {
+	case "mysql":
+		if h.force {
+			builder.WriteString("FORCE INDEX (")
+		} else {
+			builder.WriteString("USE INDEX (")
+		}
+		h.writeNames(builder, h.names)
+		builder.WriteByte(')')
+	case "sqlserver":
+		builder.WriteString("WITH (INDEX(")
+		h.writeNames(builder, h.names)
+		builder.WriteString("))")
+	case "sqlite":
+		builder.WriteString("INDEXED BY ")
+		builder.WriteQuoted(h.names[0])
+	}
+}
+
+// writeNames 写入以逗号分隔的索引名称
+func (h indexHint) writeNames(builder clause.Builder, names []string) {
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteQuoted(name)
+	}
+}
+
+// MergeClause 合并子句
+func (h indexHint) MergeClause(c *clause.Clause) {
+	c.Expression = h
+}
+
+// ModifyStatement 将提示附加到 FROM 子句之后，多个提示依次输出
+func (h indexHint) ModifyStatement(stmt *gorm.Statement) {
+	hints := fromHintsOf(stmt)
+	hints.index = append(hints.index, h)
+	hints.apply(stmt)
+}
+
+// tableHint sqlserver 的表提示，如 UPDLOCK、READPAST，与索引提示合并到 FROM 表名之后的同一个 WITH 中
+type tableHint []string
+
+// Name 子句名称
+func (h tableHint) Name() string {
+	return "qdb:table_hint"
+}
+
+// Build 生成提示
+func (h tableHint) Build(builder clause.Builder) {
+	fromHints{with: h}.Build(builder)
+}
+
+// MergeClause 合并子句
+func (h tableHint) MergeClause(c *clause.Clause) {
+	c.Expression = h
+}
+
+// ModifyStatement 将提示附加到 FROM 子句之后
+func (h tableHint) ModifyStatement(stmt *gorm.Statement) {
+	hints := fromHintsOf(stmt)
+	hints.with = append(hints.with, h...)
+	hints.apply(stmt)
+}
+
+// fromHints 写在 FROM 表名之后的全部提示
+type fromHints struct {
+	index []indexHint
+	with  []string // sqlserver 的表提示
+}
+
+// fromHintsOf 返回语句中已附加的提示
+func fromHintsOf(stmt *gorm.Statement) fromHints {
+	hints, _ := stmt.Clauses["FROM"].AfterExpression.(fromHints)
+	return hints
+}
+
+// apply 写回 FROM 子句
+func (hs fromHints) apply(stmt *gorm.Statement) {
+	from := stmt.Clauses["FROM"]
+	from.AfterExpression = hs
+	stmt.Clauses["FROM"] = from
+}
+
+// Build 以空格分隔输出，sqlserver 的表提示和索引提示合并到同一个 WITH 中
+func (hs fromHints) Build(builder clause.Builder) {
+	if len(hs.with) > 0 || (len(hs.index) > 0 && hs.index[0].dialect == "sqlserver") {
+		builder.WriteString("WITH (")
+		for i, w := range hs.with {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			builder.WriteString(w)
+		}
+		for i, h := range hs.index {
+			if i > 0 || len(hs.with) > 0 {
+				builder.WriteString(", ")
+			}
+			builder.WriteString("INDEX(")
+			h.writeNames(builder, h.names)
+			builder.WriteByte(')')
+		}
+		builder.WriteByte(')')
+		return
+	}
+	for i, h := range hs.index {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		h.Build(builder)
+	}
+}
@@ -0,0 +1,45 @@
+package qdb
+
+import (
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"testing"
+)
+
+type hintRow struct {
+	DbSimple
+	Name string
+}
+
+func TestHintsMerged(t *testing.T) {
+	cases := []struct {
+		name      string
+		dialector gorm.Dialector
+		opts      []QueryOpt
+		want      string
+	}{
+		{"sqlserver", sqlserver.New(sqlserver.Config{DSN: "sqlserver://u:p@localhost:1433?database=x"}),
+			[]QueryOpt{SkipLocked(), UseIndex("idx_a"), ForceIndex("idx_b")},
+			`SELECT * FROM "hint_rows" WITH (UPDLOCK, READPAST, ROWLOCK, INDEX("idx_a"), INDEX("idx_b"))`},
+		{"sqlserver index", sqlserver.New(sqlserver.Config{DSN: "sqlserver://u:p@localhost:1433?database=x"}),
+			[]QueryOpt{UseIndex("idx_a")},
+			`SELECT * FROM "hint_rows" WITH (INDEX("idx_a"))`},
+		{"mysql", mysql.New(mysql.Config{DSN: "u:p@tcp(localhost:3306)/x", SkipInitializeWithVersion: true}),
+			[]QueryOpt{SkipLocked(), UseIndex("idx_a"), ForceIndex("idx_b")},
+			"SELECT * FROM `hint_rows` USE INDEX (`idx_a`) FORCE INDEX (`idx_b`) FOR UPDATE SKIP LOCKED"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			db, err := gorm.Open(c.dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var list []hintRow
+			got := applyOpts(db.Model(&hintRow{}), c.opts).Find(&list).Statement.SQL.String()
+			if got != c.want {
+				t.Fatalf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
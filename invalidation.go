@@ -0,0 +1,88 @@
+package qdb
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// PubSub 发布订阅客户端，由使用方基于 Redis、MQTT 等客户端实现，qdb 不依赖具体客户端
+//
+//	如 Redis：Publish 调用 PUBLISH，Subscribe 调用 SUBSCRIBE 并在后台读取消息直到上下文结束
+type PubSub interface {
+	// Publish 发布消息
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe 订阅主题，订阅成功后返回，之后收到的消息交给 handler 处理，直到上下文结束
+	Subscribe(ctx context.Context, topic string, handler func(payload []byte)) error
+}
+
+// invalidation 失效消息
+type invalidation struct {
+	Node  string `json:"node"`          // 发布实例
+	Cache string `json:"cache"`         // 缓存名称
+	Key   string `json:"key,omitempty"` // 键，为空表示全部
+}
+
+// InvalidationBus 跨实例的缓存失效总线，本实例写入后发布失效消息，其他实例收到后清除对应缓存
+//
+//	KV、Dict 通过 UseBus 接入，自定义缓存通过 Register 和 Invalidate 接入
+type InvalidationBus struct {
+	ps       PubSub
+	topic    string
+	node     string
+	lock     sync.RWMutex
+	handlers map[string][]func(key string)
+	OnError  func(err error) // 发布失败回调，为空忽略，失败时其他实例的缓存在过期后才更新
+}
+
+// NewInvalidationBus 创建缓存失效总线并订阅主题
+//
+//	@param ctx 上下文，结束后停止订阅
+//	@param ps 发布订阅客户端
+//	@param topic 主题，同一组实例使用相同主题，如 qdb:invalidate:orders
+//	@return *InvalidationBus, error
+func NewInvalidationBus(ctx context.Context, ps PubSub, topic string) (*InvalidationBus, error) {
+	b := &InvalidationBus{ps: ps, topic: topic, node: lockOwner(), handlers: map[string][]func(key string){}}
+	if err := ps.Subscribe(ctx, topic, b.receive); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Register 注册缓存的清除方法，收到其他实例发布的失效消息时调用
+//
+//	@param cache 缓存名称
+//	@param fn 清除方法，key 为空时清除全部
+func (b *InvalidationBus) Register(cache string, fn func(key string)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handlers[cache] = append(b.handlers[cache], fn)
+}
+
+// Invalidate 通知其他实例清除缓存，本实例的缓存由调用方自行清除
+//
+//	@param cache 缓存名称
+//	@param key 键，为空清除全部
+func (b *InvalidationBus) Invalidate(cache string, key string) {
+	payload, _ := json.Marshal(invalidation{Node: b.node, Cache: cache, Key: key})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.ps.Publish(ctx, b.topic, payload); err != nil && b.OnError != nil {
+		b.OnError(err)
+	}
+}
+
+// receive 处理收到的失效消息，忽略本实例发布的消息
+func (b *InvalidationBus) receive(payload []byte) {
+	var msg invalidation
+	if json.Unmarshal(payload, &msg) != nil || msg.Node == b.node {
+		return
+	}
+	b.lock.RLock()
+	handlers := b.handlers[msg.Cache]
+	b.lock.RUnlock()
+	for _, fn := range handlers {
+		fn(msg.Key)
+	}
+}
@@ -0,0 +1,137 @@
+package qdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// KafkaMessage Kafka消息
+type KafkaMessage struct {
+	Key     []byte            // 消息键，相同键进入同一分区，保证同一记录的变化有序
+	Value   []byte            // 消息内容
+	Headers map[string]string // 消息头，包含 op、table
+}
+
+// KafkaProducer Kafka生产者，由使用方基于 sarama、franz-go 等客户端实现，qdb 不依赖具体客户端
+type KafkaProducer interface {
+	// Produce 同步发送一批消息，全部被确认后返回，acks 等可靠性配置由客户端设置
+	Produce(ctx context.Context, topic string, messages []KafkaMessage) error
+}
+
+// Delivery 发送失败时的处理方式
+//
+//	两种方式均不是至少一次：事件只保存在内存中，进程退出时缓冲中未发送的事件丢失，
+//	接收过慢时 Watch 丢弃积压的事件
+type Delivery uint8
+
+const (
+	RetryUntilSent Delivery = iota // 发送失败时按指数退避一直重试，直到成功或上下文结束
+	DropOnError                    // 发送失败时丢弃该批消息
+)
+
+// KafkaSinkOptions Kafka转发选项
+type KafkaSinkOptions struct {
+	Topic         string                                  // 主题，为空使用 qdb.表名
+	Query         any                                     // 转发的记录条件，为nil转发全部
+	Args          []any                                   // 条件参数
+	Key           func(msg ChangeMessage) []byte          // 消息键，为空使用唯一号，批量变化时使用表名
+	Encode        func(msg ChangeMessage) ([]byte, error) // 消息编码，为空使用JSON，使用 Avro 等格式时自行编码
+	Delivery      Delivery                                // 发送失败时的处理方式，默认一直重试
+	BatchSize     int                                     // 每批的最大条数，为0使用100
+	BatchInterval time.Duration                           // 每批的最长等待时间，为0使用100毫秒
+	OnError       func(err error)                         // 发送失败回调，重试时每次重试前调用，事件积压被丢弃时传入 ErrEventsDropped，为空忽略
+}
+
+// SinkKafka 将Dao的写入事件发送到Kafka，后台运行直到上下文结束，用于云端分析消费表的变化
+//
+//	事件来自 Watch，仅包含进程运行期间的变化，进程退出时未发送的事件丢失，Watch 积压丢弃的事件不发送，
+//	只通过 OnError 传入 ErrEventsDropped；需要至少一次的投递保证时，将事件写入业务表并结合 Checkpoint 发送
+//
+//	@param ctx 上下文
+//	@param dao 数据访问对象，使用 WithWatchPoll 时同时发送其他进程的写入
+//	@param producer Kafka生产者
+//	@param opts 转发选项
+//	@return error 订阅失败时返回
+func SinkKafka[T any](ctx context.Context, dao *Dao[T], producer KafkaProducer, opts KafkaSinkOptions) error {
+	if opts.Topic == "" {
+		opts.Topic = "qdb." + dao.table
+	}
+	if opts.Key == nil {
+		opts.Key = func(msg ChangeMessage) []byte {
+			if msg.Id == 0 {
+				return []byte(msg.Table)
+			}
+			return []byte(strconv.FormatUint(msg.Id, 10))
+		}
+	}
+	if opts.Encode == nil {
+		opts.Encode = func(msg ChangeMessage) ([]byte, error) {
+			return json.Marshal(msg)
+		}
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = 100 * time.Millisecond
+	}
+	events, err := dao.Watch(ctx, opts.Query, opts.Args...)
+	if err != nil {
+		return err
+	}
+	go batchEvents(events, opts.BatchSize, opts.BatchInterval, func(batch []ChangeEvent[T]) {
+		messages := make([]KafkaMessage, 0, len(batch))
+		for _, ev := range batch {
+			// 积压提示不是记录的变化，消费方无法据此重新加载，不发送
+			if ev.Overflow {
+				if opts.OnError != nil {
+					opts.OnError(fmt.Errorf("%w: kafka sink for %s", ErrEventsDropped, dao.table))
+				}
+				continue
+			}
+			msg := newChangeMessage(dao.table, ev)
+			value, err := opts.Encode(msg)
+			if err != nil {
+				// 无法编码的事件重试也不会成功，直接丢弃
+				if opts.OnError != nil {
+					opts.OnError(err)
+				}
+				continue
+			}
+			messages = append(messages, KafkaMessage{Key: opts.Key(msg), Value: value,
+				Headers: map[string]string{"op": msg.Op, "table": msg.Table}})
+		}
+		if len(messages) > 0 {
+			kafkaProduce(ctx, producer, opts, messages)
+		}
+	})
+	return nil
+}
+
+// kafkaProduce 发送一批消息，RetryUntilSent 时按指数退避重试直到成功或上下文结束
+func kafkaProduce(ctx context.Context, producer KafkaProducer, opts KafkaSinkOptions, messages []KafkaMessage) {
+	wait := 200 * time.Millisecond
+	for {
+		err := producer.Produce(ctx, opts.Topic, messages)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if opts.OnError != nil {
+			opts.OnError(err)
+		}
+		if opts.Delivery == DropOnError {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if wait < 30*time.Second {
+			wait *= 2
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package qdb
+
+import (
+	"encoding/json"
+	"github.com/kamioair/utils/qcache"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// dbKV 键值记录
+type dbKV struct {
+	Namespace string         `gorm:"primaryKey;size:64"`  // 命名空间
+	Key       string         `gorm:"primaryKey;size:191"` // 键
+	Value     string         // 值，JSON
+	LastTime  qtime.DateTime // 最后操作时间
+}
+
+// TableName 表名
+func (dbKV) TableName() string {
+	return "qdb_kv"
+}
+
+// KV 键值存储，用于服务的配置项、开关、游标等零散数据，值以JSON保存在 qdb_kv 表
+//
+//	读写使用 GetKV、ListKV 及 Set、Delete
+type KV struct {
+	db        *gorm.DB
+	namespace string
+	cache     *qcache.Caches[string]
+	bus       *InvalidationBus
+}
+
+// NewKV 创建键值存储，表不存在时自动创建
+//
+//	启用缓存后其他实例的修改在缓存过期后才可见，使用 UseBus 时立即失效
+//
+//	@param db 数据库连接
+//	@param namespace 命名空间，如服务名
+//	@param cacheTTL 读取缓存时长，为0不缓存
+//	@return *KV, error
+func NewKV(db *gorm.DB, namespace string, cacheTTL time.Duration) (*KV, error) {
+	if err := ensureTable(db, &dbKV{}); err != nil {
+		return nil, err
+	}
+	kv := &KV{db: db, namespace: namespace}
+	if cacheTTL > 0 {
+		kv.cache = qcache.NewCaches[string](cacheTTL, cacheTTL, nil)
+	}
+	return kv, nil
+}
+
+// Set 写入值，已存在时覆盖
+//
+//	@param key 键
+//	@param value 值，按JSON序列化
+//	@return error
+func (kv *KV) Set(key string, value any) error {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	row := &dbKV{Namespace: kv.namespace, Key: key, Value: string(js), LastTime: qtime.NewDateTime(now())}
+	if err = kv.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error; err != nil {
+		return err
+	}
+	if kv.cache != nil {
+		kv.cache.Set(key, row.Value)
+	}
+	if kv.bus != nil {
+		kv.bus.Invalidate("kv:"+kv.namespace, key)
+	}
+	return nil
+}
+
+// Delete 删除键，不存在时不报错
+//
+//	@param key 键
+//	@return error
+func (kv *KV) Delete(key string) error {
+	err := kv.db.Where(clause.Eq{Column: fieldColumn(kv.db, &dbKV{}, "Namespace"), Value: kv.namespace}).
+		Where(clause.Eq{Column: fieldColumn(kv.db, &dbKV{}, "Key"), Value: key}).Delete(&dbKV{}).Error
+	if err == nil && kv.cache != nil {
+		kv.cache.Delete(key)
+	}
+	if err == nil && kv.bus != nil {
+		kv.bus.Invalidate("kv:"+kv.namespace, key)
+	}
+	return err
+}
+
+// UseBus 接入缓存失效总线，本实例写入后通知其他实例清除对应的缓存，须在读写前调用
+//
+//	@param bus 缓存失效总线
+func (kv *KV) UseBus(bus *InvalidationBus) {
+	kv.bus = bus
+	bus.Register("kv:"+kv.namespace, func(key string) {
+		if kv.cache != nil {
+			kv.cache.Delete(key)
+		}
+	})
+}
+
+// Keys 返回指定前缀的全部键，按键排序
+//
+//	@param prefix 前缀，为空返回全部
+//	@return []string, error
+func (kv *KV) Keys(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	err := kv.where(prefix).Model(&dbKV{}).Order(clause.OrderByColumn{Column: fieldColumn(kv.db, &dbKV{}, "Key")}).
+		Pluck(fieldColumn(kv.db, &dbKV{}, "Key").Name, &keys).Error
+	return keys, err
+}
+
+// get 读取值的JSON，不存在时返回空
+func (kv *KV) get(key string) (string, error) {
+	if kv.cache != nil {
+		if v, ok := kv.cache.Get(key); ok {
+			return v, nil
+		}
+	}
+	var rows []dbKV
+	err := kv.db.Where(clause.Eq{Column: fieldColumn(kv.db, &dbKV{}, "Namespace"), Value: kv.namespace}).
+		Where(clause.Eq{Column: fieldColumn(kv.db, &dbKV{}, "Key"), Value: key}).Limit(1).Find(&rows).Error
+	if err != nil {
+		return "", err
+	}
+	value := ""
+	if len(rows) > 0 {
+		value = rows[0].Value
+	}
+	// 不存在的键同样缓存，避免重复查询
+	if kv.cache != nil {
+		kv.cache.Set(key, value)
+	}
+	return value, nil
+}
+
+// where 按命名空间和键前缀筛选
+func (kv *KV) where(prefix string) *gorm.DB {
+	db := kv.db.Where(clause.Eq{Column: fieldColumn(kv.db, &dbKV{}, "Namespace"), Value: kv.namespace})
+	if prefix != "" {
+		db = db.Where("? LIKE ? ESCAPE '!'", fieldColumn(kv.db, &dbKV{}, "Key"), likeEscape(prefix)+"%")
+	}
+	return db
+}
+
+// GetKV 读取值
+//
+//	@param kv 键值存储
+//	@param key 键
+//	@return V, bool 是否存在, error
+func GetKV[V any](kv *KV, key string) (V, bool, error) {
+	var value V
+	js, err := kv.get(key)
+	if err != nil || js == "" {
+		return value, false, err
+	}
+	if err = json.Unmarshal([]byte(js), &value); err != nil {
+		return value, false, err
+	}
+	return value, true, nil
+}
+
+// ListKV 读取指定前缀的全部值
+//
+//	@param kv 键值存储
+//	@param prefix 键前缀，为空返回全部
+//	@return map[string]V, error
+func ListKV[V any](kv *KV, prefix string) (map[string]V, error) {
+	var rows []dbKV
+	if err := kv.where(prefix).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	values := make(map[string]V, len(rows))
+	for _, row := range rows {
+		var value V
+		if err := json.Unmarshal([]byte(row.Value), &value); err != nil {
+			return nil, err
+		}
+		values[row.Key] = value
+	}
+	return values, nil
+}
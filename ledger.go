@@ -0,0 +1,245 @@
+package qdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// DbLedger 账本数据模型，记录只追加不修改，序号连续递增，哈希链防篡改
+//
+// 哈希按记录的JSON内容计算，字段应能无损往返数据库，如 time.Time 需与列精度一致
+type DbLedger struct {
+	Id       uint64         `gorm:"primaryKey"`  // 唯一号
+	Seq      uint64         `gorm:"uniqueIndex"` // 序号，从1开始连续递增
+	PrevHash string         `gorm:"size:64"`     // 上一条记录的哈希，第一条为空
+	Hash     string         `gorm:"size:64"`     // 本条记录的哈希
+	LastTime qtime.DateTime `gorm:"index"`       // 最后操作时间
+}
+
+// GetID 返回唯一号
+func (m *DbLedger) GetID() uint64 {
+	return m.Id
+}
+
+// Touch 最后操作时间为空时写入指定时间
+func (m *DbLedger) Touch(t time.Time) {
+	if m.LastTime == 0 {
+		m.LastTime = dateTimeOf(t.Local())
+	}
+}
+
+// ledgerEntry 嵌入 DbLedger 的模型
+type ledgerEntry interface {
+	ledger() *DbLedger
+}
+
+// ledger 返回账本字段
+func (m *DbLedger) ledger() *DbLedger {
+	return m
+}
+
+// LedgerDao 只追加的账本Dao，不提供修改和删除
+type LedgerDao[T any] struct {
+	dao *Dao[T]
+}
+
+// 序号冲突时的重试次数
+const ledgerRetries = 5
+
+// NewLedgerDao 创建账本Dao，T需嵌入 DbLedger，建表失败或未嵌入时panic
+//
+//	@param db 数据库连接
+//	@param opts 可选项，操作类型固定为查询和新增
+//	@return *LedgerDao[T]
+func NewLedgerDao[T any](db *gorm.DB, opts ...DaoOption) *LedgerDao[T] {
+	if _, ok := any(new(T)).(ledgerEntry); !ok {
+		panic(fmt.Sprintf("qdb: ledger model %T must embed DbLedger", *new(T)))
+	}
+	opts = append(opts, WithAllowedOps(OpRead|OpCreate))
+	dao, err := TryNewDao[T](db, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return &LedgerDao[T]{dao: dao}
+}
+
+// Dao 返回只读的底层Dao，用于条件查询等，新增、修改和删除返回 ErrOpNotAllowed，追加使用 Append
+//
+//	@return *Dao[T]
+func (l *LedgerDao[T]) Dao() *Dao[T] {
+	clone := *l.dao
+	clone.opts.allowedOps = OpRead
+	return &clone
+}
+
+// Append 追加一条记录，写入序号和哈希，并发追加时按序号冲突重试
+//
+//	@param model 待追加实体，Id、Seq、PrevHash、Hash 由账本写入
+//	@return error
+func (l *LedgerDao[T]) Append(model *T) error {
+	entry := any(model).(ledgerEntry).ledger()
+	return l.dao.exec("LedgerAppend", OpCreate, func(op *Operation) error {
+		touch(op.Context(), model, now())
+		var err error
+		for i := 0; i < ledgerRetries; i++ {
+			err = trackedTx(op.DB, func(tx *gorm.DB) error {
+				last, err := l.last(tx, true)
+				if err != nil {
+					return err
+				}
+				entry.Id, entry.Seq, entry.PrevHash = 0, 1, ""
+				if last != nil {
+					prev := any(last).(ledgerEntry).ledger()
+					entry.Seq, entry.PrevHash = prev.Seq+1, prev.Hash
+				}
+				if entry.Hash, err = ledgerHash(model); err != nil {
+					return err
+				}
+				result := tx.Create(model)
+				op.RowsAffected = result.RowsAffected
+				return result.Error
+			}, 1)
+			if !IsDuplicateKey(err) {
+				return err
+			}
+			op.Attempts++
+		}
+		return err
+	})
+}
+
+// Last 返回序号最大的记录，账本为空时返回nil
+//
+//	@return *T, error
+func (l *LedgerDao[T]) Last() (*T, error) {
+	var model *T
+	err := l.dao.exec("LedgerLast", OpRead, func(op *Operation) error {
+		var err error
+		model, err = l.last(op.DB, false)
+		return err
+	})
+	return model, err
+}
+
+// GetBySeq 按序号查询一条记录，不存在时返回 ErrNotFound
+//
+//	@param seq 序号
+//	@return *T, error
+func (l *LedgerDao[T]) GetBySeq(seq uint64) (*T, error) {
+	model := new(T)
+	err := l.dao.exec("LedgerBySeq", OpRead, func(op *Operation) error {
+		result := op.DB.Where(clause.Eq{Column: fieldColumn(op.DB, model, "Seq"), Value: seq}).Limit(1).Find(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		op.RowsAffected = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return model, nil
+}
+
+// GetRange 按序号升序查询一段记录
+//
+//	@param fromSeq 开始序号（包含）
+//	@param maxCount 最大数量
+//	@return []*T, error
+func (l *LedgerDao[T]) GetRange(fromSeq uint64, maxCount int) ([]*T, error) {
+	list := make([]*T, 0)
+	err := l.dao.exec("LedgerRange", OpRead, func(op *Operation) error {
+		col := fieldColumn(op.DB, new(T), "Seq")
+		result := op.DB.Where(clause.Gte{Column: col, Value: fromSeq}).
+			Order(clause.OrderByColumn{Column: col}).Limit(maxCount).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// Verify 按序号顺序校验全部记录的序号连续性和哈希链
+//
+//	@return error 发现不一致时可通过 errors.Is(err, ErrLedgerBroken) 判断，信息中包含序号
+func (l *LedgerDao[T]) Verify() error {
+	return l.dao.exec("LedgerVerify", OpRead, func(op *Operation) error {
+		const batch = 1000
+		col := fieldColumn(op.DB, new(T), "Seq")
+		var prev *DbLedger
+		for from := uint64(1); ; {
+			list := make([]*T, 0, batch)
+			result := op.DB.Where(clause.Gte{Column: col, Value: from}).
+				Order(clause.OrderByColumn{Column: col}).Limit(batch).Find(&list)
+			if result.Error != nil {
+				return result.Error
+			}
+			for _, model := range list {
+				entry := any(model).(ledgerEntry).ledger()
+				want := uint64(1)
+				prevHash := ""
+				if prev != nil {
+					want, prevHash = prev.Seq+1, prev.Hash
+				}
+				if entry.Seq != want {
+					return fmt.Errorf("%w: seq %d missing", ErrLedgerBroken, want)
+				}
+				if entry.PrevHash != prevHash {
+					return fmt.Errorf("%w: seq %d prev hash mismatch", ErrLedgerBroken, entry.Seq)
+				}
+				hash, err := ledgerHash(model)
+				if err != nil {
+					return err
+				}
+				if hash != entry.Hash {
+					return fmt.Errorf("%w: seq %d hash mismatch", ErrLedgerBroken, entry.Seq)
+				}
+				copied := *entry
+				prev = &copied
+				op.RowsAffected++
+			}
+			if len(list) < batch {
+				return nil
+			}
+			from = prev.Seq + 1
+		}
+	})
+}
+
+// last 查询序号最大的记录，lock 为true时在事务中锁定该行
+func (l *LedgerDao[T]) last(db *gorm.DB, lock bool) (*T, error) {
+	model := new(T)
+	if lock {
+		switch db.Dialector.Name() {
+		case "mysql", "postgres":
+			db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+	}
+	result := db.Order(clause.OrderByColumn{Column: fieldColumn(db, model, "Seq"), Desc: true}).Limit(1).Find(model)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+	return model, nil
+}
+
+// ledgerHash 计算记录的哈希，内容为不含 Id、Hash 的JSON
+func ledgerHash[T any](model *T) (string, error) {
+	entry := any(model).(ledgerEntry).ledger()
+	id, hash := entry.Id, entry.Hash
+	entry.Id, entry.Hash = 0, ""
+	js, err := json.Marshal(model)
+	entry.Id, entry.Hash = id, hash
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(js)
+	return hex.EncodeToString(sum[:]), nil
+}
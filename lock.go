@@ -0,0 +1,110 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+	"sync"
+	"time"
+)
+
+// dbLock 数据库锁，用于多实例之间的单例执行
+type dbLock struct {
+	Name       string `gorm:"primaryKey;size:128"` // 锁名称
+	Owner      string `gorm:"size:128"`            // 持有者
+	ExpireTime int64  // 过期时间，Unix毫秒
+}
+
+// TableName 表名
+func (dbLock) TableName() string {
+	return "qdb_lock"
+}
+
+var (
+	migrated    sync.Map
+	migrateLock sync.Mutex
+)
+
+// ensureTable 首次使用时创建内部表
+func ensureTable(db *gorm.DB, model any) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%p:%s", db.Config, stmt.Schema.Table)
+	if _, ok := migrated.Load(key); ok {
+		return nil
+	}
+	migrateLock.Lock()
+	defer migrateLock.Unlock()
+	if !db.Migrator().HasTable(stmt.Schema.Table) {
+		if err := db.AutoMigrate(model); err != nil {
+			return err
+		}
+	}
+	migrated.Store(key, true)
+	return nil
+}
+
+// lockOwner 返回本进程的持有者标识
+func lockOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+}
+
+// fieldColumn 返回模型字段对应的列，列名由命名策略生成
+func fieldColumn(db *gorm.DB, model any, field string) clause.Column {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err == nil {
+		if f := stmt.Schema.LookUpField(field); f != nil {
+			return clause.Column{Name: f.DBName}
+		}
+	}
+	return clause.Column{Name: field}
+}
+
+// tryLock 尝试获取或续期锁，锁已过期或由自己持有时成功
+func tryLock(db *gorm.DB, name string, owner string, ttl time.Duration) (bool, error) {
+	if err := ensureTable(db, &dbLock{}); err != nil {
+		return false, err
+	}
+	model := &dbLock{}
+	nowMs := now().UnixMilli()
+	expire := nowMs + ttl.Milliseconds()
+	result := db.Model(model).
+		Where(clause.Eq{Column: fieldColumn(db, model, "Name"), Value: name}).
+		Where(clause.Or(
+			clause.Eq{Column: fieldColumn(db, model, "Owner"), Value: owner},
+			clause.Lt{Column: fieldColumn(db, model, "ExpireTime"), Value: nowMs},
+		)).
+		Updates(map[string]any{"Owner": owner, "ExpireTime": expire})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+	// 首次使用时插入，已被其他实例插入则不影响任何行
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&dbLock{Name: name, Owner: owner, ExpireTime: expire})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error == nil, result.Error
+	}
+	// mysql 按实际变化的行数返回，同一毫秒内续期时值未变化，修改行数为0，按持有者判断
+	var holder []string
+	err := db.Model(model).Where(clause.Eq{Column: fieldColumn(db, model, "Name"), Value: name}).
+		Limit(1).Pluck(fieldColumn(db, model, "Owner").Name, &holder).Error
+	if err != nil {
+		return false, err
+	}
+	return len(holder) > 0 && holder[0] == owner, nil
+}
+
+// unlock 释放自己持有的锁
+func unlock(db *gorm.DB, name string, owner string) error {
+	model := &dbLock{}
+	return db.Model(model).
+		Where(clause.Eq{Column: fieldColumn(db, model, "Name"), Value: name}).
+		Where(clause.Eq{Column: fieldColumn(db, model, "Owner"), Value: owner}).
+		Update("ExpireTime", 0).Error
+}
@@ -0,0 +1,51 @@
+package qdb
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTryLockRenewal(t *testing.T) {
+	db := newTestDB(t)
+	var ms atomic.Int64
+	ms.Store(time.Now().UnixMilli())
+	SetClock(ClockFunc(func() time.Time { return time.UnixMilli(ms.Load()) }))
+	t.Cleanup(func() { SetClock(nil) })
+
+	lock := func(owner string) bool {
+		t.Helper()
+		ok, err := tryLock(db, "test", owner, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !lock("a") {
+		t.Fatal("first lock failed")
+	}
+	// 同一毫秒内续期，值未变化
+	if !lock("a") {
+		t.Fatal("renewal in the same millisecond failed")
+	}
+	if lock("b") {
+		t.Fatal("lock held by a was taken by b")
+	}
+	ms.Add(500)
+	if !lock("a") {
+		t.Fatal("renewal failed")
+	}
+	ms.Add(1200)
+	if !lock("b") {
+		t.Fatal("expired lock was not taken over")
+	}
+	if lock("a") {
+		t.Fatal("previous holder renewed a lock taken over by b")
+	}
+	if err := unlock(db, "test", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if !lock("a") {
+		t.Fatal("released lock not acquired")
+	}
+}
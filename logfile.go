@@ -0,0 +1,115 @@
+package qdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateWriter 按大小和日期切分的日志文件
+type rotateWriter struct {
+	path    string
+	maxSize int64         // 单个文件最大字节数，为0不按大小切分
+	maxAge  time.Duration // 历史文件保留时长，为0不清理
+	file    *os.File
+	size    int64
+	day     string
+	lock    sync.Mutex
+}
+
+var (
+	logWriters = map[string]*rotateWriter{}
+	writerLock sync.Mutex
+)
+
+// openRotateWriter 打开日志文件，同一路径共用一个写入器
+func openRotateWriter(path string, maxSizeMB int, maxAgeDays int) (*rotateWriter, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	writerLock.Lock()
+	defer writerLock.Unlock()
+	if w, ok := logWriters[abs]; ok {
+		return w, nil
+	}
+	w := &rotateWriter{
+		path:    abs,
+		maxSize: int64(maxSizeMB) * 1024 * 1024,
+		maxAge:  time.Duration(maxAgeDays) * 24 * time.Hour,
+	}
+	if err = w.open(); err != nil {
+		return nil, err
+	}
+	logWriters[abs] = w
+	return w, nil
+}
+
+// Write 写入日志，超过大小或跨天时切分
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if (w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize) || time.Now().Format("20060102") != w.day {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// open 打开或创建当前日志文件
+func (w *rotateWriter) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file, w.size, w.day = f, info.Size(), info.ModTime().Format("20060102")
+	return nil
+}
+
+// rotate 将当前文件改名为带时间的历史文件，并清理过期的历史文件
+func (w *rotateWriter) rotate() error {
+	if w.size > 0 {
+		_ = w.file.Close()
+		ext := filepath.Ext(w.path)
+		backup := fmt.Sprintf("%s.%s%s", strings.TrimSuffix(w.path, ext), time.Now().Format("20060102-150405.000"), ext)
+		if err := os.Rename(w.path, backup); err != nil {
+			return err
+		}
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	w.day = time.Now().Format("20060102")
+	w.clean()
+	return nil
+}
+
+// clean 删除超过保留时长的历史文件
+func (w *rotateWriter) clean() {
+	if w.maxAge <= 0 {
+		return
+	}
+	ext := filepath.Ext(w.path)
+	files, _ := filepath.Glob(strings.TrimSuffix(w.path, ext) + ".*" + ext)
+	sort.Strings(files)
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && time.Since(info.ModTime()) > w.maxAge {
+			_ = os.Remove(file)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"sync"
+)
+
+// 会话中保存行数上限的键
+const maxRowsKey = "qdb:max_rows"
+
+var maxRowsLock sync.Mutex
+
+// WithMaxRows 限制单次查询返回的最大行数，超过时返回 ErrTooManyRows，防止小内存设备误读大表
+//
+//	@param n 最大行数，为0不限制
+//	@return DaoOption
+func WithMaxRows(n int) DaoOption {
+	return func(opts *daoOptions) {
+		opts.maxRows = n
+	}
+}
+
+// MaxRows 返回限制单次查询最大行数的Dao，覆盖 WithMaxRows 的设置
+//
+//	@param n 最大行数，为0不限制
+//	@return *Dao[T]
+func (dao *Dao[T]) MaxRows(n int) *Dao[T] {
+	clone := *dao
+	clone.opts.maxRows = n
+	return &clone
+}
+
+// limitRows 查询列表时最多读取 n+1 行，调用方指定了更小的数量时不修改
+func limitRows(db *gorm.DB, n int) *gorm.DB {
+	return db.Set(maxRowsKey, n).Scopes(func(db *gorm.DB) *gorm.DB {
+		dest := reflect.ValueOf(db.Statement.Dest)
+		for dest.Kind() == reflect.Ptr {
+			dest = dest.Elem()
+		}
+		if dest.Kind() != reflect.Slice {
+			return db
+		}
+		if c, ok := db.Statement.Clauses["LIMIT"]; ok {
+			if limit, ok := c.Expression.(clause.Limit); ok && limit.Limit != nil && *limit.Limit <= n {
+				return db
+			}
+		}
+		return db.Limit(n + 1)
+	})
+}
+
+// useMaxRows 注册查询行数检查，已注册时跳过
+//
+//	注册回调与执行中的查询存在数据竞争，只在创建连接和 TryNewDao 时调用，不在查询时延迟注册
+func useMaxRows(db *gorm.DB) error {
+	maxRowsLock.Lock()
+	defer maxRowsLock.Unlock()
+	if _, ok := db.Config.Plugins[maxRowsPlugin{}.Name()]; ok {
+		return nil
+	}
+	return db.Use(maxRowsPlugin{})
+}
+
+// maxRowsPlugin 查询后检查返回行数
+type maxRowsPlugin struct{}
+
+// Name 插件名称
+func (maxRowsPlugin) Name() string {
+	return "qdb:max_rows"
+}
+
+// Initialize 注册回调
+func (maxRowsPlugin) Initialize(db *gorm.DB) error {
+	return db.Callback().Query().After("gorm:query").Register("qdb:max_rows", func(db *gorm.DB) {
+		v, ok := db.Get(maxRowsKey)
+		if !ok || db.Error != nil {
+			return
+		}
+		if n := v.(int); n > 0 && db.Statement.RowsAffected > int64(n) {
+			_ = db.AddError(fmt.Errorf("%w: %s returned more than %d rows", ErrTooManyRows, db.Statement.Table, n))
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package qdb
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+// Operation 一次Dao操作
+type Operation struct {
+	Name         string   // 操作名称，与Dao方法同名，如 Create、GetModel，树、账本等为 TreeMove、LedgerAppend
+	Kind         OpKind   // 操作类型，Save可能新增也可能修改
+	Table        string   // 表名
+	DB           *gorm.DB // 本次操作使用的连接，中间件可替换，如设置超时上下文
+	RowsAffected int64    // 影响或返回的行数，操作执行后有效
+	Attempts     int      // 已执行次数，由重试中间件维护
+}
+
+// Context 返回本次操作的上下文
+func (op *Operation) Context() context.Context {
+	if op.DB.Statement.Context != nil {
+		return op.DB.Statement.Context
+	}
+	return context.Background()
+}
+
+// Handler 操作处理方法
+type Handler func(op *Operation) error
+
+// Middleware 中间件，包裹Dao的每一次操作，用于超时、日志、统计、租户校验等通用逻辑
+type Middleware func(next Handler) Handler
+
+var (
+	globalMws  []Middleware
+	globalLock sync.RWMutex
+)
+
+// Use 注册全局中间件，作用于所有Dao，先注册的在外层
+//
+//	@param mw 中间件
+func Use(mw ...Middleware) {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	globalMws = append(globalMws, mw...)
+}
+
+// Use 注册当前Dao的中间件，在全局中间件之内执行
+//
+//	未加锁，须在并发使用该Dao之前调用；WithContext 等返回的副本注册时不影响原Dao
+//
+//	@param mw 中间件
+func (dao *Dao[T]) Use(mw ...Middleware) {
+	// 总是复制到新切片，副本与原Dao共享底层数组，原地追加会互相覆盖
+	mws := make([]Middleware, 0, len(dao.mws)+len(mw))
+	mws = append(mws, dao.mws...)
+	dao.mws = append(mws, mw...)
+}
+
+// exec 通过中间件链执行操作，kind 为该操作所需的操作类型
+func (dao *Dao[T]) exec(name string, kind OpKind, fn Handler) error {
+	if dao.opts.allowedOps != 0 && kind&^dao.opts.allowedOps != 0 {
+		return fmt.Errorf("%w: %s on %s", ErrOpNotAllowed, name, dao.table)
+	}
+	globalLock.RLock()
+	chain := make([]Middleware, 0, len(globalMws)+len(dao.mws))
+	chain = append(chain, globalMws...)
+	globalLock.RUnlock()
+	chain = append(chain, dao.mws...)
+
+	h := fn
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	op := &Operation{Name: name, Kind: kind, Table: dao.table, DB: dao.db}
+	start := time.Now()
+	err := h(op)
+	if op.Attempts == 0 {
+		op.Attempts = 1
+	}
+	// 记录执行结果
+	if dao.stat != nil {
+		dao.stat.Attempts = op.Attempts
+		dao.stat.Duration = time.Since(start)
+		dao.stat.RowsAffected = op.RowsAffected
+	}
+	return err
+}
+
+// Timeout 超时中间件，超过指定时间后取消操作
+//
+//	@param d 超时时间
+//	@return Middleware
+func Timeout(d time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			ctx, cancel := context.WithTimeout(op.Context(), d)
+			defer cancel()
+			op.DB = op.DB.WithContext(ctx)
+			return next(op)
+		}
+	}
+}
+
+// Observe 观察中间件，每次操作完成后回调，用于日志、统计等
+//
+//	@param fn 回调方法，参数为操作、耗时和错误
+//	@return Middleware
+func Observe(fn func(op *Operation, cost time.Duration, err error)) Middleware {
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			start := time.Now()
+			err := next(op)
+			fn(op, time.Since(start), err)
+			return err
+		}
+	}
+}
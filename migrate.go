@@ -0,0 +1,243 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sync"
+)
+
+var (
+	registeredModels []any
+	registeredTypes  = map[reflect.Type]bool{}
+	registerLock     sync.Mutex
+)
+
+// Register 注册模型，应用启动时通过 AutoMigrateAll 统一迁移，重复注册的类型忽略
+//
+//	@param models 模型，如 &User{}、Order{}
+func Register(models ...any) {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+	for _, model := range models {
+		typ := reflect.TypeOf(model)
+		for typ != nil && typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ == nil || typ.Kind() != reflect.Struct {
+			panic(fmt.Sprintf("qdb: register model %T is not a struct", model))
+		}
+		if registeredTypes[typ] {
+			continue
+		}
+		registeredTypes[typ] = true
+		registeredModels = append(registeredModels, reflect.New(typ).Interface())
+	}
+}
+
+// RegisteredModels 返回已注册的模型，按注册顺序排列
+//
+//	@return []any 模型指针
+func RegisteredModels() []any {
+	registerLock.Lock()
+	defer registerLock.Unlock()
+	return append([]any(nil), registeredModels...)
+}
+
+// MigrateOption 批量迁移选项
+type MigrateOption func(*migrateOptions)
+
+type migrateOptions struct {
+	foreignKeys *bool
+}
+
+// WithForeignKeys 是否创建外键约束，未指定时按 gorm 配置 DisableForeignKeyConstraintWhenMigrating
+//
+//	@param enable 是否创建
+//	@return MigrateOption
+func WithForeignKeys(enable bool) MigrateOption {
+	return func(o *migrateOptions) {
+		o.foreignKeys = &enable
+	}
+}
+
+// AutoMigrateAll 迁移全部已注册的模型，创建缺失的表、列和索引
+//
+//	按外键依赖排序，被引用的表先创建；所有表创建完成后再创建外键约束，
+//	循环引用或 sqlserver 等严格校验约束的数据库也不会因创建顺序失败
+//
+//	@param db 数据库连接
+//	@param opts 迁移选项
+//	@return error 第一个失败的模型及原因
+func AutoMigrateAll(db *gorm.DB, opts ...MigrateOption) error {
+	var o migrateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	foreignKeys := !db.DisableForeignKeyConstraintWhenMigrating
+	if o.foreignKeys != nil {
+		foreignKeys = *o.foreignKeys
+	}
+
+	models, err := dependencyOrder(db, RegisteredModels())
+	if err != nil {
+		return err
+	}
+	// 先建表，不带约束
+	tables := withoutForeignKeys(db)
+	for _, model := range models {
+		if err = migrateDB(tables, model).AutoMigrate(model); err != nil {
+			return fmt.Errorf("qdb: migrate %s: %w", modelName(model), err)
+		}
+	}
+	if !foreignKeys {
+		return nil
+	}
+	// 再补齐外键约束
+	migrator := db.Migrator()
+	created := false
+	for _, model := range models {
+		for _, name := range constraintNames(db, model) {
+			if migrator.HasConstraint(model, name) {
+				continue
+			}
+			if err = migrator.CreateConstraint(model, name); err != nil {
+				return fmt.Errorf("qdb: create constraint %s on %s: %w", name, modelName(model), err)
+			}
+			created = true
+		}
+	}
+	// sqlite 添加约束时重建表会丢失索引，再次迁移补齐
+	if created && db.Dialector.Name() == "sqlite" {
+		for _, model := range models {
+			if err = migrateDB(tables, model).AutoMigrate(model); err != nil {
+				return fmt.Errorf("qdb: migrate %s: %w", modelName(model), err)
+			}
+		}
+	}
+	return nil
+}
+
+// DropAll 删除全部已注册模型的表，按依赖的逆序删除，引用其他表的表先删除
+//
+//	@param db 数据库连接
+//	@return error
+func DropAll(db *gorm.DB) error {
+	models, err := dependencyOrder(db, RegisteredModels())
+	if err != nil {
+		return err
+	}
+	migrator := db.Migrator()
+	for i := len(models) - 1; i >= 0; i-- {
+		if !migrator.HasTable(models[i]) {
+			continue
+		}
+		if err = migrator.DropTable(models[i]); err != nil {
+			return fmt.Errorf("qdb: drop %s: %w", modelName(models[i]), err)
+		}
+	}
+	return nil
+}
+
+// dependencyOrder 按外键依赖拓扑排序，无依赖关系的模型保持注册顺序，循环依赖的部分按注册顺序排列
+func dependencyOrder(db *gorm.DB, models []any) ([]any, error) {
+	schemas := make([]*schema.Schema, len(models))
+	index := map[string]int{}
+	for i, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("qdb: parse %s: %w", modelName(model), err)
+		}
+		schemas[i] = stmt.Schema
+		index[stmt.Schema.Table] = i
+	}
+	// deps[i] 为模型i引用的模型
+	deps := make([]map[int]bool, len(models))
+	for i := range deps {
+		deps[i] = map[int]bool{}
+	}
+	for _, sch := range schemas {
+		for _, rel := range sch.Relationships.Relations {
+			c := rel.ParseConstraint()
+			if c == nil || c.Schema == nil || c.ReferenceSchema == nil {
+				continue
+			}
+			owner, ok1 := index[c.Schema.Table]
+			ref, ok2 := index[c.ReferenceSchema.Table]
+			if ok1 && ok2 && owner != ref {
+				deps[owner][ref] = true
+			}
+		}
+	}
+
+	done := make([]bool, len(models))
+	ordered := make([]any, 0, len(models))
+	for len(ordered) < len(models) {
+		progressed := false
+		for i := range models {
+			if done[i] || !depsDone(deps[i], done) {
+				continue
+			}
+			done[i] = true
+			ordered = append(ordered, models[i])
+			progressed = true
+			break
+		}
+		if progressed {
+			continue
+		}
+		// 存在循环依赖，取第一个未完成的模型打破循环
+		for i := range models {
+			if !done[i] {
+				done[i] = true
+				ordered = append(ordered, models[i])
+				break
+			}
+		}
+	}
+	return ordered, nil
+}
+
+// depsDone 依赖的模型是否已全部排序
+func depsDone(deps map[int]bool, done []bool) bool {
+	for i := range deps {
+		if !done[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// constraintNames 返回模型关联中需要创建的外键约束名称
+func constraintNames(db *gorm.DB, model any) []string {
+	stmt := &gorm.Statement{DB: db}
+	if stmt.Parse(model) != nil {
+		return nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, rel := range stmt.Schema.Relationships.Relations {
+		c := rel.ParseConstraint()
+		if c == nil || seen[c.Name] {
+			continue
+		}
+		seen[c.Name] = true
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// withoutForeignKeys 返回迁移时不创建外键约束的连接
+func withoutForeignKeys(db *gorm.DB) *gorm.DB {
+	tx := db.Session(&gorm.Session{})
+	config := *tx.Config
+	config.DisableForeignKeyConstraintWhenMigrating = true
+	tx.Config = &config
+	return tx
+}
+
+// modelName 模型类型名称
+func modelName(model any) string {
+	return reflect.Indirect(reflect.ValueOf(model)).Type().Name()
+}
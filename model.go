@@ -0,0 +1,122 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qreflect"
+	"github.com/kamioair/utils/qtime"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Model 可选的模型接口，实现后Dao直接调用而不再通过反射读写字段
+//
+// 嵌入 DbSimple、DbFull 或 DbTracked 的模型已自动实现
+type Model interface {
+	GetID() uint64
+	Touch(t time.Time)
+}
+
+// GetID 返回唯一号
+func (m *DbSimple) GetID() uint64 {
+	return m.Id
+}
+
+// Touch 最后操作时间为空时写入指定时间
+func (m *DbSimple) Touch(t time.Time) {
+	if m.LastTime == 0 {
+		m.LastTime = dateTimeOf(t.Local())
+	}
+}
+
+// GetID 返回唯一号
+func (m *DbFull) GetID() uint64 {
+	return m.Id
+}
+
+// Touch 最后操作时间为空时写入指定时间
+func (m *DbFull) Touch(t time.Time) {
+	if m.LastTime == 0 {
+		m.LastTime = dateTimeOf(t.Local())
+	}
+}
+
+// GetID 返回唯一号
+func (m *DbTracked) GetID() uint64 {
+	return m.Id
+}
+
+// Touch 创建时间、最后操作时间为空时写入指定时间
+func (m *DbTracked) Touch(t time.Time) {
+	if m.CreatedTime == 0 {
+		m.CreatedTime = dateTimeOf(t.Local())
+	}
+	if m.LastTime == 0 {
+		m.LastTime = dateTimeOf(t.Local())
+	}
+}
+
+// touch 写入前更新最后操作时间和操作人，未实现Model的模型通过反射处理
+func touch(ctx context.Context, model any, now time.Time) {
+	if a, ok := model.(Auditable); ok {
+		if actor, ok := ActorFrom(ctx); ok {
+			a.SetActor(actor)
+		}
+	}
+	if o, ok := model.(Ownable); ok {
+		if owner, ok := OwnerFrom(ctx); ok {
+			o.SetOwner(owner.Type, owner.Id)
+		}
+	}
+	if m, ok := model.(Model); ok {
+		m.Touch(now)
+		return
+	}
+	// LastTime 为 qtime.DateTime 时按缓存的字段位置直接写入
+	value := reflect.ValueOf(model)
+	if value.Kind() == reflect.Ptr && value.Elem().Kind() == reflect.Struct {
+		if index, ok := lastTimeIndex(value.Elem().Type()); ok {
+			field := value.Elem().FieldByIndex(index)
+			if field.Uint() == 0 {
+				field.SetUint(uint64(dateTimeOf(now.Local())))
+			}
+			return
+		}
+	}
+	ref := qreflect.New(model)
+	if ref.Get("LastTime") == "0001-01-01 00:00:00" {
+		_ = ref.Set("LastTime", qtime.NewDateTime(now))
+	}
+}
+
+// 各模型类型 LastTime 字段的位置，值为 []int，不是 qtime.DateTime 类型时为nil
+var lastTimeIndexes sync.Map
+
+// lastTimeIndex 返回 qtime.DateTime 类型的 LastTime 字段位置
+func lastTimeIndex(typ reflect.Type) ([]int, bool) {
+	if v, ok := lastTimeIndexes.Load(typ); ok {
+		index := v.([]int)
+		return index, index != nil
+	}
+	var index []int
+	if field, ok := typ.FieldByName("LastTime"); ok && field.Type == dateTimeType && field.IsExported() {
+		index = field.Index
+		// 经过指针嵌入的字段可能为nil，仍使用反射库处理
+		for i := 1; i < len(field.Index); i++ {
+			if typ.FieldByIndex(field.Index[:i]).Type.Kind() == reflect.Ptr {
+				index = nil
+				break
+			}
+		}
+	}
+	lastTimeIndexes.Store(typ, index)
+	return index, index != nil
+}
+
+// dateTimeOf 按时间所在时区的年月日时分秒生成 qtime.DateTime，不做时区转换，不分配内存
+func dateTimeOf(t time.Time) qtime.DateTime {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+	return qtime.DateTime(uint64(year)*10000000000 + uint64(month)*100000000 + uint64(day)*1000000 +
+		uint64(hour)*10000 + uint64(minute)*100 + uint64(second))
+}
@@ -0,0 +1,58 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qreflect"
+	"github.com/kamioair/utils/qtime"
+	"testing"
+	"time"
+)
+
+// touchModel 未实现 Touch 的模型，走反射写入 LastTime
+type touchModel struct {
+	Id       uint64
+	LastTime qtime.DateTime
+	Name     string
+}
+
+func TestTouch(t *testing.T) {
+	now := time.Now()
+	m := &touchModel{}
+	touch(context.Background(), m, now)
+	if want := qtime.NewDateTime(now); m.LastTime != want {
+		t.Fatalf("touch: got %d, want %d", m.LastTime, want)
+	}
+	set := &touchModel{LastTime: 20200101000000}
+	touch(context.Background(), set, now)
+	if set.LastTime != 20200101000000 {
+		t.Fatalf("touch overwrote LastTime: %d", set.LastTime)
+	}
+}
+
+func BenchmarkTouch(b *testing.B) {
+	now := time.Now()
+	ctx := context.Background()
+	// 原实现：qreflect 按名称读取并写入
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ref := qreflect.New(&touchModel{})
+			if ref.Get("LastTime") == "0001-01-01 00:00:00" {
+				_ = ref.Set("LastTime", qtime.NewDateTime(now))
+			}
+		}
+	})
+	// 现实现：缓存字段位置，按年月日时分秒计算
+	b.Run("fast", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			touch(ctx, &touchModel{}, now)
+		}
+	})
+	b.Run("toucher", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			touch(ctx, &DbSimple{}, now)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package qdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MQTTClient MQTT客户端，由使用方基于 paho 等客户端实现，qdb 不依赖具体客户端
+type MQTTClient interface {
+	// Publish 发布消息，QoS 大于0时应等待服务端确认后返回
+	Publish(ctx context.Context, topic string, qos byte, retained bool, payload []byte) error
+}
+
+// ChangeMessage 转发的变化消息
+type ChangeMessage struct {
+	Op    string    `json:"op"`             // 变化类型，create、update、delete
+	Table string    `json:"table"`          // 表名
+	Id    uint64    `json:"id"`             // 唯一号，为0表示按条件批量变化
+	Time  time.Time `json:"time"`           // 发现时间
+	Data  any       `json:"data,omitempty"` // 变化后的记录，删除或批量变化时为空
+}
+
+// newChangeMessage 将变化事件转换为消息
+func newChangeMessage[T any](table string, ev ChangeEvent[T]) ChangeMessage {
+	msg := ChangeMessage{Op: ev.Op.String(), Table: table, Id: ev.Id, Time: ev.Time}
+	if ev.Model != nil {
+		msg.Data = ev.Model
+	}
+	return msg
+}
+
+// MQTTBridgeOptions MQTT转发选项
+type MQTTBridgeOptions struct {
+	Topic         string          // 主题，支持 {table}、{op}、{id} 占位符，为空使用 qdb/{table}/{op}
+	QoS           byte            // 服务质量，0、1、2
+	Retained      bool            // 是否保留消息，逐条发送时可用于设备影子
+	Query         any             // 转发的记录条件，为nil转发全部
+	Args          []any           // 条件参数
+	BatchSize     int             // 批量发送的最大条数，大于1时合并为JSON数组发送，主题中的 {op}、{id} 为空
+	BatchInterval time.Duration   // 批量发送的最长等待时间，为0使用1秒
+	Retries       int             // 发送失败的重试次数，为0使用3次
+	OnError       func(err error) // 重试后仍失败的回调，消息被丢弃，事件积压被丢弃时传入 ErrEventsDropped，为空忽略
+}
+
+// BridgeMQTT 将Dao的写入事件转发到MQTT，后台运行直到上下文结束，用于边缘网关上报数据
+//
+//	事件来自 Watch，消息为 ChangeMessage 的JSON，断网等发送失败按指数退避重试，重试后仍失败时丢弃；
+//	Watch 积压丢弃的事件不转发，只通过 OnError 传入 ErrEventsDropped
+//
+//	@param ctx 上下文
+//	@param dao 数据访问对象，使用 WithWatchPoll 时同时转发其他进程的写入
+//	@param client MQTT客户端
+//	@param opts 转发选项
+//	@return error 订阅失败时返回
+func BridgeMQTT[T any](ctx context.Context, dao *Dao[T], client MQTTClient, opts MQTTBridgeOptions) error {
+	if opts.Topic == "" {
+		opts.Topic = "qdb/{table}/{op}"
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = time.Second
+	}
+	if opts.Retries <= 0 {
+		opts.Retries = 3
+	}
+	events, err := dao.Watch(ctx, opts.Query, opts.Args...)
+	if err != nil {
+		return err
+	}
+	publish := func(topic string, v any) {
+		payload, err := json.Marshal(v)
+		if err == nil {
+			err = mqttPublish(ctx, client, opts, topic, payload)
+		}
+		if err != nil && opts.OnError != nil && ctx.Err() == nil {
+			opts.OnError(err)
+		}
+	}
+	// 积压提示不是记录的变化，订阅方无法据此重新加载，不转发
+	dropped := func(ev ChangeEvent[T]) bool {
+		if ev.Overflow && opts.OnError != nil {
+			opts.OnError(fmt.Errorf("%w: mqtt bridge for %s", ErrEventsDropped, dao.table))
+		}
+		return ev.Overflow
+	}
+	go func() {
+		if opts.BatchSize <= 1 {
+			for ev := range events {
+				if dropped(ev) {
+					continue
+				}
+				msg := newChangeMessage(dao.table, ev)
+				publish(mqttTopic(opts.Topic, msg.Table, msg.Op, strconv.FormatUint(msg.Id, 10)), msg)
+			}
+			return
+		}
+		topic := mqttTopic(opts.Topic, dao.table, "", "")
+		batchEvents(events, opts.BatchSize, opts.BatchInterval, func(batch []ChangeEvent[T]) {
+			list := make([]ChangeMessage, 0, len(batch))
+			for _, ev := range batch {
+				if !dropped(ev) {
+					list = append(list, newChangeMessage(dao.table, ev))
+				}
+			}
+			if len(list) > 0 {
+				publish(topic, list)
+			}
+		})
+	}()
+	return nil
+}
+
+// mqttPublish 发送消息，失败时按指数退避重试
+func mqttPublish(ctx context.Context, client MQTTClient, opts MQTTBridgeOptions, topic string, payload []byte) error {
+	wait := 200 * time.Millisecond
+	var err error
+	for i := 0; i <= opts.Retries; i++ {
+		if err = client.Publish(ctx, topic, opts.QoS, opts.Retained, payload); err == nil {
+			return nil
+		}
+		if i == opts.Retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	return err
+}
+
+// mqttTopic 替换主题中的占位符，为空的占位符连同前面的分隔符一起去掉
+func mqttTopic(pattern string, table string, op string, id string) string {
+	values := map[string]string{"{table}": table, "{op}": op, "{id}": id}
+	parts := strings.Split(pattern, "/")
+	topic := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if v, ok := values[part]; ok {
+			if v == "" {
+				continue
+			}
+			part = v
+		}
+		topic = append(topic, part)
+	}
+	return strings.Join(topic, "/")
+}
@@ -0,0 +1,55 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm/schema"
+	"sync"
+)
+
+var (
+	columnMappers = map[string]func(table, field string) string{}
+	mapperLock    sync.RWMutex
+)
+
+// RegisterColumnMapper 注册列名映射方法，在配置 Config.ColumnMapper 中按名称引用
+//
+//	@param name 名称
+//	@param fn 映射方法，参数为表名和字段名，返回空则使用默认列名
+func RegisterColumnMapper(name string, fn func(table, field string) string) {
+	mapperLock.Lock()
+	defer mapperLock.Unlock()
+	columnMappers[name] = fn
+}
+
+// mappedNamer 使用自定义列名映射的命名策略
+type mappedNamer struct {
+	schema.NamingStrategy
+	mapper func(table, field string) string
+}
+
+// ColumnName 返回列名
+func (n mappedNamer) ColumnName(table, column string) string {
+	if name := n.mapper(table, column); name != "" {
+		return name
+	}
+	return n.NamingStrategy.ColumnName(table, column)
+}
+
+// newNamer 根据配置创建命名策略
+func newNamer(cfg settingConfig) (schema.Namer, error) {
+	ns := schema.NamingStrategy{
+		TablePrefix:   cfg.TablePrefix,
+		SingularTable: cfg.SingularTable,
+		NoLowerCase:   cfg.NoLowerCase,
+	}
+	if cfg.ColumnMapper == "" {
+		return ns, nil
+	}
+	mapperLock.RLock()
+	fn, ok := columnMappers[cfg.ColumnMapper]
+	mapperLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("column mapper %s is not registered", cfg.ColumnMapper)
+	}
+	return mappedNamer{NamingStrategy: ns, mapper: fn}, nil
+}
@@ -0,0 +1,160 @@
+package qdb
+
+import (
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dbSequence 序列
+type dbSequence struct {
+	Name     string         `gorm:"primaryKey;size:191"` // 序列名称
+	Value    uint64         // 当前值
+	LastTime qtime.DateTime // 最后操作时间
+}
+
+// TableName 表名
+func (dbSequence) TableName() string {
+	return "qdb_sequence"
+}
+
+// NextSequence 返回序列的下一个值，从1开始，多实例并发安全
+//
+//	@param db 数据库连接
+//	@param name 序列名称
+//	@return uint64, error
+func NextSequence(db *gorm.DB, name string) (uint64, error) {
+	if err := ensureTable(db, &dbSequence{}); err != nil {
+		return 0, err
+	}
+	var value uint64
+	var err error
+	for i := 0; i < 3; i++ {
+		err = trackedTx(db, func(tx *gorm.DB) error {
+			seq := &dbSequence{}
+			nameCol := fieldColumn(tx, seq, "Name")
+			// 先加一再读取，更新时的行锁保证并发下不重复
+			result := tx.Model(seq).Where(clause.Eq{Column: nameCol, Value: name}).Updates(map[string]any{
+				fieldColumn(tx, seq, "Value").Name:    gorm.Expr("? + 1", fieldColumn(tx, seq, "Value")),
+				fieldColumn(tx, seq, "LastTime").Name: qtime.NewDateTime(now()),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				value = 1
+				return tx.Create(&dbSequence{Name: name, Value: 1, LastTime: qtime.NewDateTime(now())}).Error
+			}
+			return tx.Model(seq).Where(clause.Eq{Column: nameCol, Value: name}).
+				Pluck(fieldColumn(tx, seq, "Value").Name, &value).Error
+		}, 1)
+		// 并发首次创建时唯一键冲突，重试走更新
+		if !IsDuplicateKey(err) {
+			break
+		}
+	}
+	return value, err
+}
+
+// Numbering 业务单号生成规则，如 PO-{yyyyMMdd}-{seq:4} 生成 PO-20240501-0001
+//
+//	日期占位符支持 yyyy、yy、MM、dd、HH、mm、ss 的组合，序号按日期占位符的取值重置，
+//	如包含 {yyyyMMdd} 时每天从1开始、只包含 {yyyyMM} 时每月从1开始，不含日期占位符时不重置；
+//	{seq:4} 表示序号至少4位，不足补0，为 {seq} 时不补0
+type Numbering struct {
+	db      *gorm.DB
+	pattern string
+	parts   []numberPart
+}
+
+// numberPart 规则中的一段
+type numberPart struct {
+	text   string // 固定文本
+	layout string // 日期格式，Go时间格式
+	width  int    // 序号宽度，-1表示非序号
+}
+
+var (
+	numberTokenRegex = regexp.MustCompile(`\{([^{}]+)\}`)
+	numberDateRegex  = regexp.MustCompile(`^(yyyy|yy|MM|dd|HH|mm|ss|[-_/.: ])+$`)
+	numberLayouts    = strings.NewReplacer("yyyy", "2006", "yy", "06", "MM", "01", "dd", "02", "HH", "15", "mm", "04", "ss", "05")
+)
+
+// NewNumbering 创建单号生成规则
+//
+//	@param db 数据库连接，序号保存在 qdb_sequence 表
+//	@param pattern 规则，如 PO-{yyyyMMdd}-{seq:4}，须包含一个 {seq}
+//	@return *Numbering, error
+func NewNumbering(db *gorm.DB, pattern string) (*Numbering, error) {
+	n := &Numbering{db: db, pattern: pattern}
+	seqs := 0
+	last := 0
+	for _, m := range numberTokenRegex.FindAllStringSubmatchIndex(pattern, -1) {
+		if m[0] > last {
+			n.parts = append(n.parts, numberPart{text: pattern[last:m[0]], width: -1})
+		}
+		last = m[1]
+		token := pattern[m[2]:m[3]]
+		switch {
+		case token == "seq" || strings.HasPrefix(token, "seq:"):
+			width := 0
+			if token != "seq" {
+				w, err := strconv.Atoi(token[4:])
+				if err != nil || w < 0 || w > 20 {
+					return nil, fmt.Errorf("qdb: invalid sequence width in %q", pattern)
+				}
+				width = w
+			}
+			n.parts = append(n.parts, numberPart{width: width})
+			seqs++
+		case numberDateRegex.MatchString(token):
+			n.parts = append(n.parts, numberPart{layout: numberLayouts.Replace(token), width: -1})
+		default:
+			return nil, fmt.Errorf("qdb: unknown placeholder {%s} in %q", token, pattern)
+		}
+	}
+	if last < len(pattern) {
+		n.parts = append(n.parts, numberPart{text: pattern[last:], width: -1})
+	}
+	if seqs != 1 {
+		return nil, fmt.Errorf("qdb: pattern %q requires exactly one {seq}", pattern)
+	}
+	return n, nil
+}
+
+// Next 生成下一个单号，多实例并发安全
+//
+//	@return string, error
+func (n *Numbering) Next() (string, error) {
+	t := now().Local()
+	// 序列按规则及日期占位符的取值区分，日期变化时自动从1开始
+	key := strings.Builder{}
+	key.WriteString("number:")
+	key.WriteString(n.pattern)
+	for _, p := range n.parts {
+		if p.layout != "" {
+			key.WriteByte(':')
+			key.WriteString(t.Format(p.layout))
+		}
+	}
+	seq, err := NextSequence(n.db, key.String())
+	if err != nil {
+		return "", err
+	}
+	out := strings.Builder{}
+	for _, p := range n.parts {
+		switch {
+		case p.layout != "":
+			out.WriteString(t.Format(p.layout))
+		case p.width >= 0:
+			out.WriteString(fmt.Sprintf("%0*d", p.width, seq))
+		default:
+			out.WriteString(p.text)
+		}
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,169 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// OnlineDDLOptions mysql在线表结构变更选项，作用于 AutoMigrate 等通过 Exec 执行的 ALTER TABLE、CREATE INDEX
+type OnlineDDLOptions struct {
+	MinRows   int64                                                       // 表的估算行数达到该值时才处理，为0全部处理
+	AllowCopy bool                                                        // 无法在线执行时是否记录警告后按原语句执行，false时返回错误
+	Runner    func(ctx context.Context, table string, alter string) error // 通过外部工具执行变更，如调用 gh-ost --alter、pt-online-schema-change --alter，为空时以 ALGORITHM=INPLACE, LOCK=NONE 执行
+	Logf      func(format string, args ...any)                            // 日志方法，为空使用 log.Printf
+}
+
+var (
+	alterTableRegex  = regexp.MustCompile("(?is)^\\s*ALTER\\s+TABLE\\s+(`[^`]+`|\\S+)\\s+(.+)$")
+	createIndexRegex = regexp.MustCompile("(?is)^\\s*CREATE\\s+((?:UNIQUE\\s+|FULLTEXT\\s+|SPATIAL\\s+)?INDEX)\\s+(`[^`]+`|\\S+)\\s+ON\\s+(`[^`]+`|\\S+)\\s*(.+)$")
+	algorithmRegex   = regexp.MustCompile(`(?i)\bALGORITHM\s*=`)
+)
+
+// onlineDDLPlugin 拦截mysql的表结构变更语句
+type onlineDDLPlugin struct {
+	opts OnlineDDLOptions
+}
+
+// Name 插件名称
+func (onlineDDLPlugin) Name() string {
+	return "qdb:online_ddl"
+}
+
+// Initialize 注册回调
+func (p *onlineDDLPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Raw().Before("gorm:raw").Register("qdb:online_ddl_before", p.before); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("qdb:online_ddl_after", p.after)
+}
+
+// EnableOnlineDDL 开启mysql在线表结构变更，避免大表 ALTER 长时间锁表
+//
+//	未设置 Runner 时为变更语句追加 ALGORITHM=INPLACE, LOCK=NONE，服务端无法在线执行时直接报错而不是锁表复制；
+//	设置 Runner 时交由 gh-ost、pt-online-schema-change 等影子表复制工具执行，语句本身不再执行
+//
+//	@param db 数据库连接，非mysql时不处理
+//	@param opts 选项
+//	@return error
+func EnableOnlineDDL(db *gorm.DB, opts OnlineDDLOptions) error {
+	if db.Dialector.Name() != "mysql" {
+		return nil
+	}
+	if _, ok := db.Config.Plugins[onlineDDLPlugin{}.Name()]; ok {
+		return nil
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	return db.Use(&onlineDDLPlugin{opts: opts})
+}
+
+// before 改写或转交变更语句
+func (p *onlineDDLPlugin) before(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+	query := db.Statement.SQL.String()
+	table, alter, inplace, ok := parseDDL(query)
+	if !ok || algorithmRegex.MatchString(query) {
+		return
+	}
+	if p.opts.MinRows > 0 && estimateRows(db, table) < p.opts.MinRows {
+		return
+	}
+	if p.opts.Runner != nil && alter != "" {
+		p.opts.Logf("qdb: online ddl on %s via runner: %s", table, alter)
+		if err := p.opts.Runner(db.Statement.Context, table, alter); err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		// 已由外部工具执行，跳过原语句
+		db.Statement.ConnPool = skipExecPool{db.Statement.ConnPool}
+		return
+	}
+	db.Statement.Settings.Store("qdb:online_ddl_origin", query)
+	db.Statement.SQL.Reset()
+	db.Statement.SQL.WriteString(inplace)
+}
+
+// after 无法在线执行时按选项报错或回退为原语句
+func (p *onlineDDLPlugin) after(db *gorm.DB) {
+	origin, ok := db.Statement.Settings.Load("qdb:online_ddl_origin")
+	if !ok || db.Error == nil {
+		return
+	}
+	var me *mysqlDriver.MySQLError
+	if !errors.As(db.Error, &me) || (me.Number != 1845 && me.Number != 1846) {
+		return
+	}
+	if !p.opts.AllowCopy {
+		db.Error = errors.Join(ErrUnsupported, db.Error)
+		return
+	}
+	p.opts.Logf("qdb: online ddl not supported, table will be locked: %s (%s)", origin, me.Message)
+	result, err := db.Statement.ConnPool.ExecContext(db.Statement.Context, origin.(string), db.Statement.Vars...)
+	db.Error = err
+	if err == nil {
+		db.RowsAffected, _ = result.RowsAffected()
+	}
+}
+
+// parseDDL 解析变更语句，返回表名、供外部工具使用的变更内容及追加在线选项后的语句
+func parseDDL(query string) (table string, alter string, inplace string, ok bool) {
+	if m := alterTableRegex.FindStringSubmatch(query); m != nil {
+		body := strings.TrimRight(strings.TrimSpace(m[2]), ";")
+		// 重命名等不涉及数据复制的变更不处理
+		if strings.HasPrefix(strings.ToUpper(body), "RENAME ") {
+			return "", "", "", false
+		}
+		return strings.Trim(m[1], "`"), body, "ALTER TABLE " + m[1] + " " + body + ", ALGORITHM=INPLACE, LOCK=NONE", true
+	}
+	if m := createIndexRegex.FindStringSubmatch(query); m != nil {
+		body := strings.TrimRight(strings.TrimSpace(m[4]), ";")
+		// 全文、空间索引不支持 LOCK=NONE
+		if kind := strings.ToUpper(m[1]); strings.HasPrefix(kind, "FULLTEXT") || strings.HasPrefix(kind, "SPATIAL") {
+			return "", "", "", false
+		}
+		return strings.Trim(m[3], "`"), "ADD " + m[1] + " " + m[2] + " " + body,
+			strings.TrimRight(strings.TrimSpace(query), ";") + " ALGORITHM=INPLACE LOCK=NONE", true
+	}
+	return "", "", "", false
+}
+
+// estimateRows 通过 information_schema 估算表的行数，失败时返回0
+func estimateRows(db *gorm.DB, table string) int64 {
+	var rows sql.NullInt64
+	_ = db.Session(&gorm.Session{NewDB: true}).Set("qdb:skip_stats", true).Set("qdb:skip_slow_log", true).
+		Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", table).
+		Row().Scan(&rows)
+	return rows.Int64
+}
+
+// skipExecPool 不执行写语句的连接，用于已由外部工具完成的变更
+type skipExecPool struct {
+	gorm.ConnPool
+}
+
+// ExecContext 直接返回成功
+func (skipExecPool) ExecContext(context.Context, string, ...any) (sql.Result, error) {
+	return driverResult(0), nil
+}
+
+// driverResult 影响行数固定的执行结果
+type driverResult int64
+
+// LastInsertId 不支持
+func (driverResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+// RowsAffected 影响行数
+func (r driverResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
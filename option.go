@@ -0,0 +1,167 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"time"
+)
+
+// DaoOption Dao创建选项
+type DaoOption func(opts *daoOptions)
+
+// daoOptions Dao选项集合
+type daoOptions struct {
+	defaultOrder string                    // 列表查询默认排序
+	scopes       []func(*gorm.DB) *gorm.DB // 默认查询范围
+	allowDelete  bool                      // 是否允许无条件删除
+	allowedOps   OpKind                    // 允许的操作类型，为0不限制
+	maxRows      int                       // 单次查询最大行数，为0不限制
+	singleFlight bool                      // 是否合并并发的相同查询
+	partition    *partitionKey             // 分区字段及查询范围，为nil未分区
+	watchPoll    time.Duration             // Watch 的轮询间隔，为0不轮询
+}
+
+// OpKind 操作类型，可按位组合
+type OpKind uint8
+
+const (
+	OpRead   OpKind = 1 << iota // 查询
+	OpCreate                    // 新增
+	OpUpdate                    // 修改
+	OpDelete                    // 删除
+)
+
+// WithAllowedOps 限制Dao允许的操作类型，执行其他操作时返回 ErrOpNotAllowed
+//
+//	注意：通过 DB() 取得的连接不受限制
+//
+//	@param kinds 允许的操作类型，如 OpRead | OpCreate
+//	@return DaoOption
+func WithAllowedOps(kinds OpKind) DaoOption {
+	return func(opts *daoOptions) {
+		opts.allowedOps = kinds
+	}
+}
+
+// ReadOnly 只读Dao，仅允许查询
+//
+//	@return DaoOption
+func ReadOnly() DaoOption {
+	return WithAllowedOps(OpRead)
+}
+
+// NoDelete 不允许删除的Dao
+//
+//	@return DaoOption
+func NoDelete() DaoOption {
+	return WithAllowedOps(OpRead | OpCreate | OpUpdate)
+}
+
+// WithDefaultOrder 设置列表查询的默认排序，调用时指定排序则覆盖
+//
+//	@param order 排序，如 id desc
+//	@return DaoOption
+func WithDefaultOrder(order string) DaoOption {
+	return func(opts *daoOptions) {
+		opts.defaultOrder = order
+	}
+}
+
+// WithDefaultScope 设置默认查询范围，应用于所有查询，可通过 Unscoped 取消
+//
+//	@param fn 范围方法，如 func(db *gorm.DB) *gorm.DB { return db.Where("enable = ?", true) }
+//	@return DaoOption
+func WithDefaultScope(fn func(db *gorm.DB) *gorm.DB) DaoOption {
+	return func(opts *daoOptions) {
+		opts.scopes = append(opts.scopes, fn)
+	}
+}
+
+// AllowFullTableDelete 允许 DeleteCondition 使用空条件删除全表数据
+//
+//	@return DaoOption
+func AllowFullTableDelete() DaoOption {
+	return func(opts *daoOptions) {
+		opts.allowDelete = true
+	}
+}
+
+// Unscoped 返回不应用默认排序和默认查询范围的Dao
+//
+//	@return *Dao[T]
+func (dao *Dao[T]) Unscoped() *Dao[T] {
+	clone := *dao
+	clone.opts.defaultOrder = ""
+	clone.opts.scopes = nil
+	return &clone
+}
+
+// WithUnscoped 返回标记查询不应用默认查询范围的上下文，效果同 Unscoped，行过滤策略仍然生效
+//
+//	用于管理端查看范围外的数据，无需另写方法，通过 Dao.WithContext 传入
+//
+//	@param ctx 上下文
+//	@return context.Context
+func WithUnscoped(ctx context.Context) context.Context {
+	return WithValues(ctx, KeyUnscoped, true)
+}
+
+// WithIncludeDeleted 返回标记查询包含软删除记录（gorm.DeletedAt）的上下文
+//
+//	@param ctx 上下文
+//	@return context.Context
+func WithIncludeDeleted(ctx context.Context) context.Context {
+	return WithValues(ctx, KeyIncludeDeleted, true)
+}
+
+// Debug 返回输出完整SQL日志的Dao，不受全局OpenLog设置影响，用于线上定向排查
+//
+//	@return *Dao[T]
+func (dao *Dao[T]) Debug() *Dao[T] {
+	clone := *dao
+	clone.db = dao.db.Debug()
+	return &clone
+}
+
+// WithContext 返回使用指定上下文的Dao，用于传递超时、操作人等
+//
+//	@param ctx 上下文，如 WithActor(ctx, "user42")
+//	@return *Dao[T]
+func (dao *Dao[T]) WithContext(ctx context.Context) *Dao[T] {
+	clone := *dao
+	clone.db = dao.db.WithContext(ctx)
+	return &clone
+}
+
+// query 返回应用行过滤策略、默认查询范围和行数上限的连接，上下文标记见 WithUnscoped、WithIncludeDeleted
+func (dao *Dao[T]) query(db *gorm.DB) *gorm.DB {
+	db = rowPolicy[T](db)
+	ctx := db.Statement.Context
+	if unscoped, _ := ValueFrom[bool](ctx, KeyUnscoped); len(dao.opts.scopes) > 0 && !unscoped {
+		db = db.Scopes(dao.opts.scopes...)
+	}
+	if deleted, _ := ValueFrom[bool](ctx, KeyIncludeDeleted); deleted {
+		db = db.Unscoped()
+	}
+	if dao.opts.maxRows > 0 {
+		db = limitRows(db, dao.opts.maxRows)
+	}
+	return dao.partitionRange(db, false)
+}
+
+// list 返回应用默认查询范围和默认排序的连接
+func (dao *Dao[T]) list(db *gorm.DB) *gorm.DB {
+	return dao.listOrder(db, "")
+}
+
+// listOrder 返回应用默认查询范围和分区时间窗口的连接，指定排序时代替默认排序
+func (dao *Dao[T]) listOrder(db *gorm.DB, order string) *gorm.DB {
+	db = dao.partitionRange(dao.query(db), true)
+	if order == "" {
+		order = dao.opts.defaultOrder
+	}
+	if order != "" {
+		db = db.Order(order)
+	}
+	return db
+}
@@ -0,0 +1,101 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+)
+
+// DbOwned 多态关联的所属对象，用于附件、评论等可挂在多种实体下的表，与 DbSimple 等一同嵌入模型
+//
+//	所属类型默认为所属实体的表名，可通过 OwnerTypeOf 取得
+type DbOwned struct {
+	OwnerType string `gorm:"size:64;index:,composite:owner"` // 所属类型
+	OwnerId   uint64 `gorm:"index:,composite:owner"`         // 所属唯一号
+}
+
+// Ownable 可选的所属对象接口，嵌入 DbOwned 的模型已自动实现
+type Ownable interface {
+	SetOwner(ownerType string, ownerId uint64)
+}
+
+// OwnerRef 所属对象
+type OwnerRef struct {
+	Type string // 所属类型
+	Id   uint64 // 所属唯一号
+}
+
+// SetOwner 所属类型为空时写入所属对象
+func (m *DbOwned) SetOwner(ownerType string, ownerId uint64) {
+	if m.OwnerType == "" {
+		m.OwnerType, m.OwnerId = ownerType, ownerId
+	}
+}
+
+// WithOwner 返回带所属对象的上下文，Dao新增时填充到 DbOwned
+//
+//	@param ctx 上下文
+//	@param ownerType 所属类型，如 OwnerTypeOf(db, &Order{})
+//	@param ownerId 所属唯一号
+//	@return context.Context
+func WithOwner(ctx context.Context, ownerType string, ownerId uint64) context.Context {
+	return WithValues(ctx, KeyOwner, OwnerRef{Type: ownerType, Id: ownerId})
+}
+
+// OwnerFrom 读取上下文中的所属对象
+//
+//	@param ctx 上下文
+//	@return OwnerRef, bool
+func OwnerFrom(ctx context.Context) (OwnerRef, bool) {
+	return ValueFrom[OwnerRef](ctx, KeyOwner)
+}
+
+// OwnerTypeOf 返回实体的所属类型，即按命名策略生成的表名
+//
+//	@param db 数据库连接
+//	@param owner 所属实体，如 &Order{}
+//	@return string
+func OwnerTypeOf(db *gorm.DB, owner any) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(owner); err == nil {
+		return stmt.Schema.Table
+	}
+	return reflect.Indirect(reflect.ValueOf(owner)).Type().Name()
+}
+
+// CreateFor 新建一条属于指定实体的记录，所属类型和唯一号取自所属实体
+//
+//	@param owner 所属实体，需已保存，如 order
+//	@param model 待新增实体
+//	@return error
+func (dao *Dao[T]) CreateFor(owner any, model *T) error {
+	ref := OwnerRef{Type: OwnerTypeOf(dao.db, owner)}
+	if m, ok := owner.(Model); ok {
+		ref.Id = m.GetID()
+	} else if id := reflect.Indirect(reflect.ValueOf(owner)).FieldByName("Id"); id.IsValid() && id.CanUint() {
+		ref.Id = id.Uint()
+	}
+	if o, ok := any(model).(Ownable); ok {
+		o.SetOwner(ref.Type, ref.Id)
+	}
+	return dao.Create(model)
+}
+
+// GetOwned 查询属于指定实体的一组列表
+//
+//	@param ownerType 所属类型，如 OwnerTypeOf(db, &Order{})
+//	@param ownerId 所属唯一号
+//	@return []*T, error
+func (dao *Dao[T]) GetOwned(ownerType string, ownerId uint64) ([]*T, error) {
+	list := make([]*T, 0)
+	err := dao.exec("GetOwned", OpRead, func(op *Operation) error {
+		result := dao.list(op.DB).Where(clause.And(
+			clause.Eq{Column: fieldColumn(op.DB, new(T), "OwnerType"), Value: ownerType},
+			clause.Eq{Column: fieldColumn(op.DB, new(T), "OwnerId"), Value: ownerId},
+		)).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
@@ -0,0 +1,167 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+)
+
+// ParallelOptions 并行读取选项
+type ParallelOptions struct {
+	Query     string // 条件，为空读取全表
+	Args      []any  // 条件参数
+	Workers   int    // 并行数量，为0使用4
+	RangeSize uint64 // 每个唯一号区间的跨度，为0使用100000
+	BatchSize int    // 区间内每次查询的数量，为0使用1000
+	Buffer    int    // 输出通道容量，为0使用 BatchSize
+}
+
+// ParallelReader 并行读取器，按唯一号区间并发读取，结果无序
+type ParallelReader[T any] struct {
+	rows chan *T
+	err  error
+	done chan struct{}
+}
+
+// Rows 返回结果通道，全部读取完成或出错后关闭
+//
+//	@return <-chan *T
+func (r *ParallelReader[T]) Rows() <-chan *T {
+	return r.rows
+}
+
+// Err 等待读取结束并返回首个错误
+//
+//	@return error
+func (r *ParallelReader[T]) Err() error {
+	<-r.done
+	return r.err
+}
+
+// ReadParallel 将表按唯一号划分为多个区间，在多个协程中并发读取并汇总到同一通道，用于大表导出
+//
+//	调用方须读完 Rows 或取消ctx，否则读取协程将阻塞
+//
+//	@param ctx 上下文，取消后停止读取
+//	@param opts 并行读取选项
+//	@return *ParallelReader[T]
+func (dao *Dao[T]) ReadParallel(ctx context.Context, opts ParallelOptions) *ParallelReader[T] {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.RangeSize == 0 {
+		opts.RangeSize = 100000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = opts.BatchSize
+	}
+	r := &ParallelReader[T]{rows: make(chan *T, opts.Buffer), done: make(chan struct{})}
+	ctx, cancel := context.WithCancel(ctx)
+
+	// 记录首个错误并停止其余协程
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			r.err = err
+			cancel()
+		})
+	}
+
+	go func() {
+		defer close(r.done)
+		defer close(r.rows)
+		defer cancel()
+
+		// 唯一号范围
+		var lower, upper sql.NullInt64
+		err := dao.exec("ReadParallel", OpRead, func(op *Operation) error {
+			db := dao.query(op.DB.WithContext(ctx)).Model(new(T))
+			if opts.Query != "" {
+				db = db.Where(opts.Query, opts.Args...)
+			}
+			return db.Select("MIN(id), MAX(id)").Row().Scan(&lower, &upper)
+		})
+		if err != nil {
+			fail(err)
+			return
+		}
+		if !upper.Valid {
+			return
+		}
+		lowId, highId := uint64(lower.Int64), uint64(upper.Int64)
+
+		ranges := make(chan [2]uint64)
+		go func() {
+			defer close(ranges)
+			for lo := lowId; lo <= highId; lo += opts.RangeSize {
+				select {
+				case ranges <- [2]uint64{lo, lo + opts.RangeSize}:
+				case <-ctx.Done():
+					return
+				}
+				if lo+opts.RangeSize < lo {
+					return
+				}
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < opts.Workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for rg := range ranges {
+					if err := dao.readRange(ctx, opts, rg[0], rg[1], r.rows); err != nil {
+						fail(err)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if r.err == nil && ctx.Err() != nil {
+			fail(ctx.Err())
+		}
+	}()
+	return r
+}
+
+// readRange 分批读取 [lo, hi) 区间内的记录
+func (dao *Dao[T]) readRange(ctx context.Context, opts ParallelOptions, lo uint64, hi uint64, out chan<- *T) error {
+	return dao.exec("ReadParallel", OpRead, func(op *Operation) error {
+		last := lo
+		first := true
+		for {
+			db := dao.query(op.DB.WithContext(ctx))
+			if opts.Query != "" {
+				db = db.Where(opts.Query, opts.Args...)
+			}
+			if first {
+				db = db.Where("id >= ? AND id < ?", last, hi)
+			} else {
+				db = db.Where("id > ? AND id < ?", last, hi)
+			}
+			var list []*T
+			if err := db.Order("id").Limit(opts.BatchSize).Find(&list).Error; err != nil {
+				return err
+			}
+			for _, model := range list {
+				select {
+				case out <- model:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			op.RowsAffected += int64(len(list))
+			if len(list) < opts.BatchSize {
+				return nil
+			}
+			last = reflect.ValueOf(list[len(list)-1]).Elem().FieldByName("Id").Uint()
+			first = false
+		}
+	})
+}
@@ -0,0 +1,217 @@
+package qdb
+
+import (
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// partitionKey 分区字段及查询范围
+type partitionKey struct {
+	field  string         // 分区字段，如 LastTime
+	window time.Duration  // 列表查询的默认时间窗口，为0不限定
+	ranged bool           // 是否显式指定了范围，指定后不再使用默认窗口
+	start  qtime.DateTime // 范围开始（包含），为0不限制
+	end    qtime.DateTime // 范围结束（包含），为0不限制
+}
+
+// PruneInfo 分区裁剪诊断信息
+type PruneInfo struct {
+	Field      string         // 分区字段
+	Start      qtime.DateTime // 附加的分区条件开始，为0未限制
+	End        qtime.DateTime // 附加的分区条件结束，为0未限制
+	SQL        string         // 实际执行的语句
+	Partitions []string       // 执行计划中访问的分区，mysql取自 EXPLAIN 的 partitions 列，postgres取自扫描的子表
+	Total      int            // 表的分区总数，不支持的数据库为0
+}
+
+// WithPartitionKey 声明表按时间字段分区，查询自动附加分区字段条件以便数据库裁剪分区
+//
+//	列表查询默认限定在最近的 window 内，可通过 InPartitions 指定范围；按时间范围查询时按范围附加条件
+//
+//	@param field 分区字段，如 LastTime
+//	@param window 列表查询的默认时间窗口，如 30*24*time.Hour，为0不限定
+//	@return DaoOption
+func WithPartitionKey(field string, window time.Duration) DaoOption {
+	return func(opts *daoOptions) {
+		opts.partition = &partitionKey{field: field, window: window}
+	}
+}
+
+// InPartitions 返回查询限定在指定时间范围分区内的Dao，作用于包括按唯一号查询在内的所有查询
+//
+//	未通过 WithPartitionKey 声明时按 LastTime 分区
+//
+//	@param start 开始时间（包含），为0不限制
+//	@param end 结束时间（包含），为0不限制
+//	@return *Dao[T]
+func (dao *Dao[T]) InPartitions(start, end qtime.DateTime) *Dao[T] {
+	p := partitionKey{field: "LastTime"}
+	if dao.opts.partition != nil {
+		p = *dao.opts.partition
+	}
+	p.ranged, p.start, p.end = true, start, end
+	clone := *dao
+	clone.opts.partition = &p
+	return &clone
+}
+
+// AllPartitions 返回列表查询不使用默认时间窗口的Dao，访问全部分区
+//
+//	@return *Dao[T]
+func (dao *Dao[T]) AllPartitions() *Dao[T] {
+	return dao.InPartitions(0, 0)
+}
+
+// partitionRange 附加分区范围条件，未声明分区或未限定范围时不处理
+//
+//	@param list 是否为列表查询，显式范围由 query 附加，列表查询只附加默认窗口
+func (dao *Dao[T]) partitionRange(db *gorm.DB, list bool) *gorm.DB {
+	p := dao.opts.partition
+	if p == nil {
+		return db
+	}
+	start, end := p.start, p.end
+	switch {
+	case p.ranged && list:
+		// 显式范围已在 query 中附加
+		return db
+	case !p.ranged && (!list || p.window <= 0):
+		return db
+	case !p.ranged:
+		start, end = dateTimeOf(now().Add(-p.window).Local()), 0
+	}
+	if start == 0 && end == 0 {
+		return db
+	}
+	column := fieldColumn(db, new(T), p.field)
+	if _, ok := db.Config.Plugins[utcPlugin{}.Name()]; ok {
+		start, end = UTCDateTime(start), UTCDateTime(end)
+	}
+	if start > 0 {
+		db = db.Where(clause.Gte{Column: column, Value: start})
+	}
+	if end > 0 {
+		db = db.Where(clause.Lte{Column: column, Value: end})
+	}
+	return db
+}
+
+// betweenPartitions 按时间字段范围查询时推导分区范围
+//
+//	范围字段即分区字段时直接使用；按 CreatedTime 查询且按 LastTime 分区时，最后操作时间不早于创建时间，可限定开始时间
+func (dao *Dao[T]) betweenPartitions(field string, start, end qtime.DateTime) *Dao[T] {
+	p := dao.opts.partition
+	if p == nil || p.ranged {
+		return dao
+	}
+	switch {
+	case field == p.field:
+		return dao.InPartitions(start, end)
+	case field == "CreatedTime" && p.field == "LastTime":
+		return dao.InPartitions(start, 0)
+	}
+	return dao.AllPartitions()
+}
+
+// PruneInfo 返回按条件执行列表查询时附加的分区条件和数据库实际访问的分区，用于确认查询是否裁剪了分区
+//
+//	@param query 查询条件，如 status = ?，为nil时不附加条件
+//	@param args 条件参数
+//	@return PruneInfo, error
+func (dao *Dao[T]) PruneInfo(query any, args ...any) (PruneInfo, error) {
+	var info PruneInfo
+	err := dao.exec("PruneInfo", OpRead, func(op *Operation) error {
+		if p := dao.opts.partition; p != nil {
+			info.Field, info.Start, info.End = p.field, p.start, p.end
+			if !p.ranged && p.window > 0 {
+				info.Start = dateTimeOf(now().Add(-p.window).Local())
+			}
+		}
+		info.SQL = op.DB.ToSQL(func(tx *gorm.DB) *gorm.DB {
+			db := dao.list(tx)
+			if query != nil {
+				db = db.Where(query, args...)
+			}
+			return db.Find(&[]*T{})
+		})
+		db := op.DB.Session(&gorm.Session{NewDB: true}).Set("qdb:skip_stats", true).Set("qdb:skip_slow_log", true)
+		switch db.Dialector.Name() {
+		case "mysql":
+			return mysqlPrune(db, dao.table, &info)
+		case "postgres":
+			return postgresPrune(db, dao.table, &info)
+		}
+		return nil
+	})
+	return info, err
+}
+
+// mysqlPrune 通过 EXPLAIN 的 partitions 列读取访问的分区
+func mysqlPrune(db *gorm.DB, table string, info *PruneInfo) error {
+	rows, err := db.Raw("EXPLAIN " + info.SQL).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		for i := range values {
+			values[i] = new(any)
+		}
+		if err = rows.Scan(values...); err != nil {
+			return err
+		}
+		for i, name := range columns {
+			v := *(values[i].(*any))
+			if !strings.EqualFold(name, "partitions") || v == nil {
+				continue
+			}
+			for _, part := range strings.Split(fmt.Sprintf("%s", v), ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					info.Partitions = append(info.Partitions, part)
+				}
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	var total int64
+	err = db.Raw("SELECT COUNT(*) FROM information_schema.PARTITIONS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL", table).
+		Row().Scan(&total)
+	info.Total = int(total)
+	return err
+}
+
+// 执行计划中扫描的表
+var planScanRegex = regexp.MustCompile(`Scan(?: using \S+)? on (\S+)`)
+
+// postgresPrune 通过 EXPLAIN 中扫描的子表读取访问的分区
+func postgresPrune(db *gorm.DB, table string, info *PruneInfo) error {
+	var plan []string
+	if err := db.Raw("EXPLAIN " + info.SQL).Scan(&plan).Error; err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, line := range plan {
+		for _, m := range planScanRegex.FindAllStringSubmatch(line, -1) {
+			if name := strings.Trim(m[1], `"`); !seen[name] {
+				seen[name] = true
+				info.Partitions = append(info.Partitions, name)
+			}
+		}
+	}
+	var total int64
+	err := db.Raw("SELECT COUNT(*) FROM pg_inherits WHERE inhparent = to_regclass(?)", `"`+table+`"`).Row().Scan(&total)
+	info.Total = int(total)
+	return err
+}
@@ -0,0 +1,43 @@
+package qdb
+
+import (
+	"github.com/kamioair/utils/qtime"
+	"testing"
+	"time"
+)
+
+type partitionEvent struct {
+	DbSimple
+	At   qtime.DateTime
+	Name string
+}
+
+func TestPartitionWindowWithOrder(t *testing.T) {
+	dao, err := TryNewDao[partitionEvent](newTestDB(t), WithPartitionKey("At", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dao.CreateList([]partitionEvent{
+		{At: qtime.NewDateTime(time.Now().Add(-2 * time.Hour)), Name: "old"},
+		{At: qtime.NewDateTime(time.Now()), Name: "new"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := dao.GetConditionsOrder("id desc", "1 = 1")
+	if err != nil || len(list) != 1 || list[0].Name != "new" {
+		t.Errorf("GetConditionsOrder: %d %v", len(list), err)
+	}
+	list, total, err := dao.FindAndCount(FindOptions{Order: "id desc"})
+	if err != nil || len(list) != 1 || total != 1 {
+		t.Errorf("FindAndCount with order: %d/%d %v", len(list), total, err)
+	}
+	list, err = dao.GetMany(Order("id desc"))
+	if err != nil || len(list) != 1 {
+		t.Errorf("GetMany with order: %d %v", len(list), err)
+	}
+	// 单条查询不限定时间窗口
+	if old, _ := dao.GetCondition("name = ?", "old"); old == nil {
+		t.Error("GetCondition limited by list window")
+	}
+}
@@ -0,0 +1,171 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sync"
+)
+
+// 各模型类型的对象池，值为 *objectPool
+var modelPools sync.Map
+
+// objectPool 模型对象池及列表切片池
+type objectPool struct {
+	items sync.Pool // 模型对象
+	lists sync.Pool // 列表切片的指针
+}
+
+// PooledList 从对象池取得的查询结果，使用完毕后须调用 Release 归还，归还后不可再访问
+type PooledList[T any] struct {
+	Items []*T
+	pool  *objectPool
+}
+
+// Release 将结果归还对象池，可重复调用
+func (p *PooledList[T]) Release() {
+	if p.pool == nil {
+		return
+	}
+	var zero T
+	for _, item := range p.Items {
+		*item = zero
+		p.pool.items.Put(item)
+	}
+	items := p.Items[:0]
+	p.pool.lists.Put(&items)
+	p.Items = nil
+	p.pool = nil
+}
+
+// GetAllPooled 返回所有列表，结果对象从对象池取得，用于高频轮询同一张表时减少GC压力
+//
+//	@return *PooledList[T], error
+func (dao *Dao[T]) GetAllPooled() (*PooledList[T], error) {
+	return dao.getPooled("GetAllPooled", nil)
+}
+
+// GetConditionsPooled 条件查询一组列表，结果对象从对象池取得，用于高频轮询同一张表时减少GC压力
+//
+//	@param query 条件，如 id = ? 或 id IN (?) 等
+//	@param args 条件参数，如 id, ids 等
+//	@return *PooledList[T], error
+func (dao *Dao[T]) GetConditionsPooled(query interface{}, args ...interface{}) (*PooledList[T], error) {
+	return dao.getPooled("GetConditionsPooled", query, args...)
+}
+
+// getPooled 逐行扫描到对象池中的对象，之后执行UTC转换和 AfterFind 钩子，不执行预加载等其他查询回调
+func (dao *Dao[T]) getPooled(name string, query interface{}, args ...interface{}) (*PooledList[T], error) {
+	pool := modelPool[T]()
+	list := &PooledList[T]{pool: pool}
+	if items, ok := pool.lists.Get().(*[]*T); ok {
+		list.Items = *items
+	}
+	err := dao.exec(name, OpRead, func(op *Operation) error {
+		db := dao.list(op.DB).Model(new(T))
+		if query != nil {
+			db = db.Where(query, args...)
+		}
+		rows, err := db.Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		sch, fields, err := columnFields[T](op.DB, rows)
+		if err != nil {
+			return err
+		}
+		// 直接扫描后按字段写入，避免每行构建语句
+		values := make([]any, len(fields))
+		dest := make([]any, len(fields))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if dao.opts.maxRows > 0 && len(list.Items) >= dao.opts.maxRows {
+				return fmt.Errorf("%w: %s returned more than %d rows", ErrTooManyRows, dao.table, dao.opts.maxRows)
+			}
+			item := pool.items.Get().(*T)
+			list.Items = append(list.Items, item)
+			if err = rows.Scan(dest...); err != nil {
+				return err
+			}
+			value := reflect.ValueOf(item).Elem()
+			for i, field := range fields {
+				if field == nil || values[i] == nil {
+					continue
+				}
+				if err = field.Set(op.Context(), value, values[i]); err != nil {
+					return err
+				}
+			}
+		}
+		op.RowsAffected = int64(len(list.Items))
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return afterPooled(op.DB, sch, list.Items)
+	})
+	if err != nil {
+		list.Release()
+		return nil, err
+	}
+	return list, nil
+}
+
+// afterPooled 执行直接扫描时跳过的查询后处理：UTC存储时转换为本地时间，调用 AfterFind 钩子
+func afterPooled[T any](db *gorm.DB, sch *schema.Schema, items []*T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if _, ok := db.Config.Plugins[utcPlugin{}.Name()]; ok {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		convertSchemaDateTimes(ctx, sch, reflect.ValueOf(items), LocalDateTime)
+	}
+	if db.Statement.SkipHooks || !sch.AfterFind {
+		return nil
+	}
+	tx := db.Session(&gorm.Session{NewDB: true})
+	for _, item := range items {
+		if err := any(item).(callbacks.AfterFindInterface).AfterFind(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// columnFields 返回模型结构及各列对应的字段，不存在的列为nil
+func columnFields[T any](db *gorm.DB, rows *sql.Rows) (*schema.Schema, []*schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, nil, err
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := make([]*schema.Field, len(columns))
+	for i, column := range columns {
+		fields[i] = stmt.Schema.LookUpField(column)
+	}
+	return stmt.Schema, fields, nil
+}
+
+// modelPool 返回模型的对象池
+func modelPool[T any]() *objectPool {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if v, ok := modelPools.Load(typ); ok {
+		return v.(*objectPool)
+	}
+	pool := &objectPool{}
+	pool.items.New = func() any { return new(T) }
+	v, _ := modelPools.LoadOrStore(typ, pool)
+	return v.(*objectPool)
+}
@@ -0,0 +1,269 @@
+package qdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bool 跨数据库一致的布尔字段
+//
+// 建表时 sqlite 为 integer、mysql 为 tinyint(1)、sqlserver 为 bit、postgres 为 boolean，
+// 读取时兼容各驱动返回的整数、布尔、字符串
+type Bool bool
+
+// GormDataType 通用数据类型
+func (Bool) GormDataType() string {
+	return string(schema.Bool)
+}
+
+// GormDBDataType 各数据库的建表类型
+func (Bool) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "tinyint(1)"
+	case "sqlserver":
+		return "bit"
+	case "postgres":
+		return "boolean"
+	default:
+		return "integer"
+	}
+}
+
+// Value 写入值
+func (b Bool) Value() (driver.Value, error) {
+	return bool(b), nil
+}
+
+// Scan 读取值
+func (b *Bool) Scan(src any) error {
+	v, err := ToBool(src)
+	if err != nil {
+		return err
+	}
+	*b = Bool(v)
+	return nil
+}
+
+// 时间字段写入格式，保留到毫秒，不含时区
+const portableTimeLayout = "2006-01-02 15:04:05.000"
+
+// Time 跨数据库一致的时间字段
+//
+// 统一保留到毫秒，以本地时间的年月日时分秒写入且不含时区，读取时按本地时间解析，
+// 避免 sqlite 文本、mysql 的 parseTime/loc 设置、sqlserver datetime2 返回UTC标记造成的差异；
+// 零值写入为NULL
+type Time struct {
+	time.Time
+}
+
+// NewTime 创建时间字段，截断到毫秒
+//
+//	@param t 时间
+//	@return Time
+func NewTime(t time.Time) Time {
+	return Time{Time: t.Truncate(time.Millisecond)}
+}
+
+// GormDataType 通用数据类型
+func (Time) GormDataType() string {
+	return string(schema.Time)
+}
+
+// GormDBDataType 各数据库的建表类型
+func (Time) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return "datetime(3)"
+	case "sqlserver":
+		return "datetime2(3)"
+	case "postgres":
+		return "timestamp(3)"
+	default:
+		return "datetime"
+	}
+}
+
+// Value 写入值
+func (t Time) Value() (driver.Value, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.Local().Format(portableTimeLayout), nil
+}
+
+// Scan 读取值
+func (t *Time) Scan(src any) error {
+	v, err := ToTime(src)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+// ToBool 将驱动返回的值转换为布尔，兼容 bit、tinyint(1)、整数和字符串
+//
+//	@param v 驱动返回的值
+//	@return bool, error
+func ToBool(v any) (bool, error) {
+	switch x := v.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return x, nil
+	case int64:
+		return x != 0, nil
+	case uint64:
+		return x != 0, nil
+	case float64:
+		return x != 0, nil
+	case []byte:
+		return parseBool(string(x))
+	case string:
+		return parseBool(x)
+	}
+	return false, fmt.Errorf("qdb: cannot convert %T to bool", v)
+}
+
+// parseBool 解析字符串形式的布尔
+func parseBool(s string) (bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false, nil
+	}
+	// mysql bit(1) 以单字节返回
+	if len(s) == 1 && s[0] <= 1 {
+		return s[0] == 1, nil
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n != 0, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("qdb: cannot convert %q to bool", s)
+	}
+	return v, nil
+}
+
+// 驱动以文本返回时间时可能的格式
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ToTime 将驱动返回的值转换为本地时间，不含时区的值按本地时间解析，结果截断到毫秒
+//
+//	@param v 驱动返回的值
+//	@return time.Time, error
+func ToTime(v any) (time.Time, error) {
+	switch x := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		// 不含时区的列由驱动标记为UTC，取其年月日时分秒作为本地时间
+		if x.Location() == time.UTC {
+			x = wallClock(x)
+		}
+		return x.Local().Truncate(time.Millisecond), nil
+	case []byte:
+		return parseTime(string(x))
+	case string:
+		return parseTime(x)
+	case int64, uint64:
+		d, err := ToDateTime(x)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return d.ToTime(), nil
+	}
+	return time.Time{}, fmt.Errorf("qdb: cannot convert %T to time", v)
+}
+
+// wallClock 以相同的年月日时分秒构造本地时间
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// parseTime 解析文本形式的时间
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Local().Truncate(time.Millisecond), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("qdb: cannot parse time %q", s)
+}
+
+// ToDateTime 将驱动返回的值转换为 qtime.DateTime，兼容整数、数字文本、时间文本和 time.Time，
+// 用于原生查询、聚合结果等无法直接扫描到 qtime.DateTime 的场景
+//
+//	@param v 驱动返回的值
+//	@return qtime.DateTime, error
+func ToDateTime(v any) (qtime.DateTime, error) {
+	switch x := v.(type) {
+	case nil:
+		return 0, nil
+	case qtime.DateTime:
+		return x, nil
+	case int64:
+		if x < 0 {
+			return 0, fmt.Errorf("qdb: invalid datetime %d", x)
+		}
+		return qtime.DateTime(x), nil
+	case uint64:
+		return qtime.DateTime(x), nil
+	case float64:
+		if x < 0 {
+			return 0, fmt.Errorf("qdb: invalid datetime %v", x)
+		}
+		return qtime.DateTime(x), nil
+	case time.Time:
+		t, _ := ToTime(x)
+		return dateTimeOf(t), nil
+	case []byte:
+		return parseDateTime(string(x))
+	case string:
+		return parseDateTime(x)
+	}
+	return 0, fmt.Errorf("qdb: cannot convert %T to datetime", v)
+}
+
+// parseDateTime 解析数字或时间文本形式的 qtime.DateTime
+func parseDateTime(s string) (qtime.DateTime, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	// 聚合结果可能带小数，如 SUM、AVG 返回的 decimal
+	if i := strings.IndexByte(s, '.'); i > 0 && !strings.ContainsAny(s, "-:") {
+		s = s[:i]
+	}
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return qtime.DateTime(n), nil
+	}
+	t, err := parseTime(s)
+	if err != nil {
+		return 0, err
+	}
+	if t.IsZero() {
+		return 0, nil
+	}
+	return dateTimeOf(t), nil
+}
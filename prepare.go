@@ -0,0 +1,337 @@
+package qdb
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prepared 已注册的原始SQL，结果映射到T
+type Prepared[T any] struct {
+	Name string // 名称
+	SQL  string // 语句，参数使用 ?
+}
+
+// preparedChecker 可校验的已注册语句
+type preparedChecker interface {
+	Validate(db *gorm.DB) error
+}
+
+var (
+	prepared     = map[string]preparedChecker{}
+	preparedLock sync.RWMutex
+)
+
+// Prepare 注册原始SQL，启动时通过 ValidatePrepared 对照实际表结构校验，名称重复时panic
+//
+//	@param name 名称，如 report.daily
+//	@param sql 语句，如 SELECT Id, UserName FROM User WHERE Id > ?
+//	@return *Prepared[T]
+func Prepare[T any](name string, sql string) *Prepared[T] {
+	preparedLock.Lock()
+	defer preparedLock.Unlock()
+	if _, ok := prepared[name]; ok {
+		panic(fmt.Sprintf("qdb: prepared query %s already registered", name))
+	}
+	p := &Prepared[T]{Name: name, SQL: sql}
+	prepared[name] = p
+	return p
+}
+
+// ValidatePrepared 校验全部已注册的语句，返回所有不一致
+//
+//	@param db 数据库连接
+//	@return error 可通过 errors.Is(err, ErrSchemaDrift) 判断
+func ValidatePrepared(db *gorm.DB) error {
+	preparedLock.RLock()
+	names := make([]string, 0, len(prepared))
+	for name := range prepared {
+		names = append(names, name)
+	}
+	preparedLock.RUnlock()
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		preparedLock.RLock()
+		p := prepared[name]
+		preparedLock.RUnlock()
+		if err := p.Validate(db); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate 校验语句可执行、结果列在T中存在且类型兼容，仅校验查询语句
+//
+//	以参数全部为NULL、条件恒为假的方式执行，不读取数据；sqlserver 的子查询不允许 ORDER BY 和 WITH，
+//	改为通过 sp_describe_first_result_set 取得结果列，参数按 nvarchar 声明
+//
+//	@param db 数据库连接
+//	@return error
+func (p *Prepared[T]) Validate(db *gorm.DB) error {
+	head := strings.ToUpper(strings.TrimSpace(p.SQL))
+	if !strings.HasPrefix(head, "SELECT") && !strings.HasPrefix(head, "WITH") {
+		return nil
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSchemaDrift, p.Name, err)
+	}
+
+	var columns []resultColumn
+	var err error
+	if db.Dialector.Name() == "sqlserver" {
+		columns, err = describeSqlserver(db, p.SQL)
+	} else {
+		columns, err = describeWrapped(db, p.SQL)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSchemaDrift, p.Name, err)
+	}
+
+	var problems []string
+	for _, col := range columns {
+		field := stmt.Schema.LookUpField(col.name)
+		if field == nil {
+			problems = append(problems, fmt.Sprintf("column %s has no field", col.name))
+			continue
+		}
+		if !compatibleKind(field, col.dbType, col.scan) {
+			problems = append(problems, fmt.Sprintf("column %s (%s) cannot scan into %s %s", col.name, col.dbType, field.Name, field.FieldType))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s: %s", ErrSchemaDrift, p.Name, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// resultColumn 查询结果的一列
+type resultColumn struct {
+	name   string
+	dbType string
+	scan   reflect.Type // 扫描类型，未知时为nil
+}
+
+// describeWrapped 将语句包装为条件恒为假的子查询执行，从结果集取得列
+func describeWrapped(db *gorm.DB, sql string) ([]resultColumn, error) {
+	args := make([]any, placeholders(sql))
+	sql = "SELECT * FROM (" + strings.TrimRight(strings.TrimSpace(sql), ";") + ") qdb_prepared WHERE 1 = 0"
+	rows, err := db.Session(&gorm.Session{NewDB: true}).Raw(sql, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]resultColumn, len(types))
+	for i, ct := range types {
+		columns[i] = resultColumn{name: ct.Name(), dbType: ct.DatabaseTypeName(), scan: ct.ScanType()}
+	}
+	return columns, nil
+}
+
+// describeSqlserver 通过 sp_describe_first_result_set 取得结果列，不执行语句
+func describeSqlserver(db *gorm.DB, sql string) ([]resultColumn, error) {
+	// 参数 ? 依次改为 @p1、@p2...，引号内的不替换
+	var b strings.Builder
+	var params []string
+	var quote rune
+	for _, c := range strings.TrimRight(strings.TrimSpace(sql), ";") {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			params = append(params, fmt.Sprintf("@p%d nvarchar(4000)", len(params)+1))
+			b.WriteString(fmt.Sprintf("@p%d", len(params)))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	var described []struct {
+		Name           string `gorm:"column:name"`
+		SystemTypeName string `gorm:"column:system_type_name"`
+		IsHidden       bool   `gorm:"column:is_hidden"`
+	}
+	err := db.Session(&gorm.Session{NewDB: true}).
+		Raw("EXEC sp_describe_first_result_set @tsql = ?, @params = ?", b.String(), strings.Join(params, ", ")).
+		Scan(&described).Error
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]resultColumn, 0, len(described))
+	for _, d := range described {
+		if !d.IsHidden {
+			columns = append(columns, resultColumn{name: d.Name, dbType: d.SystemTypeName, scan: sqlserverScanType(d.SystemTypeName)})
+		}
+	}
+	return columns, nil
+}
+
+// sqlserverScanType 按 sqlserver 类型名返回扫描类型，如 int、nvarchar(50)，未知时返回nil
+func sqlserverScanType(typeName string) reflect.Type {
+	name := strings.ToLower(typeName)
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = name[:i]
+	}
+	switch name {
+	case "bigint", "int", "smallint", "tinyint":
+		return reflect.TypeOf(int64(0))
+	case "float", "real":
+		return reflect.TypeOf(float64(0))
+	case "bit":
+		return reflect.TypeOf(false)
+	case "date", "datetime", "datetime2", "smalldatetime", "datetimeoffset", "time":
+		return reflect.TypeOf(time.Time{})
+	case "char", "varchar", "nchar", "nvarchar", "text", "ntext", "uniqueidentifier", "xml":
+		return reflect.TypeOf("")
+	case "binary", "varbinary", "image", "timestamp", "rowversion":
+		return reflect.TypeOf([]byte(nil))
+	}
+	return nil
+}
+
+// Query 执行查询并返回列表
+//
+//	@param db 数据库连接
+//	@param args 参数
+//	@return []*T, error
+func (p *Prepared[T]) Query(db *gorm.DB, args ...any) ([]*T, error) {
+	list := make([]*T, 0)
+	err := db.Raw(p.SQL, args...).Scan(&list).Error
+	return list, err
+}
+
+// One 执行查询并返回第一条，不存在时返回 ErrNotFound
+//
+//	@param db 数据库连接
+//	@param args 参数
+//	@return *T, error
+func (p *Prepared[T]) One(db *gorm.DB, args ...any) (*T, error) {
+	model := new(T)
+	result := db.Raw(p.SQL, args...).Scan(model)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return model, nil
+}
+
+// Exec 执行非查询语句
+//
+//	@param db 数据库连接
+//	@param args 参数
+//	@return int64 影响行数, error
+func (p *Prepared[T]) Exec(db *gorm.DB, args ...any) (int64, error) {
+	result := db.Exec(p.SQL, args...)
+	return result.RowsAffected, result.Error
+}
+
+// placeholders 统计字符串常量以外的 ? 数量
+func placeholders(sql string) int {
+	count := 0
+	var quote rune
+	for _, c := range sql {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			count++
+		}
+	}
+	return count
+}
+
+// compatibleKind 判断列的扫描类型能否写入字段，驱动未给出类型时视为兼容
+//
+//	DECIMAL、NUMERIC 列驱动多以字节或字符串扫描，可写入浮点和字符串字段
+func compatibleKind(field *schema.Field, dbType string, scan reflect.Type) bool {
+	if scan == nil {
+		return true
+	}
+	if isDecimalType(dbType) {
+		switch field.IndirectFieldType.Kind() {
+		case reflect.Float32, reflect.Float64, reflect.String:
+			return true
+		}
+	}
+	for scan.Kind() == reflect.Ptr {
+		scan = scan.Elem()
+	}
+	if scan.Kind() == reflect.Interface {
+		return true
+	}
+	target := field.FieldType
+	for target.Kind() == reflect.Ptr {
+		target = target.Elem()
+	}
+	from, to := kindClass(scan), kindClass(target)
+	switch to {
+	case "number":
+		return from == "number" || from == "bool" || from == ""
+	case "bool":
+		return from == "number" || from == "bool" || from == ""
+	case "time":
+		// sqlite以文本保存时间
+		return from == "time" || from == "string" || from == ""
+	}
+	return true
+}
+
+// isDecimalType 是否为定点数列，如 DECIMAL(10,2)、NUMERIC、MONEY
+func isDecimalType(dbType string) bool {
+	dbType = strings.ToUpper(dbType)
+	for _, prefix := range []string{"DECIMAL", "NUMERIC", "NEWDECIMAL", "MONEY", "SMALLMONEY"} {
+		if strings.HasPrefix(dbType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// kindClass 类型分类：number、bool、string、time、bytes，其他返回空
+func kindClass(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "time"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+	case reflect.Struct:
+		// sql.NullInt64 等按其值字段分类
+		if t.NumField() > 0 {
+			return kindClass(t.Field(0).Type)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestDB 创建测试用的sqlite数据库，测试结束后关闭
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	SetConfigSource(LiteralSource(map[string]any{
+		testSection(t): map[string]any{"Connect": "sqlite|" + filepath.Join(t.TempDir(), "test.db") + "&WAL"},
+	}))
+	return reopenTestDB(t)
+}
+
+// reopenTestDB 再次打开 newTestDB 创建的数据库，模拟其他进程的连接
+func reopenTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := NewDb(testSection(t), "")
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// testSection 测试使用的配置节点名称
+func testSection(t *testing.T) string {
+	return strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+}
@@ -0,0 +1,173 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// QueryOpt 查询选项，用于 GetOne、GetMany、Count、DeleteWhere
+type QueryOpt func(db *gorm.DB) *gorm.DB
+
+// Where 查询条件，多个条件之间为and关系
+//
+//	@param query 条件，如 id = ? 或 id IN (?) 等
+//	@param args 条件参数
+//	@return QueryOpt
+func Where(query any, args ...any) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(query, args...)
+	}
+}
+
+// Order 排序，指定后不再使用默认排序
+//
+//	@param order 排序，如 id asc, time desc
+//	@return QueryOpt
+func Order(order any) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Order(order)
+	}
+}
+
+// Limit 最大数量
+//
+//	@param limit 数量
+//	@return QueryOpt
+func Limit(limit int) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Limit(limit)
+	}
+}
+
+// Offset 跳过数量
+//
+//	@param offset 数量
+//	@return QueryOpt
+func Offset(offset int) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset(offset)
+	}
+}
+
+// Select 查询的列
+//
+//	@param columns 列名
+//	@return QueryOpt
+func Select(columns ...string) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select(columns)
+	}
+}
+
+// Preload 预加载关联
+//
+//	@param query 关联名称
+//	@param args 关联条件
+//	@return QueryOpt
+func Preload(query string, args ...any) QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Preload(query, args...)
+	}
+}
+
+// Lock 加行锁（FOR UPDATE），需在事务中使用
+//
+//	@return QueryOpt
+func Lock() QueryOpt {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+	}
+}
+
+// SkipLocked 加行锁并跳过已被其他事务锁定的行，需在事务中使用
+//
+//	@return QueryOpt
+func SkipLocked() QueryOpt {
+	return skipLocked
+}
+
+// skipLocked 按数据库类型生成跳过锁定行的行锁
+func skipLocked(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "sqlserver" {
+		return db.Clauses(tableHint{"UPDLOCK", "READPAST", "ROWLOCK"})
+	}
+	return db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked})
+}
+
+// applyOpts 依次应用查询选项
+func applyOpts(db *gorm.DB, opts []QueryOpt) *gorm.DB {
+	for _, opt := range opts {
+		db = opt(db)
+	}
+	return db
+}
+
+// GetOne 按查询选项获取一条记录，未查询到时返回nil
+//
+//	@param opts 查询选项，如 qdb.Where("code = ?", code), qdb.Order("id desc")
+//	@return *T, error
+func (dao *Dao[T]) GetOne(opts ...QueryOpt) (*T, error) {
+	var model *T
+	err := dao.exec("GetOne", OpRead, func(op *Operation) error {
+		m := new(T)
+		result := applyOpts(dao.query(op.DB), opts).Limit(1).Find(m)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		model = m
+		return nil
+	})
+	return model, err
+}
+
+// GetMany 按查询选项查询一组列表，未指定排序时使用默认排序
+//
+//	@param opts 查询选项，如 qdb.Where("status = ?", 1), qdb.Order("id desc"), qdb.Limit(10)
+//	@return []*T, error
+func (dao *Dao[T]) GetMany(opts ...QueryOpt) ([]*T, error) {
+	list := make([]*T, 0)
+	err := dao.exec("GetMany", OpRead, func(op *Operation) error {
+		db := applyOpts(dao.partitionRange(dao.query(op.DB), true), opts)
+		if _, ok := db.Statement.Clauses["ORDER BY"]; !ok && dao.opts.defaultOrder != "" {
+			db = db.Order(dao.opts.defaultOrder)
+		}
+		result := db.Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
+
+// Count 按查询选项获取记录数
+//
+//	@param opts 查询选项，如 qdb.Where("status = ?", 1)
+//	@return int64, error
+func (dao *Dao[T]) Count(opts ...QueryOpt) (int64, error) {
+	var count int64
+	err := dao.exec("Count", OpRead, func(op *Operation) error {
+		return applyOpts(dao.query(op.DB).Model(new(T)), opts).Count(&count).Error
+	})
+	return count, err
+}
+
+// DeleteWhere 按查询选项删除数据，没有条件时须使用 AllowFullTableDelete 选项
+//
+//	@param opts 查询选项，如 qdb.Where("status = ?", 0)
+//	@return int64 删除数量, error
+func (dao *Dao[T]) DeleteWhere(opts ...QueryOpt) (int64, error) {
+	var stat resultStat
+	err := dao.track(&stat).exec("DeleteWhere", OpDelete, func(op *Operation) error {
+		db := applyOpts(op.DB, opts)
+		if _, ok := db.Statement.Clauses["WHERE"]; !ok {
+			if !dao.opts.allowDelete {
+				return ErrFullTableDelete
+			}
+			db = db.Session(&gorm.Session{AllowGlobalUpdate: true})
+		}
+		result := rowPolicy[T](db).Delete(new(T))
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return stat.RowsAffected, err
+}
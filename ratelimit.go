@@ -0,0 +1,110 @@
+package qdb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitOptions 限流选项
+type RateLimitOptions struct {
+	Rate    float64       // 每秒允许的操作数，小于等于0不限流
+	Burst   int           // 突发上限，为0使用 Rate 向上取整
+	MaxWait time.Duration // 超出时最长等待时长，为0直接返回 ErrRateLimited
+	Reads   bool          // 是否同时限制查询，默认仅限制写入
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var (
+	throttled     = map[string]int64{}
+	throttledLock sync.Mutex
+)
+
+// RateLimit 限流中间件，按表分别计算，可全局注册或注册到单个Dao
+//
+//	@param opts 限流选项
+//	@return Middleware
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Rate <= 0 {
+		return func(next Handler) Handler {
+			return next
+		}
+	}
+	burst := float64(opts.Burst)
+	if burst <= 0 {
+		burst = opts.Rate
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	buckets := map[string]*tokenBucket{}
+	var lock sync.Mutex
+
+	// reserve 取得令牌，返回需要等待的时长
+	reserve := func(table string) time.Duration {
+		lock.Lock()
+		defer lock.Unlock()
+		t := time.Now()
+		b, ok := buckets[table]
+		if !ok {
+			b = &tokenBucket{tokens: burst, last: t}
+			buckets[table] = b
+		}
+		b.tokens += t.Sub(b.last).Seconds() * opts.Rate
+		if b.tokens > burst {
+			b.tokens = burst
+		}
+		b.last = t
+		wait := time.Duration(0)
+		if b.tokens < 1 {
+			wait = time.Duration((1 - b.tokens) / opts.Rate * float64(time.Second))
+			if wait > opts.MaxWait {
+				return wait
+			}
+		}
+		b.tokens--
+		return wait
+	}
+
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			if !opts.Reads && op.Kind == OpRead {
+				return next(op)
+			}
+			wait := reserve(op.Table)
+			if wait == 0 {
+				return next(op)
+			}
+			throttledLock.Lock()
+			throttled[op.Table]++
+			throttledLock.Unlock()
+			if wait > opts.MaxWait {
+				return fmt.Errorf("%w: %s on %s", ErrRateLimited, op.Name, op.Table)
+			}
+			select {
+			case <-op.Context().Done():
+				return op.Context().Err()
+			case <-time.After(wait):
+			}
+			return next(op)
+		}
+	}
+}
+
+// RateLimitStats 返回各表被限流（等待或拒绝）的次数
+//
+//	@return map[string]int64
+func RateLimitStats() map[string]int64 {
+	throttledLock.Lock()
+	defer throttledLock.Unlock()
+	stats := make(map[string]int64, len(throttled))
+	for k, v := range throttled {
+		stats[k] = v
+	}
+	return stats
+}
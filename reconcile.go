@@ -0,0 +1,155 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"sort"
+)
+
+// ReconcileOptions 对账选项
+type ReconcileOptions struct {
+	Query       string // 可选条件，如 LastTime > ?
+	Args        []any  // 条件参数
+	UseChecksum bool   // 按行哈希比较，默认按 Id + LastTime 比较
+	Repair      bool   // 是否修复目标，为false时仅生成报告
+	DeleteExtra bool   // 修复时是否删除目标中多余的行
+	BatchSize   int    // 修复时每批读取的行数，为0使用500
+}
+
+// ReconcileReport 对账报告
+type ReconcileReport struct {
+	Missing  []uint64 // 目标中缺少的行
+	Extra    []uint64 // 目标中多余的行
+	Stale    []uint64 // 目标中内容不一致的行
+	Upserted int64    // 修复时写入的行数
+	Deleted  int64    // 修复时删除的行数
+}
+
+// Reconcile 比较两个连接中同一模型的数据，找出目标中缺少、多余和不一致的行，可选修复目标
+//
+//	@param src 源
+//	@param dst 目标
+//	@param opts 对账选项
+//	@return *ReconcileReport, error
+func Reconcile[T any](src, dst *Dao[T], opts ReconcileOptions) (*ReconcileReport, error) {
+	var query []any
+	if opts.Query != "" {
+		query = append([]any{opts.Query}, opts.Args...)
+	}
+
+	var diff *ChecksumDiff
+	var err error
+	if opts.UseChecksum {
+		diff, err = DiffTables(src, dst, query...)
+	} else {
+		diff, err = diffLastTime(src, dst, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := &ReconcileReport{Missing: diff.Missing, Extra: diff.Extra, Stale: diff.Changed}
+	if !opts.Repair {
+		return report, nil
+	}
+
+	batch := opts.BatchSize
+	if batch <= 0 {
+		batch = 500
+	}
+	ids := append(append([]uint64{}, diff.Missing...), diff.Changed...)
+	err = dst.exec("ReconcileRepair", OpCreate|OpUpdate|OpDelete, func(op *Operation) error {
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			for i := 0; i < len(ids); i += batch {
+				end := i + batch
+				if end > len(ids) {
+					end = len(ids)
+				}
+				var list []*T
+				if err := src.query(src.db).Where("id IN ?", ids[i:end]).Find(&list).Error; err != nil {
+					return err
+				}
+				// 按目标的行过滤策略写入，策略外的同主键行不会被覆盖
+				for _, model := range list {
+					result := dst.save(tx, model)
+					if result.Error != nil {
+						return result.Error
+					}
+					report.Upserted++
+				}
+			}
+			if opts.DeleteExtra && len(diff.Extra) > 0 {
+				result := rowPolicy[T](tx).Where("id IN ?", diff.Extra).Delete(new(T))
+				if result.Error != nil {
+					return result.Error
+				}
+				report.Deleted = result.RowsAffected
+			}
+			op.RowsAffected = report.Upserted + report.Deleted
+			return nil
+		}, 1)
+	})
+	return report, err
+}
+
+// diffLastTime 按 Id + LastTime 比较两个连接中的数据
+func diffLastTime[T any](src, dst *Dao[T], query []any) (*ChecksumDiff, error) {
+	a, err := idTimes(src, query)
+	if err != nil {
+		return nil, err
+	}
+	b, err := idTimes(dst, query)
+	if err != nil {
+		return nil, err
+	}
+	diff := &ChecksumDiff{}
+	for id, t := range a {
+		if d, ok := b[id]; !ok {
+			diff.Missing = append(diff.Missing, id)
+		} else if d != t {
+			diff.Changed = append(diff.Changed, id)
+		}
+	}
+	for id := range b {
+		if _, ok := a[id]; !ok {
+			diff.Extra = append(diff.Extra, id)
+		}
+	}
+	for _, ids := range [][]uint64{diff.Missing, diff.Extra, diff.Changed} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return diff, nil
+}
+
+// idTimes 读取唯一号及最后操作时间
+func idTimes[T any](dao *Dao[T], query []any) (map[uint64]uint64, error) {
+	values := map[uint64]uint64{}
+	err := dao.exec("Reconcile", OpRead, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		pk, lt := stmt.Schema.PrioritizedPrimaryField, stmt.Schema.LookUpField("LastTime")
+		if pk == nil || lt == nil {
+			return fmt.Errorf("%s has no primary key or LastTime", stmt.Schema.Name)
+		}
+		db := dao.query(op.DB).Model(new(T)).Select([]string{pk.DBName, lt.DBName})
+		if len(query) > 0 {
+			db = db.Where(query[0], query[1:]...)
+		}
+		rows, err := db.Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, t uint64
+			if err = rows.Scan(&id, &t); err != nil {
+				return err
+			}
+			values[id] = t
+		}
+		op.RowsAffected = int64(len(values))
+		return rows.Err()
+	})
+	return values, err
+}
@@ -0,0 +1,120 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ReportLibrary 报表语句模板库
+//
+//	模板文件名为 名称.sql，数据库专用版本为 名称.数据库类型.sql，如 daily.sql、daily.mysql.sql；
+//	模板使用 text/template 语法组织语句结构，值须使用 @参数名 绑定，不要直接输出到语句中，如
+//
+//	SELECT Region, SUM(Amount) AS Total FROM Sale WHERE Day >= @Start
+//	{{if .Region}} AND Region = @Region {{end}}
+//	GROUP BY Region
+type ReportLibrary struct {
+	templates map[string]map[string]*template.Template // 名称 -> 数据库类型（空为通用） -> 模板
+	lock      sync.RWMutex
+}
+
+// LoadReports 从文件系统加载目录下的全部 .sql 模板，通常为 embed.FS
+//
+//	@param fsys 文件系统
+//	@param dir 目录，如 reports
+//	@return *ReportLibrary, error
+func LoadReports(fsys fs.FS, dir string) (*ReportLibrary, error) {
+	lib := &ReportLibrary{templates: map[string]map[string]*template.Template{}}
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		name, dialect := strings.TrimSuffix(entry.Name(), ".sql"), ""
+		if i := strings.LastIndex(name, "."); i > 0 {
+			name, dialect = name[:i], name[i+1:]
+		}
+		if err = lib.Register(name, dialect, string(content)); err != nil {
+			return nil, err
+		}
+	}
+	return lib, nil
+}
+
+// Register 注册一个模板
+//
+//	@param name 名称
+//	@param dialect 数据库类型，如 mysql、postgres，为空表示通用
+//	@param text 模板内容
+//	@return error
+func (l *ReportLibrary) Register(name string, dialect string, text string) error {
+	tpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return fmt.Errorf("report %s: %v", name, err)
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.templates[name] == nil {
+		l.templates[name] = map[string]*template.Template{}
+	}
+	l.templates[name][dialect] = tpl
+	return nil
+}
+
+// SQL 生成语句，优先使用数据库专用版本
+//
+//	@param dialect 数据库类型
+//	@param name 名称
+//	@param params 参数，map或结构体
+//	@return string, error
+func (l *ReportLibrary) SQL(dialect string, name string, params any) (string, error) {
+	l.lock.RLock()
+	variants := l.templates[name]
+	tpl, ok := variants[dialect]
+	if !ok {
+		tpl, ok = variants[""]
+	}
+	l.lock.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: report %s for %s", ErrNotFound, name, dialect)
+	}
+	var builder strings.Builder
+	if err := tpl.Execute(&builder, params); err != nil {
+		return "", fmt.Errorf("report %s: %v", name, err)
+	}
+	// 以注释标记报表名称，便于在日志和执行统计中区分
+	return "/* report:" + name + " */ " + strings.TrimSpace(builder.String()), nil
+}
+
+// Report 执行报表模板并将结果映射到R
+//
+//	@param db 数据库连接
+//	@param lib 模板库
+//	@param name 名称
+//	@param params 参数，map[string]any或结构体，模板中使用 @字段名 绑定
+//	@return []R, error
+func Report[R any](db *gorm.DB, lib *ReportLibrary, name string, params any) ([]R, error) {
+	sql, err := lib.SQL(db.Dialector.Name(), name, params)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]R, 0)
+	if params == nil {
+		err = db.Raw(sql).Scan(&list).Error
+	} else {
+		err = db.Raw(sql, params).Scan(&list).Error
+	}
+	return list, err
+}
@@ -0,0 +1,189 @@
+package qdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+// resultStat 操作执行统计
+type resultStat struct {
+	Attempts     int           // 执行次数，含重试
+	Duration     time.Duration // 总耗时
+	RowsAffected int64         // 影响行数
+}
+
+// Result 写操作结果，包含执行次数、耗时和影响行数，便于上报遥测数据
+type Result[V any] struct {
+	Value V
+	resultStat
+}
+
+// track 返回记录执行统计的Dao
+func (dao *Dao[T]) track(stat *resultStat) *Dao[T] {
+	clone := *dao
+	clone.stat = stat
+	return &clone
+}
+
+// CreateResult 新建一条记录，返回执行结果
+//
+//	@param model 待新增实体
+//	@return Result[*T], error
+func (dao *Dao[T]) CreateResult(model *T) (Result[*T], error) {
+	r := Result[*T]{Value: model}
+	err := dao.track(&r.resultStat).Create(model)
+	return r, err
+}
+
+// CreateListResult 创建一组列表，返回执行结果
+//
+//	@param list 待新增列表
+//	@return Result[[]T], error
+func (dao *Dao[T]) CreateListResult(list []T) (Result[[]T], error) {
+	r := Result[[]T]{Value: list}
+	err := dao.track(&r.resultStat).CreateList(list)
+	return r, err
+}
+
+// UpdateResult 修改一条记录，返回执行结果
+//
+//	@param model 待更新实体
+//	@return Result[*T], error
+func (dao *Dao[T]) UpdateResult(model *T) (Result[*T], error) {
+	r := Result[*T]{Value: model}
+	err := dao.track(&r.resultStat).Update(model)
+	return r, err
+}
+
+// UpdateListResult 修改一组记录，返回执行结果
+//
+//	@param list 待更新列表
+//	@return Result[[]T], error
+func (dao *Dao[T]) UpdateListResult(list []T) (Result[[]T], error) {
+	r := Result[[]T]{Value: list}
+	err := dao.track(&r.resultStat).UpdateList(list)
+	return r, err
+}
+
+// SaveResult 修改一条记录（不存在则新增），返回执行结果
+//
+//	@param model 待保存实体
+//	@return Result[*T], error
+func (dao *Dao[T]) SaveResult(model *T) (Result[*T], error) {
+	r := Result[*T]{Value: model}
+	err := dao.track(&r.resultStat).Save(model)
+	return r, err
+}
+
+// SaveListResult 修改一组记录（不存在则新增），返回执行结果
+//
+//	@param list 待保存列表
+//	@return Result[[]T], error
+func (dao *Dao[T]) SaveListResult(list []T) (Result[[]T], error) {
+	r := Result[[]T]{Value: list}
+	err := dao.track(&r.resultStat).SaveList(list)
+	return r, err
+}
+
+// DeleteResult 删除一条记录，返回执行结果
+//
+//	@param id 唯一号
+//	@return Result[uint64] 值为删除的唯一号, error
+func (dao *Dao[T]) DeleteResult(id uint64) (Result[uint64], error) {
+	r := Result[uint64]{Value: id}
+	err := dao.track(&r.resultStat).Delete(id)
+	return r, err
+}
+
+// DeleteConditionResult 自定义条件删除数据，返回执行结果
+//
+//	@param condition 条件，如 id = ? 或 id IN (?) 等
+//	@param args 条件参数，如 id, ids 等
+//	@return Result[int64] 值为删除的行数, error
+func (dao *Dao[T]) DeleteConditionResult(condition string, args ...any) (Result[int64], error) {
+	r := Result[int64]{}
+	err := dao.track(&r.resultStat).DeleteCondition(condition, args...)
+	r.Value = r.RowsAffected
+	return r, err
+}
+
+// Retry 重试中间件，遇到可重试错误时按间隔重试，仅重试查询和删除
+//
+//	新增、修改、保存遇到网络错误时无法确认是否已执行，重试可能产生重复记录，不重试；
+//	确认修改可安全重复执行时使用 RetryOps
+//
+//	@param times 最大执行次数，含首次
+//	@param backoff 首次重试间隔，之后每次翻倍
+//	@param retryable 判断错误是否可重试，为空使用 IsRetryable
+//	@return Middleware
+func Retry(times int, backoff time.Duration, retryable func(err error) bool) Middleware {
+	return RetryOps(OpRead|OpDelete, times, backoff, retryable)
+}
+
+// RetryOps 重试指定类型操作的中间件，其他操作只执行一次
+//
+//	新增（含 Save、SaveList）始终不重试，主键已被首次执行回填，且无法确认是否已写入
+//
+//	@param kinds 重试的操作类型，如 OpRead | OpUpdate，OpUpdate 仅在修改可重复执行时使用（不含 gorm.Expr 自增等）
+//	@param times 最大执行次数，含首次
+//	@param backoff 首次重试间隔，之后每次翻倍
+//	@param retryable 判断错误是否可重试，为空使用 IsRetryable
+//	@return Middleware
+func RetryOps(kinds OpKind, times int, backoff time.Duration, retryable func(err error) bool) Middleware {
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	return func(next Handler) Handler {
+		return func(op *Operation) error {
+			kind := op.Kind
+			if kind&OpCreate != 0 || kind&kinds != kind {
+				op.Attempts++
+				return next(op)
+			}
+			wait := backoff
+			for {
+				op.Attempts++
+				op.RowsAffected = 0
+				err := next(op)
+				if err == nil || op.Attempts >= times || !retryable(err) {
+					return err
+				}
+				// 等待后重试，上下文结束则返回
+				select {
+				case <-op.Context().Done():
+					return err
+				case <-time.After(wait):
+				}
+				wait *= 2
+			}
+		}
+	}
+}
+
+// IsRetryable 判断是否为连接中断、死锁、锁等待等可重试的临时错误
+//
+//	@param err 错误
+//	@return bool
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, key := range []string{"deadlock", "database is locked", "lock wait timeout", "connection reset", "broken pipe", "40001"} {
+		if strings.Contains(msg, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,247 @@
+package qdb
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy 数据保留策略，超过保留时长的行按批删除，可先移入归档表
+type RetentionPolicy struct {
+	Name      string        // 名称，唯一，为空使用模型类型名
+	Model     any           // 模型，如 &Telemetry{}
+	Column    string        // 时间字段，qtime.DateTime 或 time.Time 类型，为空使用 LastTime
+	MaxAge    time.Duration // 保留时长
+	Archive   bool          // 删除前移入归档表（表名加 _archive 后缀）
+	BatchSize int           // 每批删除的行数，为0使用1000
+}
+
+// RetentionResult 一次执行中单个策略的结果
+type RetentionResult struct {
+	Name     string        // 名称
+	Table    string        // 表名
+	Cutoff   time.Time     // 早于该时间的行被清理
+	Rows     int64         // 删除的行数，试运行时为将删除的行数
+	Archived int64         // 归档的行数
+	Duration time.Duration // 耗时
+	Err      error         // 错误
+}
+
+// RetentionStats 单个策略的累计统计
+type RetentionStats struct {
+	Runs      int64     // 执行次数
+	Rows      int64     // 累计删除的行数
+	Archived  int64     // 累计归档的行数
+	LastRun   time.Time // 最后执行时间
+	LastError string    // 最后的错误
+}
+
+var (
+	retentionPolicies []RetentionPolicy
+	retentionStats    = map[string]*RetentionStats{}
+	retentionLock     sync.Mutex
+)
+
+// RegisterRetention 注册数据保留策略，通过 RunRetention 或 RetentionJob 统一执行，名称重复时panic
+//
+//	过期记录被物理删除，包含已软删除的记录
+//
+//	@param policies 保留策略
+func RegisterRetention(policies ...RetentionPolicy) {
+	retentionLock.Lock()
+	defer retentionLock.Unlock()
+	for _, p := range policies {
+		if p.Model == nil || p.MaxAge <= 0 {
+			panic("qdb: retention policy requires Model and MaxAge")
+		}
+		if p.Column == "" {
+			p.Column = "LastTime"
+		}
+		if p.BatchSize <= 0 {
+			p.BatchSize = 1000
+		}
+		if p.Name == "" {
+			p.Name = modelName(p.Model)
+		}
+		if _, ok := retentionStats[p.Name]; ok {
+			panic(fmt.Sprintf("qdb: retention policy %s already registered", p.Name))
+		}
+		retentionPolicies = append(retentionPolicies, p)
+		retentionStats[p.Name] = &RetentionStats{}
+	}
+}
+
+// RetentionStatsOf 返回各策略的累计统计
+//
+//	@return map[string]RetentionStats
+func RetentionStatsOf() map[string]RetentionStats {
+	retentionLock.Lock()
+	defer retentionLock.Unlock()
+	stats := make(map[string]RetentionStats, len(retentionStats))
+	for name, st := range retentionStats {
+		stats[name] = *st
+	}
+	return stats
+}
+
+// RetentionJob 返回执行全部保留策略的单例任务，可加入 Scheduler
+//
+//	@param db 数据库连接
+//	@param interval 执行间隔，如 time.Hour
+//	@return Job
+func RetentionJob(db *gorm.DB, interval time.Duration) Job {
+	return Job{Name: "retention", Interval: interval, Singleton: true, Run: func(ctx context.Context) error {
+		_, err := RunRetention(ctx, db, false)
+		return err
+	}}
+}
+
+// RunRetention 按注册顺序执行全部保留策略，单个策略失败不影响其他策略
+//
+//	@param ctx 上下文
+//	@param db 数据库连接
+//	@param dryRun 是否试运行，只统计将删除的行数
+//	@return []RetentionResult 各策略的结果, error 第一个失败策略的错误
+func RunRetention(ctx context.Context, db *gorm.DB, dryRun bool) ([]RetentionResult, error) {
+	retentionLock.Lock()
+	policies := append([]RetentionPolicy(nil), retentionPolicies...)
+	retentionLock.Unlock()
+
+	db = db.WithContext(ctx)
+	results := make([]RetentionResult, 0, len(policies))
+	var first error
+	for _, p := range policies {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		start := time.Now()
+		r := runRetention(db, p, dryRun)
+		r.Duration = time.Since(start)
+		results = append(results, r)
+		if r.Err != nil && first == nil {
+			first = fmt.Errorf("qdb: retention %s: %w", p.Name, r.Err)
+		}
+		if dryRun {
+			continue
+		}
+		retentionLock.Lock()
+		st := retentionStats[p.Name]
+		st.Runs++
+		st.Rows += r.Rows
+		st.Archived += r.Archived
+		st.LastRun = start
+		st.LastError = ""
+		if r.Err != nil {
+			st.LastError = r.Err.Error()
+		}
+		retentionLock.Unlock()
+	}
+	return results, first
+}
+
+// runRetention 执行单个策略
+func runRetention(db *gorm.DB, p RetentionPolicy, dryRun bool) RetentionResult {
+	r := RetentionResult{Name: p.Name, Cutoff: now().Add(-p.MaxAge).Local()}
+	stmt := &gorm.Statement{DB: db}
+	if r.Err = stmt.Parse(p.Model); r.Err != nil {
+		return r
+	}
+	r.Table = stmt.Schema.Table
+	field := stmt.Schema.LookUpField(p.Column)
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if field == nil || pk == nil {
+		r.Err = fmt.Errorf("%s requires a primary key and field %s", stmt.Schema.Name, p.Column)
+		return r
+	}
+	var cutoff any = r.Cutoff
+	if field.FieldType == dateTimeType {
+		dt := dateTimeOf(r.Cutoff)
+		if _, ok := db.Config.Plugins[utcPlugin{}.Name()]; ok {
+			dt = UTCDateTime(dt)
+		}
+		cutoff = dt
+	}
+	where := clause.Lt{Column: clause.Column{Name: field.DBName}, Value: cutoff}
+	if dryRun {
+		r.Err = db.Unscoped().Model(p.Model).Where(where).Count(&r.Rows).Error
+		return r
+	}
+
+	archive := r.Table + "_archive"
+	if p.Archive {
+		if r.Err = ensureArchive(db, p.Model, r.Table, archive); r.Err != nil {
+			return r
+		}
+	}
+	pkCol := clause.Column{Name: pk.DBName}
+	quoted := make([]string, 0, len(stmt.Schema.DBNames))
+	for _, name := range stmt.Schema.DBNames {
+		quoted = append(quoted, db.Statement.Quote(name))
+	}
+	columns := strings.Join(quoted, ", ")
+	for {
+		var ids []any
+		r.Err = db.Unscoped().Model(p.Model).Where(where).Order(clause.OrderByColumn{Column: pkCol}).Limit(p.BatchSize).
+			Pluck(pk.DBName, &ids).Error
+		if r.Err != nil || len(ids) == 0 {
+			return r
+		}
+		r.Err = trackedTx(db, func(tx *gorm.DB) error {
+			if p.Archive {
+				result := tx.Exec(fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s IN ?", db.Statement.Quote(archive),
+					columns, columns, db.Statement.Quote(r.Table), db.Statement.Quote(pk.DBName)), ids)
+				if result.Error != nil {
+					return result.Error
+				}
+				r.Archived += result.RowsAffected
+			}
+			result := tx.Unscoped().Where(clause.IN{Column: pkCol, Values: ids}).Delete(p.Model)
+			r.Rows += result.RowsAffected
+			return result.Error
+		}, 1)
+		if r.Err != nil || len(ids) < p.BatchSize {
+			return r
+		}
+		time.Sleep(batchPause)
+	}
+}
+
+// ensureArchive 创建结构与原表相同的归档表，不复制索引和自增属性，原表新增的列同步添加
+func ensureArchive(db *gorm.DB, model any, table string, archive string) error {
+	m := db.Migrator()
+	if !m.HasTable(archive) {
+		src, dst := db.Statement.Quote(table), db.Statement.Quote(archive)
+		var sql string
+		switch db.Dialector.Name() {
+		case "mysql":
+			sql = fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 1 = 0", dst, src)
+		case "postgres":
+			sql = fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS)", dst, src)
+		case "sqlserver":
+			// UNION ALL 使新表不继承 IDENTITY，可写入原唯一号
+			sql = fmt.Sprintf("SELECT * INTO %s FROM %s WHERE 1 = 0 UNION ALL SELECT * FROM %s WHERE 1 = 0", dst, src, src)
+		default:
+			sql = fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s WHERE 0", dst, src)
+		}
+		if err := db.Exec(sql).Error; err != nil {
+			return err
+		}
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	am := db.Table(archive).Migrator()
+	for _, name := range stmt.Schema.DBNames {
+		if !am.HasColumn(model, name) {
+			if err := am.AddColumn(model, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
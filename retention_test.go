@@ -0,0 +1,61 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+type retentionEvent struct {
+	DbSimple
+	Name      string
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func init() {
+	RegisterRetention(RetentionPolicy{Model: &retentionEvent{}, MaxAge: 24 * time.Hour})
+}
+
+func TestRetentionSoftDeleted(t *testing.T) {
+	db := newTestDB(t)
+	dao, err := TryNewDao[retentionEvent](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := qtime.NewDateTime(time.Now().Add(-48 * time.Hour))
+	list := []*retentionEvent{
+		{DbSimple: DbSimple{LastTime: old}, Name: "old"},
+		{DbSimple: DbSimple{LastTime: old}, Name: "old-deleted"},
+		{DbSimple: DbSimple{LastTime: qtime.NewDateTime(time.Now())}, Name: "new"},
+	}
+	// 直接写入，保留指定的 LastTime
+	if err = db.Create(list).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Delete(list[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := RunRetention(context.Background(), db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Rows != 2 {
+		t.Fatalf("dry run: got %+v, want 2 rows", results)
+	}
+	if _, err = RunRetention(context.Background(), db, false); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err = db.Unscoped().Model(&retentionEvent{}).Pluck("name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "new" {
+		t.Fatalf("rows left after retention: %v", names)
+	}
+	if all, _ := dao.GetAll(); len(all) != 1 {
+		t.Fatalf("GetAll after retention: %d rows", len(all))
+	}
+}
@@ -0,0 +1,266 @@
+package qdb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// RollupColumn 汇总列
+type RollupColumn struct {
+	Name  string // 汇总表列名，如 AvgTemp
+	Expr  string // 对原始行的聚合表达式，如 AVG(Temp)
+	Merge string // 对上一级汇总行的聚合表达式，为空时按 Expr 推导：SUM、COUNT 为 SUM(Name)，MIN、MAX 不变，AVG 等需显式指定
+}
+
+// RollupLevel 汇总级别
+type RollupLevel struct {
+	Model     any           // 汇总表模型，如 &TelemetryHour{}，需包含 qtime.DateTime 类型的 Bucket 字段、分组列和汇总列
+	Interval  time.Duration // 汇总间隔，支持的取值同 AggregateByInterval
+	Retention time.Duration // 汇总行保留时长，为0不清理
+}
+
+// RollupOptions 汇总选项
+type RollupOptions struct {
+	Name         string         // 名称，唯一，作为进度记录的键
+	Source       any            // 原始数据模型，如 &Telemetry{}
+	TimeColumn   string         // 原始数据时间列，需为 qtime.DateTime 类型，为空使用 LastTime
+	GroupBy      []string       // 分组列，汇总表中同名，如 DeviceId
+	Columns      []RollupColumn // 汇总列
+	Levels       []RollupLevel  // 汇总级别，由细到粗，如1分钟、1小时、1天，第一级汇总原始数据，之后每级汇总上一级
+	Delay        time.Duration  // 等待迟到数据的时长，分组结束超过该时长后才汇总，为0使用1分钟
+	RawRetention time.Duration  // 原始行汇总后保留的时长，为0不删除
+}
+
+// Rollup 将原始数据按时间间隔逐级汇总到汇总表，每个分组只汇总一次，进度记录在 qdb_rollup 表
+type Rollup struct {
+	db   *gorm.DB
+	opts RollupOptions
+}
+
+// rollupState 汇总进度记录
+type rollupState struct {
+	Name        string         `gorm:"primaryKey;size:128"` // 名称:级别
+	Watermark   qtime.DateTime // 已汇总到的时间（不包含）
+	UpdatedTime qtime.DateTime // 最后更新时间
+}
+
+// TableName 表名
+func (rollupState) TableName() string {
+	return "qdb_rollup"
+}
+
+// 单次执行每级最多汇总的分组数，积压时分多次追上
+const rollupMaxBuckets = 1000
+
+// 聚合函数名
+var aggFuncRegex = regexp.MustCompile(`(?i)^\s*(SUM|COUNT|MIN|MAX)\s*\(`)
+
+// NewRollup 创建汇总任务，汇总表不存在时自动创建
+//
+//	@param db 数据库连接
+//	@param opts 汇总选项
+//	@return *Rollup, error
+func NewRollup(db *gorm.DB, opts RollupOptions) (*Rollup, error) {
+	if opts.Name == "" || opts.Source == nil || len(opts.Columns) == 0 || len(opts.Levels) == 0 {
+		return nil, fmt.Errorf("qdb: rollup requires Name, Source, Columns and Levels")
+	}
+	if opts.TimeColumn == "" {
+		opts.TimeColumn = "LastTime"
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = time.Minute
+	}
+	for i, c := range opts.Columns {
+		if c.Merge != "" {
+			continue
+		}
+		m := aggFuncRegex.FindStringSubmatch(c.Expr)
+		if m == nil {
+			return nil, fmt.Errorf("qdb: rollup column %s requires Merge", c.Name)
+		}
+		fn := strings.ToUpper(m[1])
+		if fn == "COUNT" {
+			fn = "SUM"
+		}
+		opts.Columns[i].Merge = fmt.Sprintf("%s(%s)", fn, db.Statement.Quote(c.Name))
+	}
+	for i, level := range opts.Levels {
+		if _, err := dateTimeBucket(db.Dialector.Name(), "", level.Interval); err != nil {
+			return nil, err
+		}
+		if i > 0 && level.Interval%opts.Levels[i-1].Interval != 0 {
+			return nil, fmt.Errorf("qdb: rollup interval %s is not a multiple of %s", level.Interval, opts.Levels[i-1].Interval)
+		}
+		if err := ensureTable(db, level.Model); err != nil {
+			return nil, err
+		}
+	}
+	if err := ensureTable(db, &rollupState{}); err != nil {
+		return nil, err
+	}
+	return &Rollup{db: db, opts: opts}, nil
+}
+
+// Job 返回可加入 Scheduler 的单例任务
+//
+//	@param interval 执行间隔，如 time.Minute
+//	@return Job
+func (r *Rollup) Job(interval time.Duration) Job {
+	return Job{Name: "rollup:" + r.opts.Name, Interval: interval, Singleton: true, Run: r.Run}
+}
+
+// Run 执行一次汇总，依次处理各级别并清理过期数据
+//
+//	@param ctx 上下文
+//	@return error
+func (r *Rollup) Run(ctx context.Context) error {
+	db := r.db.WithContext(ctx)
+	ready := bucketStart(now().Add(-r.opts.Delay).Local(), r.opts.Levels[0].Interval)
+	for i, level := range r.opts.Levels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		watermark, err := r.rollupLevel(db, i, ready)
+		if err != nil {
+			return fmt.Errorf("qdb: rollup %s level %s: %w", r.opts.Name, level.Interval, err)
+		}
+		// 下一级只汇总本级已完成的部分
+		ready = watermark
+		if i == 0 && r.opts.RawRetention > 0 && !watermark.IsZero() {
+			if err = r.purge(db, r.opts.Source, r.opts.TimeColumn, r.opts.RawRetention, watermark); err != nil {
+				return err
+			}
+		}
+		if level.Retention > 0 {
+			if err = r.purge(db, level.Model, "Bucket", level.Retention, time.Time{}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rollupLevel 汇总一个级别到 ready 之前已结束的分组，返回新的进度
+func (r *Rollup) rollupLevel(db *gorm.DB, index int, ready time.Time) (time.Time, error) {
+	level := r.opts.Levels[index]
+	source, timeColumn := r.opts.Source, r.opts.TimeColumn
+	if index > 0 {
+		source, timeColumn = r.opts.Levels[index-1].Model, "Bucket"
+	}
+	name := fmt.Sprintf("%s:%d", r.opts.Name, index)
+	state := &rollupState{}
+	result := db.Where(clause.Eq{Column: fieldColumn(db, state, "Name"), Value: name}).Limit(1).Find(state)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	var from time.Time
+	if state.Watermark > 0 {
+		from = state.Watermark.ToTime()
+	} else {
+		// 首次执行从最早的数据开始
+		var first sql.NullInt64
+		err := db.Model(source).Select("MIN(?)", fieldColumn(db, source, timeColumn)).Row().Scan(&first)
+		if err != nil || !first.Valid {
+			return time.Time{}, err
+		}
+		from = bucketStart(qtime.DateTime(first.Int64).ToTime(), level.Interval)
+	}
+	to := bucketStart(ready, level.Interval)
+	if limit := from.Add(level.Interval * rollupMaxBuckets); to.After(limit) {
+		to = limit
+	}
+	if !to.After(from) {
+		return from, nil
+	}
+
+	query, err := r.insertSQL(db, source, timeColumn, level)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// 汇总结果和进度在同一事务中提交，分组不会重复汇总
+	err = trackedTx(db, func(tx *gorm.DB) error {
+		if err := tx.Exec(query, dateTimeOf(from), dateTimeOf(to)).Error; err != nil {
+			return err
+		}
+		return tx.Save(&rollupState{Name: name, Watermark: dateTimeOf(to), UpdatedTime: qtime.NewDateTime(now())}).Error
+	}, 1)
+	return to, err
+}
+
+// insertSQL 生成 INSERT ... SELECT 汇总语句，参数为时间范围 [from, to)
+func (r *Rollup) insertSQL(db *gorm.DB, source any, timeColumn string, level RollupLevel) (string, error) {
+	src := &gorm.Statement{DB: db}
+	if err := src.Parse(source); err != nil {
+		return "", err
+	}
+	dst := &gorm.Statement{DB: db}
+	if err := dst.Parse(level.Model); err != nil {
+		return "", err
+	}
+	bucketField := dst.Schema.LookUpField("Bucket")
+	timeField := src.Schema.LookUpField(timeColumn)
+	if bucketField == nil || timeField == nil {
+		return "", fmt.Errorf("qdb: rollup requires %s.Bucket and %s.%s", dst.Schema.Name, src.Schema.Name, timeColumn)
+	}
+	timeCol := db.Statement.Quote(timeField.DBName)
+	bucket, err := dateTimeBucket(db.Dialector.Name(), timeCol, level.Interval)
+	if err != nil {
+		return "", err
+	}
+
+	columns := []string{db.Statement.Quote(bucketField.DBName)}
+	selects := []string{bucket}
+	groups := []string{bucket}
+	for _, g := range r.opts.GroupBy {
+		col := db.Statement.Quote(g)
+		columns = append(columns, col)
+		selects = append(selects, col)
+		groups = append(groups, col)
+	}
+	for _, c := range r.opts.Columns {
+		columns = append(columns, db.Statement.Quote(c.Name))
+		if source == r.opts.Source {
+			selects = append(selects, c.Expr)
+		} else {
+			selects = append(selects, c.Merge)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s >= ? AND %s < ? GROUP BY %s",
+		db.Statement.Quote(dst.Schema.Table), strings.Join(columns, ", "), strings.Join(selects, ", "),
+		db.Statement.Quote(src.Schema.Table), timeCol, timeCol, strings.Join(groups, ", ")), nil
+}
+
+// purge 删除超过保留时长的行，limit 不为零时只删除该时间之前的行
+func (r *Rollup) purge(db *gorm.DB, model any, timeColumn string, retention time.Duration, limit time.Time) error {
+	cutoff := now().Add(-retention).Local()
+	if !limit.IsZero() && limit.Before(cutoff) {
+		cutoff = limit
+	}
+	return db.Session(&gorm.Session{NewDB: true}).
+		Where(clause.Lt{Column: fieldColumn(db, model, timeColumn), Value: dateTimeOf(cutoff)}).
+		Delete(model).Error
+}
+
+// bucketStart 返回时间所在分组的开始时间，与 dateTimeBucket 的截断规则一致
+func bucketStart(t time.Time, interval time.Duration) time.Time {
+	year, month, day := t.Date()
+	hour, minute := t.Hour(), t.Minute()
+	switch {
+	case interval >= 24*time.Hour:
+		hour, minute = 0, 0
+	case interval >= time.Hour:
+		n := int(interval / time.Hour)
+		hour, minute = hour/n*n, 0
+	default:
+		n := int(interval / time.Minute)
+		minute = minute / n * n
+	}
+	return time.Date(year, month, day, hour, minute, 0, 0, t.Location())
+}
@@ -0,0 +1,98 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"reflect"
+	"sync"
+)
+
+// Condition 查询条件
+type Condition struct {
+	Query any   // 条件，如 tenant = ?，为空不过滤
+	Args  []any // 条件参数
+}
+
+var (
+	rowPolicies = map[reflect.Type][]func(ctx context.Context) Condition{}
+	policyLock  sync.RWMutex
+)
+
+// RegisterRowPolicy 注册模型的行过滤策略，自动追加到该模型所有Dao的查询、修改和删除条件中，Unscoped 不会取消
+//
+//	作用于通过Dao执行的查询、Update、UpdateAll、UpdateStrict、UpdateLoose、UpdateList、Save、SaveList、
+//	StateField.Transition、Tree 的新增、移动和删除、Reconcile 的修复、WriteBlob、Delete、DeleteCondition、DeleteConditionBatched、DeleteWhere；
+//	Save 时策略外的同主键记录不会被覆盖，新增时返回唯一键冲突；Truncate、Tree.Rebuild 返回 ErrOpNotAllowed。
+//	新增的记录不检查是否符合策略，需要时在 BeforeCreate 钩子或中间件中设置租户等字段；
+//	通过 DB() 取得的连接及原始SQL不受策略限制
+//
+//	@param fn 根据上下文返回条件，如 func(ctx context.Context) qdb.Condition { return qdb.Condition{Query: "tenant = ?", Args: []any{tenant}} }
+func RegisterRowPolicy[T any](fn func(ctx context.Context) Condition) {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	rowPolicies[typ] = append(rowPolicies[typ], fn)
+}
+
+// rowPolicy 追加模型的行过滤条件
+func rowPolicy[T any](db *gorm.DB) *gorm.DB {
+	policyLock.RLock()
+	fns := rowPolicies[reflect.TypeOf((*T)(nil)).Elem()]
+	policyLock.RUnlock()
+	if len(fns) == 0 {
+		return db
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	for _, fn := range fns {
+		if cond := fn(ctx); cond.Query != nil {
+			db = db.Where(cond.Query, cond.Args...)
+		}
+	}
+	return db
+}
+
+// hasRowPolicy 模型是否注册了行过滤策略
+func hasRowPolicy[T any]() bool {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	return len(rowPolicies[reflect.TypeOf((*T)(nil)).Elem()]) > 0
+}
+
+// save 保存一条记录，有行过滤策略时按策略条件修改，未修改任何行且策略内不存在时新增，
+// 避免 gorm Save 在修改0行时以冲突更新覆盖策略外的记录
+func (dao *Dao[T]) save(db *gorm.DB, model *T) *gorm.DB {
+	if !hasRowPolicy[T]() {
+		return db.Save(model)
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		_ = db.AddError(err)
+		return db
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rv := reflect.ValueOf(model).Elem()
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return db.Create(model)
+	}
+	for _, f := range stmt.Schema.PrimaryFields {
+		if _, zero := f.ValueOf(ctx, rv); zero {
+			return db.Create(model)
+		}
+	}
+	result := rowPolicy[T](db).Model(model).Select("*").Updates(model)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result
+	}
+	// mysql 内容无变化时修改行数为0
+	if exist, err := dao.exists(rowPolicy[T](db), model); err != nil || exist {
+		_ = result.AddError(err)
+		return result
+	}
+	return db.Create(model)
+}
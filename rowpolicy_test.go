@@ -0,0 +1,109 @@
+package qdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type policyOrder struct {
+	DbSimple
+	Tenant string
+	Name   string
+}
+
+type tenantKey struct{}
+
+func init() {
+	RegisterRowPolicy[policyOrder](func(ctx context.Context) Condition {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return Condition{Query: "tenant = ?", Args: []any{tenant}}
+	})
+}
+
+func TestRowPolicyWrites(t *testing.T) {
+	db := newTestDB(t)
+	dao, err := TryNewDao[policyOrder](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := dao.WithContext(context.WithValue(context.Background(), tenantKey{}, "a"))
+	b := dao.WithContext(context.WithValue(context.Background(), tenantKey{}, "b"))
+	order := &policyOrder{Tenant: "a", Name: "first"}
+	if err = a.Create(order); err != nil {
+		t.Fatal(err)
+	}
+	id := order.Id
+
+	if err = b.Update(&policyOrder{DbSimple: DbSimple{Id: id}, Name: "hijack"}); err == nil {
+		t.Error("Update of other tenant's row succeeded")
+	}
+	if err = b.UpdateAll(&policyOrder{DbSimple: DbSimple{Id: id}, Tenant: "b", Name: "hijack"}); err == nil {
+		t.Error("UpdateAll of other tenant's row succeeded")
+	}
+	if err = b.Save(&policyOrder{DbSimple: DbSimple{Id: id}, Tenant: "b", Name: "hijack"}); err == nil {
+		t.Error("Save over other tenant's row succeeded")
+	}
+	if err = b.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.DeleteCondition("name = ?", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Truncate(); !errors.Is(err, ErrOpNotAllowed) {
+		t.Errorf("Truncate with row policy: got %v, want ErrOpNotAllowed", err)
+	}
+	got, err := a.GetModel(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Tenant != "a" || got.Name != "first" {
+		t.Fatalf("row of tenant a changed by tenant b: %+v", got)
+	}
+
+	// 策略内的写入正常生效
+	if err = a.Update(&policyOrder{DbSimple: DbSimple{Id: id}, Name: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	got.Name = "third"
+	if err = a.Save(got); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = a.GetModel(id); got == nil || got.Name != "third" {
+		t.Fatalf("Save within policy: got %+v", got)
+	}
+	if err = a.Delete(id); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = a.GetModel(id); got != nil {
+		t.Fatalf("Delete within policy left %+v", got)
+	}
+}
+
+func TestRowPolicyReconcile(t *testing.T) {
+	src, err := TryNewDao[policyOrder](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := TryNewDao[policyOrder](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctxA := context.WithValue(context.Background(), tenantKey{}, "a")
+	ctxB := context.WithValue(context.Background(), tenantKey{}, "b")
+	if err = src.WithContext(ctxA).Create(&policyOrder{Tenant: "a", Name: "source"}); err != nil {
+		t.Fatal(err)
+	}
+	// 目标中同主键的行属于其他租户
+	if err = dst.WithContext(ctxB).Create(&policyOrder{Tenant: "b", Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Reconcile(src.WithContext(ctxA), dst.WithContext(ctxA), ReconcileOptions{Repair: true})
+	if err == nil {
+		t.Errorf("repair over other tenant's row succeeded: %+v", report)
+	}
+	got, _ := dst.WithContext(ctxB).GetAll()
+	if len(got) != 1 || got[0].Tenant != "b" || got[0].Name != "other" {
+		t.Fatalf("row of tenant b changed by repair: %+v", got)
+	}
+}
@@ -0,0 +1,247 @@
+package qdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Job 定时任务
+type Job struct {
+	Name      string                          // 名称，唯一
+	Interval  time.Duration                   // 执行间隔
+	Jitter    time.Duration                   // 随机抖动上限，避免多实例同时执行
+	Singleton bool                            // 是否通过数据库锁保证多实例中只有一个执行
+	Run       func(ctx context.Context) error // 执行方法
+	leader    bool                            // 是否为主节点任务，见 RunSingleton
+}
+
+// JobStats 任务执行统计
+type JobStats struct {
+	Runs      int64         // 执行次数
+	Failures  int64         // 失败次数，包括panic
+	Panics    int64         // panic次数
+	Skipped   int64         // 未获得锁而跳过的次数
+	LastRun   time.Time     // 最后执行时间
+	LastCost  time.Duration // 最后执行耗时
+	LastError string        // 最后的错误
+	Leader    bool          // 是否为主节点，仅 RunSingleton 添加的任务有效
+}
+
+// Scheduler 后台任务调度器，用于保留策略、归档、维护、同步等周期任务
+type Scheduler struct {
+	db      *gorm.DB
+	owner   string
+	jobs    []Job
+	stats   map[string]*JobStats
+	lock    sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	OnError func(job string, err error) // 任务失败回调，为空不处理
+}
+
+// NewScheduler 创建调度器
+//
+//	@param db 数据库连接，用于单例任务的锁，不使用单例任务时可为空
+//	@return *Scheduler
+func NewScheduler(db *gorm.DB) *Scheduler {
+	return &Scheduler{db: db, owner: lockOwner(), stats: map[string]*JobStats{}}
+}
+
+// Add 添加任务，需在 Start 之前调用
+//
+//	@param job 任务
+//	@return error
+func (s *Scheduler) Add(job Job) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if job.Name == "" || job.Interval <= 0 || job.Run == nil {
+		return errors.New("job requires Name, Interval and Run")
+	}
+	if _, ok := s.stats[job.Name]; ok {
+		return fmt.Errorf("job %s already exists", job.Name)
+	}
+	if job.Singleton && s.db == nil {
+		return fmt.Errorf("singleton job %s requires db", job.Name)
+	}
+	s.jobs = append(s.jobs, job)
+	s.stats[job.Name] = &JobStats{}
+	return nil
+}
+
+// RunSingleton 添加主节点任务，多个实例中只有获得主节点租约的一个持续执行，
+// 主节点每次执行及执行期间按间隔续租，其他实例按间隔检查租约，主节点停止续租3个间隔后接管
+//
+//	与 Singleton 任务每次执行后释放锁不同，主节点保持不变，适合需要连续性的消费、同步任务；需在 Start 之前调用
+//
+//	@param name 名称，唯一
+//	@param interval 执行间隔
+//	@param fn 执行方法
+//	@return error
+func (s *Scheduler) RunSingleton(name string, interval time.Duration, fn func(ctx context.Context) error) error {
+	if s.db == nil {
+		return fmt.Errorf("singleton job %s requires db", name)
+	}
+	return s.Add(Job{Name: name, Interval: interval, Run: fn, leader: true})
+}
+
+// Start 启动所有任务
+//
+//	@param ctx 上下文，结束时停止所有任务
+func (s *Scheduler) Start(ctx context.Context) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, job)
+	}
+}
+
+// Stop 停止所有任务并等待执行中的任务结束
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	cancel := s.cancel
+	s.lock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Stats 返回各任务的执行统计
+//
+//	@return map[string]JobStats
+func (s *Scheduler) Stats() map[string]JobStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := make(map[string]JobStats, len(s.stats))
+	for name, st := range s.stats {
+		stats[name] = *st
+	}
+	return stats
+}
+
+// loop 按间隔循环执行任务
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+	if job.leader {
+		// 停止时释放租约，其他实例可立即接管
+		defer func() {
+			_ = unlock(s.db, "leader:"+job.Name, s.owner)
+			s.record(job.Name, func(st *JobStats) { st.Leader = false })
+		}()
+	}
+	for {
+		wait := job.Interval
+		if job.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(job.Jitter)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		s.runOnce(ctx, job)
+	}
+}
+
+// runOnce 执行一次任务，单例任务需先获得锁
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	name := "job:" + job.Name
+	if job.Singleton {
+		ok, err := tryLock(s.db.WithContext(ctx), name, s.owner, job.Interval+job.Jitter+time.Minute)
+		if err != nil || !ok {
+			s.record(job.Name, func(st *JobStats) { st.Skipped++ })
+			if err != nil {
+				s.fail(job.Name, err)
+			}
+			return
+		}
+		defer func() { _ = unlock(s.db, name, s.owner) }()
+	}
+	if job.leader {
+		name = "leader:" + job.Name
+		ttl := 3 * (job.Interval + job.Jitter)
+		ok, err := tryLock(s.db.WithContext(ctx), name, s.owner, ttl)
+		s.record(job.Name, func(st *JobStats) {
+			st.Leader = ok
+			if !ok {
+				st.Skipped++
+			}
+		})
+		if err != nil || !ok {
+			if err != nil {
+				s.fail(job.Name, err)
+			}
+			return
+		}
+		defer s.heartbeat(ctx, name, ttl, job.Interval)()
+	}
+
+	start := time.Now()
+	err := s.safeRun(ctx, job)
+	cost := time.Since(start)
+	s.record(job.Name, func(st *JobStats) {
+		st.Runs++
+		st.LastRun = start
+		st.LastCost = cost
+		st.LastError = ""
+		if err != nil {
+			st.Failures++
+			st.LastError = err.Error()
+		}
+	})
+	if err != nil {
+		s.fail(job.Name, err)
+	}
+}
+
+// heartbeat 任务执行期间按间隔续租，返回停止方法
+func (s *Scheduler) heartbeat(ctx context.Context, name string, ttl time.Duration, every time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				_, _ = tryLock(s.db.WithContext(ctx), name, s.owner, ttl)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// safeRun 执行任务并恢复panic
+func (s *Scheduler) safeRun(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.record(job.Name, func(st *JobStats) { st.Panics++ })
+			err = fmt.Errorf("job %s panic: %v", job.Name, r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// record 更新统计
+func (s *Scheduler) record(name string, fn func(st *JobStats)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	fn(s.stats[name])
+}
+
+// fail 回调错误
+func (s *Scheduler) fail(name string, err error) {
+	if s.OnError != nil {
+		s.OnError(name, err)
+	}
+}
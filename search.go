@@ -0,0 +1,264 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"strings"
+)
+
+// SearchRequest 搜索的分页与排序参数，嵌入到自定义搜索结构体中使用
+//
+//	type DevSearch struct {
+//		qdb.SearchRequest
+//		Name   *string `qdb:"op:like"`
+//		Status *int
+//		Begin  qtime.DateTime `qdb:"op:ge;column:LastTime"`
+//		City   string `qdb:"extra:loc.city"`
+//	}
+type SearchRequest struct {
+	Page     int    // 页码，从1开始，为0不分页
+	PageSize int    // 每页数量
+	Sort     string // 排序，如 Name asc,Id desc，仅允许模型字段
+}
+
+// 标签操作符对应的过滤操作符
+var searchOps = map[string]string{
+	"eq":     "eq",
+	"ne":     "ne",
+	"gt":     "gt",
+	"ge":     "ge",
+	"lt":     "lt",
+	"le":     "le",
+	"in":     "in",
+	"like":   "contains",
+	"prefix": "startswith",
+	"suffix": "endswith",
+}
+
+// searchPlan 解析后的搜索计划
+type searchPlan struct {
+	filter Filter
+	orders []clause.OrderByColumn
+	limit  int
+	offset int
+}
+
+// BindSearch 将搜索结构体绑定为查询范围，包含条件、排序和分页
+//
+//	字段为nil指针、零值或空切片时忽略，标签 qdb:"op:like;column:Name" 指定操作符和列，
+//	qdb:"extra:path" 按FullInfo中的路径过滤，qdb:"-" 忽略该字段
+//
+//	@param req 搜索结构体或其指针
+//	@return func(db *gorm.DB) *gorm.DB 解析失败时错误写入db
+func BindSearch[T any](req any) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		plan, err := parseSearch[T](db, req)
+		if err != nil {
+			_ = db.AddError(err)
+			return db
+		}
+		return plan.page(plan.where(db))
+	}
+}
+
+// Search 按搜索结构体查询一组列表，同时返回不分页时的总数
+//
+//	@param req 搜索结构体或其指针，参见 BindSearch
+//	@return []*T, int64 总数, error
+func (dao *Dao[T]) Search(req any) ([]*T, int64, error) {
+	list := make([]*T, 0)
+	var total int64
+	err := dao.exec("Search", OpRead, func(op *Operation) error {
+		plan, err := parseSearch[T](op.DB, req)
+		if err != nil {
+			return err
+		}
+		if err = plan.where(dao.query(op.DB)).Model(new(T)).Count(&total).Error; err != nil {
+			return err
+		}
+		// 未指定排序时使用默认排序
+		db := dao.query(op.DB)
+		if len(plan.orders) == 0 {
+			db = dao.list(op.DB)
+		}
+		result := plan.page(plan.where(db)).Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, total, err
+}
+
+// where 应用过滤条件
+func (p *searchPlan) where(db *gorm.DB) *gorm.DB {
+	if p.filter.Query != "" {
+		db = db.Where(p.filter.Query, p.filter.Args...)
+	}
+	return db
+}
+
+// page 应用排序和分页
+func (p *searchPlan) page(db *gorm.DB) *gorm.DB {
+	for _, order := range p.orders {
+		db = db.Order(order)
+	}
+	if p.limit > 0 {
+		db = db.Limit(p.limit).Offset(p.offset)
+	}
+	return db
+}
+
+// parseSearch 解析搜索结构体
+func parseSearch[T any](db *gorm.DB, req any) (*searchPlan, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(req)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return &searchPlan{}, nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("search: request must be a struct, got %s", v.Kind())
+	}
+
+	plan := &searchPlan{}
+	parts := make([]string, 0)
+	if err := searchFields(db, stmt, v, plan, &parts); err != nil {
+		return nil, err
+	}
+	plan.filter.Query = strings.Join(parts, " AND ")
+	return plan, nil
+}
+
+// searchFields 递归解析结构体字段
+func searchFields(db *gorm.DB, stmt *gorm.Statement, v reflect.Value, plan *searchPlan, parts *[]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("qdb")
+		if tag == "-" {
+			continue
+		}
+
+		// 分页与排序
+		if sf.Anonymous && sf.Type == reflect.TypeOf(SearchRequest{}) {
+			if err := searchPaging(stmt, fv.Interface().(SearchRequest), plan); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := searchFields(db, stmt, fv, plan, parts); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 忽略未赋值字段
+		if fv.IsZero() || (fv.Kind() == reflect.Slice && fv.Len() == 0) {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			fv = fv.Elem()
+		}
+
+		// 解析标签
+		op, column, extra := "eq", sf.Name, ""
+		for _, item := range strings.Split(tag, ";") {
+			kv := strings.SplitN(strings.TrimSpace(item), ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.TrimSpace(kv[0]) {
+			case "op":
+				op = strings.TrimSpace(kv[1])
+			case "column":
+				column = strings.TrimSpace(kv[1])
+			case "extra":
+				extra = strings.TrimSpace(kv[1])
+			}
+		}
+		fop, ok := searchOps[op]
+		if !ok {
+			return fmt.Errorf("search: field %s has unknown op %q", sf.Name, op)
+		}
+
+		// 列必须存在于模型中，FullInfo路径需数据库支持JSON
+		var col any
+		if extra != "" {
+			expr, err := ExtraExpr(db, extra)
+			if err != nil {
+				return err
+			}
+			col = clause.Expr{SQL: expr}
+		} else {
+			field := stmt.Schema.LookUpField(column)
+			if field == nil || field.DBName == "" {
+				return fmt.Errorf("search: field %s maps to unknown column %q", sf.Name, column)
+			}
+			col = clause.Column{Name: field.DBName}
+		}
+
+		var value any
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			items := make([]any, fv.Len())
+			for j := range items {
+				items[j] = fv.Index(j).Interface()
+			}
+			value = items
+			if fop == "eq" {
+				fop = "in"
+			}
+		} else {
+			value = fv.Interface()
+		}
+		q, err := compareExpr(&plan.filter, col, sf.Name, fop, value, nil)
+		if err != nil {
+			return err
+		}
+		*parts = append(*parts, q)
+	}
+	return nil
+}
+
+// searchPaging 解析分页与排序
+func searchPaging(stmt *gorm.Statement, req SearchRequest, plan *searchPlan) error {
+	if req.Page > 0 && req.PageSize > 0 {
+		plan.limit = req.PageSize
+		plan.offset = (req.Page - 1) * req.PageSize
+	}
+	for _, item := range strings.Split(req.Sort, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return fmt.Errorf("search: invalid sort %q", item)
+		}
+		field := stmt.Schema.LookUpField(fields[0])
+		if field == nil || field.DBName == "" {
+			return fmt.Errorf("search: unknown sort field %q", fields[0])
+		}
+		desc := false
+		if len(fields) == 2 {
+			switch strings.ToLower(fields[1]) {
+			case "asc":
+			case "desc":
+				desc = true
+			default:
+				return fmt.Errorf("search: invalid sort direction %q", fields[1])
+			}
+		}
+		plan.orders = append(plan.orders, clause.OrderByColumn{Column: clause.Column{Name: field.DBName}, Desc: desc})
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package qdb
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature 数据库功能标识
+type Feature string
+
+const (
+	FeatureJSON       Feature = "JSON"        // JSON函数及类型
+	FeatureCTE        Feature = "CTE"         // WITH公用表表达式（含递归）
+	FeatureSkipLocked Feature = "SKIP LOCKED" // 跳过已锁定行
+	FeatureUpsert     Feature = "UPSERT"      // 冲突时更新
+	FeatureReturning  Feature = "RETURNING"   // 写入时返回数据
+	FeatureWindow     Feature = "WINDOW"      // 窗口函数
+)
+
+// DbServerInfo 数据库服务信息
+type DbServerInfo struct {
+	Dialect  string           // 数据库类型，如 sqlite、mysql、postgres、sqlserver
+	Version  string           // 服务端原始版本号
+	MariaDB  bool             // 是否为MariaDB
+	Features map[Feature]bool // 支持的功能
+}
+
+// 已探测的服务信息，按 *sql.DB 缓存
+var serverInfos sync.Map
+
+// ServerInfo 获取数据库类型、版本及支持的功能，结果按连接池缓存，事务中调用时在事务外探测
+//
+//	@param db 数据库连接
+//	@return *DbServerInfo, error
+func ServerInfo(db *gorm.DB) (*DbServerInfo, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := serverInfos.Load(sqlDB); ok {
+		return v.(*DbServerInfo), nil
+	}
+
+	info := &DbServerInfo{Dialect: db.Dialector.Name(), Features: map[Feature]bool{}}
+	var sql string
+	switch info.Dialect {
+	case "sqlite":
+		sql = "SELECT sqlite_version()"
+	case "mysql":
+		sql = "SELECT VERSION()"
+	case "postgres":
+		sql = "SHOW server_version"
+	case "sqlserver":
+		sql = "SELECT CAST(SERVERPROPERTY('ProductVersion') AS VARCHAR(64))"
+	default:
+		return nil, fmt.Errorf("%w: unknown dialect %s", ErrUnsupported, info.Dialect)
+	}
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err = sqlDB.QueryRowContext(ctx, sql).Scan(&info.Version); err != nil {
+		return nil, err
+	}
+	info.MariaDB = strings.Contains(strings.ToLower(info.Version), "mariadb")
+
+	v := parseVersion(info.Version)
+	switch {
+	case info.Dialect == "sqlite":
+		info.Features[FeatureJSON] = v >= version(3, 38, 0)
+		info.Features[FeatureCTE] = v >= version(3, 8, 3)
+		info.Features[FeatureUpsert] = v >= version(3, 24, 0)
+		info.Features[FeatureReturning] = v >= version(3, 35, 0)
+		info.Features[FeatureWindow] = v >= version(3, 25, 0)
+	case info.MariaDB:
+		info.Features[FeatureJSON] = v >= version(10, 2, 7)
+		info.Features[FeatureCTE] = v >= version(10, 2, 2)
+		info.Features[FeatureSkipLocked] = v >= version(10, 6, 0)
+		info.Features[FeatureUpsert] = true
+		info.Features[FeatureReturning] = v >= version(10, 5, 0)
+		info.Features[FeatureWindow] = v >= version(10, 2, 0)
+	case info.Dialect == "mysql":
+		info.Features[FeatureJSON] = v >= version(5, 7, 8)
+		info.Features[FeatureCTE] = v >= version(8, 0, 0)
+		info.Features[FeatureSkipLocked] = v >= version(8, 0, 1)
+		info.Features[FeatureUpsert] = true
+		info.Features[FeatureWindow] = v >= version(8, 0, 0)
+	case info.Dialect == "postgres":
+		info.Features[FeatureJSON] = v >= version(9, 4, 0)
+		info.Features[FeatureCTE] = v >= version(8, 4, 0)
+		info.Features[FeatureSkipLocked] = v >= version(9, 5, 0)
+		info.Features[FeatureUpsert] = v >= version(9, 5, 0)
+		info.Features[FeatureReturning] = true
+		info.Features[FeatureWindow] = v >= version(8, 4, 0)
+	case info.Dialect == "sqlserver":
+		// 13.x 为 SQL Server 2016，跳过锁定行使用 READPAST 实现
+		info.Features[FeatureJSON] = v >= version(13, 0, 0)
+		info.Features[FeatureCTE] = true
+		info.Features[FeatureSkipLocked] = true
+		info.Features[FeatureUpsert] = true
+		info.Features[FeatureReturning] = true
+		info.Features[FeatureWindow] = v >= version(11, 0, 0)
+	}
+
+	serverInfos.Store(sqlDB, info)
+	return info, nil
+}
+
+// Supports 是否支持指定功能
+//
+//	@param feature 功能标识
+//	@return bool
+func (s *DbServerInfo) Supports(feature Feature) bool {
+	return s.Features[feature]
+}
+
+// RequireFeature 校验数据库是否支持指定功能，不支持时返回 ErrUnsupported
+//
+//	@param db 数据库连接
+//	@param features 功能标识
+//	@return error
+func RequireFeature(db *gorm.DB, features ...Feature) error {
+	info, err := ServerInfo(db)
+	if err != nil {
+		return err
+	}
+	for _, f := range features {
+		if !info.Supports(f) {
+			return fmt.Errorf("%w: %s %s does not support %s", ErrUnsupported, info.Dialect, info.Version, f)
+		}
+	}
+	return nil
+}
+
+// version 将版本号合并为可比较的整数
+func version(major, minor, patch int) int {
+	return major*1000000 + minor*1000 + patch
+}
+
+// parseVersion 解析版本字符串，如 8.0.33、10.6.12-MariaDB、15.3 (Debian 15.3-1)
+func parseVersion(str string) int {
+	nums := [3]int{}
+	for i, part := range strings.SplitN(strings.TrimSpace(str), ".", 3) {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		nums[i], _ = strconv.Atoi(part[:end])
+		if end < len(part) {
+			break
+		}
+	}
+	return version(nums[0], nums[1], nums[2])
+}
@@ -1,18 +1,44 @@
 package qdb
 
 import (
-	"encoding/json"
-	"os"
+	"fmt"
+	"reflect"
+	"strings"
 )
 
 type setting struct {
-	Connect string `comment:"数据库连接串\n sqlite|./db/data.db&OFF\n sqlserver|用户名:密码@地址?database=数据库&encrypt=disable\n mysql|用户名:密码@tcp(127.0.0.1:3306)/数据库?charset=utf8mb4&parseTime=True&loc=Local"`
-	Config  struct {
-		OpenLog                bool
-		SkipDefaultTransaction bool
-		NoLowerCase            bool
-	} `comment:"其他设置\n OpenLog：是否打开调试日志\n SkipDefaultTransaction：是否跳过默认事务\n NoLowerCase：是否不将结构体名和字段名转换为小写字母的形式"`
-	filePath string
+	Base    string        `comment:"继承的配置节名称，为空不继承\n 继承其Connect以外的设置，按字段合并，本节中显式填写的Config、SSH字段优先"`
+	Connect string        `comment:"数据库连接串\n sqlite|./db/data.db&OFF\n sqlserver|用户名:密码@地址?database=数据库&encrypt=disable\n mysql|用户名:密码@tcp(127.0.0.1:3306)/数据库?charset=utf8mb4&parseTime=True&loc=Local\n mysql|用户名:密码@unix(/var/run/mysqld/mysqld.sock)/数据库?charset=utf8mb4&parseTime=True&loc=Local\n postgres|host=/var/run/postgresql user=用户名 password=密码 dbname=数据库"`
+	Config  settingConfig `comment:"其他设置\n OpenLog：是否打开调试日志\n SkipDefaultTransaction：是否跳过默认事务\n NoLowerCase：是否不将结构体名和字段名转换为小写字母的形式\n TablePrefix：表名前缀，如 t_\n SingularTable：是否使用单数表名，false时表名为复数\n ColumnMapper：列名映射方法名称，需先通过 qdb.RegisterColumnMapper 注册，为空不启用\n UTC：是否以UTC存储时间，qtime.DateTime字段写入时转换为UTC、读取时转换为本地时间，mysql连接自动设置parseTime、loc，postgres设置TimeZone\n SlowThreshold：慢查询阈值（毫秒），超过时记录到 qdb_slow_log 表，为0不记录\n SlowRetentionDays：慢查询记录保留天数，为0不清理\n LogFile：SQL日志文件路径，开启OpenLog时写入该文件，为空输出到控制台\n LogMaxSizeMB：单个日志文件最大大小（MB），超过或跨天时切分，为0仅按天切分\n LogMaxAgeDays：历史日志文件保留天数，为0不清理\n TableCharset：mysql建表字符集，如 utf8mb4，为空使用服务端默认值\n TableCollation：mysql建表排序规则，如 utf8mb4_0900_ai_ci\n TableEngine：mysql建表引擎，如 InnoDB"`
+	SSH     settingSSH    `comment:"SSH隧道（仅mysql/postgres，Host为空则不启用）\n Host：SSH服务器地址，如 10.0.0.1:22\n User：SSH用户名\n Password：SSH密码\n KeyFile：私钥文件路径\n KnownHosts：known_hosts文件路径，用于校验主机密钥\n InsecureSkipHostKey：不校验主机密钥，仅用于测试环境，KnownHosts为空时必须显式开启\n JumpHost：跳板机地址，如 用户名@10.0.0.2:22，使用相同的认证信息"`
+}
+
+type settingConfig struct {
+	OpenLog                bool
+	SkipDefaultTransaction bool
+	NoLowerCase            bool
+	TablePrefix            string
+	SingularTable          bool
+	ColumnMapper           string
+	UTC                    bool
+	SlowThreshold          int
+	SlowRetentionDays      int
+	LogFile                string
+	LogMaxSizeMB           int
+	LogMaxAgeDays          int
+	TableCharset           string
+	TableCollation         string
+	TableEngine            string
+}
+
+type settingSSH struct {
+	Host                string
+	User                string
+	Password            string
+	KeyFile             string
+	KnownHosts          string
+	InsecureSkipHostKey bool
+	JumpHost            string
 }
 
 func initBaseConfig(defaultConn string) *setting {
@@ -20,30 +46,86 @@ func initBaseConfig(defaultConn string) *setting {
 		defaultConn = "sqlite|./db/data.db&OFF"
 	}
 	config := &setting{
-		filePath: "./config.yaml",
-		Connect:  defaultConn,
-		Config: struct {
-			OpenLog                bool
-			SkipDefaultTransaction bool
-			NoLowerCase            bool
-		}{
+		Connect: defaultConn,
+		Config: settingConfig{
 			OpenLog:                false,
 			SkipDefaultTransaction: true,
 			NoLowerCase:            true,
+			SingularTable:          true,
 		},
 	}
+	return config
+}
+
+// loadSetting 加载配置节，配置了Base时继承其设置
+func loadSetting(sectionName string, defaultConn string, visited map[string]bool) (*setting, error) {
+	if visited[sectionName] {
+		return nil, fmt.Errorf("config section %s has circular Base", sectionName)
+	}
+	visited[sectionName] = true
+
+	src, err := currentConfigSource()
+	if err != nil {
+		return nil, err
+	}
+	cfg := initBaseConfig(defaultConn)
+	raw, err := src.Load(sectionName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Base == "" {
+		return cfg, nil
+	}
 
-	if len(os.Args) > 1 {
-		args := map[string]string{}
-		err := json.Unmarshal([]byte(os.Args[1]), &args)
-		if err != nil {
-			panic(err)
+	// 继承基础配置节，本节中未填写的字段使用基础配置
+	base, err := loadSetting(cfg.Base, defaultConn, visited)
+	if err != nil {
+		return nil, err
+	}
+	inheritFields(reflect.ValueOf(&cfg.Config).Elem(), reflect.ValueOf(base.Config), rawChild(raw, "Config"))
+	inheritFields(reflect.ValueOf(&cfg.SSH).Elem(), reflect.ValueOf(base.SSH), rawChild(raw, "SSH"))
+	return cfg, nil
+}
+
+// inheritFields 将 raw 中未填写的字段设置为基础配置的值，嵌套结构体逐字段合并
+func inheritFields(dst reflect.Value, base reflect.Value, raw map[string]any) {
+	typ := dst.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		name := typ.Field(i).Name
+		if !hasKey(raw, name) {
+			dst.Field(i).Set(base.Field(i))
+		} else if dst.Field(i).Kind() == reflect.Struct {
+			inheritFields(dst.Field(i), base.Field(i), rawChild(raw, name))
 		}
-		// 自定义配置文件路径
-		if val, ok := args["ConfigPath"]; ok {
-			config.filePath = val
+	}
+}
+
+// rawChild 不区分大小写返回配置节中的子节点，不存在或不是节点时返回nil
+func rawChild(raw map[string]any, key string) map[string]any {
+	for k, v := range raw {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+		switch child := v.(type) {
+		case map[string]any:
+			return child
+		case map[any]any:
+			m := make(map[string]any, len(child))
+			for ck, cv := range child {
+				m[fmt.Sprint(ck)] = cv
+			}
+			return m
 		}
 	}
+	return nil
+}
 
-	return config
+// hasKey 不区分大小写判断配置节中是否填写了指定键
+func hasKey(raw map[string]any, key string) bool {
+	for k := range raw {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
 }
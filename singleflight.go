@@ -0,0 +1,49 @@
+package qdb
+
+import (
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+)
+
+// 合并并发的相同查询
+var flights singleflight.Group
+
+// WithSingleFlight 合并并发的相同 GetModel 查询，热点记录被大量并发读取时只查询一次数据库
+//
+//	按连接池、表和唯一号合并，各调用方得到结果的浅拷贝，上下文中的键值（如租户）不同时不合并；
+//	模型注册了行过滤策略、Dao设置了默认查询范围或在事务中时不合并
+//
+//	@return DaoOption
+func WithSingleFlight() DaoOption {
+	return func(opts *daoOptions) {
+		opts.singleFlight = true
+	}
+}
+
+// getShared 合并执行查询，返回结果的浅拷贝，无法安全合并时直接执行
+func getShared[T any](dao *Dao[T], key string, fn func() (*T, error)) (*T, error) {
+	if hasRowPolicy[T]() || len(dao.opts.scopes) > 0 {
+		return fn()
+	}
+	if _, ok := dao.db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return fn()
+	}
+	sqlDB, err := dao.db.DB()
+	if err != nil {
+		return fn()
+	}
+	key = fmt.Sprintf("%p|%s|%s|%v", sqlDB, dao.table, key, Values(dao.db.Statement.Context))
+	if p := dao.opts.partition; p != nil && p.ranged {
+		key += fmt.Sprintf("|%d-%d", p.start, p.end)
+	}
+	v, err, _ := flights.Do(key, func() (any, error) {
+		return fn()
+	})
+	model, _ := v.(*T)
+	if err != nil || model == nil {
+		return nil, err
+	}
+	clone := *model
+	return &clone, nil
+}
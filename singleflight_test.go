@@ -0,0 +1,105 @@
+package qdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type flightItem struct {
+	DbSimple
+	Name string
+}
+
+// blockGetModel 注册中间件，GetModel 进入时通知并等待释放，返回进入次数
+func blockGetModel[T any](dao *Dao[T], entered chan<- struct{}, release <-chan struct{}) *atomic.Int32 {
+	calls := &atomic.Int32{}
+	dao.Use(func(next Handler) Handler {
+		return func(op *Operation) error {
+			if op.Name == "GetModel" {
+				calls.Add(1)
+				entered <- struct{}{}
+				<-release
+			}
+			return next(op)
+		}
+	})
+	return calls
+}
+
+func TestSingleFlightCollapses(t *testing.T) {
+	dao, err := TryNewDao[flightItem](newTestDB(t), WithSingleFlight())
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &flightItem{Name: "hot"}
+	if err = dao.Create(item); err != nil {
+		t.Fatal(err)
+	}
+	const n = 8
+	entered, release := make(chan struct{}, n), make(chan struct{})
+	calls := blockGetModel(dao, entered, release)
+
+	var wg sync.WaitGroup
+	results := make([]*flightItem, n)
+	get := func(i int) {
+		defer wg.Done()
+		results[i], _ = dao.GetModel(item.Id)
+	}
+	wg.Add(n)
+	go get(0)
+	<-entered
+	for i := 1; i < n; i++ {
+		go get(i)
+	}
+	// 等待其余调用加入等待中的查询
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if c := calls.Load(); c != 1 {
+		t.Errorf("GetModel ran %d times, want 1", c)
+	}
+	for i, r := range results {
+		if r == nil || r.Name != "hot" {
+			t.Fatalf("result %d: %+v", i, r)
+		}
+		if i > 0 && r == results[0] {
+			t.Fatal("callers share the same pointer")
+		}
+	}
+}
+
+func TestSingleFlightSkipsRowPolicy(t *testing.T) {
+	dao, err := TryNewDao[policyOrder](newTestDB(t), WithSingleFlight())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := dao.WithContext(context.WithValue(context.Background(), tenantKey{}, "a"))
+	order := &policyOrder{Tenant: "a", Name: "first"}
+	if err = a.Create(order); err != nil {
+		t.Fatal(err)
+	}
+	entered, release := make(chan struct{}, 2), make(chan struct{})
+	blockGetModel(a, entered, release)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			_, _ = a.GetModel(order.Id)
+		}()
+	}
+	// 两次查询均独立进入中间件
+	for i := 0; i < 2; i++ {
+		select {
+		case <-entered:
+		case <-time.After(2 * time.Second):
+			close(release)
+			t.Fatal("GetModel with row policy was shared")
+		}
+	}
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,179 @@
+package qdb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dbSlowLog 慢查询记录
+type dbSlowLog struct {
+	Id        uint64         `gorm:"primaryKey"`
+	Time      qtime.DateTime `gorm:"index"` // 执行时间
+	Statement string         // 归一化后的语句
+	Digest    string         `gorm:"size:64"` // 参数摘要，相同参数摘要相同
+	CostMs    float64        // 耗时，毫秒
+	Rows      int64          // 影响或返回的行数
+	Caller    string         `gorm:"size:512"` // 调用位置
+	Error     string         // 错误
+}
+
+// TableName 表名
+func (dbSlowLog) TableName() string {
+	return "qdb_slow_log"
+}
+
+// slowLogPlugin 记录慢查询
+type slowLogPlugin struct {
+	threshold time.Duration
+	retention time.Duration
+	logs      chan dbSlowLog
+	lock      sync.RWMutex  // 保护 stopped 与关闭 logs
+	stopped   bool          // 已停止，不再写入队列
+	done      chan struct{} // 写入协程退出后关闭
+}
+
+// Name 插件名称
+func (*slowLogPlugin) Name() string {
+	return "qdb:slow_log"
+}
+
+// Initialize 注册回调并启动写入
+func (p *slowLogPlugin) Initialize(db *gorm.DB) error {
+	if err := ensureTable(db, &dbSlowLog{}); err != nil {
+		return err
+	}
+	before := func(db *gorm.DB) { db.InstanceSet("qdb:slow_start", time.Now()) }
+	after := func(db *gorm.DB) {
+		v, ok := db.InstanceGet("qdb:slow_start")
+		if !ok || db.Statement.SQL.Len() == 0 {
+			return
+		}
+		if _, skip := db.Get("qdb:skip_slow_log"); skip {
+			return
+		}
+		cost := time.Since(v.(time.Time))
+		if cost < p.threshold {
+			return
+		}
+		item := dbSlowLog{
+			Time:      qtime.NewDateTime(now()),
+			Statement: normalizeStatement(db.Statement.SQL.String()),
+			Digest:    varsDigest(db.Statement.Vars),
+			CostMs:    ms(cost),
+			Rows:      db.RowsAffected,
+			Caller:    callerOutside(),
+		}
+		if db.Error != nil {
+			item.Error = db.Error.Error()
+		}
+		// 写入队列已满时丢弃，不影响业务执行
+		p.lock.RLock()
+		defer p.lock.RUnlock()
+		if p.stopped {
+			return
+		}
+		select {
+		case p.logs <- item:
+		default:
+		}
+	}
+	if err := registerAround(db, "qdb:slow_log", before, after); err != nil {
+		return err
+	}
+	go p.write(db.Session(&gorm.Session{NewDB: true}))
+	return nil
+}
+
+// write 后台写入慢查询记录并清理过期记录，直到 stop 关闭队列
+func (p *slowLogPlugin) write(db *gorm.DB) {
+	defer close(p.done)
+	// 每条语句从新会话开始，避免条件在多次执行间累积
+	session := func() *gorm.DB {
+		return db.Set("qdb:skip_slow_log", true).Set("qdb:skip_stats", true)
+	}
+	column := fieldColumn(db, &dbSlowLog{}, "Time")
+	var lastClean time.Time
+	for item := range p.logs {
+		_ = session().Create(&item).Error
+		if p.retention > 0 && time.Since(lastClean) > time.Hour {
+			lastClean = time.Now()
+			expire := qtime.NewDateTime(now().Add(-p.retention))
+			_ = session().Where(clause.Lt{Column: column, Value: expire}).Delete(&dbSlowLog{}).Error
+		}
+	}
+}
+
+// stop 停止记录，等待队列中的记录写入后返回
+func (p *slowLogPlugin) stop() {
+	p.lock.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.logs)
+	}
+	p.lock.Unlock()
+	<-p.done
+}
+
+// EnableSlowLog 将耗时超过阈值的语句记录到 qdb_slow_log 表
+//
+//	@param db 数据库连接
+//	@param threshold 耗时阈值
+//	@param retention 保留时长，为0不清理
+//	@return error
+func EnableSlowLog(db *gorm.DB, threshold time.Duration, retention time.Duration) error {
+	if _, ok := db.Config.Plugins[(&slowLogPlugin{}).Name()]; ok {
+		return nil
+	}
+	return db.Use(&slowLogPlugin{threshold: threshold, retention: retention, logs: make(chan dbSlowLog, 1000), done: make(chan struct{})})
+}
+
+// DisableSlowLog 停止记录慢查询，等待已排队的记录写入后返回，关闭数据库连接前调用
+//
+//	停止后同一连接不能再次启用
+//
+//	@param db 数据库连接
+func DisableSlowLog(db *gorm.DB) {
+	if plugin, ok := db.Config.Plugins[(&slowLogPlugin{}).Name()]; ok {
+		plugin.(*slowLogPlugin).stop()
+	}
+}
+
+// varsDigest 计算参数摘要
+func varsDigest(vars []any) string {
+	if len(vars) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprint(vars...)))
+	return hex.EncodeToString(sum[:])
+}
+
+var qdbDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// callerOutside 返回gorm和qdb之外的第一个调用位置
+func callerOutside() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.Contains(frame.File, "gorm.io/") && filepath.Dir(frame.File) != qdbDir &&
+			!strings.HasPrefix(frame.Function, "runtime.") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package qdb
+
+import (
+	"github.com/kamioair/utils/qtime"
+	"testing"
+	"time"
+)
+
+func TestSlowLogWriter(t *testing.T) {
+	db := newTestDB(t)
+	if err := ensureTable(db, &dbSlowLog{}); err != nil {
+		t.Fatal(err)
+	}
+	old := dbSlowLog{Time: qtime.NewDateTime(time.Now().Add(-48 * time.Hour)), Statement: "old"}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := EnableSlowLog(db, 0, 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		var n int64
+		if err := db.Model(&dbSlowLog{}).Where("statement = ?", "x").Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	DisableSlowLog(db)
+
+	var logs []dbSlowLog
+	if err := db.Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 5 {
+		t.Fatalf("got %d slow logs, want 5", len(logs))
+	}
+	for _, l := range logs {
+		if l.Id == old.Id {
+			t.Fatal("expired slow log not cleaned")
+		}
+	}
+	// 停止后不再记录
+	if err := db.Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	db.Model(&dbSlowLog{}).Count(&n)
+	if n != 5 {
+		t.Fatalf("slow log written after DisableSlowLog: %d", n)
+	}
+}
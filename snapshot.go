@@ -0,0 +1,376 @@
+package qdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotLine 快照中的一行，表结构或数据
+type snapshotLine struct {
+	Type    string           `json:"type"` // table、row
+	Table   string           `json:"table"`
+	Columns []snapshotColumn `json:"columns,omitempty"`
+	Data    map[string]any   `json:"data,omitempty"`
+}
+
+// snapshotColumn 通用列定义
+type snapshotColumn struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"` // int、float、string、bytes、bool、time
+	PrimaryKey bool   `json:"primaryKey,omitempty"`
+	Nullable   bool   `json:"nullable,omitempty"`
+}
+
+// Snapshot 导出整个数据库的表结构和数据，格式为gzip压缩的JSON行，可在不同类型的数据库之间恢复
+//
+//	@param db 数据库连接
+//	@param w 输出
+//	@return error
+func Snapshot(db *gorm.DB, w io.Writer) error {
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(w)
+	enc := json.NewEncoder(zw)
+	for _, table := range tables {
+		if strings.HasPrefix(table, "sqlite_") {
+			continue
+		}
+		if err = snapshotTable(db, enc, table); err != nil {
+			return fmt.Errorf("snapshot %s: %w", table, err)
+		}
+	}
+	return zw.Close()
+}
+
+// snapshotTable 导出一张表
+func snapshotTable(db *gorm.DB, enc *json.Encoder, table string) error {
+	types, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		return err
+	}
+	line := snapshotLine{Type: "table", Table: table}
+	kinds := map[string]string{}
+	for _, ct := range types {
+		col := snapshotColumn{Name: ct.Name(), Type: genericType(db.Dialector.Name(), ct.DatabaseTypeName())}
+		col.PrimaryKey, _ = ct.PrimaryKey()
+		col.Nullable, _ = ct.Nullable()
+		kinds[col.Name] = col.Type
+		line.Columns = append(line.Columns, col)
+	}
+	if err = enc.Encode(line); err != nil {
+		return err
+	}
+
+	rows, err := db.Table(table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		data := map[string]any{}
+		if err = db.ScanRows(rows, &data); err != nil {
+			return err
+		}
+		// 部分驱动以[]byte返回文本，或以文本返回二进制
+		for k, v := range data {
+			if b, ok := v.([]byte); ok && kinds[k] != "bytes" {
+				data[k] = string(b)
+			} else if s, ok := v.(string); ok && kinds[k] == "bytes" {
+				data[k] = []byte(s)
+			}
+		}
+		if err = enc.Encode(snapshotLine{Type: "row", Table: table, Data: data}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore 从 Snapshot 的输出恢复数据，在一个事务中执行
+//
+//	表不存在时按通用列定义创建（不含索引，可先通过 NewDao 创建完整表结构），快照中的表会先清空再写入；
+//	已存在的表按其列类型转换布尔值。恢复期间暂停外键检查，表按快照中的顺序写入：
+//	sqlite 推迟到提交时检查，mysql 关闭 FOREIGN_KEY_CHECKS，sqlserver 对全部表 NOCHECK 后重新校验，
+//	postgres 设置 session_replication_role（需超级用户），无权限时推迟可延迟的约束，其他外键仍按顺序检查
+//
+//	@param db 数据库连接
+//	@param r 输入
+//	@return error
+func Restore(db *gorm.DB, r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	return trackedTx(db, func(tx *gorm.DB) (err error) {
+		enable, err := disableForeignKeys(tx)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := enable(); err == nil {
+				err = e
+			}
+		}()
+		dec := json.NewDecoder(bufio.NewReader(zr))
+		dec.UseNumber()
+		var columns map[string]snapshotColumn
+		var batch []map[string]any
+		table := ""
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			err := tx.Table(table).Create(batch).Error
+			batch = batch[:0]
+			return err
+		}
+		for {
+			var line snapshotLine
+			if err := dec.Decode(&line); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			switch line.Type {
+			case "table":
+				if err := flush(); err != nil {
+					return err
+				}
+				table = line.Table
+				columns = map[string]snapshotColumn{}
+				for _, col := range line.Columns {
+					columns[col.Name] = col
+				}
+				exists := tx.Migrator().HasTable(table)
+				if err := restoreTable(tx, line); err != nil {
+					return fmt.Errorf("restore %s: %w", table, err)
+				}
+				// sqlite 的布尔列为 numeric，按数值导出，写入已有表的布尔列时转换
+				if exists {
+					types, err := tx.Migrator().ColumnTypes(table)
+					if err != nil {
+						return fmt.Errorf("restore %s: %w", table, err)
+					}
+					for _, ct := range types {
+						if col, ok := columns[ct.Name()]; ok && genericType(tx.Dialector.Name(), ct.DatabaseTypeName()) == "bool" {
+							col.Type = "bool"
+							columns[ct.Name()] = col
+						}
+					}
+				}
+			case "row":
+				data := map[string]any{}
+				for k, v := range line.Data {
+					val, err := restoreValue(columns[k].Type, v)
+					if err != nil {
+						return fmt.Errorf("restore %s.%s: %w", table, k, err)
+					}
+					data[k] = val
+				}
+				batch = append(batch, data)
+				if len(batch) >= 500 {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return flush()
+	}, 1)
+}
+
+// disableForeignKeys 暂停当前事务的外键检查，返回恢复检查的方法
+func disableForeignKeys(tx *gorm.DB) (func() error, error) {
+	none := func() error { return nil }
+	switch tx.Dialector.Name() {
+	case "sqlite":
+		// 事务中不能修改 foreign_keys，推迟到提交时检查，事务结束后自动恢复
+		return none, tx.Exec("PRAGMA defer_foreign_keys = ON").Error
+	case "mysql":
+		// 会话变量随连接归还连接池，结束时必须恢复
+		if err := tx.Exec("SET FOREIGN_KEY_CHECKS = 0").Error; err != nil {
+			return nil, err
+		}
+		return func() error { return tx.Exec("SET FOREIGN_KEY_CHECKS = 1").Error }, nil
+	case "postgres":
+		if err := tx.SavePoint("qdb_restore_fk").Error; err != nil {
+			return nil, err
+		}
+		if tx.Exec("SET LOCAL session_replication_role = replica").Error == nil {
+			return none, nil
+		}
+		if err := tx.RollbackTo("qdb_restore_fk").Error; err != nil {
+			return nil, err
+		}
+		return none, tx.Exec("SET CONSTRAINTS ALL DEFERRED").Error
+	case "sqlserver":
+		tables, err := tx.Migrator().GetTables()
+		if err != nil {
+			return nil, err
+		}
+		alter := func(action string) error {
+			for _, table := range tables {
+				if err := tx.Exec("ALTER TABLE ? "+action+" CONSTRAINT ALL", clause.Table{Name: table}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err = alter("NOCHECK"); err != nil {
+			return nil, err
+		}
+		// 恢复时校验已有数据
+		return func() error { return alter("WITH CHECK CHECK") }, nil
+	}
+	return none, nil
+}
+
+// restoreTable 创建或清空表
+func restoreTable(tx *gorm.DB, line snapshotLine) error {
+	if tx.Migrator().HasTable(line.Table) {
+		return tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Table(line.Table).Delete(map[string]any{}).Error
+	}
+	var defs, pks []string
+	for _, col := range line.Columns {
+		def := tx.Statement.Quote(col.Name) + " " + dialectType(tx.Dialector.Name(), col.Type, col.PrimaryKey)
+		if !col.Nullable || col.PrimaryKey {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+		if col.PrimaryKey {
+			pks = append(pks, tx.Statement.Quote(col.Name))
+		}
+	}
+	if len(pks) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(pks, ",")+")")
+	}
+	return tx.Exec("CREATE TABLE ? ("+strings.Join(defs, ",")+")", clause.Table{Name: line.Table}).Error
+}
+
+// genericType 将数据库列类型转换为通用类型，sqlite中布尔值使用numeric，无法与定点数区分，按数值处理
+func genericType(dialect string, dbType string) string {
+	t := strings.ToUpper(dbType)
+	switch {
+	case strings.Contains(t, "BOOL"), t == "BIT":
+		return "bool"
+	case strings.Contains(t, "INT"):
+		return "int"
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"),
+		strings.Contains(t, "DEC"), strings.Contains(t, "NUM"):
+		return "float"
+	case strings.Contains(t, "BLOB"), strings.Contains(t, "BINARY"), t == "BYTEA":
+		return "bytes"
+	case strings.Contains(t, "DATE"), strings.Contains(t, "TIME"):
+		return "time"
+	}
+	return "string"
+}
+
+// dialectType 将通用类型转换为指定数据库的列类型
+func dialectType(dialect string, typ string, primaryKey bool) string {
+	switch typ {
+	case "int":
+		if dialect == "sqlite" {
+			return "INTEGER"
+		}
+		return "BIGINT"
+	case "float":
+		switch dialect {
+		case "mysql":
+			return "DOUBLE"
+		case "sqlserver":
+			return "FLOAT"
+		}
+		return "DOUBLE PRECISION"
+	case "bytes":
+		switch dialect {
+		case "mysql":
+			return "LONGBLOB"
+		case "postgres":
+			return "BYTEA"
+		case "sqlserver":
+			return "VARBINARY(MAX)"
+		}
+		return "BLOB"
+	case "bool":
+		if dialect == "sqlserver" {
+			return "BIT"
+		}
+		return "BOOLEAN"
+	case "time":
+		switch dialect {
+		case "mysql":
+			return "DATETIME(3)"
+		case "sqlserver":
+			return "DATETIME2"
+		}
+		return "TIMESTAMP"
+	}
+	// 主键和索引列不能使用不定长文本
+	switch dialect {
+	case "mysql":
+		if primaryKey {
+			return "VARCHAR(191)"
+		}
+		return "LONGTEXT"
+	case "sqlserver":
+		if primaryKey {
+			return "NVARCHAR(256)"
+		}
+		return "NVARCHAR(MAX)"
+	}
+	return "TEXT"
+}
+
+// restoreValue 按通用类型转换JSON值
+func restoreValue(typ string, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	switch typ {
+	case "int":
+		if n, ok := v.(json.Number); ok {
+			if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+				return i, nil
+			}
+			return strconv.ParseUint(string(n), 10, 64)
+		}
+	case "float":
+		if n, ok := v.(json.Number); ok {
+			return n.Float64()
+		}
+	case "bool":
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			return f != 0, err
+		}
+	case "bytes":
+		if s, ok := v.(string); ok {
+			return base64.StdEncoding.DecodeString(s)
+		}
+	case "time":
+		if s, ok := v.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t, nil
+			}
+			return s, nil
+		}
+	}
+	if n, ok := v.(json.Number); ok {
+		return string(n), nil
+	}
+	return v, nil
+}
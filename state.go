@@ -0,0 +1,89 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StateField 状态字段，声明允许的状态转换，转换时以条件更新保证原子性，替代先查询、再判断、后修改的写法
+type StateField[T any, S comparable] struct {
+	dao         *Dao[T]
+	field       string
+	transitions map[S][]S
+}
+
+// NewStateField 创建状态字段
+//
+//	@param dao 模型的Dao
+//	@param field 状态字段，如 Status
+//	@param transitions 允许的转换，键为原状态，值为可转换到的状态，如 {"new": {"paid", "cancelled"}}
+//	@return *StateField[T, S]
+func NewStateField[T any, S comparable](dao *Dao[T], field string, transitions map[S][]S) *StateField[T, S] {
+	return &StateField[T, S]{dao: dao, field: field, transitions: transitions}
+}
+
+// Can 判断是否允许从原状态转换到新状态
+//
+//	@param from 原状态
+//	@param to 新状态
+//	@return bool
+func (s *StateField[T, S]) Can(from, to S) bool {
+	for _, next := range s.transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Next 返回原状态可转换到的状态
+//
+//	@param from 原状态
+//	@return []S
+func (s *StateField[T, S]) Next(from S) []S {
+	return s.transitions[from]
+}
+
+// Transition 将记录的状态从原状态改为新状态，仅当记录当前为原状态时修改，同时更新最后操作时间
+//
+//	@param id 唯一号
+//	@param from 原状态
+//	@param to 新状态
+//	@return error 未声明该转换或当前状态不是原状态时返回 ErrInvalidTransition，记录不存在返回 ErrUpdateNotExist
+func (s *StateField[T, S]) Transition(id uint64, from, to S) error {
+	if !s.Can(from, to) {
+		return fmt.Errorf("%w: %v -> %v", ErrInvalidTransition, from, to)
+	}
+	return s.dao.exec("Transition", OpUpdate, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		f := stmt.Schema.LookUpField(s.field)
+		if f == nil {
+			return fmt.Errorf("%s has no field %s", stmt.Schema.Name, s.field)
+		}
+		values := map[string]any{f.DBName: to}
+		if lt := stmt.Schema.LookUpField("LastTime"); lt != nil && lt.FieldType == dateTimeType {
+			values[lt.DBName] = dateTimeOf(now().Local())
+		}
+		idCol := fieldColumn(op.DB, new(T), "Id")
+		result := rowPolicy[T](op.DB).Model(new(T)).Where(clause.Eq{Column: idCol, Value: id}).
+			Where(clause.Eq{Column: clause.Column{Name: f.DBName}, Value: from}).Updates(values)
+		op.RowsAffected = result.RowsAffected
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		// 未修改时区分记录不存在和状态已变化
+		var current []S
+		err := rowPolicy[T](op.DB).Model(new(T)).Where(clause.Eq{Column: idCol, Value: id}).Limit(1).Pluck(f.DBName, &current).Error
+		if err != nil {
+			return err
+		}
+		if len(current) == 0 {
+			return ErrUpdateNotExist
+		}
+		return fmt.Errorf("%w: %v -> %v, current %v", ErrInvalidTransition, from, to, current[0])
+	})
+}
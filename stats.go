@@ -0,0 +1,231 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatementStats 语句执行统计
+type StatementStats struct {
+	Statement string        // 归一化后的语句，参数和字面量替换为 ?
+	Count     int64         // 执行次数
+	Errors    int64         // 失败次数
+	Total     time.Duration // 总耗时
+	Mean      time.Duration // 平均耗时
+	P95       time.Duration // 最近样本的95分位耗时
+	Rows      int64         // 影响或返回的总行数
+}
+
+// statEntry 单条语句的累计数据
+type statEntry struct {
+	stats   StatementStats
+	samples []time.Duration // 最近的耗时样本，环形写入
+	next    int
+}
+
+const statSamples = 256
+
+var (
+	statEntries = map[string]*statEntry{}
+	statLock    sync.Mutex
+	statRegexps = []struct {
+		re   *regexp.Regexp
+		repl string
+	}{
+		{regexp.MustCompile(`'(?:[^']|'')*'`), "?"},
+		{regexp.MustCompile(`\b\d+(?:\.\d+)?\b`), "?"},
+		{regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`), "(?+)"},
+		{regexp.MustCompile(`\s+`), " "},
+	}
+)
+
+// statsPlugin 统计语句执行情况
+type statsPlugin struct{}
+
+// Name 插件名称
+func (statsPlugin) Name() string {
+	return "qdb:stats"
+}
+
+// Initialize 注册回调
+func (statsPlugin) Initialize(db *gorm.DB) error {
+	before := func(db *gorm.DB) { db.InstanceSet("qdb:stats_start", time.Now()) }
+	after := func(db *gorm.DB) {
+		v, ok := db.InstanceGet("qdb:stats_start")
+		if !ok || db.Statement.SQL.Len() == 0 {
+			return
+		}
+		if _, skip := db.Get("qdb:skip_stats"); skip {
+			return
+		}
+		recordStatement(db.Statement.SQL.String(), time.Since(v.(time.Time)), db.RowsAffected, db.Error)
+	}
+	return registerAround(db, "qdb:stats", before, after)
+}
+
+// registerAround 在所有处理器的首尾注册回调
+func registerAround(db *gorm.DB, prefix string, before, after func(db *gorm.DB)) error {
+	cb := db.Callback()
+	processors := []struct {
+		name  string
+		start func(name string, fn func(*gorm.DB)) error
+		end   func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("*").Register, cb.Create().After("*").Register},
+		{"query", cb.Query().Before("*").Register, cb.Query().After("*").Register},
+		{"update", cb.Update().Before("*").Register, cb.Update().After("*").Register},
+		{"delete", cb.Delete().Before("*").Register, cb.Delete().After("*").Register},
+		{"row", cb.Row().Before("*").Register, cb.Row().After("*").Register},
+		{"raw", cb.Raw().Before("*").Register, cb.Raw().After("*").Register},
+	}
+	for _, p := range processors {
+		if err := p.start(prefix+"_before_"+p.name, before); err != nil {
+			return err
+		}
+		if err := p.end(prefix+"_after_"+p.name, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnableStats 开启语句执行统计，通过 StatsReport 查看
+//
+//	@param db 数据库连接
+//	@return error
+func EnableStats(db *gorm.DB) error {
+	if _, ok := db.Config.Plugins[statsPlugin{}.Name()]; ok {
+		return nil
+	}
+	return db.Use(statsPlugin{})
+}
+
+// normalizeStatement 将参数和字面量替换为 ?，合并IN列表
+func normalizeStatement(sql string) string {
+	for _, r := range statRegexps {
+		sql = r.re.ReplaceAllString(sql, r.repl)
+	}
+	return strings.TrimSpace(sql)
+}
+
+// recordStatement 累计一次执行
+func recordStatement(sql string, cost time.Duration, rows int64, err error) {
+	key := normalizeStatement(sql)
+	statLock.Lock()
+	defer statLock.Unlock()
+	e, ok := statEntries[key]
+	if !ok {
+		e = &statEntry{stats: StatementStats{Statement: key}}
+		statEntries[key] = e
+	}
+	e.stats.Count++
+	e.stats.Total += cost
+	if rows > 0 {
+		e.stats.Rows += rows
+	}
+	if err != nil {
+		e.stats.Errors++
+	}
+	if len(e.samples) < statSamples {
+		e.samples = append(e.samples, cost)
+	} else {
+		e.samples[e.next] = cost
+		e.next = (e.next + 1) % statSamples
+	}
+}
+
+// StatsReport 返回语句执行统计，按总耗时从高到低排序
+//
+//	@return []StatementStats
+func StatsReport() []StatementStats {
+	statLock.Lock()
+	list := make([]StatementStats, 0, len(statEntries))
+	for _, e := range statEntries {
+		st := e.stats
+		st.Mean = st.Total / time.Duration(st.Count)
+		samples := append([]time.Duration{}, e.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		st.P95 = samples[(len(samples)*95-1)/100]
+		list = append(list, st)
+	}
+	statLock.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Total > list[j].Total })
+	return list
+}
+
+// ResetStats 清空语句执行统计
+func ResetStats() {
+	statLock.Lock()
+	defer statLock.Unlock()
+	statEntries = map[string]*statEntry{}
+}
+
+// dbStats 统计表
+type dbStats struct {
+	Id        uint64         `gorm:"primaryKey"`
+	Time      qtime.DateTime `gorm:"index"` // 统计时间
+	Statement string         // 归一化后的语句
+	Count     int64          // 执行次数
+	Errors    int64          // 失败次数
+	TotalMs   float64        // 总耗时，毫秒
+	MeanMs    float64        // 平均耗时，毫秒
+	P95Ms     float64        // 95分位耗时，毫秒
+	Rows      int64          // 总行数
+}
+
+// TableName 表名
+func (dbStats) TableName() string {
+	return "qdb_stats"
+}
+
+// DumpStats 定时将统计中耗时最高的语句写入 qdb_stats 表，写入后清空统计
+//
+//	@param ctx 上下文，结束时停止
+//	@param db 数据库连接
+//	@param interval 写入间隔
+//	@param top 每次写入的语句数量，为0全部写入
+//	@return error
+func DumpStats(ctx context.Context, db *gorm.DB, interval time.Duration, top int) error {
+	if err := ensureTable(db, &dbStats{}); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			report := StatsReport()
+			ResetStats()
+			if top > 0 && len(report) > top {
+				report = report[:top]
+			}
+			if len(report) == 0 {
+				continue
+			}
+			ts := qtime.NewDateTime(now())
+			rows := make([]dbStats, 0, len(report))
+			for _, st := range report {
+				rows = append(rows, dbStats{Time: ts, Statement: st.Statement, Count: st.Count, Errors: st.Errors,
+					TotalMs: ms(st.Total), MeanMs: ms(st.Mean), P95Ms: ms(st.P95), Rows: st.Rows})
+			}
+			// 统计表自身的写入不计入统计
+			_ = db.Set("qdb:skip_stats", true).Create(&rows).Error
+		}
+	}()
+	return nil
+}
+
+// ms 转换为毫秒
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
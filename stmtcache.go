@@ -0,0 +1,92 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// 固定形式语句的缓存，值为以 ? 为参数占位的SQL，不可缓存时为空
+var stmtCache sync.Map
+
+// stmtKey 语句缓存键
+type stmtKey struct {
+	dialect string
+	table   string
+	model   reflect.Type
+	name    string
+}
+
+// cachedSQL 返回按唯一号查询或删除的缓存语句，避免每次构建子句，不满足缓存条件时返回空
+//
+//	有默认查询范围、行过滤策略、行数上限、分区、上下文标记、UTC插件、预设条件或删除钩子方法时不使用缓存；
+//	缓存的查询语句仍经过查询回调链执行
+func (dao *Dao[T]) cachedSQL(db *gorm.DB, name string) string {
+	if len(dao.opts.scopes) > 0 || dao.opts.maxRows > 0 || len(db.Statement.Clauses) > 0 || dao.opts.partition != nil {
+		return ""
+	}
+	ctx := db.Statement.Context
+	if unscoped, _ := ValueFrom[bool](ctx, KeyUnscoped); unscoped {
+		return ""
+	}
+	if deleted, _ := ValueFrom[bool](ctx, KeyIncludeDeleted); deleted {
+		return ""
+	}
+	if _, ok := db.Config.Plugins[utcPlugin{}.Name()]; ok {
+		return ""
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	policyLock.RLock()
+	policies := len(rowPolicies[typ])
+	policyLock.RUnlock()
+	if policies > 0 || watching(db, dao.table) {
+		return ""
+	}
+
+	key := stmtKey{dialect: db.Dialector.Name(), table: dao.table, model: typ, name: name}
+	if v, ok := stmtCache.Load(key); ok {
+		return v.(string)
+	}
+	sql := buildFixedSQL[T](db, name)
+	stmtCache.Store(key, sql)
+	return sql
+}
+
+// buildFixedSQL 以空运行方式构建语句，参数占位统一为 ?
+func buildFixedSQL[T any](db *gorm.DB, name string) string {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return ""
+	}
+	sch := stmt.Schema
+	dry := db.Session(&gorm.Session{DryRun: true, Logger: logger.Discard}).Set("qdb:skip_stats", true).Set("qdb:skip_slow_log", true)
+	var built *gorm.Statement
+	switch name {
+	case "GetModel":
+		built = dry.Where("id = ?", 0).Find(new(T)).Statement
+	case "Delete":
+		// 软删除需要写入当前时间，不缓存
+		if sch.BeforeDelete || sch.AfterDelete || len(sch.DeleteClauses) > 0 {
+			return ""
+		}
+		built = dry.Where("id = ?", 0).Delete(new(T)).Statement
+	default:
+		return ""
+	}
+	if len(built.Vars) != 1 {
+		return ""
+	}
+	sql := built.SQL.String()
+	switch db.Dialector.Name() {
+	case "postgres":
+		sql = strings.Replace(sql, "$1", "?", 1)
+	case "sqlserver":
+		sql = strings.Replace(sql, "@p1", "?", 1)
+	}
+	if strings.Count(sql, "?") != 1 {
+		return ""
+	}
+	return sql
+}
@@ -0,0 +1,55 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"sync/atomic"
+	"testing"
+)
+
+type cachedItem struct {
+	DbSimple
+	Name  string
+	Found bool `gorm:"-"`
+}
+
+// AfterFind 标记经过查询钩子
+func (m *cachedItem) AfterFind(tx *gorm.DB) error {
+	m.Found = true
+	return nil
+}
+
+func TestCachedGetModelRunsQueryCallbacks(t *testing.T) {
+	db := newTestDB(t)
+	dao, err := TryNewDao[cachedItem](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries atomic.Int32
+	err = db.Callback().Query().After("gorm:query").Register("test:count_query", func(tx *gorm.DB) {
+		queries.Add(1)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &cachedItem{Name: "a"}
+	if err = dao.Create(item); err != nil {
+		t.Fatal(err)
+	}
+	if dao.cachedSQL(db, "GetModel") == "" {
+		t.Fatal("GetModel not cached")
+	}
+	queries.Store(0)
+	got, err := dao.GetModel(item.Id)
+	if err != nil || got == nil || got.Name != "a" {
+		t.Fatal(got, err)
+	}
+	if !got.Found {
+		t.Error("AfterFind not called on cached GetModel")
+	}
+	if queries.Load() != 1 {
+		t.Errorf("query callbacks ran %d times, want 1", queries.Load())
+	}
+	if missing, err := dao.GetModel(item.Id + 1); err != nil || missing != nil {
+		t.Errorf("GetModel of missing id: %+v %v", missing, err)
+	}
+}
@@ -0,0 +1,185 @@
+package qdb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+)
+
+// 流式读写每条语句传输的字节数
+const blobChunk = 1 << 20
+
+// blobReader 按段读取二进制列
+type blobReader struct {
+	db     *gorm.DB
+	query  string
+	id     uint64
+	pos    int64
+	size   int64
+	buf    []byte
+	closed bool
+}
+
+// ReadBlob 流式读取二进制列，每次读取1MB，不将整列加载到内存
+//
+//	各段分别查询，读取期间该列被修改时内容可能不一致；Blob 字段的内容带有格式标记，应使用 Blob.Bytes 读取
+//
+//	@param id 唯一号
+//	@param column 字段名，如 Content
+//	@return io.ReadCloser, error 记录不存在时返回 ErrNotFound
+func (dao *Dao[T]) ReadBlob(id uint64, column string) (io.ReadCloser, error) {
+	var reader *blobReader
+	err := dao.exec("ReadBlob", OpRead, func(op *Operation) error {
+		col, err := blobColumn(op.DB, new(T), column)
+		if err != nil {
+			return err
+		}
+		var size sql.NullInt64
+		err = dao.query(op.DB).Model(new(T)).Select(blobLength(op.DB, col)).
+			Where(clause.Eq{Column: fieldColumn(op.DB, new(T), "Id"), Value: id}).Limit(1).Row().Scan(&size)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		substr := "SUBSTRING"
+		switch op.DB.Dialector.Name() {
+		case "postgres", "sqlite":
+			substr = "substr"
+		}
+		reader = &blobReader{
+			db: op.DB.Session(&gorm.Session{NewDB: true}),
+			query: fmt.Sprintf("SELECT %s(%s, ?, ?) FROM %s WHERE %s = ?", substr, col, op.DB.Statement.Quote(dao.table),
+				op.DB.Statement.Quote(fieldColumn(op.DB, new(T), "Id").Name)),
+			id:   id,
+			size: size.Int64,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Read 读取内容，缓冲区为空时查询下一段
+func (r *blobReader) Read(p []byte) (int, error) {
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(r.buf) == 0 {
+		if r.pos >= r.size {
+			return 0, io.EOF
+		}
+		var chunk []byte
+		if err := r.db.Raw(r.query, r.pos+1, blobChunk, r.id).Row().Scan(&chunk); err != nil {
+			return 0, err
+		}
+		if len(chunk) == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.pos += int64(len(chunk))
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close 关闭读取
+func (r *blobReader) Close() error {
+	r.closed, r.buf = true, nil
+	return nil
+}
+
+// WriteBlob 流式写入二进制列，每次写入1MB，全部写入在同一事务中完成
+//
+//	mysql 的 max_allowed_packet 需大于1MB
+//
+//	@param id 唯一号
+//	@param column 字段名，如 Content
+//	@param r 内容
+//	@return error 记录不存在或不在行过滤策略内时返回 ErrUpdateNotExist
+func (dao *Dao[T]) WriteBlob(id uint64, column string, r io.Reader) error {
+	return dao.exec("WriteBlob", OpUpdate, func(op *Operation) error {
+		col, err := blobColumn(op.DB, new(T), column)
+		if err != nil {
+			return err
+		}
+		name := fieldColumn(op.DB, new(T), column).Name
+		var appendExpr string
+		switch op.DB.Dialector.Name() {
+		case "mysql":
+			appendExpr = fmt.Sprintf("CONCAT(%s, ?)", col)
+		case "sqlserver":
+			appendExpr = fmt.Sprintf("%s + ?", col)
+		case "sqlite":
+			appendExpr = fmt.Sprintf("CAST(%s || ? AS BLOB)", col)
+		default:
+			appendExpr = fmt.Sprintf("%s || ?", col)
+		}
+		return trackedTx(op.DB, func(tx *gorm.DB) error {
+			// 按行过滤策略和默认查询范围确认记录存在，修改同样限定在策略内
+			byId := clause.Eq{Column: fieldColumn(tx, new(T), "Id"), Value: id}
+			var count int64
+			if err := dao.query(tx).Model(new(T)).Where(byId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrUpdateNotExist
+			}
+			buf := make([]byte, blobChunk)
+			for first := true; ; first = false {
+				n, err := io.ReadFull(r, buf)
+				if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+					return err
+				}
+				if n == 0 && !first {
+					return nil
+				}
+				var value any = buf[:n]
+				if !first {
+					value = gorm.Expr(appendExpr, buf[:n])
+				}
+				if err = rowPolicy[T](tx).Model(new(T)).Where(byId).UpdateColumn(name, value).Error; err != nil {
+					return err
+				}
+				op.RowsAffected = 1
+				if n < blobChunk {
+					return nil
+				}
+			}
+		}, 1)
+	})
+}
+
+// blobColumn 校验字段并返回带引号的列名
+func blobColumn(db *gorm.DB, model any, field string) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	f := stmt.Schema.LookUpField(field)
+	if f == nil || f.DBName == "" {
+		return "", fmt.Errorf("%s has no field %s", stmt.Schema.Name, field)
+	}
+	return db.Statement.Quote(f.DBName), nil
+}
+
+// blobLength 二进制列字节数的表达式
+func blobLength(db *gorm.DB, col string) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("octet_length(%s)", col)
+	case "sqlserver":
+		return fmt.Sprintf("DATALENGTH(%s)", col)
+	case "sqlite":
+		return fmt.Sprintf("length(CAST(%s AS BLOB))", col)
+	default:
+		return fmt.Sprintf("LENGTH(%s)", col)
+	}
+}
@@ -0,0 +1,66 @@
+package qdb
+
+// 以下方法在未查询到数据时返回 ErrNotFound，用于区分“不存在”和“查询失败”；
+// 对应的 GetModel、GetCondition 等方法在未查询到时返回 nil, nil
+
+// GetModelStrict 获取一条记录，不存在时返回 ErrNotFound
+//
+//	@param id 唯一号
+//	@return *T, error
+func (dao *Dao[T]) GetModelStrict(id uint64) (*T, error) {
+	return found(dao.GetModel(id))
+}
+
+// GetConditionStrict 条件查询一条记录，不存在时返回 ErrNotFound
+//
+//	@param query 条件，如 id = ? 或 id IN (?) 等
+//	@param args 条件参数，如 id, ids 等
+//	@return *T, error
+func (dao *Dao[T]) GetConditionStrict(query interface{}, args ...interface{}) (*T, error) {
+	return found(dao.GetCondition(query, args...))
+}
+
+// GetConditionOrderStrict 条件查询一条记录，不存在时返回 ErrNotFound
+//
+//	@param order 排序，如 id asc, time desc
+//	@param query 条件，如 id = ? 或 id IN (?) 等
+//	@param args 条件参数，如 id, ids 等
+//	@return *T, error
+func (dao *Dao[T]) GetConditionOrderStrict(order string, query interface{}, args ...interface{}) (*T, error) {
+	return found(dao.GetConditionOrder(order, query, args...))
+}
+
+// GetOneStrict 按查询选项获取一条记录，不存在时返回 ErrNotFound
+//
+//	@param opts 查询选项，如 qdb.Where("code = ?", code), qdb.Order("id desc")
+//	@return *T, error
+func (dao *Dao[T]) GetOneStrict(opts ...QueryOpt) (*T, error) {
+	return found(dao.GetOne(opts...))
+}
+
+// Exists 验证数据是否存在，查询失败时返回错误，CheckExist 会忽略错误
+//
+//	@param id 唯一号
+//	@return bool, error
+func (dao *Dao[T]) Exists(id uint64) (bool, error) {
+	exist := false
+	err := dao.exec("Exists", OpRead, func(op *Operation) error {
+		var count int64
+		result := dao.query(op.DB).Model(new(T)).Where("id = ?", id).Count(&count)
+		op.RowsAffected = result.RowsAffected
+		exist = count > 0
+		return result.Error
+	})
+	return exist, err
+}
+
+// found 将未查询到的结果转换为 ErrNotFound
+func found[T any](model *T, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, ErrNotFound
+	}
+	return model, nil
+}
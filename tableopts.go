@@ -0,0 +1,78 @@
+package qdb
+
+import (
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
+)
+
+// tableOptionsPlugin 保存配置中的mysql建表选项，通过插件表随连接传递
+type tableOptionsPlugin struct {
+	charset   string
+	collation string
+	engine    string
+}
+
+// Name 插件名称
+func (tableOptionsPlugin) Name() string {
+	return "qdb:table_options"
+}
+
+// Initialize 无需注册回调
+func (tableOptionsPlugin) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// migrateDB 返回建表使用的连接，mysql按配置和模型标签附加建表选项
+//
+//	模型可通过空白字段的 qdb 标签覆盖配置，如
+//
+//	_ struct{} `qdb:"charset:utf8mb4;collate:utf8mb4_0900_ai_ci;engine:InnoDB"`
+func migrateDB(db *gorm.DB, model any) *gorm.DB {
+	if db.Dialector.Name() != "mysql" {
+		return db
+	}
+	opts := tableOptionsPlugin{}
+	if p, ok := db.Config.Plugins[opts.Name()].(tableOptionsPlugin); ok {
+		opts = p
+	}
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		tag, ok := typ.Field(i).Tag.Lookup("qdb")
+		if !ok || typ.Field(i).Name != "_" {
+			continue
+		}
+		for _, item := range strings.Split(tag, ";") {
+			kv := strings.SplitN(item, ":", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(strings.TrimSpace(kv[0])) {
+			case "charset":
+				opts.charset = strings.TrimSpace(kv[1])
+			case "collate", "collation":
+				opts.collation = strings.TrimSpace(kv[1])
+			case "engine":
+				opts.engine = strings.TrimSpace(kv[1])
+			}
+		}
+	}
+
+	var parts []string
+	if opts.engine != "" {
+		parts = append(parts, "ENGINE="+opts.engine)
+	}
+	if opts.charset != "" {
+		parts = append(parts, "DEFAULT CHARSET="+opts.charset)
+	}
+	if opts.collation != "" {
+		parts = append(parts, "COLLATE="+opts.collation)
+	}
+	if len(parts) == 0 {
+		return db
+	}
+	return db.Set("gorm:table_options", strings.Join(parts, " "))
+}
@@ -0,0 +1,162 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var dateTimeType = reflect.TypeOf(qtime.DateTime(0))
+
+// UTCDateTime 将本地时间转换为UTC时间，用于UTC存储时构造查询条件
+//
+//	@param d 本地时间
+//	@return qtime.DateTime
+func UTCDateTime(d qtime.DateTime) qtime.DateTime {
+	if d == 0 {
+		return 0
+	}
+	return dateTimeOf(d.ToTime().UTC())
+}
+
+// LocalDateTime 将UTC时间转换为本地时间
+//
+//	@param d UTC时间
+//	@return qtime.DateTime
+func LocalDateTime(d qtime.DateTime) qtime.DateTime {
+	if d == 0 {
+		return 0
+	}
+	t := d.ToTime()
+	return qtime.NewDateTime(time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC))
+}
+
+// utcPlugin 以UTC存储 qtime.DateTime 字段，写入前转换为UTC，写入和查询后转换为本地时间
+//
+//	覆盖模型的 Create、Save、Updates（含 map 及 Update 单列）、Find/First 及 Dao 的查询方法；
+//	以下情况不转换：Raw/Exec 的参数和 Raw().Scan、Row、Rows/ScanRows 的结果，
+//	Where 条件中的时间（使用 UTCDateTime 转换），扫描到非模型类型（如自定义结构体、map）的结果
+type utcPlugin struct{}
+
+// Name 插件名称
+func (utcPlugin) Name() string {
+	return "qdb:utc"
+}
+
+// Initialize 注册回调
+func (p utcPlugin) Initialize(db *gorm.DB) error {
+	toUTC := func(db *gorm.DB) { convertDateTimes(db, UTCDateTime) }
+	toLocal := func(db *gorm.DB) { convertDateTimes(db, LocalDateTime) }
+	if err := db.Callback().Create().Before("gorm:create").Register("qdb:utc_before_create", toUTC); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("qdb:utc_after_create", toLocal); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("qdb:utc_before_update", toUTC); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("qdb:utc_after_update", toLocal); err != nil {
+		return err
+	}
+	return db.Callback().Query().After("gorm:query").Register("qdb:utc_after_query", toLocal)
+}
+
+// convertDateTimes 转换本次操作实体中所有 qtime.DateTime 字段
+func convertDateTimes(db *gorm.DB, fn func(d qtime.DateTime) qtime.DateTime) {
+	stmt := db.Statement
+	// Updates(map)、Update(列, 值) 的值在 Dest 中
+	if dest, ok := stmt.Dest.(map[string]any); ok {
+		for k, v := range dest {
+			if d, ok := v.(qtime.DateTime); ok {
+				dest[k] = fn(d)
+			}
+		}
+	}
+	if stmt.Schema == nil || !stmt.ReflectValue.IsValid() {
+		return
+	}
+	ctx := stmt.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	convertSchemaDateTimes(ctx, stmt.Schema, stmt.ReflectValue, fn)
+}
+
+// convertSchemaDateTimes 转换实体、实体指针或其切片中所有 qtime.DateTime 字段，类型与模型不一致的值跳过
+func convertSchemaDateTimes(ctx context.Context, sch *schema.Schema, value reflect.Value, fn func(d qtime.DateTime) qtime.DateTime) {
+	var fields []int
+	for i, field := range sch.Fields {
+		if field.FieldType == dateTimeType {
+			fields = append(fields, i)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+
+	convert := func(rv reflect.Value) {
+		for rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct || rv.Type() != sch.ModelType {
+			return
+		}
+		for _, i := range fields {
+			field := sch.Fields[i]
+			if v, zero := field.ValueOf(ctx, rv); !zero {
+				_ = field.Set(ctx, rv, fn(v.(qtime.DateTime)))
+			}
+		}
+	}
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			convert(value.Index(i))
+		}
+	default:
+		convert(value)
+	}
+}
+
+// utcDSN 为连接串设置UTC时区，mysql使用 parseTime、loc，postgres使用 TimeZone
+func utcDSN(dbType string, dsn string) string {
+	switch dbType {
+	case "mysql":
+		base, query := dsn, ""
+		if i := strings.LastIndex(dsn, "?"); i >= 0 {
+			base, query = dsn[:i], dsn[i+1:]
+		}
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return dsn
+		}
+		values.Set("parseTime", "True")
+		values.Set("loc", "UTC")
+		return base + "?" + values.Encode()
+	case "postgres":
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			u, err := url.Parse(dsn)
+			if err != nil {
+				return dsn
+			}
+			values := u.Query()
+			values.Set("TimeZone", "UTC")
+			u.RawQuery = values.Encode()
+			return u.String()
+		}
+		if strings.Contains(dsn, "TimeZone=") {
+			return dsn
+		}
+		return dsn + " TimeZone=UTC"
+	}
+	return dsn
+}
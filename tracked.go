@@ -0,0 +1,56 @@
+package qdb
+
+import (
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+)
+
+// GetCreatedBetween 查询创建时间在指定范围内的列表，模型需包含 CreatedTime 字段，如嵌入 DbTracked
+//
+//	@param start 开始时间（包含），为0不限制
+//	@param end 结束时间（包含），为0不限制
+//	@return []*T, error
+func (dao *Dao[T]) GetCreatedBetween(start, end qtime.DateTime) ([]*T, error) {
+	return dao.getBetween("GetCreatedBetween", "CreatedTime", start, end)
+}
+
+// GetUpdatedBetween 查询最后操作时间在指定范围内的列表
+//
+//	@param start 开始时间（包含），为0不限制
+//	@param end 结束时间（包含），为0不限制
+//	@return []*T, error
+func (dao *Dao[T]) GetUpdatedBetween(start, end qtime.DateTime) ([]*T, error) {
+	return dao.getBetween("GetUpdatedBetween", "LastTime", start, end)
+}
+
+// getBetween 按时间字段范围查询，列名由命名策略生成，UTC存储时条件自动转换，声明分区时附加分区条件
+func (dao *Dao[T]) getBetween(name string, field string, start, end qtime.DateTime) ([]*T, error) {
+	list := make([]*T, 0)
+	d := dao.betweenPartitions(field, start, end)
+	err := d.exec(name, OpRead, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			return fmt.Errorf("%s has no field %s", stmt.Schema.Name, field)
+		}
+		if _, ok := op.DB.Config.Plugins[utcPlugin{}.Name()]; ok {
+			start, end = UTCDateTime(start), UTCDateTime(end)
+		}
+
+		db := d.list(op.DB)
+		if start > 0 {
+			db = db.Where(fmt.Sprintf("%s >= ?", stmt.Quote(f.DBName)), start)
+		}
+		if end > 0 {
+			db = db.Where(fmt.Sprintf("%s <= ?", stmt.Quote(f.DBName)), end)
+		}
+		result := db.Find(&list)
+		op.RowsAffected = result.RowsAffected
+		return result.Error
+	})
+	return list, err
+}
@@ -0,0 +1,217 @@
+package qdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mysqlDriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 隧道注册序号，用于生成mysql自定义网络名
+var tunnelSeq int32
+
+// sshTunnel SSH隧道，SSH连接断开后在下一次拨号时自动重连
+type sshTunnel struct {
+	cfg    settingSSH
+	client *ssh.Client
+	jump   *ssh.Client
+	lock   sync.Mutex
+}
+
+// newSSHTunnel 创建SSH隧道并立即建立连接
+func newSSHTunnel(cfg settingSSH) (*sshTunnel, error) {
+	t := &sshTunnel{cfg: cfg}
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// clientConfig 生成SSH认证配置
+func (t *sshTunnel) clientConfig(user string) (*ssh.ClientConfig, error) {
+	auths := make([]ssh.AuthMethod, 0)
+	if t.cfg.KeyFile != "" {
+		key, err := os.ReadFile(t.cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var signer ssh.Signer
+		if t.cfg.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(t.cfg.Password))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+	if t.cfg.Password != "" {
+		auths = append(auths, ssh.Password(t.cfg.Password))
+	}
+	if len(auths) == 0 {
+		return nil, errors.New("ssh tunnel requires Password or KeyFile")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case t.cfg.KnownHosts != "":
+		callback, err := knownhosts.New(t.cfg.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		hostKey = callback
+	case t.cfg.InsecureSkipHostKey:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, errors.New("ssh tunnel requires KnownHosts, or InsecureSkipHostKey to disable host key verification")
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auths,
+		HostKeyCallback: hostKey,
+		Timeout:         10 * time.Second,
+	}, nil
+}
+
+// connect 建立SSH连接，配置了跳板机时先连接跳板机再转发到目标SSH服务器
+func (t *sshTunnel) connect() error {
+	target, err := t.clientConfig(t.cfg.User)
+	if err != nil {
+		return err
+	}
+	if t.cfg.JumpHost == "" {
+		client, err := ssh.Dial("tcp", t.cfg.Host, target)
+		if err != nil {
+			return err
+		}
+		t.client = client
+		return nil
+	}
+
+	// 跳板机格式：用户名@地址:端口，用户名缺省时与目标一致
+	jumpUser, jumpAddr := t.cfg.User, t.cfg.JumpHost
+	if i := strings.LastIndex(jumpAddr, "@"); i >= 0 {
+		jumpUser, jumpAddr = jumpAddr[:i], jumpAddr[i+1:]
+	}
+	jumpCfg, err := t.clientConfig(jumpUser)
+	if err != nil {
+		return err
+	}
+	jump, err := ssh.Dial("tcp", jumpAddr, jumpCfg)
+	if err != nil {
+		return err
+	}
+	conn, err := jump.Dial("tcp", t.cfg.Host)
+	if err != nil {
+		_ = jump.Close()
+		return err
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, t.cfg.Host, target)
+	if err != nil {
+		_ = conn.Close()
+		_ = jump.Close()
+		return err
+	}
+	t.jump = jump
+	t.client = ssh.NewClient(c, chans, reqs)
+	return nil
+}
+
+// close 关闭当前SSH连接
+func (t *sshTunnel) close() {
+	if t.client != nil {
+		_ = t.client.Close()
+		t.client = nil
+	}
+	if t.jump != nil {
+		_ = t.jump.Close()
+		t.jump = nil
+	}
+}
+
+// DialContext 通过隧道连接数据库地址，拨号在锁外进行
+//
+//	拨号失败时发送 keepalive 检查SSH连接，仍可用时直接返回错误（如数据库未启动），
+//	已断开时重建SSH连接后重试一次
+func (t *sshTunnel) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := t.current(nil)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.DialContext(ctx, network, addr)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	if _, _, kaErr := client.SendRequest("keepalive@openssh.com", true, nil); kaErr == nil {
+		return nil, err
+	}
+	if client, err = t.current(client); err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, network, addr)
+}
+
+// current 返回可用的SSH连接，dead 不为空且仍是当前连接时关闭并重连，已被其他拨号重连时直接使用新连接
+func (t *sshTunnel) current(dead *ssh.Client) (*ssh.Client, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.client != nil && t.client != dead {
+		return t.client, nil
+	}
+	t.close()
+	if err := t.connect(); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+// openTunnelDialector 根据数据库类型创建经过SSH隧道的驱动
+func openTunnelDialector(dbType string, dsn string, cfg settingSSH) (gorm.Dialector, error) {
+	tunnel, err := newSSHTunnel(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch dbType {
+	case "mysql":
+		dc, err := mysqlDriver.ParseDSN(dsn)
+		if err != nil {
+			tunnel.close()
+			return nil, err
+		}
+		// 注册自定义网络，驱动通过该网络名拨号，保留原网络类型以支持远端的 unix 套接字
+		network := dc.Net
+		if network == "" {
+			network = "tcp"
+		}
+		netName := fmt.Sprintf("qdb-ssh-%d", atomic.AddInt32(&tunnelSeq, 1))
+		mysqlDriver.RegisterDialContext(netName, func(ctx context.Context, addr string) (net.Conn, error) {
+			return tunnel.DialContext(ctx, network, addr)
+		})
+		dc.Net = netName
+		return mysql.Open(dc.FormatDSN()), nil
+	case "postgres":
+		pc, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			tunnel.close()
+			return nil, err
+		}
+		pc.DialFunc = tunnel.DialContext
+		return postgres.New(postgres.Config{Conn: stdlib.OpenDB(*pc)}), nil
+	}
+	tunnel.close()
+	return nil, fmt.Errorf("ssh tunnel not supported for %s", dbType)
+}
@@ -0,0 +1,195 @@
+package qdb
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TxInfo 执行中的事务
+type TxInfo struct {
+	ID     uint64        // 事务序号
+	Caller string        // 开启事务的调用位置，如 order.go:42
+	Start  time.Time     // 开始时间
+	Cost   time.Duration // 已开启时长
+}
+
+var (
+	openTxs sync.Map
+	txSeq   uint64
+)
+
+// Transaction 在事务中执行，返回错误时回滚，事务会被 WatchTransactions 监控
+//
+//	@param db 数据库连接
+//	@param fn 事务方法
+//	@return error
+func Transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return trackedTx(db, fn, 2)
+}
+
+// InTx 在事务中执行并返回结果，返回错误时回滚
+//
+//	@param db 数据库连接
+//	@param fn 事务方法
+//	@return R, error
+func InTx[R any](db *gorm.DB, fn func(tx *gorm.DB) (R, error)) (R, error) {
+	var result R
+	err := trackedTx(db, func(tx *gorm.DB) error {
+		r, err := fn(tx)
+		if err != nil {
+			return err
+		}
+		result = r
+		return nil
+	}, 2)
+	return result, err
+}
+
+// 保存点名称
+var savepointRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Savepoint 在事务中创建保存点，之后可通过 RollbackTo 回滚到该位置而不影响之前的写入
+//
+//	@param tx 事务连接
+//	@param name 保存点名称，仅允许字母、数字和下划线且不以数字开头
+//	@return error
+func Savepoint(tx *gorm.DB, name string) error {
+	if err := checkSavepoint(tx, name); err != nil {
+		return err
+	}
+	return tx.SavePoint(name).Error
+}
+
+// RollbackTo 回滚到指定保存点，事务继续有效
+//
+//	@param tx 事务连接
+//	@param name 保存点名称
+//	@return error
+func RollbackTo(tx *gorm.DB, name string) error {
+	if err := checkSavepoint(tx, name); err != nil {
+		return err
+	}
+	return tx.RollbackTo(name).Error
+}
+
+// ReleaseSavepoint 释放保存点，sqlserver不支持释放，直接返回
+//
+//	@param tx 事务连接
+//	@param name 保存点名称
+//	@return error
+func ReleaseSavepoint(tx *gorm.DB, name string) error {
+	if err := checkSavepoint(tx, name); err != nil {
+		return err
+	}
+	if tx.Dialector.Name() == "sqlserver" {
+		return nil
+	}
+	return tx.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+// checkSavepoint 校验保存点名称及连接是否处于事务中
+func checkSavepoint(tx *gorm.DB, name string) error {
+	if !savepointRegex.MatchString(name) {
+		return fmt.Errorf("qdb: invalid savepoint name %q", name)
+	}
+	if _, ok := tx.Statement.ConnPool.(gorm.TxCommitter); !ok {
+		return fmt.Errorf("qdb: savepoint %s requires a transaction", name)
+	}
+	return nil
+}
+
+// trackedTx 执行事务并记录开启位置，skip 同 runtime.Caller，qdb 内部开启的事务传入1记录调用处
+func trackedTx(db *gorm.DB, fn func(tx *gorm.DB) error, skip int) error {
+	defer trackTx(skip)()
+	return db.Transaction(fn)
+}
+
+// trackTx 记录开启的事务，返回事务结束时调用的方法，用于 Begin 手动开启的事务，skip 按调用 trackTx 的方法计
+func trackTx(skip int) func() {
+	caller := "unknown"
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		caller = fmt.Sprintf("%s:%d", file, line)
+	}
+	id := atomic.AddUint64(&txSeq, 1)
+	openTxs.Store(id, &TxInfo{ID: id, Caller: caller, Start: time.Now()})
+	return func() {
+		openTxs.Delete(id)
+	}
+}
+
+// OpenTransactions 返回通过 Transaction、InTx 及 qdb 内部开启且未结束的事务，按开启时长从长到短排序
+//
+//	@return []TxInfo
+func OpenTransactions() []TxInfo {
+	list := make([]TxInfo, 0)
+	openTxs.Range(func(_, v any) bool {
+		tx := *v.(*TxInfo)
+		tx.Cost = time.Since(tx.Start)
+		list = append(list, tx)
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Cost > list[j].Cost })
+	return list
+}
+
+// TxWatchOptions 长事务监控选项
+type TxWatchOptions struct {
+	Threshold time.Duration                    // 事务开启时长阈值，为0使用30秒
+	Interval  time.Duration                    // 检查间隔，为0使用阈值的一半
+	OnLong    func(tx TxInfo)                  // 发现长事务时回调，用于上报指标，每个事务只回调一次
+	Logf      func(format string, args ...any) // 日志方法，为空使用 log.Printf
+}
+
+// WatchTransactions 监控长事务，事务开启时长超过阈值时输出日志和开启位置
+//
+//	@param ctx 上下文，结束时停止
+//	@param opts 监控选项
+func WatchTransactions(ctx context.Context, opts TxWatchOptions) {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 30 * time.Second
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = opts.Threshold / 2
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	go func() {
+		reported := map[uint64]bool{}
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			open := map[uint64]bool{}
+			for _, tx := range OpenTransactions() {
+				open[tx.ID] = true
+				if tx.Cost < opts.Threshold || reported[tx.ID] {
+					continue
+				}
+				reported[tx.ID] = true
+				opts.Logf("qdb: transaction open for %s, started at %s", tx.Cost, tx.Caller)
+				if opts.OnLong != nil {
+					opts.OnLong(tx)
+				}
+			}
+			// 清理已结束的事务
+			for id := range reported {
+				if !open[id] {
+					delete(reported, id)
+				}
+			}
+		}
+	}()
+}
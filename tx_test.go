@@ -0,0 +1,66 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"strings"
+	"testing"
+)
+
+type txItem struct {
+	DbSimple
+	Name string
+}
+
+// txCallers 返回执行中事务的开启位置
+func txCallers() []string {
+	var callers []string
+	for _, tx := range OpenTransactions() {
+		callers = append(callers, tx.Caller)
+	}
+	return callers
+}
+
+func TestInternalTransactionsTracked(t *testing.T) {
+	db := newTestDB(t)
+	dao, err := TryNewDao[txItem](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	err = db.Callback().Create().Before("gorm:create").Register("test:open_txs", func(tx *gorm.DB) {
+		seen = txCallers()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dao.CreateList([]txItem{{Name: "a"}, {Name: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || !strings.Contains(seen[0], "database.go") {
+		t.Errorf("CreateList transaction not tracked: %v", seen)
+	}
+
+	other, err := TryNewDao[txItem](newTestDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = other.DB().Callback().Create().Before("gorm:create").Register("test:open_txs", func(tx *gorm.DB) {
+		seen = txCallers()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DualWrite(context.Background(),
+		DualStep{DB: dao.DB(), Write: func(tx *gorm.DB) error { return tx.Create(&txItem{Name: "first"}).Error }},
+		DualStep{DB: other.DB(), Write: func(tx *gorm.DB) error { return tx.Create(&txItem{Name: "second"}).Error }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 2 || !strings.Contains(seen[0], "dualwrite.go") {
+		t.Errorf("DualWrite transactions not tracked: %v", seen)
+	}
+	if open := txCallers(); len(open) != 0 {
+		t.Errorf("transactions left open: %v", open)
+	}
+}
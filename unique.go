@@ -0,0 +1,72 @@
+package qdb
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+	"strings"
+)
+
+// ConflictError 唯一性校验失败，列出与其他记录重复的列
+type ConflictError struct {
+	Table   string   // 表名
+	Columns []string // 重复的字段名
+}
+
+// Error 错误信息
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s duplicated in %s", ErrUniqueConflict.Error(), strings.Join(e.Columns, ", "), e.Table)
+}
+
+// Unwrap 可通过 errors.Is(err, ErrUniqueConflict) 判断
+func (e *ConflictError) Unwrap() error {
+	return ErrUniqueConflict
+}
+
+// CheckUnique 新增或修改前校验指定列的值未被其他记录使用（排除自身唯一号），各列分别校验
+//
+//	@param model 待保存实体
+//	@param columns 字段名或列名，如 Code、Phone
+//	@return error 存在重复时返回 *ConflictError，可通过 errors.As 取得重复的列
+func (dao *Dao[T]) CheckUnique(model *T, columns ...string) error {
+	var conflict []string
+	err := dao.exec("CheckUnique", OpRead, func(op *Operation) error {
+		stmt := &gorm.Statement{DB: op.DB}
+		if err := stmt.Parse(new(T)); err != nil {
+			return err
+		}
+		value := reflect.ValueOf(model).Elem()
+		var id any
+		if pk := stmt.Schema.PrioritizedPrimaryField; pk != nil {
+			if v, zero := pk.ValueOf(op.Context(), value); !zero {
+				id = v
+			}
+		}
+		for _, column := range columns {
+			field := stmt.Schema.LookUpField(column)
+			if field == nil || field.DBName == "" {
+				return fmt.Errorf("qdb: unknown column %s in %s", column, dao.table)
+			}
+			v, _ := field.ValueOf(op.Context(), value)
+			db := dao.query(op.DB).Model(new(T)).Where(map[string]any{field.DBName: v})
+			if id != nil {
+				db = db.Not(map[string]any{stmt.Schema.PrioritizedPrimaryField.DBName: id})
+			}
+			var count int64
+			if err := db.Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				conflict = append(conflict, field.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(conflict) > 0 {
+		return &ConflictError{Table: dao.table, Columns: conflict}
+	}
+	return nil
+}
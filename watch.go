@@ -0,0 +1,474 @@
+package qdb
+
+import (
+	"context"
+	"fmt"
+	"github.com/kamioair/utils/qtime"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ChangeOp 变化类型
+type ChangeOp uint8
+
+const (
+	ChangeCreate ChangeOp = iota + 1 // 新建
+	ChangeUpdate                     // 修改
+	ChangeDelete                     // 删除
+)
+
+// String 变化类型名称
+func (o ChangeOp) String() string {
+	switch o {
+	case ChangeCreate:
+		return "create"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// ChangeEvent 记录变化事件
+type ChangeEvent[T any] struct {
+	Op       ChangeOp  // 变化类型
+	Id       uint64    // 唯一号，为0表示按条件批量变化或事件积压，需重新加载
+	Model    *T        // 变化后的记录，删除或批量变化时为nil
+	Local    bool      // 是否本进程的写入，为false时由轮询发现
+	Overflow bool      // 接收过慢，之前的事件被丢弃，Id 为0
+	Time     time.Time // 发现时间
+}
+
+// WithWatchPoll 设置 Watch 的轮询间隔，按 LastTime 轮询以发现其他进程的新建和修改，其他进程的删除无法发现
+//
+//	设置后该Dao的 Update、UpdateAll、Save 等修改总是将 LastTime 写为当前时间，其他进程的写入方也需设置，
+//	否则修改已有 LastTime 的记录时不会更新该字段，轮询无法发现
+//
+//	@param interval 轮询间隔，为0只通知本进程的写入
+//	@return DaoOption
+func WithWatchPoll(interval time.Duration) DaoOption {
+	return func(opts *daoOptions) {
+		opts.watchPoll = interval
+	}
+}
+
+// touchUpdate 修改前更新最后操作时间和操作人，设置了轮询时先清空最后操作时间，使其总是写入当前时间
+func (dao *Dao[T]) touchUpdate(ctx context.Context, model *T, ts time.Time) {
+	if dao.opts.watchPoll > 0 {
+		if rv := reflect.ValueOf(model).Elem(); rv.Kind() == reflect.Struct {
+			if index, ok := lastTimeIndex(rv.Type()); ok {
+				rv.FieldByIndex(index).SetUint(0)
+			}
+		}
+	}
+	touch(ctx, model, ts)
+}
+
+// watchKey 按连接和表区分订阅，会话可能复制配置，以共享的钩子集合区分连接
+type watchKey struct {
+	callbacks any
+	table     string
+}
+
+// watchSignal 本进程写入的通知
+type watchSignal struct {
+	op  ChangeOp
+	ids []uint64 // 为空表示按条件批量变化
+}
+
+// watcher 单个订阅
+type watcher struct {
+	signals  chan watchSignal
+	overflow atomic.Bool // 通知积压被丢弃
+}
+
+var (
+	watchers  = map[watchKey]map[*watcher]struct{}{}
+	watchLock sync.RWMutex
+)
+
+// Watch 订阅符合条件的记录的新建、修改、删除事件，用于实时刷新的看板等
+//
+//	本进程通过 gorm 写入的变化由钩子立即通知，新建、修改后按条件重新查询，不再符合条件的记录不通知；
+//	删除无法判断原记录是否符合条件，均通知。事务中的写入在语句执行时通知，不等待提交。
+//	使用 WithWatchPoll 时另按 LastTime 轮询发现其他进程的写入。接收过慢导致积压时丢弃通知，
+//	并发送一个唯一号为0的事件提示重新加载。上下文结束后关闭通道
+//
+//	@param ctx 上下文
+//	@param query 条件，如 Status = ?，为nil订阅全部
+//	@param args 条件参数
+//	@return <-chan ChangeEvent[T], error
+func (dao *Dao[T]) Watch(ctx context.Context, query any, args ...any) (<-chan ChangeEvent[T], error) {
+	db := dao.db.WithContext(ctx)
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil, fmt.Errorf("%s has no primary key", stmt.Schema.Name)
+	}
+	last := stmt.Schema.LookUpField("LastTime")
+	if dao.opts.watchPoll > 0 && (last == nil || last.FieldType != dateTimeType) {
+		return nil, fmt.Errorf("%s has no LastTime field for polling", stmt.Schema.Name)
+	}
+
+	w := &watcher{signals: make(chan watchSignal, 256)}
+	key := watchKey{callbacks: db.Callback(), table: dao.table}
+	watchLock.Lock()
+	if watchers[key] == nil {
+		watchers[key] = map[*watcher]struct{}{}
+	}
+	watchers[key][w] = struct{}{}
+	watchLock.Unlock()
+
+	out := make(chan ChangeEvent[T], 64)
+	s := &watchSession[T]{dao: dao, db: db, pk: pk, last: last, created: stmt.Schema.LookUpField("CreatedTime"),
+		query: query, args: args, out: out, seen: map[uint64]qtime.DateTime{}}
+	go func() {
+		defer close(out)
+		defer func() {
+			watchLock.Lock()
+			delete(watchers[key], w)
+			if len(watchers[key]) == 0 {
+				delete(watchers, key)
+			}
+			watchLock.Unlock()
+		}()
+		var tick <-chan time.Time
+		if dao.opts.watchPoll > 0 {
+			ticker := time.NewTicker(dao.opts.watchPoll)
+			defer ticker.Stop()
+			tick = ticker.C
+			s.since = qtime.NewDateTime(now())
+		}
+		for {
+			ok := true
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-w.signals:
+				ok = s.signal(ctx, sig)
+			case <-tick:
+				ok = s.poll(ctx)
+			}
+			if ok && w.overflow.Swap(false) {
+				ok = s.send(ctx, ChangeEvent[T]{Op: ChangeUpdate, Local: true, Overflow: true, Time: now()})
+			}
+			if !ok {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// watchSession 单个订阅的处理状态
+type watchSession[T any] struct {
+	dao     *Dao[T]
+	db      *gorm.DB
+	pk      *schema.Field
+	last    *schema.Field // 最后操作时间，轮询时使用
+	created *schema.Field // 创建时间，轮询时区分新建和修改，可为nil
+	query   any
+	args    []any
+	out     chan ChangeEvent[T]
+	since   qtime.DateTime            // 轮询的起始时间
+	seen    map[uint64]qtime.DateTime // 已通知的记录及其最后操作时间，避免轮询重复通知
+}
+
+// send 发送事件，上下文结束时返回false
+func (s *watchSession[T]) send(ctx context.Context, ev ChangeEvent[T]) bool {
+	select {
+	case s.out <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// find 按条件查询
+func (s *watchSession[T]) find(db *gorm.DB) ([]*T, error) {
+	list := make([]*T, 0)
+	db = s.dao.query(db.Set("qdb:skip_stats", true).Set("qdb:skip_slow_log", true))
+	if s.query != nil {
+		db = db.Where(s.query, s.args...)
+	}
+	return list, db.Find(&list).Error
+}
+
+// signal 处理本进程写入的通知
+func (s *watchSession[T]) signal(ctx context.Context, sig watchSignal) bool {
+	if len(sig.ids) == 0 {
+		return s.send(ctx, ChangeEvent[T]{Op: sig.op, Local: true, Time: now()})
+	}
+	if sig.op == ChangeDelete {
+		for _, id := range sig.ids {
+			delete(s.seen, id)
+			if !s.send(ctx, ChangeEvent[T]{Op: sig.op, Id: id, Local: true, Time: now()}) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, chunk := range chunkIds(sig.ids) {
+		list, err := s.find(s.db.Where(clause.IN{Column: clause.Column{Name: s.pk.DBName}, Values: toAny(chunk)}))
+		if err != nil {
+			// 查询失败时提示重新加载
+			return s.send(ctx, ChangeEvent[T]{Op: sig.op, Local: true, Time: now()})
+		}
+		for _, model := range list {
+			id, last := s.values(ctx, model)
+			if s.last != nil {
+				s.seen[id] = last
+			}
+			if !s.send(ctx, ChangeEvent[T]{Op: sig.op, Id: id, Model: model, Local: true, Time: now()}) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// poll 查询最后操作时间不早于上次轮询的记录，通知未通知过的变化
+func (s *watchSession[T]) poll(ctx context.Context) bool {
+	since := s.since
+	if _, ok := s.db.Config.Plugins[utcPlugin{}.Name()]; ok {
+		since = UTCDateTime(since)
+	}
+	list, err := s.find(s.db.Where(clause.Gte{Column: clause.Column{Name: s.last.DBName}, Value: since}))
+	if err != nil {
+		return true
+	}
+	maxLast := s.since
+	for _, model := range list {
+		id, last := s.values(ctx, model)
+		if last > maxLast {
+			maxLast = last
+		}
+		if seen, ok := s.seen[id]; ok && seen >= last {
+			continue
+		}
+		s.seen[id] = last
+		op := ChangeUpdate
+		if s.created != nil {
+			if v, _ := s.created.ValueOf(ctx, reflect.ValueOf(model).Elem()); v == last {
+				op = ChangeCreate
+			}
+		}
+		if !s.send(ctx, ChangeEvent[T]{Op: op, Id: id, Model: model, Time: now()}) {
+			return false
+		}
+	}
+	// 只保留与新起始时间相同的记录，其余不会再被查询到
+	s.since = maxLast
+	for id, last := range s.seen {
+		if last < maxLast {
+			delete(s.seen, id)
+		}
+	}
+	return true
+}
+
+// values 返回记录的唯一号和最后操作时间
+func (s *watchSession[T]) values(ctx context.Context, model *T) (uint64, qtime.DateTime) {
+	rv := reflect.ValueOf(model).Elem()
+	v, _ := s.pk.ValueOf(ctx, rv)
+	id, _ := toUint64(v)
+	var last qtime.DateTime
+	if s.last != nil {
+		if v, _ = s.last.ValueOf(ctx, rv); v != nil {
+			last, _ = v.(qtime.DateTime)
+		}
+	}
+	return id, last
+}
+
+// registerWatch 在连接上注册写入后的通知钩子，已注册时跳过
+//
+//	注册回调与执行中的写入存在数据竞争，只在创建连接和 TryNewDao 时调用，无订阅时钩子直接返回
+func registerWatch(db *gorm.DB) error {
+	watchLock.Lock()
+	defer watchLock.Unlock()
+	cb := db.Callback()
+	if cb.Create().Get("qdb:watch_create") != nil {
+		return nil
+	}
+	if err := cb.Create().After("gorm:create").Register("qdb:watch_create", watchNotify(ChangeCreate)); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("qdb:watch_update", watchNotify(ChangeUpdate)); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Register("qdb:watch_delete", watchNotify(ChangeDelete))
+}
+
+// watching 表是否有订阅，有订阅时不使用缓存语句，以便钩子取得唯一号
+func watching(db *gorm.DB, table string) bool {
+	watchLock.RLock()
+	defer watchLock.RUnlock()
+	return len(watchers[watchKey{callbacks: db.Callback(), table: table}]) > 0
+}
+
+// watchNotify 返回写入后通知订阅的钩子，不阻塞写入
+func watchNotify(op ChangeOp) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil || db.RowsAffected == 0 || db.Statement.Schema == nil {
+			return
+		}
+		watchLock.RLock()
+		defer watchLock.RUnlock()
+		subs := watchers[watchKey{callbacks: db.Callback(), table: db.Statement.Table}]
+		if len(subs) == 0 {
+			return
+		}
+		sig := watchSignal{op: op, ids: changedIds(db.Statement)}
+		for w := range subs {
+			select {
+			case w.signals <- sig:
+			default:
+				w.overflow.Store(true)
+			}
+		}
+	}
+}
+
+// changedIds 从语句的模型或唯一号条件中取得变化的唯一号，无法确定时返回nil
+func changedIds(stmt *gorm.Statement) []uint64 {
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return nil
+	}
+	ids := make([]uint64, 0)
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Struct:
+		if v, zero := pk.ValueOf(stmt.Context, rv); !zero {
+			if id, ok := toUint64(v); ok {
+				ids = append(ids, id)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if elem.Kind() != reflect.Struct {
+				continue
+			}
+			if v, zero := pk.ValueOf(stmt.Context, elem); !zero {
+				if id, ok := toUint64(v); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	if len(ids) > 0 {
+		return ids
+	}
+	// 按唯一号条件修改、删除，如 Where("id = ?", id)
+	where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok || len(where.Exprs) != 1 {
+		return nil
+	}
+	var values []any
+	switch e := where.Exprs[0].(type) {
+	case clause.Eq:
+		if watchIsPk(e.Column, pk) {
+			values = []any{e.Value}
+		}
+	case clause.IN:
+		if watchIsPk(e.Column, pk) {
+			values = e.Values
+		}
+	case clause.Expr:
+		sql := strings.ToLower(strings.Join(strings.Fields(e.SQL), " "))
+		name := strings.ToLower(pk.DBName)
+		if len(e.Vars) == 1 && (sql == name+" = ?" || sql == name+" in ?" || sql == name+" in (?)") {
+			values = []any{e.Vars[0]}
+			if rv := reflect.ValueOf(e.Vars[0]); rv.Kind() == reflect.Slice {
+				values = make([]any, rv.Len())
+				for i := range values {
+					values[i] = rv.Index(i).Interface()
+				}
+			}
+		}
+	}
+	for _, v := range values {
+		id, ok := toUint64(v)
+		if !ok {
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
+
+// toUint64 将唯一号转换为 uint64
+func toUint64(v any) (uint64, bool) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(rv.Int()), rv.Int() >= 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint(), true
+	}
+	return 0, false
+}
+
+// watchIsPk 条件列是否为主键
+func watchIsPk(column any, pk *schema.Field) bool {
+	switch c := column.(type) {
+	case clause.Column:
+		return c.Name == clause.PrimaryKey || strings.EqualFold(c.Name, pk.DBName)
+	case string:
+		return strings.EqualFold(c, pk.DBName)
+	}
+	return false
+}
+
+// batchEvents 将事件按条数或等待时间分批处理，直到通道关闭，关闭时处理剩余的事件
+func batchEvents[T any](events <-chan ChangeEvent[T], size int, interval time.Duration, fn func(batch []ChangeEvent[T])) {
+	batch := make([]ChangeEvent[T], 0, size)
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	flush := func() {
+		if len(batch) > 0 {
+			fn(batch)
+			batch = make([]ChangeEvent[T], 0, size)
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				flush()
+				return
+			}
+			// 每批的第一条开始计时
+			if len(batch) == 0 {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(interval)
+			}
+			batch = append(batch, ev)
+			if len(batch) >= size {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
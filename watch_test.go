@@ -0,0 +1,54 @@
+package qdb
+
+import (
+	"context"
+	"github.com/kamioair/utils/qtime"
+	"testing"
+	"time"
+)
+
+type watchItem struct {
+	DbSimple
+	Name string
+}
+
+func TestWatchPollFindsUpdates(t *testing.T) {
+	reader, err := TryNewDao[watchItem](newTestDB(t), WithWatchPoll(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 其他进程的连接，写入不经过本连接的钩子
+	writer, err := TryNewDao[watchItem](reopenTestDB(t), WithWatchPoll(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := &watchItem{Name: "old"}
+	item.LastTime = qtime.NewDateTime(time.Now().Add(-time.Hour))
+	if err = writer.Create(item); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	events, err := reader.Watch(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := writer.GetModel(item.Id)
+	if err != nil || loaded == nil {
+		t.Fatal(loaded, err)
+	}
+	loaded.Name = "new"
+	if err = writer.Update(loaded); err != nil {
+		t.Fatal(err)
+	}
+	for ev := range events {
+		if ev.Id == item.Id {
+			if ev.Local || ev.Model == nil || ev.Model.Name != "new" {
+				t.Errorf("unexpected event %+v", ev)
+			}
+			return
+		}
+	}
+	t.Fatal("update from other connection not found by poll")
+}
@@ -0,0 +1,115 @@
+package qdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InflightOp 执行中的Dao操作
+type InflightOp struct {
+	Name    string        // 操作名称
+	Table   string        // 表名
+	TraceID string        // 链路ID，来自上下文 KeyTraceID
+	Start   time.Time     // 开始时间
+	Cost    time.Duration // 已执行时长
+}
+
+var (
+	inflight     sync.Map
+	inflightSeq  uint64
+	inflightOnce sync.Once
+)
+
+// trackInflight 记录执行中操作的中间件
+func trackInflight(next Handler) Handler {
+	return func(op *Operation) error {
+		id := atomic.AddUint64(&inflightSeq, 1)
+		traceID, _ := ValueFrom[string](op.Context(), KeyTraceID)
+		inflight.Store(id, &InflightOp{Name: op.Name, Table: op.Table, TraceID: traceID, Start: time.Now()})
+		defer inflight.Delete(id)
+		return next(op)
+	}
+}
+
+// Inflight 返回执行中的Dao操作，按已执行时长从长到短排序，需先调用 WatchPool 启用记录
+//
+//	@return []InflightOp
+func Inflight() []InflightOp {
+	list := make([]InflightOp, 0)
+	inflight.Range(func(_, v any) bool {
+		op := *v.(*InflightOp)
+		op.Cost = time.Since(op.Start)
+		list = append(list, op)
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Cost > list[j].Cost })
+	return list
+}
+
+// PoolWatchOptions 连接池监控选项
+type PoolWatchOptions struct {
+	Interval     time.Duration                    // 检查间隔，为0使用10秒
+	WaitCount    int64                            // 间隔内等待连接次数阈值，为0使用1
+	WaitDuration time.Duration                    // 间隔内等待连接总时长阈值，为0不按时长判断
+	Top          int                              // 输出执行最久的操作数量，为0使用5
+	Logf         func(format string, args ...any) // 日志方法，为空使用 log.Printf
+}
+
+// WatchPool 监控连接池，间隔内等待连接的次数或时长超过阈值时输出连接池状态和执行最久的Dao操作，用于排查连接泄漏
+//
+//	@param ctx 上下文，结束时停止
+//	@param db 数据库连接
+//	@param opts 监控选项
+//	@return error
+func WatchPool(ctx context.Context, db *gorm.DB, opts PoolWatchOptions) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.WaitCount <= 0 {
+		opts.WaitCount = 1
+	}
+	if opts.Top <= 0 {
+		opts.Top = 5
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	inflightOnce.Do(func() { Use(trackInflight) })
+
+	go func() {
+		last := sqlDB.Stats()
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			st := sqlDB.Stats()
+			waits, waited := st.WaitCount-last.WaitCount, st.WaitDuration-last.WaitDuration
+			last = st
+			if waits < opts.WaitCount && (opts.WaitDuration <= 0 || waited < opts.WaitDuration) {
+				continue
+			}
+			opts.Logf("qdb: connection pool waiting, waits=%d waited=%s open=%d inUse=%d idle=%d max=%d",
+				waits, waited, st.OpenConnections, st.InUse, st.Idle, st.MaxOpenConnections)
+			for i, op := range Inflight() {
+				if i >= opts.Top {
+					break
+				}
+				opts.Logf("qdb:   inflight %s %s cost=%s trace=%s", op.Table, op.Name, op.Cost, op.TraceID)
+			}
+		}
+	}()
+	return nil
+}